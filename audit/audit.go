@@ -0,0 +1,134 @@
+// Package audit records administrative and security-relevant actions in the
+// append-only audit_log table.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// Record appends an entry for an action made by the actor of the request.
+// The before and after states are stored as JSON and may be nil. Errors are
+// logged and do not fail the action, which has already happened.
+func Record(c *gin.Context, db *sql.DB, action, targetType, targetID string, before, after any) {
+	entry := Entry(c, action, targetType, targetID)
+	entry.Before = marshal(c, before)
+	entry.After = marshal(c, after)
+	write(c, db, entry)
+}
+
+// RecordFailure appends an entry for a refused attempt, such as a failed
+// login. The name identifies the actor when the request has none, as the
+// username of a login.
+func RecordFailure(c *gin.Context, db *sql.DB, action, name, reason string) {
+	entry := Entry(c, action, "", "")
+	if entry.ActorType == models.AuditActorAnonymous && name != "" {
+		entry.ActorName = name
+	}
+	entry.Success = false
+	entry.After = marshal(c, map[string]string{"reason": reason})
+	write(c, db, entry)
+}
+
+// RecordUser appends an action of a user on their own account, made
+// before the user is stored in the request, as a login.
+func RecordUser(c *gin.Context, db *sql.DB, user *models.User, action string, after any) {
+	entry := Entry(c, action, "user", strconv.Itoa(user.ID))
+	entry.ActorType = models.AuditActorUser
+	entry.ActorID = &user.ID
+	entry.ActorName = user.Email
+	entry.After = marshal(c, after)
+	write(c, db, entry)
+}
+
+// RecordLogout appends the logout of the user of a session, which is
+// not stored in the request since the logout route is public.
+func RecordLogout(c *gin.Context, db *sql.DB, sessionID string) {
+	entry := Entry(c, models.AuditLogout, "user", "")
+	var id int
+	err := db.QueryRow(`
+		SELECT u.id, u.email
+		FROM users u
+		INNER JOIN user_sessions s ON u.id = s.user_id
+		WHERE s.id = $1 AND s.is_active = true
+	`, sessionID).Scan(&id, &entry.ActorName)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.ErrorContext(c.Request.Context(), "Failed to find the user of a session", "error", err)
+		}
+		return
+	}
+	entry.ActorType = models.AuditActorUser
+	entry.ActorID = &id
+	entry.TargetID = strconv.Itoa(id)
+	write(c, db, entry)
+}
+
+// Entry returns a successful entry with the actor, address and request ID
+// of the request.
+func Entry(c *gin.Context, action, targetType, targetID string) models.AuditEntry {
+	entry := models.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Success:    true,
+		IPAddress:  c.ClientIP(),
+		RequestID:  c.GetString("request_id"),
+	}
+	entry.ActorType, entry.ActorID, entry.ActorName = Actor(c)
+	return entry
+}
+
+// Actor returns the type, ID and name of the actor of a request: the user
+// of the session, the API key, the machine credential, the client
+// certificate or the SCIM client of the identity provider.
+func Actor(c *gin.Context) (string, *int, string) {
+	if u, ok := c.Get("user"); ok {
+		if user, ok := u.(*models.User); ok && user != nil {
+			return models.AuditActorUser, &user.ID, user.Email
+		}
+	}
+	if k, ok := c.Get("api_key"); ok {
+		if key, ok := k.(*models.ApiKey); ok && key != nil {
+			return models.AuditActorAPIKey, &key.ID, key.Name
+		}
+	}
+	if m, ok := c.Get("machine_credential"); ok {
+		if credential, ok := m.(*models.MachineCredential); ok && credential != nil {
+			return models.AuditActorMachineCredential, &credential.ID, credential.Hostname
+		}
+	}
+	if i, ok := c.Get("client_certificate"); ok {
+		if identity, ok := i.(*models.CertificateIdentity); ok && identity != nil {
+			return models.AuditActorClientCertificate, nil, identity.Name()
+		}
+	}
+	if c.GetBool("scim_client") {
+		return models.AuditActorSCIM, nil, "SCIM"
+	}
+	return models.AuditActorAnonymous, nil, ""
+}
+
+// marshal returns the JSON document of a state, or nil.
+func marshal(c *gin.Context, state any) json.RawMessage {
+	if state == nil {
+		return nil
+	}
+	doc, err := json.Marshal(state)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to encode audit state", "error", err)
+		return nil
+	}
+	return doc
+}
+
+func write(c *gin.Context, db *sql.DB, entry models.AuditEntry) {
+	if err := models.NewAuditManager(db).Record(entry); err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to record audit entry", "action", entry.Action, "error", err)
+	}
+}
@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/models"
+)
+
+func TestActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		key      string
+		value    any
+		wantType string
+		wantID   int
+		wantName string
+	}{
+		{"anonymous", "", nil, models.AuditActorAnonymous, 0, ""},
+		{"user", "user", &models.User{ID: 4, Email: "alice@example.com"}, models.AuditActorUser, 4, "alice@example.com"},
+		{"api key", "api_key", &models.ApiKey{ID: 9, Name: "ansible"}, models.AuditActorAPIKey, 9, "ansible"},
+		{"machine credential", "machine_credential", &models.MachineCredential{ID: 2, Hostname: "web01"}, models.AuditActorMachineCredential, 2, "web01"},
+		{"client certificate", "client_certificate", &models.CertificateIdentity{Names: []string{"web02"}}, models.AuditActorClientCertificate, 0, "web02"},
+		{"scim client", "scim_client", true, models.AuditActorSCIM, 0, "SCIM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.key != "" {
+				c.Set(tt.key, tt.value)
+			}
+
+			actorType, actorID, name := Actor(c)
+			if actorType != tt.wantType || name != tt.wantName {
+				t.Errorf("Actor() = %q, %q, want %q, %q", actorType, name, tt.wantType, tt.wantName)
+			}
+			if (actorID == nil) != (tt.wantID == 0) || (actorID != nil && *actorID != tt.wantID) {
+				t.Errorf("Actor() ID = %v, want %d", actorID, tt.wantID)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package auth
 import (
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +21,10 @@ func CategorizeAuthError(err error) string {
 		return "auth_failed"
 	}
 
+	if errors.Is(err, ErrLocalAccountConflict) {
+		return "local_account"
+	}
+
 	errStr := err.Error()
 
 	// Check for configuration issues
@@ -55,8 +61,37 @@ func CategorizeAuthError(err error) string {
 
 type LDAPService struct {
 	DB *sql.DB
+	// Lockout slows down password guessing on the LDAP login form
+	Lockout models.LoginLockout
+	// NestedGroups is how members of nested groups are found: "" for direct
+	// members only, LDAPNestedGroupsAD or LDAPNestedGroupsRecursive
+	NestedGroups string
 }
 
+// Ways of resolving nested groups, set with LDAP_NESTED_GROUPS.
+const (
+	// LDAPNestedGroupsAD asks Active Directory to follow nested groups with
+	// LDAP_MATCHING_RULE_IN_CHAIN.
+	LDAPNestedGroupsAD = "ad"
+	// LDAPNestedGroupsRecursive searches the groups of the user, then the
+	// groups of those groups, for directories such as OpenLDAP.
+	LDAPNestedGroupsRecursive = "recursive"
+)
+
+// ldapMatchingRuleInChain is the OID of LDAP_MATCHING_RULE_IN_CHAIN.
+const ldapMatchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// ldapMaxGroupDepth caps how many levels of nested groups are followed by
+// the recursive lookup, which also stops at cycles.
+const ldapMaxGroupDepth = 10
+
+// Login lockout used when the LDAP_LOCKOUT_* variables are not set.
+const (
+	DefaultLDAPLockoutThreshold   = 5
+	DefaultLDAPLockoutIPThreshold = 20
+	DefaultLDAPLockoutDuration    = 15 * time.Minute
+)
+
 // NewLDAPService creates a new LDAP service instance
 // Returns nil if LDAP is not configured (optional authentication)
 //
@@ -69,8 +104,15 @@ type LDAPService struct {
 //   - LDAP_BASE_DN: Base DN for user searches (e.g., ou=users,dc=example,dc=com)
 //   - LDAP_USER_FILTER: LDAP filter for user search (default: (uid=%s))
 //   - LDAP_ADMIN_GROUP: DN of admin group (e.g., cn=admins,ou=groups,dc=example,dc=com)
+//   - LDAP_SECURITY_ANALYST_GROUP: DN of security analyst group (e.g., cn=security,ou=groups,dc=example,dc=com)
+//   - LDAP_OPERATOR_GROUP: DN of operator group (e.g., cn=operators,ou=groups,dc=example,dc=com)
 //   - LDAP_VIEWER_GROUP: DN of viewer group (e.g., cn=viewers,ou=groups,dc=example,dc=com)
 //   - LDAP_GROUP_FILTER: LDAP filter for group membership (default: (member=%s))
+//   - LDAP_NESTED_GROUPS: ad or recursive to also accept members of nested groups (optional)
+//   - LDAP_GROUP_BASE_DN: Base DN of the recursive group search (default: LDAP_BASE_DN)
+//   - LDAP_LOCKOUT_THRESHOLD: failures in a row that lock a username (default: 5, 0 disables)
+//   - LDAP_LOCKOUT_IP_THRESHOLD: failures in a row that lock a client IP (default: 20, 0 disables)
+//   - LDAP_LOCKOUT_DURATION: how long a lockout lasts (default: 15m)
 func NewLDAPService(db *sql.DB) (*LDAPService, error) {
 	host := os.Getenv("LDAP_HOST")
 
@@ -92,19 +134,84 @@ func NewLDAPService(db *sql.DB) (*LDAPService, error) {
 		return nil, fmt.Errorf("at least one of LDAP_ADMIN_GROUP or LDAP_VIEWER_GROUP must be configured")
 	}
 
+	nestedGroups := strings.ToLower(strings.TrimSpace(os.Getenv("LDAP_NESTED_GROUPS")))
+	switch nestedGroups {
+	case "", LDAPNestedGroupsRecursive:
+	case LDAPNestedGroupsAD:
+		if _, err := inChainFilter(ldapGroupFilter()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("LDAP_NESTED_GROUPS must be %q or %q, got %q", LDAPNestedGroupsAD, LDAPNestedGroupsRecursive, nestedGroups)
+	}
+
+	lockout, err := ldapLockoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	return &LDAPService{
-		DB: db,
+		DB:           db,
+		Lockout:      lockout,
+		NestedGroups: nestedGroups,
 	}, nil
 }
 
+// ldapLockoutFromEnv reads the LDAP_LOCKOUT_* variables.
+func ldapLockoutFromEnv() (models.LoginLockout, error) {
+	lockout := models.LoginLockout{
+		UsernameThreshold: DefaultLDAPLockoutThreshold,
+		IPThreshold:       DefaultLDAPLockoutIPThreshold,
+		Duration:          DefaultLDAPLockoutDuration,
+	}
+
+	for name, threshold := range map[string]*int{
+		"LDAP_LOCKOUT_THRESHOLD":    &lockout.UsernameThreshold,
+		"LDAP_LOCKOUT_IP_THRESHOLD": &lockout.IPThreshold,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return lockout, fmt.Errorf("%s must be a number of failures, 0 to disable, got %q", name, value)
+		}
+		*threshold = n
+	}
+
+	if value := os.Getenv("LDAP_LOCKOUT_DURATION"); value != "" {
+		duration, err := ParseSessionDuration(value)
+		if err != nil {
+			return lockout, fmt.Errorf("LDAP_LOCKOUT_DURATION: %w", err)
+		}
+		lockout.Duration = duration
+	}
+	return lockout, nil
+}
+
 // IsLDAPConfigured checks if LDAP is properly configured
 func IsLDAPConfigured() bool {
 	host := os.Getenv("LDAP_HOST")
 	baseDN := os.Getenv("LDAP_BASE_DN")
-	adminGroup := os.Getenv("LDAP_ADMIN_GROUP")
-	viewerGroup := os.Getenv("LDAP_VIEWER_GROUP")
 
-	return host != "" && baseDN != "" && (adminGroup != "" || viewerGroup != "")
+	hasGroup := false
+	for _, name := range ldapRoleGroups {
+		if os.Getenv(name) != "" {
+			hasGroup = true
+		}
+	}
+
+	return host != "" && baseDN != "" && hasGroup
+}
+
+// ldapRoleGroups maps each role to the environment variable holding the DN
+// of the LDAP group whose members get it.
+var ldapRoleGroups = map[string]string{
+	models.RoleViewer:          "LDAP_VIEWER_GROUP",
+	models.RoleOperator:        "LDAP_OPERATOR_GROUP",
+	models.RoleSecurityAnalyst: "LDAP_SECURITY_ANALYST_GROUP",
+	models.RoleAdmin:           "LDAP_ADMIN_GROUP",
 }
 
 // Authenticate authenticates a user against LDAP
@@ -113,7 +220,7 @@ func (s *LDAPService) Authenticate(username, password string) (*models.User, err
 		return nil, fmt.Errorf("username and password are required")
 	}
 
-	logger.Info(fmt.Sprintf("LDAP authentication attempt for user: %s", username))
+	logger.Info("LDAP authentication attempt", "username", username)
 
 	// Connect to LDAP
 	conn, err := s.connect()
@@ -129,7 +236,7 @@ func (s *LDAPService) Authenticate(username, password string) (*models.User, err
 	bindPassword := os.Getenv("LDAP_BIND_PASSWORD")
 
 	if bindDN != "" && bindPassword != "" {
-		logger.Debug(fmt.Sprintf("Binding with service account: %s", bindDN))
+		logger.Debug("Binding with service account", "bind_dn", bindDN)
 		err = conn.Bind(bindDN, bindPassword)
 		if err != nil {
 			return nil, fmt.Errorf("failed to bind with service account: %w", err)
@@ -145,13 +252,13 @@ func (s *LDAPService) Authenticate(username, password string) (*models.User, err
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
-	logger.Info(fmt.Sprintf("User found in LDAP: %s", userDN))
+	logger.Info("User found in LDAP", "user_dn", userDN)
 
 	// Authenticate user
 	logger.Debug("Attempting user bind with provided credentials")
 	err = conn.Bind(userDN, password)
 	if err != nil {
-		logger.Warn(fmt.Sprintf("User bind failed for %s: %v", userDN, err))
+		logger.Warn("User bind failed", "user_dn", userDN, "error", err)
 		return nil, fmt.Errorf("invalid credentials: %w", err)
 	}
 
@@ -166,12 +273,12 @@ func (s *LDAPService) Authenticate(username, password string) (*models.User, err
 	}
 
 	// Check group membership
-	isAdmin, isViewer, err := s.checkGroupMembership(conn, userDN)
+	role, err := s.checkGroupMembership(conn, userDN)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check group membership: %w", err)
 	}
 
-	if !isAdmin && !isViewer {
+	if role == "" {
 		return nil, fmt.Errorf("user is not a member of any authorized group")
 	}
 
@@ -190,7 +297,7 @@ func (s *LDAPService) Authenticate(username, password string) (*models.User, err
 	}
 
 	// Create or update user in database
-	user, err := s.createOrUpdateUser(username, email, name, isAdmin)
+	user, err := s.createOrUpdateUser(username, email, name, role)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create/update user: %w", err)
 	}
@@ -243,7 +350,7 @@ func (s *LDAPService) searchUser(conn *ldap.Conn, username string) (string, map[
 	filter := fmt.Sprintf(userFilter, ldap.EscapeFilter(username))
 
 	// Log search parameters for debugging
-	logger.Debug(fmt.Sprintf("LDAP user search: baseDN=%s, filter=%s", baseDN, filter))
+	logger.Debug("LDAP user search", "base_dn", baseDN, "filter", filter)
 
 	searchRequest := ldap.NewSearchRequest(
 		baseDN,
@@ -259,24 +366,24 @@ func (s *LDAPService) searchUser(conn *ldap.Conn, username string) (string, map[
 
 	result, err := conn.Search(searchRequest)
 	if err != nil {
-		logger.Error(fmt.Sprintf("LDAP search failed: %v", err))
+		logger.Error("LDAP search failed", "error", err)
 		return "", nil, err
 	}
 
 	if len(result.Entries) == 0 {
-		logger.Warn(fmt.Sprintf("LDAP user not found with filter '%s' in base '%s'", filter, baseDN))
+		logger.Warn("LDAP user not found", "filter", filter, "base_dn", baseDN)
 		return "", nil, fmt.Errorf("user not found")
 	}
 
 	if len(result.Entries) > 1 {
-		logger.Warn(fmt.Sprintf("Multiple LDAP users found with filter '%s': %d entries", filter, len(result.Entries)))
+		logger.Warn("Multiple LDAP users found", "filter", filter, "entries", len(result.Entries))
 		return "", nil, fmt.Errorf("multiple users found")
 	}
 
 	entry := result.Entries[0]
 	userDN := entry.DN
 
-	logger.Debug(fmt.Sprintf("LDAP user found: %s", userDN))
+	logger.Debug("LDAP user found", "user_dn", userDN)
 
 	attrs := make(map[string]string)
 	for _, attr := range entry.Attributes {
@@ -288,38 +395,164 @@ func (s *LDAPService) searchUser(conn *ldap.Conn, username string) (string, map[
 	return userDN, attrs, nil
 }
 
-func (s *LDAPService) checkGroupMembership(conn *ldap.Conn, userDN string) (bool, bool, error) {
-	adminGroup := os.Getenv("LDAP_ADMIN_GROUP")
-	viewerGroup := os.Getenv("LDAP_VIEWER_GROUP")
+// checkGroupMembership returns the role of the user: of the roles whose
+// group the user is a member of, the one listed last in models.Roles. It
+// returns an empty string when the user is in none of the groups.
+//
+// With LDAP_NESTED_GROUPS, members of groups nested in the role groups are
+// members too.
+func (s *LDAPService) checkGroupMembership(conn *ldap.Conn, userDN string) (string, error) {
+	groupFilter := ldapGroupFilter()
+
+	var userGroups []*ldap.DN
+	switch s.NestedGroups {
+	case LDAPNestedGroupsAD:
+		filter, err := inChainFilter(groupFilter)
+		if err != nil {
+			return "", err
+		}
+		groupFilter = filter
+	case LDAPNestedGroupsRecursive:
+		groups, err := s.searchUserGroups(conn, userDN, groupFilter)
+		if err != nil {
+			return "", fmt.Errorf("failed to search the groups of the user: %w", err)
+		}
+		userGroups = groups
+	}
+
+	var roles []string
+	for role, variable := range ldapRoleGroups {
+		group := os.Getenv(variable)
+		if group == "" {
+			continue
+		}
+
+		if s.NestedGroups == LDAPNestedGroupsRecursive {
+			if containsDN(userGroups, group) {
+				roles = append(roles, role)
+			}
+			continue
+		}
+
+		isMember, err := s.isGroupMember(conn, userDN, group, groupFilter)
+		if err != nil {
+			logger.Error("Failed to check group membership", "role", role, "group", group, "error", err)
+			continue
+		}
+		if isMember {
+			roles = append(roles, role)
+		}
+	}
+
+	return models.HighestRole(roles), nil
+}
+
+// ldapGroupFilter returns LDAP_GROUP_FILTER, or (member=%s) when it is not
+// set.
+func ldapGroupFilter() string {
 	groupFilter := os.Getenv("LDAP_GROUP_FILTER")
 	if groupFilter == "" {
 		groupFilter = "(member=%s)"
 	}
+	return groupFilter
+}
 
-	isAdmin := false
-	isViewer := false
+// inChainFilter rewrites a group filter of the form (attribute=%s) to use
+// LDAP_MATCHING_RULE_IN_CHAIN, with which Active Directory also matches the
+// members of nested groups.
+func inChainFilter(groupFilter string) (string, error) {
+	attribute, ok := strings.CutPrefix(strings.TrimSpace(groupFilter), "(")
+	if ok {
+		attribute, ok = strings.CutSuffix(attribute, "=%s)")
+	}
+	if !ok || attribute == "" || strings.ContainsAny(attribute, "()=:&|!*% ") || strings.EqualFold(attribute, "memberUid") {
+		return "", fmt.Errorf("LDAP_NESTED_GROUPS=ad needs an LDAP_GROUP_FILTER such as (member=%%s), got %q", groupFilter)
+	}
+	return "(" + attribute + ":" + ldapMatchingRuleInChain + ":=%s)", nil
+}
 
-	// Check admin group membership
-	if adminGroup != "" {
-		isMember, err := s.isGroupMember(conn, userDN, adminGroup, groupFilter)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to check admin group membership: %v", err))
-		} else {
-			isAdmin = isMember
-		}
+// searchUserGroups returns the groups under LDAP_GROUP_BASE_DN that the user
+// is a member of, directly or through nested groups: the groups matching
+// groupFilter for the user, then those matching it for each group found,
+// up to ldapMaxGroupDepth levels.
+func (s *LDAPService) searchUserGroups(conn *ldap.Conn, userDN, groupFilter string) ([]*ldap.DN, error) {
+	baseDN := os.Getenv("LDAP_GROUP_BASE_DN")
+	if baseDN == "" {
+		baseDN = os.Getenv("LDAP_BASE_DN")
+	}
+
+	// memberUid holds user names, so POSIX groups cannot be nested: only
+	// the first level is searched
+	posixGroups := strings.Contains(groupFilter, "memberUid")
+	members := []string{userDN}
+	if posixGroups {
+		members = []string{extractUIDFromDN(userDN)}
 	}
 
-	// Check viewer group membership
-	if viewerGroup != "" {
-		isMember, err := s.isGroupMember(conn, userDN, viewerGroup, groupFilter)
+	var groups []*ldap.DN
+	seen := map[string]bool{}
+	for depth := 0; depth < ldapMaxGroupDepth && len(members) > 0; depth++ {
+		filters := make([]string, len(members))
+		for i, member := range members {
+			filters[i] = fmt.Sprintf(groupFilter, ldap.EscapeFilter(member))
+		}
+		filter := filters[0]
+		if len(filters) > 1 {
+			filter = "(|" + strings.Join(filters, "") + ")"
+		}
+
+		result, err := conn.Search(ldap.NewSearchRequest(
+			baseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			filter,
+			[]string{"dn"},
+			nil,
+		))
 		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to check viewer group membership: %v", err))
-		} else {
-			isViewer = isMember
+			return nil, err
+		}
+
+		members = nil
+		for _, entry := range result.Entries {
+			dn, err := ldap.ParseDN(entry.DN)
+			if err != nil {
+				logger.Warn("Ignoring LDAP group with an invalid DN", "dn", entry.DN, "error", err)
+				continue
+			}
+			key := strings.ToLower(dn.String())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			groups = append(groups, dn)
+			members = append(members, entry.DN)
+		}
+		if posixGroups {
+			break
 		}
 	}
 
-	return isAdmin, isViewer, nil
+	logger.Debug("LDAP groups of the user", "user_dn", userDN, "groups", len(groups))
+	return groups, nil
+}
+
+// containsDN reports whether groups holds the group with the given DN,
+// compared case-insensitively as directories do.
+func containsDN(groups []*ldap.DN, groupDN string) bool {
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil {
+		return false
+	}
+	for _, group := range groups {
+		if group.EqualFold(dn) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *LDAPService) isGroupMember(conn *ldap.Conn, userDN, groupDN, groupFilter string) (bool, error) {
@@ -329,7 +562,7 @@ func (s *LDAPService) isGroupMember(conn *ldap.Conn, userDN, groupDN, groupFilte
 	if strings.Contains(groupFilter, "memberUid") {
 		// Extract uid from DN (e.g., "uid=john,ou=users,dc=example,dc=com" -> "john")
 		filterValue = extractUIDFromDN(userDN)
-		logger.Debug(fmt.Sprintf("Using memberUid filter, extracted uid: %s from DN: %s", filterValue, userDN))
+		logger.Debug("Using memberUid filter", "uid", filterValue, "user_dn", userDN)
 	}
 
 	filter := fmt.Sprintf(groupFilter, ldap.EscapeFilter(filterValue))
@@ -392,7 +625,7 @@ func (s *LDAPService) getAttributeValue(attrs map[string]string, key string) str
 	return ""
 }
 
-func (s *LDAPService) createOrUpdateUser(username, email, name string, isAdmin bool) (*models.User, error) {
+func (s *LDAPService) createOrUpdateUser(username, email, name, role string) (*models.User, error) {
 	// Use username as the unique identifier (sub field)
 	ldapSub := "ldap:" + username
 
@@ -405,19 +638,25 @@ func (s *LDAPService) createOrUpdateUser(username, email, name string, isAdmin b
 	now := time.Now()
 
 	if existingUser != nil {
+		// Local accounts, such as the break-glass admin, are never taken over
+		if !strings.HasPrefix(existingUser.Sub, "ldap:") && (existingUser.IsLocal || existingUser.HasPassword) {
+			logger.Warn("LDAP login refused for the e-mail address of a local account", "user_id", existingUser.ID)
+			return nil, ErrLocalAccountConflict
+		}
+
 		// User exists. If their sub is from OIDC, do not change it.
 		if !strings.HasPrefix(existingUser.Sub, "ldap:") {
 			// This is an OIDC user. Update details but NOT sub.
 			updateQuery := `
 				UPDATE users 
-				SET name = $1, is_admin = $2, updated_at = $3, last_login_at = $4
+				SET name = $1, role = $2, updated_at = $3, last_login_at = $4
 				WHERE email = $5
-				RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+				RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 			`
 			user := &models.User{}
-			err = s.DB.QueryRow(updateQuery, name, isAdmin, now, now, email).Scan(
+			err = s.DB.QueryRow(updateQuery, name, role, now, now, email).Scan(
 				&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-				&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+				&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 			)
 			if err != nil {
 				return nil, fmt.Errorf("failed to update OIDC user with LDAP details: %w", err)
@@ -436,15 +675,15 @@ func (s *LDAPService) createOrUpdateUser(username, email, name string, isAdmin b
 		// Update existing user
 		updateQuery := `
 			UPDATE users 
-			SET email = $2, name = $3, is_admin = $4, updated_at = $5, last_login_at = $6
+			SET email = $2, name = $3, role = $4, updated_at = $5, last_login_at = $6
 			WHERE sub = $1
-			RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+			RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 		`
 
 		user := &models.User{}
-		err = s.DB.QueryRow(updateQuery, ldapSub, email, name, isAdmin, now, now).Scan(
+		err = s.DB.QueryRow(updateQuery, ldapSub, email, name, role, now, now).Scan(
 			&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-			&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+			&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 		)
 
 		if err != nil {
@@ -456,36 +695,36 @@ func (s *LDAPService) createOrUpdateUser(username, email, name string, isAdmin b
 
 	// Create new user
 	insertQuery := `
-		INSERT INTO users (sub, email, name, picture, is_active, is_admin, created_at, updated_at, last_login_at)
+		INSERT INTO users (sub, email, name, picture, is_active, role, created_at, updated_at, last_login_at)
 		VALUES ($1, $2, $3, '', true, $4, $5, $5, $5)
-		RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+		RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 	`
 
 	user := &models.User{}
-	err = s.DB.QueryRow(insertQuery, ldapSub, email, name, isAdmin, now).Scan(
+	err = s.DB.QueryRow(insertQuery, ldapSub, email, name, role, now).Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	logger.Info(fmt.Sprintf("LDAP user created: %s (%s) - Admin: %v", user.Name, user.Email, isAdmin))
+	logger.Info("LDAP user created", "user_id", user.ID, "email", user.Email, "role", role)
 
 	return user, nil
 }
 
 func (s *LDAPService) getUserBySub(sub string) (*models.User, error) {
 	query := `
-		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 		FROM users WHERE sub = $1
 	`
 
 	user := &models.User{}
 	err := s.DB.QueryRow(query, sub).Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -497,14 +736,16 @@ func (s *LDAPService) getUserBySub(sub string) (*models.User, error) {
 
 func (s *LDAPService) getUserByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at,
+		       sub LIKE 'local:%', password_hash IS NOT NULL
 		FROM users WHERE email = $1
 	`
 
 	user := &models.User{}
 	err := s.DB.QueryRow(query, email).Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsLocal, &user.HasPassword,
 	)
 
 	if err == sql.ErrNoRows {
@@ -514,26 +755,10 @@ func (s *LDAPService) getUserByEmail(email string) (*models.User, error) {
 	return user, err
 }
 
-// CreateUserSession creates a new user session (reuses OIDC session logic)
-func (s *LDAPService) CreateUserSession(userID int) (string, error) {
-	sessionID, err := generateSessionID()
-	if err != nil {
-		return "", fmt.Errorf("failed to generate session ID: %w", err)
-	}
-
-	expiresAt := time.Now().Add(24 * time.Hour * 7) // 7 days
-
-	query := `
-		INSERT INTO user_sessions (id, user_id, created_at, expires_at, is_active)
-		VALUES ($1, $2, $3, $4, true)
-	`
-
-	_, err = s.DB.Exec(query, sessionID, userID, time.Now(), expiresAt)
-	if err != nil {
-		return "", fmt.Errorf("failed to create user session: %w", err)
-	}
-
-	return sessionID, nil
+// CreateUserSession creates a new user session for a login from a
+// browser with the given User-Agent and IP address
+func (s *LDAPService) CreateUserSession(userID int, userAgent, ipAddress string) (string, error) {
+	return createSession(s.DB, userID, userAgent, ipAddress)
 }
 
 // InvalidateUserSession invalidates a user session
@@ -542,3 +767,27 @@ func (s *LDAPService) InvalidateUserSession(sessionID string) error {
 	_, err := s.DB.Exec(query, sessionID)
 	return err
 }
+
+// loginFailureKey returns the key that failed logins are counted under for
+// an LDAP username. Directories compare user names case-insensitively.
+func loginFailureKey(username string) string {
+	return "ldap:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// LockedFor returns how long LDAP logins for username from ip are still
+// refused after failed attempts, or zero when they are allowed.
+func (s *LDAPService) LockedFor(username, ip string) (time.Duration, error) {
+	return models.NewLoginFailureManager(s.DB).LockedFor(loginFailureKey(username), ip)
+}
+
+// RecordLoginFailure counts a wrong password for username from ip, and
+// reports whether the username or the address got locked out by it.
+func (s *LDAPService) RecordLoginFailure(username, ip string) (bool, error) {
+	return models.NewLoginFailureManager(s.DB).RecordFailure(loginFailureKey(username), ip, s.Lockout)
+}
+
+// ResetLoginFailures forgets the failed logins of username after it logged
+// in.
+func (s *LDAPService) ResetLoginFailures(username string) error {
+	return models.NewLoginFailureManager(s.DB).Reset(loginFailureKey(username))
+}
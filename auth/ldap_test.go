@@ -1,9 +1,40 @@
 package auth
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+
+	"github.com/go-ldap/ldap/v3"
 )
 
+func TestCategorizeAuthError_LocalAccount(t *testing.T) {
+	err := fmt.Errorf("failed to create/update user: %w", ErrLocalAccountConflict)
+	if got := CategorizeAuthError(err); got != "local_account" {
+		t.Errorf("CategorizeAuthError() = %q, want local_account", got)
+	}
+}
+
+func TestCreateOrUpdateUser_LocalAdmin(t *testing.T) {
+	db := setupAuthTestDB(t)
+	defer db.Close()
+	cleanupAuthTestData(t, db)
+	defer cleanupAuthTestData(t, db)
+
+	const email = "auth-test-admin@example.com"
+	bootstrapTestAdmin(t, db, email)
+
+	s := &LDAPService{DB: db}
+	_, err := s.createOrUpdateUser("mallory", email, "Mallory", "viewer")
+	if !errors.Is(err, ErrLocalAccountConflict) {
+		t.Errorf("createOrUpdateUser() error = %v, want ErrLocalAccountConflict", err)
+	}
+	if got := CategorizeAuthError(err); got != "local_account" {
+		t.Errorf("CategorizeAuthError() = %q, want local_account", got)
+	}
+	assertLocalAdmin(t, db, email)
+}
+
 func TestExtractUIDFromDN(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -61,3 +92,56 @@ func TestExtractUIDFromDN(t *testing.T) {
 		})
 	}
 }
+
+func TestInChainFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		want    string
+		wantErr bool
+	}{
+		{"(member=%s)", "(member:1.2.840.113556.1.4.1941:=%s)", false},
+		{" (uniqueMember=%s) ", "(uniqueMember:1.2.840.113556.1.4.1941:=%s)", false},
+		{"(memberUid=%s)", "", true},
+		{"(&(objectClass=group)(member=%s))", "", true},
+		{"member=%s", "", true},
+		{"(=%s)", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := inChainFilter(tt.filter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("inChainFilter(%q) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("inChainFilter(%q) = %q; want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestContainsDN(t *testing.T) {
+	var groups []*ldap.DN
+	for _, dn := range []string{"cn=admins,ou=groups,dc=example,dc=com", "cn=ops,ou=groups,dc=example,dc=com"} {
+		group, err := ldap.ParseDN(dn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups = append(groups, group)
+	}
+
+	tests := []struct {
+		dn   string
+		want bool
+	}{
+		{"cn=admins,ou=groups,dc=example,dc=com", true},
+		{"CN=Admins, OU=Groups, DC=example, DC=com", true},
+		{"cn=viewers,ou=groups,dc=example,dc=com", false},
+		{"not a dn", false},
+	}
+
+	for _, tt := range tests {
+		if got := containsDN(groups, tt.dn); got != tt.want {
+			t.Errorf("containsDN(%q) = %v; want %v", tt.dn, got, tt.want)
+		}
+	}
+}
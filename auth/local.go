@@ -0,0 +1,546 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Local account settings
+const (
+	MinPasswordLength  = 12
+	maxPasswordBytes   = 72 // bcrypt ignores the bytes after the 72nd
+	passwordHashCost   = 12
+	totpLoginTTL       = 5 * time.Minute
+	passwordResetTTL   = 24 * time.Hour
+	localSubjectPrefix = "local:"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown e-mail address or a
+	// wrong password, without telling which.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidTOTP is returned for a wrong, reused or expired TOTP code.
+	ErrInvalidTOTP = errors.New("invalid TOTP code")
+	// ErrInvalidResetToken is returned for an unknown, used or expired
+	// password reset link.
+	ErrInvalidResetToken = errors.New("invalid or expired password reset link")
+	// ErrLocalAccountConflict is returned by OIDC and LDAP logins whose
+	// e-mail address belongs to a local account, which they must not take
+	// over.
+	ErrLocalAccountConflict = errors.New("e-mail address belongs to a local account")
+)
+
+type LocalService struct {
+	DB *sql.DB
+}
+
+// NewLocalService creates a new local account service instance
+// Returns nil if local accounts are not enabled (optional authentication)
+//
+// Environment Variables:
+//   - LOCAL_AUTH_ENABLED: true to enable local accounts (default: false)
+//   - LOCAL_ADMIN_EMAIL: e-mail of the admin created at startup when it does not exist (optional)
+//   - LOCAL_ADMIN_PASSWORD: password of that admin (optional)
+func NewLocalService(db *sql.DB) (*LocalService, error) {
+	if !IsLocalConfigured() {
+		return nil, nil
+	}
+
+	s := &LocalService{DB: db}
+
+	email := os.Getenv("LOCAL_ADMIN_EMAIL")
+	password := os.Getenv("LOCAL_ADMIN_PASSWORD")
+	if email != "" {
+		created, err := s.BootstrapAdmin(email, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the local admin: %w", err)
+		}
+		if created {
+			logger.Info("Local admin created", "email", email)
+		}
+	}
+
+	return s, nil
+}
+
+// IsLocalConfigured checks if local accounts are enabled
+func IsLocalConfigured() bool {
+	return os.Getenv("LOCAL_AUTH_ENABLED") == "true"
+}
+
+// IsEnabled reports whether any authentication method is configured. Without
+// one, the web interface and the API are open to everyone.
+func IsEnabled() bool {
+	return IsConfigured() || IsLDAPConfigured() || IsLocalConfigured()
+}
+
+// ValidatePassword checks a new password against the password policy.
+func ValidatePassword(password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	return nil
+}
+
+// HashPassword returns the bcrypt hash of a password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyHash spends the time of a password check, so that unknown
+// e-mail addresses cannot be told apart by the response time.
+func compareDummyHash(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("txlog-dummy-password"), passwordHashCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// BootstrapAdmin creates a local admin with a password unless a user with
+// that e-mail already exists. It reports whether the user was created.
+func (s *LocalService) BootstrapAdmin(email, password string) (bool, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false, errors.New("an e-mail address is required")
+	}
+
+	var exists bool
+	if err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`, email).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check existing user: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	if err := ValidatePassword(password); err != nil {
+		return false, err
+	}
+
+	user, err := s.CreateUser(email, nameFromEmail(email), models.RoleAdmin)
+	if err != nil {
+		return false, err
+	}
+	if err := s.SetPassword(user.ID, password); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateUser creates a local user without a password; the user sets it
+// with a password reset link.
+func (s *LocalService) CreateUser(email, name, role string) (*models.User, error) {
+	email = strings.TrimSpace(email)
+	name = strings.TrimSpace(name)
+	if !strings.Contains(email, "@") {
+		return nil, errors.New("invalid e-mail address")
+	}
+	if name == "" {
+		name = nameFromEmail(email)
+	}
+
+	query := `
+		INSERT INTO users (sub, email, name, is_active, role, created_at, updated_at, last_login_at)
+		VALUES ($1, $2, $3, true, $4, NOW(), NOW(), NOW())
+		RETURNING id, sub, email, name, is_active, role, created_at, updated_at
+	`
+
+	user := &models.User{IsLocal: true}
+	err := s.DB.QueryRow(query, localSubjectPrefix+strings.ToLower(email), email, name, role).Scan(
+		&user.ID, &user.Sub, &user.Email, &user.Name, &user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, errors.New("a user with this e-mail already exists")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local user: %w", err)
+	}
+	return user, nil
+}
+
+// nameFromEmail returns the local part of an e-mail address, used as the
+// name of users created without one.
+func nameFromEmail(email string) string {
+	name, _, _ := strings.Cut(email, "@")
+	return name
+}
+
+// Authenticate checks the e-mail and password of a local user. When the
+// user has two-factor authentication enabled, totpRequired is true and the
+// login must be completed with CompleteTOTPLogin.
+func (s *LocalService) Authenticate(email, password string) (user *models.User, totpRequired bool, err error) {
+	query := `
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role,
+		       created_at, updated_at, password_hash, totp_enabled
+		FROM users
+		WHERE LOWER(email) = LOWER($1) AND password_hash IS NOT NULL
+	`
+
+	user = &models.User{HasPassword: true}
+	var hash string
+	err = s.DB.QueryRow(query, strings.TrimSpace(email)).Scan(
+		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture, &user.IsActive, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt, &hash, &user.TOTPEnabled,
+	)
+	if err == sql.ErrNoRows {
+		compareDummyHash(password)
+		return nil, false, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find local user: %w", err)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, false, ErrInvalidCredentials
+	}
+
+	if user.TOTPEnabled {
+		return user, true, nil
+	}
+	return user, false, s.recordLogin(user.ID)
+}
+
+// VerifyPassword checks the current password of a user.
+func (s *LocalService) VerifyPassword(userID int, password string) error {
+	var hash sql.NullString
+	if err := s.DB.QueryRow(`SELECT password_hash FROM users WHERE id = $1`, userID).Scan(&hash); err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	if !hash.Valid || bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// SetPassword sets the password of a user and ends all their sessions.
+func (s *LocalService) SetPassword(userID int, password string) error {
+	return s.setPassword(s.DB, userID, password, "")
+}
+
+// ChangePassword replaces the password of a signed-in user after checking
+// the current one. Sessions other than keepSessionID are ended.
+func (s *LocalService) ChangePassword(userID int, current, password, keepSessionID string) error {
+	if err := s.VerifyPassword(userID, current); err != nil {
+		return err
+	}
+	return s.setPassword(s.DB, userID, password, keepSessionID)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (s *LocalService) setPassword(db execer, userID int, password, keepSessionID string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`UPDATE users SET password_hash = $1, password_changed_at = NOW(), updated_at = NOW() WHERE id = $2`, hash, userID); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2`, userID, keepSessionID); err != nil {
+		return fmt.Errorf("failed to end sessions: %w", err)
+	}
+	return nil
+}
+
+// SetPasswordByEmail sets the password of the user with an e-mail address,
+// for the reset-password command. It also works for users of OIDC or LDAP,
+// so that an admin can be recovered while the identity provider is down.
+// With disableTOTP, two-factor authentication is turned off as well.
+func (s *LocalService) SetPasswordByEmail(email, password string, disableTOTP bool) error {
+	var userID int
+	err := s.DB.QueryRow(`SELECT id FROM users WHERE LOWER(email) = LOWER($1)`, strings.TrimSpace(email)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user with e-mail %s", email)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err := s.SetPassword(userID, password); err != nil {
+		return err
+	}
+	if disableTOTP {
+		return s.DisableTOTP(userID)
+	}
+	return nil
+}
+
+func (s *LocalService) recordLogin(userID int) error {
+	_, err := s.DB.Exec(`UPDATE users SET last_login_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record login: %w", err)
+	}
+	return nil
+}
+
+// CreateUserSession creates a new user session for a login from a
+// browser with the given User-Agent and IP address
+func (s *LocalService) CreateUserSession(userID int, userAgent, ipAddress string) (string, error) {
+	return createSession(s.DB, userID, userAgent, ipAddress)
+}
+
+// InvalidateUserSession invalidates a user session
+func (s *LocalService) InvalidateUserSession(sessionID string) error {
+	query := `UPDATE user_sessions SET is_active = false WHERE id = $1`
+	_, err := s.DB.Exec(query, sessionID)
+	return err
+}
+
+// BeginTOTPLogin records a login whose password was checked and that waits
+// for its TOTP code. The returned ID is not a session: it only lets
+// CompleteTOTPLogin be called once, within a few minutes.
+func (s *LocalService) BeginTOTPLogin(userID int) (string, error) {
+	pendingID, err := generateSessionID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_sessions (id, user_id, created_at, expires_at, absolute_expires_at, is_active, totp_pending)
+		VALUES ($1, $2, NOW(), $3, $3, false, true)
+	`
+	if _, err := s.DB.Exec(query, pendingID, userID, time.Now().Add(totpLoginTTL)); err != nil {
+		return "", fmt.Errorf("failed to record pending login: %w", err)
+	}
+	return pendingID, nil
+}
+
+// CompleteTOTPLogin checks the TOTP code of a pending login and returns its
+// user. The pending login is consumed whatever the outcome, so a wrong code
+// means entering the password again.
+func (s *LocalService) CompleteTOTPLogin(pendingID, code string) (*models.User, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		DELETE FROM user_sessions
+		WHERE id = $1 AND totp_pending AND NOT is_active AND expires_at > NOW()
+		RETURNING user_id
+	`, pendingID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidTOTP
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending login: %w", err)
+	}
+
+	user := &models.User{HasPassword: true}
+	var secret string
+	var lastStep int64
+	err = tx.QueryRow(`
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role,
+		       created_at, updated_at, totp_enabled, COALESCE(totp_secret, ''), totp_last_step
+		FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(
+		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture, &user.IsActive, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt, &user.TOTPEnabled, &secret, &lastStep,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	step, ok := ValidateTOTP(secret, code, time.Now(), lastStep)
+	if !user.TOTPEnabled || !ok {
+		// The pending login stays consumed
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit: %w", err)
+		}
+		return nil, ErrInvalidTOTP
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET totp_last_step = $1, last_login_at = NOW() WHERE id = $2`, step, userID); err != nil {
+		return nil, fmt.Errorf("failed to record TOTP code: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return user, nil
+}
+
+// BeginTOTPSetup stores a new TOTP secret for a user who has not enabled
+// two-factor authentication yet, and returns it. It only takes effect once
+// confirmed with EnableTOTP.
+func (s *LocalService) BeginTOTPSetup(userID int) (string, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := s.DB.Exec(`UPDATE users SET totp_secret = $1 WHERE id = $2 AND NOT totp_enabled AND password_hash IS NOT NULL`, secret, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return "", errors.New("two-factor authentication is already enabled or the account has no password")
+	}
+	return secret, nil
+}
+
+// PendingTOTPSecret returns the secret stored by BeginTOTPSetup that is
+// not confirmed yet, or an empty string.
+func (s *LocalService) PendingTOTPSecret(userID int) (string, error) {
+	var secret string
+	err := s.DB.QueryRow(`SELECT COALESCE(totp_secret, '') FROM users WHERE id = $1 AND NOT totp_enabled`, userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read TOTP secret: %w", err)
+	}
+	return secret, nil
+}
+
+// EnableTOTP turns on two-factor authentication once the user proves, with
+// a code, that their authenticator app has the pending secret.
+func (s *LocalService) EnableTOTP(userID int, code string) error {
+	secret, err := s.PendingTOTPSecret(userID)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return errors.New("start the two-factor setup first")
+	}
+
+	step, ok := ValidateTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return ErrInvalidTOTP
+	}
+
+	_, err = s.DB.Exec(`UPDATE users SET totp_enabled = true, totp_last_step = $1, updated_at = NOW() WHERE id = $2 AND totp_secret = $3`, step, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication and forgets the secret.
+func (s *LocalService) DisableTOTP(userID int) error {
+	_, err := s.DB.Exec(`UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = 0, updated_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// CreatePasswordReset issues a one-time link token that lets a local user
+// set a new password, replacing the unused ones issued before. Only users
+// created locally or with a password can get one, so that accounts of the
+// identity provider do not gain a password.
+func (s *LocalService) CreatePasswordReset(userID int, createdBy *int) (string, time.Time, error) {
+	var eligible bool
+	err := s.DB.QueryRow(`SELECT sub LIKE 'local:%' OR password_hash IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&eligible)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, errors.New("user not found")
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to find user: %w", err)
+	}
+	if !eligible {
+		return "", time.Time{}, errors.New("this user logs in with OIDC or LDAP")
+	}
+
+	token, hash, _, err := util.GenerateToken(util.PasswordResetPrefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(passwordResetTTL)
+
+	if _, err := s.DB.Exec(`DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to replace password resets: %w", err)
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO password_resets (token_hash, user_id, created_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, hash, userID, createdBy, expiresAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create password reset: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// PasswordResetUser returns the user a valid reset token was issued for.
+func (s *LocalService) PasswordResetUser(token string) (*models.User, error) {
+	user := &models.User{}
+	err := s.DB.QueryRow(`
+		SELECT u.id, u.email, u.name
+		FROM password_resets r
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.token_hash = $1 AND r.used_at IS NULL AND r.expires_at > NOW()
+	`, util.HashAPIKey(token)).Scan(&user.ID, &user.Email, &user.Name)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find password reset: %w", err)
+	}
+	return user, nil
+}
+
+// ResetPassword sets a new password with a reset token, which is then used
+// up, and ends all sessions of the user.
+func (s *LocalService) ResetPassword(token, password string) (*models.User, error) {
+	if err := ValidatePassword(password); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		UPDATE password_resets SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, util.HashAPIKey(token)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use password reset: %w", err)
+	}
+
+	if err := s.setPassword(tx, userID, password, ""); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return &models.User{ID: userID}, nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+func setupAuthTestDB(t *testing.T) *sql.DB {
+	connStr := "host=localhost port=5432 user=postgres password=postgres dbname=txlog_test sslmode=disable"
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Skip("Skipping test: PostgreSQL not available")
+	}
+
+	if err := db.Ping(); err != nil {
+		t.Skip("Skipping test: Cannot connect to PostgreSQL")
+	}
+
+	return db
+}
+
+func cleanupAuthTestData(t *testing.T, db *sql.DB) {
+	_, err := db.Exec("DELETE FROM users WHERE email LIKE 'auth-test-%'")
+	if err != nil {
+		t.Logf("Warning: Failed to cleanup users: %v", err)
+	}
+}
+
+// bootstrapTestAdmin creates the break-glass admin of LOCAL_ADMIN_EMAIL.
+func bootstrapTestAdmin(t *testing.T, db *sql.DB, email string) {
+	t.Helper()
+	created, err := (&LocalService{DB: db}).BootstrapAdmin(email, "correct horse battery")
+	if err != nil || !created {
+		t.Fatalf("BootstrapAdmin() = %v, %v; want true, nil", created, err)
+	}
+}
+
+// assertLocalAdmin fails unless the local admin with email is unchanged.
+func assertLocalAdmin(t *testing.T, db *sql.DB, email string) {
+	t.Helper()
+	var sub, role string
+	if err := db.QueryRow(`SELECT sub, role FROM users WHERE email = $1`, email).Scan(&sub, &role); err != nil {
+		t.Fatalf("Failed to get local admin: %v", err)
+	}
+	if !strings.HasPrefix(sub, localSubjectPrefix) || role != "admin" {
+		t.Errorf("local admin = %q, %q; want a local subject and the admin role", sub, role)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "Too short", password: "short-pass1", wantErr: true},
+		{name: "Minimum length", password: "twelve-chars"},
+		{name: "Characters, not bytes", password: strings.Repeat("é", MinPasswordLength)},
+		{name: "Too long for bcrypt", password: strings.Repeat("a", 73), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePassword(tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2a$12$") {
+		t.Errorf("HashPassword() = %q, want a bcrypt hash of cost 12", hash)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -22,6 +25,21 @@ type OIDCService struct {
 	Verifier     *oidc.IDTokenVerifier
 	DB           *sql.DB
 	HTTPClient   *http.Client
+
+	// IssuerURL is the issuer of the provider, which names it in the audit
+	// log
+	IssuerURL string
+	// EndSessionEndpoint is the end_session_endpoint of the provider, where
+	// logouts are sent when ProviderLogout is set
+	EndSessionEndpoint    string
+	ProviderLogout        bool
+	PostLogoutRedirectURL string
+	// RevalidateInterval is how often the refresh token of each session is
+	// used to check that the provider still accepts the user. Zero disables
+	// the check.
+	RevalidateInterval time.Duration
+
+	logoutVerifier *oidc.IDTokenVerifier
 }
 
 // NewOIDCService creates a new OIDC service instance
@@ -32,6 +50,17 @@ type OIDCService struct {
 //   - OIDC_CLIENT_SECRET: OAuth2 client secret
 //   - OIDC_ISSUER_URL: OIDC provider issuer URL (default: http://localhost:8090)
 //   - OIDC_REDIRECT_URL: OAuth2 redirect URL (default: http://localhost:8080/auth/callback)
+//   - OIDC_ROLE_CLAIM: ID token claim naming the user's role (optional)
+//   - OIDC_GROUPS_CLAIM: ID token claim listing the user's groups (default: groups)
+//   - OIDC_ADMIN_GROUP: groups whose members are admins, separated by commas (optional)
+//   - OIDC_SECURITY_ANALYST_GROUP: groups whose members are security analysts (optional)
+//   - OIDC_OPERATOR_GROUP: groups whose members are operators (optional)
+//   - OIDC_VIEWER_GROUP: groups whose members are viewers (optional)
+//   - OIDC_PROVIDER_LOGOUT: true to also log out of the provider (optional)
+//   - OIDC_POST_LOGOUT_REDIRECT_URL: where the provider sends users after
+//     logout (default: /login of OIDC_REDIRECT_URL)
+//   - OIDC_REVALIDATE_INTERVAL: how often sessions are checked with their
+//     refresh token, such as 15m (optional)
 func NewOIDCService(db *sql.DB) (*OIDCService, error) {
 	clientID := os.Getenv("OIDC_CLIENT_ID")
 	clientSecret := os.Getenv("OIDC_CLIENT_SECRET")
@@ -73,15 +102,76 @@ func NewOIDCService(db *sql.DB) (*OIDCService, error) {
 
 	verifier := provider.Verifier(&oidc.Config{ClientID: clientID})
 
+	// Logout tokens have no nonce and, from older providers, no exp claim:
+	// their age is checked from iat instead
+	logoutVerifier := provider.Verifier(&oidc.Config{ClientID: clientID, SkipExpiryCheck: true})
+
+	var discovery struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := provider.Claims(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to read OIDC discovery document: %w", err)
+	}
+
+	providerLogout := os.Getenv("OIDC_PROVIDER_LOGOUT") == "true"
+	if providerLogout && discovery.EndSessionEndpoint == "" {
+		logger.Warn("OIDC_PROVIDER_LOGOUT is set but the provider has no end_session_endpoint; logouts stay local")
+		providerLogout = false
+	}
+
+	postLogoutRedirectURL := os.Getenv("OIDC_POST_LOGOUT_REDIRECT_URL")
+	if postLogoutRedirectURL == "" {
+		postLogoutRedirectURL = defaultPostLogoutRedirectURL(redirectURL)
+	}
+
+	var revalidateInterval time.Duration
+	if value := os.Getenv("OIDC_REVALIDATE_INTERVAL"); value != "" {
+		revalidateInterval, err = ParseSessionDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC_REVALIDATE_INTERVAL: %w", err)
+		}
+	}
+
 	return &OIDCService{
-		Provider:     provider,
-		OAuth2Config: oauth2Config,
-		Verifier:     verifier,
-		DB:           db,
-		HTTPClient:   httpClient,
+		Provider:              provider,
+		OAuth2Config:          oauth2Config,
+		Verifier:              verifier,
+		DB:                    db,
+		HTTPClient:            httpClient,
+		IssuerURL:             issuerURL,
+		EndSessionEndpoint:    discovery.EndSessionEndpoint,
+		ProviderLogout:        providerLogout,
+		PostLogoutRedirectURL: postLogoutRedirectURL,
+		RevalidateInterval:    revalidateInterval,
+		logoutVerifier:        logoutVerifier,
 	}, nil
 }
 
+// ErrOIDCUnauthorized is returned by CreateOrUpdateUser when group mapping
+// is configured and the ID token maps to no role.
+var ErrOIDCUnauthorized = errors.New("user is not a member of any authorized group")
+
+// oidcRoleGroups maps each role to the environment variable holding the IdP
+// groups whose members get it.
+var oidcRoleGroups = map[string]string{
+	models.RoleViewer:          "OIDC_VIEWER_GROUP",
+	models.RoleOperator:        "OIDC_OPERATOR_GROUP",
+	models.RoleSecurityAnalyst: "OIDC_SECURITY_ANALYST_GROUP",
+	models.RoleAdmin:           "OIDC_ADMIN_GROUP",
+}
+
+// IsOIDCGroupMappingConfigured reports whether any OIDC_*_GROUP variable is
+// set. Roles are then taken from the ID token at every login, and users it
+// maps to no role cannot log in.
+func IsOIDCGroupMappingConfigured() bool {
+	for _, name := range oidcRoleGroups {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // IsConfigured checks if OIDC is properly configured
 func IsConfigured() bool {
 	clientID := os.Getenv("OIDC_CLIENT_ID")
@@ -121,6 +211,11 @@ func (s *OIDCService) CreateOrUpdateUser(ctx context.Context, idToken *oidc.IDTo
 		return nil, fmt.Errorf("failed to parse ID token claims: %w", err)
 	}
 
+	claimedRole, roleErr := roleFromIDToken(idToken)
+	if roleErr != nil && !errors.Is(roleErr, ErrOIDCUnauthorized) {
+		return nil, roleErr
+	}
+
 	// Validate required fields
 	if claims.Sub == "" {
 		return nil, fmt.Errorf("OIDC subject (sub) claim is empty")
@@ -131,60 +226,80 @@ func (s *OIDCService) CreateOrUpdateUser(ctx context.Context, idToken *oidc.IDTo
 	if claims.Name == "" {
 		return nil, fmt.Errorf("OIDC name claim is empty")
 	}
+	if roleErr != nil {
+		logger.Warn("OIDC user maps to no role", "email", claims.Email)
+		return nil, roleErr
+	}
 
+	return s.saveUser(claims.Sub, claims.Email, claims.Name, claims.Picture, claimedRole)
+}
+
+// saveUser links, updates or creates the user of an OIDC login, with the
+// role claimed by its ID token, if any. Local accounts with the same e-mail
+// address are not linked and return ErrLocalAccountConflict.
+func (s *OIDCService) saveUser(sub, email, name, picture, claimedRole string) (*models.User, error) {
 	// Check if user already exists by email
-	existingUser, err := s.getUserByEmail(claims.Email)
+	existingUser, err := s.getUserByEmail(email)
 	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to check existing user for email '%s': %w", claims.Email, err)
+		return nil, fmt.Errorf("failed to check existing user for email '%s': %w", email, err)
+	}
+	if existingUser != nil && existingUser.Sub != sub && (existingUser.IsLocal || existingUser.HasPassword) {
+		logger.Warn("OIDC login refused for the e-mail address of a local account", "user_id", existingUser.ID)
+		return nil, ErrLocalAccountConflict
 	}
 
 	now := time.Now()
 
 	if existingUser != nil {
-		// Update existing user with OIDC info
+		// Update existing user with OIDC info. Accounts of LDAP keep their
+		// subject and role, which the directory owns: only the OIDC subjects
+		// get their role from the ID token.
 		updateQuery := `
 			UPDATE users 
-			SET sub = $1, name = $2, picture = $3, updated_at = $4, last_login_at = $5
+			SET sub = CASE WHEN sub LIKE 'ldap:%' OR sub LIKE 'local:%' THEN sub ELSE $1 END,
+			    name = $2, picture = $3, updated_at = $4, last_login_at = $5,
+			    role = CASE WHEN sub LIKE 'ldap:%' OR sub LIKE 'local:%' THEN role ELSE COALESCE(NULLIF($7, ''), role) END
 			WHERE email = $6
-			RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+			RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 		`
 
 		user := &models.User{}
-		err = s.DB.QueryRow(updateQuery, claims.Sub, claims.Name, claims.Picture, now, now, claims.Email).Scan(
+		err = s.DB.QueryRow(updateQuery, sub, name, picture, now, now, email, claimedRole).Scan(
 			&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-			&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+			&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 		)
 
 		if err != nil {
-			return nil, fmt.Errorf("failed to update existing user (email: %s): %w", claims.Email, err)
+			return nil, fmt.Errorf("failed to update existing user (email: %s): %w", email, err)
 		}
 
 		return user, nil
 	}
 
 	// Check if user already exists by sub
-	existingUser, err = s.getUserBySub(claims.Sub)
+	existingUser, err = s.getUserBySub(sub)
 	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to check existing user for sub '%s': %w", claims.Sub, err)
+		return nil, fmt.Errorf("failed to check existing user for sub '%s': %w", sub, err)
 	}
 
 	if existingUser != nil {
 		// Update existing user
 		updateQuery := `
 			UPDATE users 
-			SET email = $2, name = $3, picture = $4, updated_at = $5, last_login_at = $6
+			SET email = $2, name = $3, picture = $4, updated_at = $5, last_login_at = $6,
+			    role = COALESCE(NULLIF($7, ''), role)
 			WHERE sub = $1
-			RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+			RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 		`
 
 		user := &models.User{}
-		err = s.DB.QueryRow(updateQuery, claims.Sub, claims.Email, claims.Name, claims.Picture, now, now).Scan(
+		err = s.DB.QueryRow(updateQuery, sub, email, name, picture, now, now, claimedRole).Scan(
 			&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-			&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+			&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 		)
 
 		if err != nil {
-			return nil, fmt.Errorf("failed to update existing user (sub: %s, email: %s): %w", claims.Sub, claims.Email, err)
+			return nil, fmt.Errorf("failed to update existing user (sub: %s, email: %s): %w", sub, email, err)
 		}
 
 		return user, nil
@@ -199,53 +314,132 @@ func (s *OIDCService) CreateOrUpdateUser(ctx context.Context, idToken *oidc.IDTo
 		return nil, fmt.Errorf("failed to count existing users: %w", err)
 	}
 
-	// First user should be admin, others are regular users
-	isAdmin := userCount == 0
+	// Without a role claim, the first user is admin and the others are
+	// viewers
+	role := claimedRole
+	if role == "" {
+		role = models.RoleViewer
+		if userCount == 0 {
+			role = models.RoleAdmin
+		}
+	}
 
 	insertQuery := `
-		INSERT INTO users (sub, email, name, picture, is_active, is_admin, created_at, updated_at, last_login_at)
+		INSERT INTO users (sub, email, name, picture, is_active, role, created_at, updated_at, last_login_at)
 		VALUES ($1, $2, $3, $4, true, $5, $6, $6, $6)
-		RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+		RETURNING id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 	`
 
 	user := &models.User{}
-	err = s.DB.QueryRow(insertQuery, claims.Sub, claims.Email, claims.Name, claims.Picture, isAdmin, now).Scan(
+	err = s.DB.QueryRow(insertQuery, sub, email, name, picture, role, now).Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new user (sub: %s, email: %s): %w", claims.Sub, claims.Email, err)
+		return nil, fmt.Errorf("failed to create new user (sub: %s, email: %s): %w", sub, email, err)
 	}
 
 	// Log if this is the first admin user
-	if isAdmin {
-		logger.Info(fmt.Sprintf("First user created as administrator: %s (%s)", user.Name, user.Email))
+	if userCount == 0 && role == models.RoleAdmin {
+		logger.Info("First user created as administrator", "user_id", user.ID, "email", user.Email)
 	}
 
 	return user, nil
 }
 
-// CreateUserSession creates a new user session
-func (s *OIDCService) CreateUserSession(userID int) (string, error) {
-	sessionID, err := generateSessionID()
-	if err != nil {
-		return "", fmt.Errorf("failed to generate session ID: %w", err)
+// roleFromIDToken returns the role that an ID token gives its user, from
+// OIDC_ROLE_CLAIM and the OIDC_*_GROUP mapping, or an empty string when it
+// names none. With group mapping configured, a token that maps to no role
+// returns ErrOIDCUnauthorized.
+func roleFromIDToken(idToken *oidc.IDToken) (string, error) {
+	var allClaims map[string]interface{}
+	if err := idToken.Claims(&allClaims); err != nil {
+		return "", fmt.Errorf("failed to parse ID token claims: %w", err)
 	}
 
-	expiresAt := time.Now().Add(24 * time.Hour * 7) // 7 days
+	role := roleFromClaims(allClaims, os.Getenv("OIDC_ROLE_CLAIM"))
+	if !IsOIDCGroupMappingConfigured() {
+		return role, nil
+	}
 
-	query := `
-		INSERT INTO user_sessions (id, user_id, created_at, expires_at, is_active)
-		VALUES ($1, $2, $3, $4, true)
-	`
+	groupsClaim := os.Getenv("OIDC_GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	role = models.HighestRole([]string{role, RoleFromGroups(claimStrings(allClaims, groupsClaim))})
+	if role == "" {
+		return "", ErrOIDCUnauthorized
+	}
+	return role, nil
+}
 
-	_, err = s.DB.Exec(query, sessionID, userID, time.Now(), expiresAt)
-	if err != nil {
-		return "", fmt.Errorf("failed to create user session: %w", err)
+// roleFromClaims returns the role named by the claim of an ID token: a
+// string or a list of strings, of which the highest known role wins. It
+// returns an empty string when claim is empty or names no known role.
+func roleFromClaims(claims map[string]interface{}, claim string) string {
+	var roles []string
+	for _, value := range claimStrings(claims, claim) {
+		if role, err := models.ParseRole(value); err == nil {
+			roles = append(roles, role)
+		}
 	}
+	return models.HighestRole(roles)
+}
+
+// RoleFromGroups returns the highest role whose OIDC_*_GROUP variable lists
+// one of groups, or an empty string. Group names are compared exactly. SCIM
+// provisioning maps the groups the identity provider pushes the same way.
+func RoleFromGroups(groups []string) string {
+	var roles []string
+	for role, variable := range oidcRoleGroups {
+		for _, group := range strings.Split(os.Getenv(variable), ",") {
+			group = strings.TrimSpace(group)
+			if group != "" && slices.Contains(groups, group) {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return models.HighestRole(roles)
+}
+
+// claimStrings returns the string values of a claim, which may be a string
+// or a list. Dots in claim reach into nested objects, as in Keycloak's
+// realm_access.roles.
+func claimStrings(claims map[string]interface{}, claim string) []string {
+	if claim == "" {
+		return nil
+	}
+
+	var value interface{} = claims
+	for _, key := range strings.Split(claim, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
 
-	return sessionID, nil
+// CreateUserSession creates a new user session for a login from a
+// browser with the given User-Agent and IP address
+func (s *OIDCService) CreateUserSession(userID int, userAgent, ipAddress string) (string, error) {
+	return createSession(s.DB, userID, userAgent, ipAddress)
 }
 
 // InvalidateUserSession invalidates a user session
@@ -257,14 +451,14 @@ func (s *OIDCService) InvalidateUserSession(sessionID string) error {
 
 func (s *OIDCService) getUserBySub(sub string) (*models.User, error) {
 	query := `
-		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at
 		FROM users WHERE sub = $1
 	`
 
 	user := &models.User{}
 	err := s.DB.QueryRow(query, sub).Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -276,14 +470,16 @@ func (s *OIDCService) getUserBySub(sub string) (*models.User, error) {
 
 func (s *OIDCService) getUserByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin, created_at, updated_at, last_login_at
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role, created_at, updated_at, last_login_at,
+		       sub LIKE 'local:%', password_hash IS NOT NULL
 		FROM users WHERE email = $1
 	`
 
 	user := &models.User{}
 	err := s.DB.QueryRow(query, email).Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsActive, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+		&user.IsLocal, &user.HasPassword,
 	)
 
 	if err == sql.ErrNoRows {
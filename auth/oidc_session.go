@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"golang.org/x/oauth2"
+)
+
+// backchannelLogoutEvent is the member of the events claim that makes a JWT
+// a logout token.
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// logoutTokenMaxAge is how long after being issued a logout token without
+// an exp claim is accepted.
+const logoutTokenMaxAge = 5 * time.Minute
+
+// revalidateTimeout caps the token request of a session revalidation.
+const revalidateTimeout = 10 * time.Second
+
+// Reasons recorded in the audit log when the provider ends a session.
+const (
+	providerLogoutBackchannel       = "backchannel_logout"
+	providerLogoutRefreshRefused    = "refresh_refused"
+	providerLogoutUnauthorizedGroup = "unauthorized_group"
+)
+
+// ErrInvalidLogoutToken is returned by BackchannelLogout for a logout token
+// that is not signed by the provider or breaks the back-channel logout rules.
+var ErrInvalidLogoutToken = errors.New("invalid logout token")
+
+// StoreSessionTokens links a session to the OIDC login that opened it: the
+// subject and provider session ID, matched by back-channel logouts, the ID
+// token when logouts are sent to the provider and the refresh token when
+// sessions are revalidated.
+func (s *OIDCService) StoreSessionTokens(sessionID string, idToken *oidc.IDToken, rawIDToken string, token *oauth2.Token) error {
+	var claims struct {
+		Sid string `json:"sid"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return fmt.Errorf("failed to parse ID token claims: %w", err)
+	}
+
+	var storedIDToken, refreshToken sql.NullString
+	if s.ProviderLogout {
+		storedIDToken = sql.NullString{String: rawIDToken, Valid: true}
+	}
+	if s.RevalidateInterval > 0 {
+		if token.RefreshToken == "" {
+			logger.Warn("OIDC provider returned no refresh token; the session will not be revalidated", "subject", idToken.Subject)
+		} else {
+			refreshToken = sql.NullString{String: token.RefreshToken, Valid: true}
+		}
+	}
+
+	_, err := s.DB.Exec(`
+		UPDATE user_sessions
+		SET oidc_subject = $2, oidc_sid = NULLIF($3, ''), oidc_id_token = $4, oidc_refresh_token = $5, oidc_checked_at = NOW()
+		WHERE id = $1
+	`, sessionID, idToken.Subject, claims.Sid, storedIDToken, refreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to store OIDC session tokens: %w", err)
+	}
+	return nil
+}
+
+// EndSessionURL returns the URL of the provider that logs out the user of a
+// session, or an empty string when logouts stay local or the session did not
+// come from an OIDC login. It must be called before the session is ended.
+func (s *OIDCService) EndSessionURL(sessionID string) (string, error) {
+	if !s.ProviderLogout {
+		return "", nil
+	}
+
+	var idToken sql.NullString
+	err := s.DB.QueryRow(`SELECT oidc_id_token FROM user_sessions WHERE id = $1`, sessionID).Scan(&idToken)
+	if err == sql.ErrNoRows || (err == nil && !idToken.Valid) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load the ID token of the session: %w", err)
+	}
+
+	return endSessionURL(s.EndSessionEndpoint, idToken.String, s.OAuth2Config.ClientID, s.PostLogoutRedirectURL)
+}
+
+// endSessionURL builds an RP-initiated logout request for the
+// end_session_endpoint of a provider.
+func endSessionURL(endpoint, idToken, clientID, postLogoutRedirectURL string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid end_session_endpoint %q: %w", endpoint, err)
+	}
+
+	query := u.Query()
+	query.Set("id_token_hint", idToken)
+	query.Set("client_id", clientID)
+	if postLogoutRedirectURL != "" {
+		query.Set("post_logout_redirect_uri", postLogoutRedirectURL)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// defaultPostLogoutRedirectURL returns the login page of the server that
+// OIDC_REDIRECT_URL points to.
+func defaultPostLogoutRedirectURL(redirectURL string) string {
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/login"}).String()
+}
+
+// logoutClaims are the claims of an OIDC back-channel logout token.
+type logoutClaims struct {
+	Subject   string                     `json:"sub"`
+	SessionID string                     `json:"sid"`
+	Nonce     *string                    `json:"nonce"`
+	Events    map[string]json.RawMessage `json:"events"`
+}
+
+// validate checks the claims that make a signed JWT a logout token, as
+// required by OpenID Connect Back-Channel Logout 1.0. The issuedAt and
+// expiry times come from the iat and exp claims; expiry may be zero.
+func (l logoutClaims) validate(issuedAt, expiry, now time.Time) error {
+	if _, ok := l.Events[backchannelLogoutEvent]; !ok {
+		return errors.New("events claim has no back-channel logout event")
+	}
+	if l.Nonce != nil {
+		return errors.New("logout tokens must not have a nonce")
+	}
+	if l.Subject == "" && l.SessionID == "" {
+		return errors.New("logout token has neither sub nor sid")
+	}
+	if issuedAt.IsZero() {
+		return errors.New("logout token has no iat claim")
+	}
+
+	if issuedAt.After(now.Add(time.Minute)) {
+		return errors.New("logout token is issued in the future")
+	}
+	if !expiry.IsZero() {
+		if !expiry.After(now) {
+			return errors.New("logout token is expired")
+		}
+	} else if now.Sub(issuedAt) > logoutTokenMaxAge {
+		return errors.New("logout token is too old")
+	}
+	return nil
+}
+
+// BackchannelLogout ends the sessions named by a logout token of the
+// provider: the session with its sid or, without one, every session of its
+// subject. It returns how many sessions were ended; a token that matches no
+// session, as one delivered twice, ends none.
+func (s *OIDCService) BackchannelLogout(ctx context.Context, rawToken string) (int64, error) {
+	token, err := s.logoutVerifier.Verify(oidc.ClientContext(ctx, s.HTTPClient), rawToken)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidLogoutToken, err)
+	}
+
+	var claims logoutClaims
+	if err := token.Claims(&claims); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidLogoutToken, err)
+	}
+	if err := claims.validate(token.IssuedAt, token.Expiry, time.Now()); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidLogoutToken, err)
+	}
+
+	rows, err := s.DB.Query(`
+		DELETE FROM user_sessions
+		WHERE oidc_subject IS NOT NULL
+		  AND ($1 = '' OR oidc_subject = $1)
+		  AND ($2 = '' OR oidc_sid = $2)
+		RETURNING user_id
+	`, claims.Subject, claims.SessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to end sessions: %w", err)
+	}
+	defer rows.Close()
+
+	ended := map[int]int64{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return 0, err
+		}
+		ended[userID]++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for userID, count := range ended {
+		s.recordProviderLogout(userID, count, providerLogoutBackchannel)
+		total += count
+	}
+	return total, nil
+}
+
+// RevalidateSessions uses the refresh token of up to limit sessions that were
+// not checked for RevalidateInterval to ask the provider whether it still
+// accepts their user. Sessions whose token is refused, or whose new ID token
+// maps to no role, are ended; the role of the others follows their new ID
+// token. It returns how many sessions were checked and ended. Network errors
+// leave sessions as they are, to be checked at the next run.
+func (s *OIDCService) RevalidateSessions(ctx context.Context, limit int) (checked, ended int, err error) {
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, oidc_refresh_token
+		FROM user_sessions
+		WHERE is_active = true AND expires_at > NOW() AND oidc_refresh_token IS NOT NULL
+		  AND oidc_checked_at < NOW() - make_interval(secs => $1)
+		ORDER BY oidc_checked_at
+		LIMIT $2
+	`, s.RevalidateInterval.Seconds(), limit)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list sessions to revalidate: %w", err)
+	}
+
+	type session struct {
+		id           string
+		userID       int
+		refreshToken string
+	}
+	var sessions []session
+	for rows.Next() {
+		var ss session
+		if err := rows.Scan(&ss.id, &ss.userID, &ss.refreshToken); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		sessions = append(sessions, ss)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	var lastErr error
+	for _, ss := range sessions {
+		reason, err := s.revalidateSession(ctx, ss.id, ss.userID, ss.refreshToken)
+		if err != nil {
+			logger.Warn("OIDC: could not revalidate session", "user_id", ss.userID, "error", err)
+			lastErr = err
+			continue
+		}
+		checked++
+
+		if reason == "" {
+			continue
+		}
+		if _, err := s.DB.Exec(`DELETE FROM user_sessions WHERE id = $1`, ss.id); err != nil {
+			lastErr = fmt.Errorf("failed to end session: %w", err)
+			continue
+		}
+		ended++
+		logger.Info("OIDC: session ended by the provider", "user_id", ss.userID, "reason", reason)
+		s.recordProviderLogout(ss.userID, 1, reason)
+	}
+	return checked, ended, lastErr
+}
+
+// revalidateSession refreshes the tokens of a session and returns why the
+// session must end, or an empty string when the provider still accepts it.
+func (s *OIDCService) revalidateSession(ctx context.Context, sessionID string, userID int, refreshToken string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.HTTPClient)
+
+	token, err := s.OAuth2Config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		// The provider answered and refused the token: the user was removed
+		// or their provider session ended
+		return providerLogoutRefreshRefused, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken != "" {
+		idToken, err := s.VerifyIDToken(ctx, rawIDToken)
+		if err != nil {
+			return "", fmt.Errorf("failed to verify refreshed ID token: %w", err)
+		}
+		role, err := roleFromIDToken(idToken)
+		if errors.Is(err, ErrOIDCUnauthorized) {
+			return providerLogoutUnauthorizedGroup, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if role != "" {
+			if _, err := s.DB.Exec(`
+				UPDATE users SET role = $2, updated_at = NOW()
+				WHERE id = $1 AND role <> $2 AND sub NOT LIKE 'ldap:%' AND sub NOT LIKE 'local:%'
+			`, userID, role); err != nil {
+				return "", fmt.Errorf("failed to update role: %w", err)
+			}
+		}
+	}
+
+	// Providers that rotate refresh tokens return a new one with each
+	// refresh; the oauth2 package keeps the old one otherwise
+	_, err = s.DB.Exec(`
+		UPDATE user_sessions
+		SET oidc_refresh_token = $2,
+		    oidc_id_token = CASE WHEN oidc_id_token IS NULL OR $3 = '' THEN oidc_id_token ELSE $3 END,
+		    oidc_checked_at = NOW()
+		WHERE id = $1
+	`, sessionID, token.RefreshToken, rawIDToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to store refreshed tokens: %w", err)
+	}
+	return "", nil
+}
+
+// recordProviderLogout adds an audit entry for sessions of a user ended by
+// the provider, named after its issuer.
+func (s *OIDCService) recordProviderLogout(userID int, sessions int64, reason string) {
+	after, _ := json.Marshal(map[string]any{"reason": reason, "sessions": sessions})
+	err := models.NewAuditManager(s.DB).Record(models.AuditEntry{
+		ActorType:  models.AuditActorAnonymous,
+		ActorName:  s.IssuerURL,
+		Action:     models.AuditProviderLogout,
+		TargetType: "user",
+		TargetID:   strconv.Itoa(userID),
+		Success:    true,
+		After:      after,
+	})
+	if err != nil {
+		logger.Error("Failed to record audit entry", "action", models.AuditProviderLogout, "error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLogoutClaimsValidate(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	events := map[string]json.RawMessage{backchannelLogoutEvent: json.RawMessage(`{}`)}
+	nonce := "n-0S6_WzA2Mj"
+
+	tests := []struct {
+		name     string
+		claims   logoutClaims
+		issuedAt time.Time
+		expiry   time.Time
+		wantErr  bool
+	}{
+		{name: "Subject and sid", claims: logoutClaims{Subject: "248289761001", SessionID: "08a5019c", Events: events}, issuedAt: now},
+		{name: "Only sid", claims: logoutClaims{SessionID: "08a5019c", Events: events}, issuedAt: now.Add(-time.Minute)},
+		{name: "Valid exp", claims: logoutClaims{Subject: "248289761001", Events: events}, issuedAt: now.Add(-time.Hour), expiry: now.Add(time.Minute)},
+		{name: "ID token instead of logout token", claims: logoutClaims{Subject: "248289761001"}, issuedAt: now, wantErr: true},
+		{name: "Other event", claims: logoutClaims{Subject: "248289761001", Events: map[string]json.RawMessage{"urn:example": nil}}, issuedAt: now, wantErr: true},
+		{name: "Nonce", claims: logoutClaims{Subject: "248289761001", Nonce: &nonce, Events: events}, issuedAt: now, wantErr: true},
+		{name: "Neither sub nor sid", claims: logoutClaims{Events: events}, issuedAt: now, wantErr: true},
+		{name: "No iat", claims: logoutClaims{Subject: "248289761001", Events: events}, wantErr: true},
+		{name: "Issued in the future", claims: logoutClaims{Subject: "248289761001", Events: events}, issuedAt: now.Add(time.Hour), wantErr: true},
+		{name: "Too old without exp", claims: logoutClaims{Subject: "248289761001", Events: events}, issuedAt: now.Add(-time.Hour), wantErr: true},
+		{name: "Expired", claims: logoutClaims{Subject: "248289761001", Events: events}, issuedAt: now.Add(-time.Minute), expiry: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.claims.validate(tt.issuedAt, tt.expiry, now); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndSessionURL(t *testing.T) {
+	got, err := endSessionURL("https://idp.example.com/logout?ui_locales=en", "eyJhbGciOi", "txlog", "https://txlog.example.com/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "idp.example.com" || u.Path != "/logout" {
+		t.Errorf("endSessionURL() = %q, want the end_session_endpoint", got)
+	}
+	for param, want := range map[string]string{
+		"ui_locales":               "en",
+		"id_token_hint":            "eyJhbGciOi",
+		"client_id":                "txlog",
+		"post_logout_redirect_uri": "https://txlog.example.com/login",
+	} {
+		if value := u.Query().Get(param); value != want {
+			t.Errorf("endSessionURL() %s = %q, want %q", param, value, want)
+		}
+	}
+}
+
+func TestDefaultPostLogoutRedirectURL(t *testing.T) {
+	tests := []struct {
+		redirectURL string
+		expected    string
+	}{
+		{"https://txlog.example.com/auth/callback", "https://txlog.example.com/login"},
+		{"http://localhost:8080/auth/callback?x=1", "http://localhost:8080/login"},
+		{"/auth/callback", ""},
+	}
+
+	for _, tt := range tests {
+		if result := defaultPostLogoutRedirectURL(tt.redirectURL); result != tt.expected {
+			t.Errorf("defaultPostLogoutRedirectURL(%q) = %q, expected %q", tt.redirectURL, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSaveUser_LocalAdmin(t *testing.T) {
+	db := setupAuthTestDB(t)
+	defer db.Close()
+	cleanupAuthTestData(t, db)
+	defer cleanupAuthTestData(t, db)
+
+	const email = "auth-test-admin@example.com"
+	bootstrapTestAdmin(t, db, email)
+
+	s := &OIDCService{DB: db}
+	if _, err := s.saveUser("oidc-subject", email, "Mallory", "", "viewer"); !errors.Is(err, ErrLocalAccountConflict) {
+		t.Errorf("saveUser() error = %v, want ErrLocalAccountConflict", err)
+	}
+	assertLocalAdmin(t, db, email)
+}
+
+func TestSaveUser_KeepsRoleOfLDAPUser(t *testing.T) {
+	db := setupAuthTestDB(t)
+	defer db.Close()
+	cleanupAuthTestData(t, db)
+	defer cleanupAuthTestData(t, db)
+
+	const email = "auth-test-alice@example.com"
+	if _, err := (&LDAPService{DB: db}).createOrUpdateUser("auth-test-alice", email, "Alice", "viewer"); err != nil {
+		t.Fatalf("Failed to create LDAP user: %v", err)
+	}
+
+	s := &OIDCService{DB: db}
+	user, err := s.saveUser("oidc-alice", email, "Alice", "", "admin")
+	if err != nil {
+		t.Fatalf("saveUser() error = %v", err)
+	}
+	if user.Role != "viewer" {
+		t.Errorf("saveUser() role = %q, want viewer", user.Role)
+	}
+	if user.Sub != "ldap:auth-test-alice" {
+		t.Errorf("saveUser() sub = %q, want ldap:auth-test-alice", user.Sub)
+	}
+}
+
+func TestRoleFromClaims(t *testing.T) {
+	claims := map[string]interface{}{
+		"txlog_role": "Operator",
+		"roles":      []interface{}{"developer", "viewer", "security_analyst", 42},
+		"groups":     []interface{}{"developers"},
+	}
+
+	tests := []struct {
+		name     string
+		claim    string
+		expected string
+	}{
+		{name: "No claim configured", claim: "", expected: ""},
+		{name: "Missing claim", claim: "txlog_roles", expected: ""},
+		{name: "String claim", claim: "txlog_role", expected: "operator"},
+		{name: "Highest role of a list", claim: "roles", expected: "security_analyst"},
+		{name: "No known role", claim: "groups", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := roleFromClaims(claims, tt.claim); result != tt.expected {
+				t.Errorf("roleFromClaims(%q) = %q, expected %q", tt.claim, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRoleFromGroups(t *testing.T) {
+	t.Setenv("OIDC_ADMIN_GROUP", "txlog-admins")
+	t.Setenv("OIDC_OPERATOR_GROUP", "ops, sre")
+	t.Setenv("OIDC_VIEWER_GROUP", "developers")
+
+	if !IsOIDCGroupMappingConfigured() {
+		t.Fatal("IsOIDCGroupMappingConfigured() = false, expected true")
+	}
+
+	tests := []struct {
+		name     string
+		groups   []string
+		expected string
+	}{
+		{name: "No groups", groups: nil, expected: ""},
+		{name: "Unmapped group", groups: []string{"marketing"}, expected: ""},
+		{name: "Viewer group", groups: []string{"marketing", "developers"}, expected: "viewer"},
+		{name: "Second group of a list", groups: []string{"sre"}, expected: "operator"},
+		{name: "Highest role wins", groups: []string{"txlog-admins", "developers"}, expected: "admin"},
+		{name: "Exact match", groups: []string{"Txlog-Admins"}, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := RoleFromGroups(tt.groups); result != tt.expected {
+				t.Errorf("RoleFromGroups(%v) = %q, expected %q", tt.groups, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	claims := map[string]interface{}{
+		"groups":       []interface{}{"a", "b"},
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+	}
+
+	tests := []struct {
+		claim    string
+		expected []string
+	}{
+		{claim: "groups", expected: []string{"a", "b"}},
+		{claim: "realm_access.roles", expected: []string{"admin"}},
+		{claim: "realm_access.groups", expected: nil},
+		{claim: "groups.roles", expected: nil},
+	}
+
+	for _, tt := range tests {
+		result := claimStrings(claims, tt.claim)
+		if !slices.Equal(result, tt.expected) {
+			t.Errorf("claimStrings(%q) = %v, expected %v", tt.claim, result, tt.expected)
+		}
+	}
+}
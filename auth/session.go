@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session lifetimes used when SESSION_IDLE_TIMEOUT and SESSION_MAX_LIFETIME
+// are not set.
+const (
+	DefaultSessionIdleTimeout = 24 * time.Hour
+	DefaultSessionMaxLifetime = 7 * 24 * time.Hour
+)
+
+// maxUserAgentLength caps the User-Agent stored with a session.
+const maxUserAgentLength = 512
+
+// SessionConfig holds the lifetimes of browser sessions.
+type SessionConfig struct {
+	// IdleTimeout ends a session that made no request for this long. Each
+	// request pushes the end of the session back, up to MaxLifetime.
+	IdleTimeout time.Duration
+	// MaxLifetime ends a session this long after login, whatever its
+	// activity.
+	MaxLifetime time.Duration
+}
+
+// CookieMaxAge returns the Max-Age, in seconds, of the session cookie.
+func (c SessionConfig) CookieMaxAge() int {
+	return int(c.MaxLifetime.Seconds())
+}
+
+var sessionConfig = SessionConfig{
+	IdleTimeout: DefaultSessionIdleTimeout,
+	MaxLifetime: DefaultSessionMaxLifetime,
+}
+
+// SessionConfigFromEnv reads the session lifetimes from the environment.
+//
+// Environment Variables:
+//   - SESSION_IDLE_TIMEOUT: time without requests after which a session ends (default: 24h)
+//   - SESSION_MAX_LIFETIME: time after login after which a session ends (default: 7d)
+//
+// Both take a Go duration, such as 30m or 12h, or a number of days, such as
+// 7d. The idle timeout cannot be longer than the maximum lifetime.
+func SessionConfigFromEnv() (SessionConfig, error) {
+	config := SessionConfig{
+		IdleTimeout: DefaultSessionIdleTimeout,
+		MaxLifetime: DefaultSessionMaxLifetime,
+	}
+
+	var errs []error
+	for name, duration := range map[string]*time.Duration{
+		"SESSION_IDLE_TIMEOUT": &config.IdleTimeout,
+		"SESSION_MAX_LIFETIME": &config.MaxLifetime,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := ParseSessionDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		*duration = parsed
+	}
+	if len(errs) > 0 {
+		return config, errors.Join(errs...)
+	}
+
+	if config.IdleTimeout > config.MaxLifetime {
+		return config, fmt.Errorf("SESSION_IDLE_TIMEOUT (%s) is longer than SESSION_MAX_LIFETIME (%s)", config.IdleTimeout, config.MaxLifetime)
+	}
+	return config, nil
+}
+
+// ParseSessionDuration parses a session lifetime: a Go duration, such as
+// 30m or 12h, or a number of days, such as 7d. It must be at least a
+// minute.
+func ParseSessionDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	var duration time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration = parsed
+	}
+
+	if duration < time.Minute {
+		return 0, fmt.Errorf("duration %q is shorter than a minute", value)
+	}
+	return duration, nil
+}
+
+// ConfigureSessions sets the session lifetimes used by the services and the
+// middleware. It must be called once at startup, before requests are served.
+func ConfigureSessions(config SessionConfig) {
+	sessionConfig = config
+}
+
+// Sessions returns the session lifetimes in use.
+func Sessions() SessionConfig {
+	return sessionConfig
+}
+
+// createSession starts a browser session for a user and returns its ID,
+// the value of the session cookie. The session ends after the idle timeout
+// unless it is used, and after the maximum lifetime in any case.
+func createSession(db *sql.DB, userID int, userAgent, ipAddress string) (string, error) {
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	config := Sessions()
+	now := time.Now()
+	absoluteExpiresAt := now.Add(config.MaxLifetime)
+	expiresAt := now.Add(config.IdleTimeout)
+	if expiresAt.After(absoluteExpiresAt) {
+		expiresAt = absoluteExpiresAt
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	query := `
+		INSERT INTO user_sessions (
+			id, user_id, created_at, expires_at, absolute_expires_at, last_seen_at, user_agent, ip_address, is_active
+		)
+		VALUES ($1, $2, $3, $4, $5, $3, $6, $7, true)
+	`
+	_, err = db.Exec(query, sessionID, userID, now, expiresAt, absoluteExpiresAt, userAgent, ipAddress)
+	if err != nil {
+		return "", fmt.Errorf("failed to create user session: %w", err)
+	}
+
+	return sessionID, nil
+}
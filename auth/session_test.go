@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSessionDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30m", want: 30 * time.Minute},
+		{value: "12h", want: 12 * time.Hour},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: " 1d ", want: 24 * time.Hour},
+		{value: "30s", wantErr: true},
+		{value: "0d", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "a week", wantErr: true},
+		{value: "1.5d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSessionDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSessionDuration(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSessionDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		idleTimeout string
+		maxLifetime string
+		want        SessionConfig
+		wantErr     bool
+	}{
+		{
+			name: "Defaults",
+			want: SessionConfig{IdleTimeout: DefaultSessionIdleTimeout, MaxLifetime: DefaultSessionMaxLifetime},
+		},
+		{
+			name:        "Both set",
+			idleTimeout: "2h",
+			maxLifetime: "1d",
+			want:        SessionConfig{IdleTimeout: 2 * time.Hour, MaxLifetime: 24 * time.Hour},
+		},
+		{name: "Idle timeout longer than lifetime", idleTimeout: "2d", maxLifetime: "1d", wantErr: true},
+		{name: "Idle timeout longer than default lifetime", idleTimeout: "30d", wantErr: true},
+		{name: "Invalid value", maxLifetime: "forever", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SESSION_IDLE_TIMEOUT", tt.idleTimeout)
+			t.Setenv("SESSION_MAX_LIFETIME", tt.maxLifetime)
+
+			got, err := SessionConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SessionConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("SessionConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionConfigCookieMaxAge(t *testing.T) {
+	config := SessionConfig{IdleTimeout: time.Hour, MaxLifetime: 7 * 24 * time.Hour}
+	if got := config.CookieMaxAge(); got != 604800 {
+		t.Errorf("CookieMaxAge() = %d, want 604800", got)
+	}
+}
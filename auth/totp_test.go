@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors of RFC 6238
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC lists 8-digit codes; these are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode([]byte("12345678901234567890"), tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		at       time.Time
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current code", code: "050471", at: now, wantStep: step, wantOK: true},
+		{name: "Code with spaces", code: " 050 471 ", at: now, wantStep: step, wantOK: true},
+		{name: "Previous time step", code: "050471", at: now.Add(totpPeriod * time.Second), wantStep: step, wantOK: true},
+		{name: "Too old", code: "050471", at: now.Add(2 * totpPeriod * time.Second)},
+		{name: "Already used", code: "050471", at: now, lastStep: step},
+		{name: "Wrong code", code: "123456", at: now},
+		{name: "Wrong length", code: "50471", at: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := ValidateTOTP(rfcSecret, tt.code, tt.at, tt.lastStep)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("len(secret) = %d, want 32", len(secret))
+	}
+	if uri := TOTPURI("jane@example.com", secret); !strings.HasPrefix(uri, "otpauth://totp/Txlog%20Server:jane@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("TOTPURI() = %s", uri)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/txlog/server/auth"
+)
+
+const commandUsage = `Usage:
+  txlog-server                            start the server
+  txlog-server create-admin <email>       create a local admin
+  txlog-server reset-password <email>     set the password of a local user and turn off their 2FA
+
+The password is read from the first line of the standard input.
+`
+
+// runCommand runs the administration command named by args and returns the
+// exit code of the process.
+func runCommand(db *sql.DB, args []string, stdin io.Reader) int {
+	if len(args) != 2 || strings.TrimSpace(args[1]) == "" {
+		fmt.Fprint(os.Stderr, commandUsage)
+		return 2
+	}
+
+	if !auth.IsLocalConfigured() {
+		fmt.Fprintln(os.Stderr, "Warning: LOCAL_AUTH_ENABLED is not true, so local accounts cannot log in until it is set.")
+	}
+
+	password, err := readPassword(stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	localService := &auth.LocalService{DB: db}
+	email := strings.TrimSpace(args[1])
+
+	switch args[0] {
+	case "create-admin":
+		created, err := localService.BootstrapAdmin(email, password)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		if !created {
+			fmt.Fprintf(os.Stderr, "Error: a user with the e-mail %s already exists; use reset-password\n", email)
+			return 1
+		}
+		fmt.Printf("Local admin %s created.\n", email)
+	case "reset-password":
+		if err := localService.SetPasswordByEmail(email, password, true); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		fmt.Printf("Password of %s set, two-factor authentication disabled and sessions ended.\n", email)
+	default:
+		fmt.Fprint(os.Stderr, commandUsage)
+		return 2
+	}
+	return 0
+}
+
+// readPassword reads a password from the first line of r.
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read the password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if err := auth.ValidatePassword(password); err != nil {
+		return "", err
+	}
+	return password, nil
+}
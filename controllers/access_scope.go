@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/models"
+)
+
+// userScope returns the scope of the signed-in user, which is unrestricted
+// for admins and when authentication is disabled.
+func userScope(c *gin.Context) models.AccessScope {
+	if user := currentUser(c); user != nil {
+		return user.Scope
+	}
+	return models.AccessScope{}
+}
+
+// scopedHostnames returns the hostnames of the assets the signed-in user
+// can see, and false when the user sees the whole fleet.
+func scopedHostnames(c *gin.Context, db *sql.DB) ([]string, bool, error) {
+	scope := userScope(c)
+	if !scope.Restricted() {
+		return nil, false, nil
+	}
+	hostnames, err := models.NewTopologyManager(db).HostnamesInScope(scope)
+	return hostnames, true, err
+}
+
+// assetInScope reports whether the signed-in user can see the asset with
+// hostname.
+func assetInScope(c *gin.Context, db *sql.DB, hostname string) (bool, error) {
+	scope := userScope(c)
+	if !scope.Restricted() {
+		return true, nil
+	}
+	topology, err := models.NewTopologyManager(db).ResolveHostname(hostname)
+	if err != nil {
+		return false, err
+	}
+	return scope.AcceptsTopology(topology), nil
+}
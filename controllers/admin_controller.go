@@ -8,9 +8,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/txlog/server/audit"
 	"github.com/txlog/server/database"
+	"github.com/txlog/server/forwarder"
 	logger "github.com/txlog/server/logger"
 	"github.com/txlog/server/models"
+	"github.com/txlog/server/ratelimit"
 	"github.com/txlog/server/util"
 )
 
@@ -19,7 +23,7 @@ func GetAdminIndex(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		users, err := getAllUsers(db)
 		if err != nil {
-			logger.Error("Failed to get users: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get users", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Internal Server Error",
 				"error": "Failed to load users",
@@ -30,7 +34,7 @@ func GetAdminIndex(db *sql.DB) gin.HandlerFunc {
 		// Get migration status
 		migrationStatus, err := getMigrationStatus(db)
 		if err != nil {
-			logger.Error("Failed to get migration status: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get migration status", "error", err)
 			// Don't fail the page, just show empty migration status
 			migrationStatus = &models.MigrationStatus{}
 		}
@@ -38,17 +42,35 @@ func GetAdminIndex(db *sql.DB) gin.HandlerFunc {
 		// Get API keys
 		apiKeys, err := getAllAPIKeys(db)
 		if err != nil {
-			logger.Error("Failed to get API keys: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get API keys", "error", err)
 			// Don't fail the page, just show empty API keys list
 			apiKeys = []models.ApiKey{}
 		}
 
+		em := models.NewEnrollmentManager(db)
+		enrollmentTokens, err := em.ListTokens()
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get enrollment tokens", "error", err)
+			enrollmentTokens = []models.EnrollmentToken{}
+		}
+		machineCredentials, err := em.ListCredentials()
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get machine credentials", "error", err)
+			machineCredentials = []models.MachineCredential{}
+		}
+
 		osvIsRunning := GetCronLockStatus(db, "vulnerabilities")
 
+		osvRuns, err := models.NewJobRunManager(db).List("vulnerabilities", 10)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get vulnerability job runs", "error", err)
+			osvRuns = []models.JobRun{}
+		}
+
 		// Get inactive assets count for housekeeping section
 		inactiveAssetsCount, err := getInactiveAssetsCount(db)
 		if err != nil {
-			logger.Error("Failed to get inactive assets count: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get inactive assets count", "error", err)
 			inactiveAssetsCount = 0
 		}
 
@@ -56,31 +78,66 @@ func GetAdminIndex(db *sql.DB) gin.HandlerFunc {
 		tm := models.NewTopologyManager(db)
 		topologyPatterns, err := tm.ListPatterns()
 		if err != nil {
-			logger.Error("Failed to get topology patterns: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get topology patterns", "error", err)
 			topologyPatterns = []models.TopologyPattern{}
 		}
 		environmentNames, err := tm.ListEnvironmentNames()
 		if err != nil {
-			logger.Error("Failed to get environment names: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get environment names", "error", err)
 			environmentNames = []models.EnvironmentName{}
 		}
 		serviceNames, err := tm.ListServiceNames()
 		if err != nil {
-			logger.Error("Failed to get service names: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to get service names", "error", err)
 			serviceNames = []models.ServiceName{}
 		}
 
+		wm := models.NewWebhookManager(db)
+		webhookSubscriptions, err := wm.ListSubscriptions()
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get webhook subscriptions", "error", err)
+			webhookSubscriptions = []models.WebhookSubscription{}
+		}
+		webhookDeliveries, err := wm.ListDeliveries(50)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get webhook deliveries", "error", err)
+			webhookDeliveries = []models.WebhookDelivery{}
+		}
+
+		syslogForwarders, err := models.NewSyslogForwarderManager(db).ListForwarders()
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get syslog forwarders", "error", err)
+			syslogForwarders = []models.SyslogForwarder{}
+		}
+
+		userRoles := make([]gin.H, 0, len(models.Roles))
+		for _, role := range models.Roles {
+			userRoles = append(userRoles, gin.H{"value": role, "label": models.RoleLabel(role)})
+		}
+
 		c.HTML(http.StatusOK, "admin.html", gin.H{
-			"Context":             c,
-			"title":               "Administration - Txlog Server",
-			"users":               users,
-			"migrations":          migrationStatus,
-			"apiKeys":             apiKeys,
-			"osvIsRunning":        osvIsRunning,
-			"inactiveAssetsCount": inactiveAssetsCount,
-			"topologyPatterns":    topologyPatterns,
-			"environmentNames":    environmentNames,
-			"serviceNames":        serviceNames,
+			"Context":              c,
+			"title":                "Administration - Txlog Server",
+			"users":                users,
+			"userRoles":            userRoles,
+			"migrations":           migrationStatus,
+			"apiKeys":              apiKeys,
+			"apiKeyScopes":         models.APIKeyScopes,
+			"enrollmentTokens":     enrollmentTokens,
+			"machineCredentials":   machineCredentials,
+			"osvIsRunning":         osvIsRunning,
+			"osvRuns":              osvRuns,
+			"inactiveAssetsCount":  inactiveAssetsCount,
+			"topologyPatterns":     topologyPatterns,
+			"environmentNames":     environmentNames,
+			"serviceNames":         serviceNames,
+			"webhookSubscriptions": webhookSubscriptions,
+			"webhookDeliveries":    webhookDeliveries,
+			"webhookEvents":        models.WebhookEvents,
+			"syslogForwarders":     syslogForwarders,
+			"syslogStats":          forwarder.Stats(),
+			"syslogDropped":        forwarder.Dropped(),
+			"rateLimits":           ratelimit.Stats(),
 		})
 	}
 }
@@ -96,16 +153,34 @@ func PostAdminUpdateUser(db *sql.DB) gin.HandlerFunc {
 		}
 
 		isActive := c.PostForm("is_active") == "on"
-		isAdmin := c.PostForm("is_admin") == "on"
+		role, err := models.ParseRole(c.PostForm("role"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+		scope := models.ParseAccessScope(c.PostForm("environments"), c.PostForm("services"))
+		if role == models.RoleAdmin && scope.Restricted() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Admins always see the whole fleet; clear the environments and services"})
+			return
+		}
+
+		before, err := getUserState(db, userID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to load user", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
 
-		err = updateUser(db, userID, isActive, isAdmin)
+		err = updateUser(db, userID, isActive, role, scope)
 		if err != nil {
-			logger.Error("Failed to update user: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to update user", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 			return
 		}
 
-		logger.Info("User " + userIDStr + " updated successfully")
+		logger.InfoContext(c.Request.Context(), "User updated successfully", "user_id", userIDStr)
+		after := userState{Email: before.Email, IsActive: isActive, Role: role, Scope: scope}
+		audit.Record(c, db, models.AuditUserUpdate, "user", userIDStr, before, after)
 		c.Redirect(http.StatusSeeOther, "/admin")
 	}
 }
@@ -120,14 +195,24 @@ func PostAdminDeleteUser(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		before, err := getUserState(db, userID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to load user", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+			return
+		}
+
 		err = deactivateUser(db, userID)
 		if err != nil {
-			logger.Error("Failed to deactivate user: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to deactivate user", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
 			return
 		}
 
-		logger.Info("User " + userIDStr + " deactivated successfully")
+		logger.InfoContext(c.Request.Context(), "User deactivated successfully", "user_id", userIDStr)
+		after := *before
+		after.IsActive = false
+		audit.Record(c, db, models.AuditUserDeactivate, "user", userIDStr, before, after)
 		c.Redirect(http.StatusSeeOther, "/admin")
 	}
 }
@@ -135,8 +220,11 @@ func PostAdminDeleteUser(db *sql.DB) gin.HandlerFunc {
 // getAllUsers retrieves all users from the database
 func getAllUsers(db *sql.DB) ([]models.User, error) {
 	query := `
-		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, is_admin,
-		       created_at, updated_at, last_login_at
+		SELECT id, sub, email, name, COALESCE(picture, '') as picture, is_active, role,
+		       environments, services, created_at, updated_at, last_login_at,
+		       sub LIKE 'local:%', password_hash IS NOT NULL, totp_enabled,
+		       (SELECT COUNT(*) FROM user_sessions s
+		        WHERE s.user_id = users.id AND s.is_active = true AND s.expires_at > NOW())
 		FROM users
 		ORDER BY created_at DESC
 	`
@@ -152,8 +240,9 @@ func getAllUsers(db *sql.DB) ([]models.User, error) {
 		var user models.User
 		err := rows.Scan(
 			&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-			&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
-			&user.LastLoginAt,
+			&user.IsActive, &user.Role, pq.Array(&user.Scope.Environments), pq.Array(&user.Scope.Services),
+			&user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+			&user.IsLocal, &user.HasPassword, &user.TOTPEnabled, &user.ActiveSessions,
 		)
 		if err != nil {
 			return nil, err
@@ -164,15 +253,35 @@ func getAllUsers(db *sql.DB) ([]models.User, error) {
 	return users, rows.Err()
 }
 
-// updateUser updates user status in the database
-func updateUser(db *sql.DB, userID int, isActive, isAdmin bool) error {
+// userState is the state of a user recorded in the audit log.
+type userState struct {
+	Email    string             `json:"email"`
+	IsActive bool               `json:"is_active"`
+	Role     string             `json:"role"`
+	Scope    models.AccessScope `json:"scope"`
+}
+
+// getUserState retrieves the state of a user recorded in the audit log
+func getUserState(db *sql.DB, userID int) (*userState, error) {
+	state := &userState{}
+	err := db.QueryRow(`
+		SELECT email, is_active, role, environments, services
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&state.Email, &state.IsActive, &state.Role,
+		pq.Array(&state.Scope.Environments), pq.Array(&state.Scope.Services))
+	return state, err
+}
+
+// updateUser updates user status, role and scope in the database
+func updateUser(db *sql.DB, userID int, isActive bool, role string, scope models.AccessScope) error {
 	query := `
 		UPDATE users
-		SET is_active = $1, is_admin = $2, updated_at = $3
-		WHERE id = $4
+		SET is_active = $1, role = $2, environments = $3, services = $4, updated_at = $5
+		WHERE id = $6
 	`
 
-	_, err := db.Exec(query, isActive, isAdmin, time.Now(), userID)
+	_, err := db.Exec(query, isActive, role, pq.Array(scope.Environments), pq.Array(scope.Services), time.Now(), userID)
 	return err
 }
 
@@ -193,7 +302,7 @@ func PostAdminRunMigrations(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// First check if database is dirty and force clean if needed
 		if err := database.ForceCleanIfDirty(); err != nil {
-			logger.Error("Failed to clean dirty state: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to clean dirty state", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Migration Error",
 				"error": "Failed to clean dirty state: " + err.Error(),
@@ -204,7 +313,7 @@ func PostAdminRunMigrations(db *sql.DB) gin.HandlerFunc {
 		// Apply all pending migrations using database package function
 		err := database.RunAllMigrations()
 		if err != nil {
-			logger.Error("Failed to run migrations: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to run migrations", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Migration Error",
 				"error": "Failed to apply migrations: " + err.Error(),
@@ -212,7 +321,8 @@ func PostAdminRunMigrations(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		logger.Info("All pending migrations applied successfully via admin panel")
+		logger.InfoContext(c.Request.Context(), "All pending migrations applied successfully via admin panel")
+		audit.Record(c, db, models.AuditMigrationsRun, "database", "", nil, nil)
 		c.Redirect(http.StatusSeeOther, "/admin?migration_success=1")
 	}
 }
@@ -222,7 +332,7 @@ func PostAdminForceCleanMigration(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		err := database.ForceCleanIfDirty()
 		if err != nil {
-			logger.Error("Failed to force clean migration state: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to force clean migration state", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Migration Error",
 				"error": "Failed to force clean migration state: " + err.Error(),
@@ -230,7 +340,7 @@ func PostAdminForceCleanMigration(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		logger.Info("Database migration forced to clean state via admin panel")
+		logger.InfoContext(c.Request.Context(), "Database migration forced to clean state via admin panel")
 		c.Redirect(http.StatusSeeOther, "/admin?migration_success=1")
 	}
 }
@@ -240,7 +350,7 @@ func GetCronLockStatus(db *sql.DB, lockName string) bool {
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM cron_lock WHERE job_name = $1", lockName).Scan(&count)
 	if err != nil {
-		logger.Error("Failed to check cron lock status for " + lockName + ": " + err.Error())
+		logger.Error("Failed to check cron lock status", "lock", lockName, "error", err)
 		return false
 	}
 	return count > 0
@@ -251,6 +361,7 @@ func PostAdminRunOSVUpdate(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Import scheduler locally just to run the background job asynchronously
 		importSchedulerFunc()
+		audit.Record(c, db, models.AuditOSVUpdate, "vulnerabilities", "", nil, nil)
 
 		c.Redirect(http.StatusSeeOther, "/admin?osv_update_started=1")
 	}
@@ -275,7 +386,7 @@ func PostAdminResetOSV(db *sql.DB) gin.HandlerFunc {
 		`
 		_, err := db.Exec(query)
 		if err != nil {
-			logger.Error("Failed to reset vulnerabilities database: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to reset vulnerabilities database", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Database Error",
 				"error": "Failed to reset vulnerabilities database: " + err.Error(),
@@ -284,6 +395,7 @@ func PostAdminResetOSV(db *sql.DB) gin.HandlerFunc {
 		}
 
 		importSchedulerFunc()
+		audit.Record(c, db, models.AuditOSVReset, "vulnerabilities", "", nil, nil)
 
 		c.Redirect(http.StatusSeeOther, "/admin?osv_reset_started=1")
 	}
@@ -344,7 +456,8 @@ func getMigrationStatus(db *sql.DB) (*models.MigrationStatus, error) {
 	return status, nil
 }
 
-// getAllAPIKeys retrieves all API keys from the database
+// getAllAPIKeys retrieves all API keys from the database, including the
+// personal access tokens of users
 func getAllAPIKeys(db *sql.DB) ([]models.ApiKey, error) {
 	query := `
 		SELECT
@@ -355,9 +468,16 @@ func getAllAPIKeys(db *sql.DB) ([]models.ApiKey, error) {
 			ak.last_used_at,
 			ak.is_active,
 			ak.created_by,
-			COALESCE(u.name, 'System') as creator_name
+			COALESCE(u.name, 'System') as creator_name,
+			ak.scopes,
+			ak.expires_at,
+			ak.allowed_cidrs,
+			COALESCE(ak.environment, ''),
+			ak.user_id,
+			COALESCE(o.name, '') as owner_name
 		FROM api_keys ak
 		LEFT JOIN users u ON ak.created_by = u.id
+		LEFT JOIN users o ON ak.user_id = o.id
 		ORDER BY ak.created_at DESC
 	`
 
@@ -379,6 +499,12 @@ func getAllAPIKeys(db *sql.DB) ([]models.ApiKey, error) {
 			&key.IsActive,
 			&key.CreatedBy,
 			&key.CreatorName,
+			pq.Array(&key.Scopes),
+			&key.ExpiresAt,
+			pq.Array(&key.AllowedCIDRs),
+			&key.Environment,
+			&key.UserID,
+			&key.OwnerName,
 		)
 		if err != nil {
 			return nil, err
@@ -389,7 +515,10 @@ func getAllAPIKeys(db *sql.DB) ([]models.ApiKey, error) {
 	return apiKeys, rows.Err()
 }
 
-// PostAdminCreateAPIKey creates a new API key
+// PostAdminCreateAPIKey creates a new API key.
+// Expects form fields: name (string), scopes (repeated: ingest, read,
+// admin), and optionally expires_on (YYYY-MM-DD), allowed_cidrs (networks
+// separated by commas or new lines) and environment (topology environment).
 func PostAdminCreateAPIKey(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		name := c.PostForm("name")
@@ -398,10 +527,16 @@ func PostAdminCreateAPIKey(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		restrictions, err := parseAPIKeyRestrictions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Generate API key
 		fullKey, keyHash, keyPrefix, err := util.GenerateAPIKey()
 		if err != nil {
-			logger.Error("Failed to generate API key: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to generate API key", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
 			return
 		}
@@ -417,18 +552,24 @@ func PostAdminCreateAPIKey(db *sql.DB) gin.HandlerFunc {
 		// Insert into database
 		var keyID int
 		query := `
-			INSERT INTO api_keys (name, key_hash, key_prefix, created_by, created_at, is_active)
-			VALUES ($1, $2, $3, $4, $5, true)
+			INSERT INTO api_keys (
+				name, key_hash, key_prefix, created_by, created_at, is_active,
+				scopes, expires_at, allowed_cidrs, environment
+			)
+			VALUES ($1, $2, $3, $4, $5, true, $6, $7, $8, NULLIF($9, ''))
 			RETURNING id
 		`
-		err = db.QueryRow(query, name, keyHash, keyPrefix, createdBy, time.Now()).Scan(&keyID)
+		err = db.QueryRow(query, name, keyHash, keyPrefix, createdBy, time.Now(),
+			pq.Array(restrictions.Scopes), restrictions.ExpiresAt, pq.Array(restrictions.AllowedCIDRs), restrictions.Environment,
+		).Scan(&keyID)
 		if err != nil {
-			logger.Error("Failed to insert API key: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to insert API key", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
 			return
 		}
 
-		logger.Info(fmt.Sprintf("API key created: ID=%d, Name=%s", keyID, name))
+		logger.InfoContext(c.Request.Context(), "API key created", "api_key_id", keyID, "name", name, "scopes", restrictions.Scopes)
+		audit.Record(c, db, models.AuditAPIKeyCreate, "api_key", strconv.Itoa(keyID), nil, gin.H{"name": name, "key_prefix": keyPrefix, "restrictions": restrictions})
 
 		// Return the full key (this is the only time it will be shown)
 		c.JSON(http.StatusOK, gin.H{
@@ -441,6 +582,75 @@ func PostAdminCreateAPIKey(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
+// PostAdminUpdateAPIKey changes the scopes and restrictions of an API key.
+// Expects form fields: key_id (int) and the restriction fields of
+// PostAdminCreateAPIKey.
+func PostAdminUpdateAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID, err := strconv.Atoi(c.PostForm("key_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+
+		restrictions, err := parseAPIKeyRestrictions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		before, err := getAPIKeyRestrictions(db, keyID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to load API key", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+			return
+		}
+
+		query := `
+			UPDATE api_keys
+			SET scopes = $2, expires_at = $3, allowed_cidrs = $4, environment = NULLIF($5, '')
+			WHERE id = $1
+		`
+		_, err = db.Exec(query, keyID,
+			pq.Array(restrictions.Scopes), restrictions.ExpiresAt, pq.Array(restrictions.AllowedCIDRs), restrictions.Environment,
+		)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to update API key", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "API key updated", "api_key_id", keyID, "scopes", restrictions.Scopes)
+		audit.Record(c, db, models.AuditAPIKeyUpdate, "api_key", strconv.Itoa(keyID), before, restrictions)
+		c.Redirect(http.StatusSeeOther, "/admin?apikey_updated=1")
+	}
+}
+
+// parseAPIKeyRestrictions reads the scope and restriction fields of the API
+// key forms.
+func parseAPIKeyRestrictions(c *gin.Context) (models.APIKeyRestrictions, error) {
+	return models.ParseAPIKeyRestrictions(
+		c.PostFormArray("scopes"),
+		c.PostForm("expires_on"),
+		c.PostForm("allowed_cidrs"),
+		c.PostForm("environment"),
+		time.Now(),
+	)
+}
+
+// getAPIKeyRestrictions retrieves the scopes and restrictions of an API key
+func getAPIKeyRestrictions(db *sql.DB, keyID int) (*models.APIKeyRestrictions, error) {
+	var restrictions models.APIKeyRestrictions
+	var environment sql.NullString
+	err := db.QueryRow(`
+		SELECT scopes, expires_at, allowed_cidrs, environment
+		FROM api_keys
+		WHERE id = $1
+	`, keyID).Scan(pq.Array(&restrictions.Scopes), &restrictions.ExpiresAt, pq.Array(&restrictions.AllowedCIDRs), &environment)
+	restrictions.Environment = environment.String
+	return &restrictions, err
+}
+
 // PostAdminRevokeAPIKey revokes (deactivates) an API key
 func PostAdminRevokeAPIKey(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -454,12 +664,13 @@ func PostAdminRevokeAPIKey(db *sql.DB) gin.HandlerFunc {
 		query := `UPDATE api_keys SET is_active = false WHERE id = $1`
 		_, err = db.Exec(query, keyID)
 		if err != nil {
-			logger.Error("Failed to revoke API key: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to revoke API key", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
 			return
 		}
 
-		logger.Info(fmt.Sprintf("API key revoked: ID=%d", keyID))
+		logger.InfoContext(c.Request.Context(), "API key revoked", "api_key_id", keyID)
+		audit.Record(c, db, models.AuditAPIKeyRevoke, "api_key", keyIDStr, gin.H{"is_active": true}, gin.H{"is_active": false})
 		c.Redirect(http.StatusSeeOther, "/admin?apikey_revoked=1")
 	}
 }
@@ -474,15 +685,19 @@ func DeleteAdminAPIKey(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		query := `DELETE FROM api_keys WHERE id = $1`
-		_, err = db.Exec(query, keyID)
-		if err != nil {
-			logger.Error("Failed to delete API key: " + err.Error())
+		var name, keyPrefix string
+		query := `DELETE FROM api_keys WHERE id = $1 RETURNING name, key_prefix`
+		err = db.QueryRow(query, keyID).Scan(&name, &keyPrefix)
+		if err != nil && err != sql.ErrNoRows {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete API key", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API key"})
 			return
 		}
 
-		logger.Info(fmt.Sprintf("API key deleted: ID=%d", keyID))
+		logger.InfoContext(c.Request.Context(), "API key deleted", "api_key_id", keyID)
+		if err == nil {
+			audit.Record(c, db, models.AuditAPIKeyDelete, "api_key", keyIDStr, gin.H{"name": name, "key_prefix": keyPrefix}, nil)
+		}
 		c.Redirect(http.StatusSeeOther, "/admin?apikey_deleted=1")
 	}
 }
@@ -510,7 +725,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 			  AND last_seen < NOW() - INTERVAL '15 days'
 		`)
 		if err != nil {
-			logger.Error("Failed to query inactive assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to query inactive assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to query inactive assets: " + err.Error(),
@@ -523,7 +738,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		for rows.Next() {
 			var id string
 			if err := rows.Scan(&id); err != nil {
-				logger.Error("Failed to scan inactive asset: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Failed to scan inactive asset", "error", err)
 				c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 					"title": "Cleanup Error",
 					"error": "Failed to scan inactive asset: " + err.Error(),
@@ -533,7 +748,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 			machineIDs = append(machineIDs, id)
 		}
 		if err := rows.Err(); err != nil {
-			logger.Error("Error iterating inactive assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error iterating inactive assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Error iterating inactive assets: " + err.Error(),
@@ -549,7 +764,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		// Delete all data in a single transaction
 		tx, err := db.Begin()
 		if err != nil {
-			logger.Error("Failed to start cleanup transaction: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to start cleanup transaction", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to start transaction: " + err.Error(),
@@ -573,7 +788,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		_, err = tx.Exec(`DELETE FROM transaction_items WHERE ` + inactiveSubquery)
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Failed to delete transaction_items for inactive assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete transaction_items for inactive assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to delete transaction items: " + err.Error(),
@@ -584,7 +799,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		_, err = tx.Exec(`DELETE FROM transactions WHERE ` + inactiveSubquery)
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Failed to delete transactions for inactive assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete transactions for inactive assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to delete transactions: " + err.Error(),
@@ -595,7 +810,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		_, err = tx.Exec(`DELETE FROM executions WHERE ` + inactiveSubquery)
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Failed to delete executions for inactive assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete executions for inactive assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to delete executions: " + err.Error(),
@@ -606,7 +821,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		_, err = tx.Exec(`DELETE FROM assets WHERE is_active = true AND last_seen < NOW() - INTERVAL '15 days'`)
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Failed to delete inactive assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete inactive assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to delete assets: " + err.Error(),
@@ -615,7 +830,7 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 		}
 
 		if err := tx.Commit(); err != nil {
-			logger.Error("Failed to commit cleanup transaction: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to commit cleanup transaction", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"title": "Cleanup Error",
 				"error": "Failed to commit transaction: " + err.Error(),
@@ -623,7 +838,8 @@ func PostAdminCleanupInactiveAssets(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		logger.Info(fmt.Sprintf("Inactive assets cleanup completed: %d assets removed", len(machineIDs)))
+		logger.InfoContext(c.Request.Context(), "Inactive assets cleanup completed", "assets_removed", len(machineIDs))
+		audit.Record(c, db, models.AuditAssetCleanupInactive, "asset", "", gin.H{"machine_ids": machineIDs}, nil)
 		c.Redirect(http.StatusSeeOther, "/admin?cleanup_success=1")
 	}
 }
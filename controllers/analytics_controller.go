@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	"github.com/txlog/server/models"
 )
 
 // GetAnalyticsAnomalies returns the anomaly detection page
@@ -17,12 +19,30 @@ func GetAnalyticsAnomalies(database *sql.DB) gin.HandlerFunc {
 	}
 }
 
-// GetAnalyticsSecurity returns the security analysis page
+// GetAnalyticsSecurity returns the security analysis page. Users whose role
+// can scan vulnerabilities also get a button to start an OSV update.
 func GetAnalyticsSecurity(database *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		user := currentUser(c)
+		canScan := user == nil || user.Can(models.PermissionScanVulnerabilities)
+
 		c.HTML(http.StatusOK, "analytics_security.html", gin.H{
-			"Context": c,
-			"title":   "Security & Mitigations",
+			"Context":          c,
+			"title":            "Security & Mitigations",
+			"canScan":          canScan,
+			"osvIsRunning":     canScan && GetCronLockStatus(database, "vulnerabilities"),
+			"osvUpdateStarted": c.Query("osv_update_started") != "",
 		})
 	}
 }
+
+// PostSecurityRunOSVUpdate starts an OSV vulnerability update from the
+// security page, for security analysts without access to the admin panel.
+func PostSecurityRunOSVUpdate(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		importSchedulerFunc()
+		audit.Record(c, database, models.AuditOSVUpdate, "vulnerabilities", "", nil, nil)
+
+		c.Redirect(http.StatusSeeOther, "/analytics/security?osv_update_started=1")
+	}
+}
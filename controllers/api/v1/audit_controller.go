@@ -0,0 +1,125 @@
+package v1
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// auditCSVHeader lists the columns of the CSV export of the audit log.
+var auditCSVHeader = []string{
+	"id", "created_at", "actor_type", "actor_id", "actor_name", "action", "target_type", "target_id",
+	"success", "before", "after", "ip_address", "request_id",
+}
+
+// GetAudit exports the audit log
+//
+//	@Summary		Audit log export
+//	@Description	Returns the audit log of administrative and security-relevant actions, newest first, as JSON or CSV.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json,text/csv
+//	@Param			actor	query		string	false	"Part of the actor name (e-mail, API key name or hostname)"
+//	@Param			action	query		string	false	"Action, or a kind of action ending with a dot, as in user."
+//	@Param			target	query		string	false	"Target type or ID"
+//	@Param			search	query		string	false	"Text in the actor, target or states"
+//	@Param			failed	query		bool	false	"Only refused attempts, such as failed logins"
+//	@Param			from	query		string	false	"Start date (YYYY-MM-DD) or time (RFC 3339)"
+//	@Param			to		query		string	false	"End date (YYYY-MM-DD, included) or time (RFC 3339)"
+//	@Param			limit	query		int		false	"Maximum number of entries to return (1-10000, default 1000)"
+//	@Param			offset	query		int		false	"Number of entries to skip"
+//	@Param			format	query		string	false	"Response format: json (default) or csv"
+//	@Success		200		{array}		models.AuditEntry
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/v1/audit [get]
+func GetAudit(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := models.ParseAuditFilter(c.Query("actor"), c.Query("action"), c.Query("target"),
+			c.Query("search"), c.Query("failed"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter.Limit = 1000
+		if limitStr := c.Query("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 10000 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+				return
+			}
+			filter.Limit = parsed
+		}
+		if offsetStr := c.Query("offset"); offsetStr != "" {
+			parsed, err := strconv.Atoi(offsetStr)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset parameter"})
+				return
+			}
+			filter.Offset = parsed
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+
+		entries, total, err := models.NewAuditManager(database).List(filter)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error listing audit entries", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		if format == "json" {
+			c.JSON(http.StatusOK, entries)
+			return
+		}
+
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="txlog-audit.csv"`)
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write(auditCSVHeader)
+		for _, e := range entries {
+			w.Write(auditCSVRecord(e))
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error writing audit CSV", "error", err)
+		}
+	}
+}
+
+// auditCSVRecord returns the CSV columns of an audit entry.
+func auditCSVRecord(e models.AuditEntry) []string {
+	actorID := ""
+	if e.ActorID != nil {
+		actorID = strconv.Itoa(*e.ActorID)
+	}
+	return []string{
+		strconv.FormatInt(e.ID, 10), e.CreatedAt.UTC().Format(time.RFC3339), e.ActorType, actorID,
+		csvText(e.ActorName), e.Action, e.TargetType, csvText(e.TargetID), strconv.FormatBool(e.Success),
+		string(e.Before), string(e.After), e.IPAddress, e.RequestID,
+	}
+}
+
+// csvText quotes text that spreadsheets would run as a formula, such as the
+// username of a failed login.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
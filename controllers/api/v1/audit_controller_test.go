@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/models"
+)
+
+// The cases below are rejected before the database is touched, so no
+// connection is needed.
+func TestGetAudit_InvalidParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/audit", GetAudit(nil))
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"bad from", "/v1/audit?from=yesterday"},
+		{"reversed range", "/v1/audit?from=2026-10-19&to=2026-10-01"},
+		{"zero limit", "/v1/audit?limit=0"},
+		{"limit too large", "/v1/audit?limit=10001"},
+		{"negative offset", "/v1/audit?offset=-1"},
+		{"unknown format", "/v1/audit?format=xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuditCSVRecord(t *testing.T) {
+	actorID := 7
+	record := auditCSVRecord(models.AuditEntry{
+		ID:         3,
+		ActorType:  models.AuditActorAnonymous,
+		ActorName:  "=HYPERLINK(\"http://example.com\")",
+		Action:     models.AuditLogin,
+		TargetID:   "-1",
+		Before:     []byte(`{"is_active":true}`),
+		ActorID:    &actorID,
+		IPAddress:  "192.0.2.1",
+		TargetType: "user",
+	})
+
+	if len(record) != len(auditCSVHeader) {
+		t.Fatalf("record has %d columns, header %d", len(record), len(auditCSVHeader))
+	}
+	want := []string{"3", "0001-01-01T00:00:00Z", "anonymous", "7", "'=HYPERLINK(\"http://example.com\")", "auth.login",
+		"user", "'-1", "false", `{"is_active":true}`, "", "192.0.2.1", ""}
+	if !slices.Equal(record, want) {
+		t.Errorf("auditCSVRecord() = %q, want %q", record, want)
+	}
+}
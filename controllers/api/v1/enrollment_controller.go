@@ -0,0 +1,131 @@
+package v1
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	"github.com/txlog/server/audit"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+)
+
+// PostEnroll Enroll a machine
+//
+//	@Summary		Enroll a machine
+//	@Description	Exchanges an enrollment token for a credential bound to the machine ID and hostname, to be sent as X-API-Key on later requests. The credential can only upload data for that machine and is only returned once. A machine with an active credential cannot enroll again until an admin revokes it.
+//	@Tags			enrollment
+//	@Accept			json
+//	@Produce		json
+//	@Param			Enrollment	body		models.EnrollmentRequest	true	"Enrollment token and machine"
+//	@Success		201			{object}	models.EnrollmentResponse
+//	@Failure		400			{object}	map[string]string
+//	@Failure		401			{object}	map[string]string
+//	@Failure		409			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Router			/v1/enroll [post]
+func PostEnroll(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body models.EnrollmentRequest
+		data, err := c.GetRawData()
+		if err != nil || json.Unmarshal(data, &body) != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON input"})
+			return
+		}
+		body.MachineID = strings.TrimSpace(body.MachineID)
+		body.Hostname = strings.TrimSpace(body.Hostname)
+		if body.EnrollmentToken == "" || body.MachineID == "" || body.Hostname == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "enrollment_token, machine_id and hostname are required"})
+			return
+		}
+
+		ctx := logger.With(c.Request.Context(), "machine_id", body.MachineID, "hostname", body.Hostname)
+
+		credential, credentialHash, credentialPrefix, err := util.GenerateToken(util.MachineCredentialPrefix)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to generate machine credential", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		err = models.NewEnrollmentManager(database).Enroll(
+			util.HashAPIKey(body.EnrollmentToken), body.MachineID, body.Hostname, credentialHash, credentialPrefix,
+		)
+		switch {
+		case errors.Is(err, models.ErrInvalidEnrollmentToken):
+			logger.WarnContext(ctx, "Enrollment with invalid token", "client_ip", c.ClientIP())
+			audit.RecordFailure(c, database, models.AuditMachineEnroll, body.Hostname, "invalid_token")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid enrollment token."})
+			return
+		case errors.Is(err, models.ErrMachineAlreadyEnrolled):
+			logger.WarnContext(ctx, "Enrollment of a machine that is already enrolled", "client_ip", c.ClientIP())
+			audit.RecordFailure(c, database, models.AuditMachineEnroll, body.Hostname, "already_enrolled")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Machine already enrolled. An admin must revoke its credential first."})
+			return
+		case err != nil:
+			logger.ErrorContext(ctx, "Failed to enroll machine", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		logger.InfoContext(ctx, "Machine enrolled", "client_ip", c.ClientIP())
+		audit.Record(c, database, models.AuditMachineEnroll, "machine", body.MachineID, nil, gin.H{"hostname": body.Hostname, "credential_prefix": credentialPrefix})
+		c.JSON(http.StatusCreated, models.EnrollmentResponse{
+			MachineID:  body.MachineID,
+			Credential: credential,
+		})
+	}
+}
+
+// machineAllowed aborts the request with 403 when its caller may not submit
+// data for the host with machineID and hostname: machine credentials and
+// client certificates only for their own host, and API keys not for
+// machines that have enrolled, which must use their credential. Sessions
+// and requests without authentication are allowed.
+func machineAllowed(c *gin.Context, database *sql.DB, machineID, hostname string) bool {
+	if value, exists := c.Get("client_certificate"); exists {
+		identity := value.(*models.CertificateIdentity)
+		if !identity.Allows(machineID, hostname) {
+			logger.WarnContext(c.Request.Context(), "Client certificate used for another machine", "machine_id", machineID, "hostname", hostname, "client_certificate", identity.Name())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Client certificate is not valid for this " + identity.Field + "."})
+			return false
+		}
+		return true
+	}
+
+	if value, exists := c.Get("machine_credential"); exists {
+		credential := value.(*models.MachineCredential)
+		if credential.MachineID != machineID {
+			logger.WarnContext(c.Request.Context(), "Machine credential used for another machine", "machine_id", machineID, "credential_machine_id", credential.MachineID)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Machine credential is not valid for this machine_id."})
+			return false
+		}
+		if !strings.EqualFold(strings.TrimSpace(hostname), credential.Hostname) {
+			logger.WarnContext(c.Request.Context(), "Machine credential used for another hostname", "machine_id", machineID, "hostname", hostname, "credential_hostname", credential.Hostname)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Machine credential is not valid for this hostname."})
+			return false
+		}
+		return true
+	}
+
+	if _, exists := c.Get("api_key"); !exists {
+		return true
+	}
+	enrolled, err := models.NewEnrollmentManager(database).IsEnrolled(machineID)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Error checking machine enrollment", "machine_id", machineID, "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if enrolled {
+		logger.WarnContext(c.Request.Context(), "API key used for an enrolled machine", "machine_id", machineID)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Machine is enrolled and must use its machine credential."})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/models"
+)
+
+// The cases below are rejected before the database is touched, so no
+// connection is needed.
+func TestPostEnroll_InvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/enroll", PostEnroll(nil))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", `{"enrollment_token":`},
+		{"missing token", `{"machine_id":"abc","hostname":"web01"}`},
+		{"missing machine_id", `{"enrollment_token":"txlog_et_x","hostname":"web01"}`},
+		{"blank hostname", `{"enrollment_token":"txlog_et_x","machine_id":"abc","hostname":"  "}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v1/enroll", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostTransactions_OtherMachineCredential(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("machine_credential", &models.MachineCredential{ID: 1, MachineID: "machine-a"})
+	})
+	router.POST("/v1/transactions", PostTransactions(nil))
+	router.POST("/v1/executions", PostExecutions(nil))
+
+	for _, url := range []string{"/v1/transactions", "/v1/executions"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, bytes.NewBufferString(`{"machine_id":"machine-b","hostname":"web02"}`))
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status %d, got %d: %s", url, http.StatusForbidden, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPostTransactions_OtherHostnameCredential(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("machine_credential", &models.MachineCredential{ID: 1, MachineID: "machine-a", Hostname: "web01"})
+	})
+	router.POST("/v1/transactions", PostTransactions(nil))
+	router.POST("/v1/executions", PostExecutions(nil))
+
+	for _, url := range []string{"/v1/transactions", "/v1/executions"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, bytes.NewBufferString(`{"machine_id":"machine-a","hostname":"web02"}`))
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status %d, got %d: %s", url, http.StatusForbidden, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPostTransactions_OtherHostCertificate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("client_certificate", &models.CertificateIdentity{Names: []string{"web01.example.com"}, Field: models.CertificateIdentityHostname})
+	})
+	router.POST("/v1/transactions", PostTransactions(nil))
+	router.POST("/v1/executions", PostExecutions(nil))
+
+	for _, url := range []string{"/v1/transactions", "/v1/executions"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, bytes.NewBufferString(`{"machine_id":"machine-b","hostname":"web02.example.com"}`))
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status %d, got %d: %s", url, http.StatusForbidden, w.Code, w.Body.String())
+		}
+	}
+}
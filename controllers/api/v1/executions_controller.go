@@ -38,10 +38,16 @@ func PostExecutions(database *sql.DB) gin.HandlerFunc {
 		err = json.Unmarshal(data, &body)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid JSON input")
-			logger.Error("Invalid JSON input:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Invalid JSON input", "error", err)
 			return
 		}
 
+		if !machineAllowed(c, database, body.MachineID, body.Hostname) {
+			return
+		}
+
+		ctx := logger.With(c.Request.Context(), "machine_id", body.MachineID, "hostname", body.Hostname)
+
 		// Convert *time.Time to sql.NullTime
 		var executedAt sql.NullTime
 		if body.ExecutedAt != nil {
@@ -66,7 +72,7 @@ func PostExecutions(database *sql.DB) gin.HandlerFunc {
 		// Start database transaction
 		tx, err := database.BeginTx(c.Request.Context(), nil)
 		if err != nil {
-			logger.Error("Error beginning transaction:" + err.Error())
+			logger.ErrorContext(ctx, "Error beginning transaction", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
@@ -94,7 +100,7 @@ func PostExecutions(database *sql.DB) gin.HandlerFunc {
 
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Error inserting execution:" + err.Error())
+			logger.ErrorContext(ctx, "Error inserting execution", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
@@ -108,7 +114,7 @@ func PostExecutions(database *sql.DB) gin.HandlerFunc {
 		err = assetManager.UpsertAsset(tx, body.Hostname, body.MachineID, *timestamp, needsRestarting, restartingReason, body.OS, body.AgentVersion)
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Error upserting asset:" + err.Error())
+			logger.ErrorContext(ctx, "Error upserting asset", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update asset registry"})
 			return
 		}
@@ -116,7 +122,7 @@ func PostExecutions(database *sql.DB) gin.HandlerFunc {
 		// Commit the database transaction
 		if err = tx.Commit(); err != nil {
 			tx.Rollback()
-			logger.Error("Error committing execution:" + err.Error())
+			logger.ErrorContext(ctx, "Error committing execution", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
@@ -190,7 +196,7 @@ func GetExecutions(database *sql.DB) gin.HandlerFunc {
 		}
 
 		if err != nil {
-			logger.Error("Error querying executions:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying executions", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -217,7 +223,7 @@ func GetExecutions(database *sql.DB) gin.HandlerFunc {
 			execution.AgentVersion = agentVersion.String
 			execution.OS = os.String
 			if err != nil {
-				logger.Error("Error iterating executions:" + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating executions", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 				return
 			}
@@ -0,0 +1,118 @@
+package v1
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// GetAnsibleInventory returns the active assets as an Ansible dynamic inventory
+//
+//	@Summary		Ansible dynamic inventory
+//	@Description	Returns every active asset in the Ansible dynamic inventory script format (--list), including _meta.hostvars. Hosts are grouped by topology environment (env_*), service (svc_*) and pod (pod_<env>_<service>_<pod>), OS (os_*), agent version (agent_*), restart flag (needs_restarting) and labels (label_<name>_<value>). Host variables are prefixed with txlog_.
+//	@Tags			inventory
+//	@Produce		json
+//	@Success		200	{object}	interface{}
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/v1/inventory/ansible [get]
+func GetAnsibleInventory(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hosts, err := models.NewInventoryManager(database).ListHosts(c.Request.Context(), models.InventoryFilter{})
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error listing inventory hosts", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.BuildAnsibleInventory(inRequestScope(c, hosts)))
+	}
+}
+
+// defaultPrometheusPort is the node_exporter port.
+const defaultPrometheusPort = 9100
+
+// GetPrometheusTargets returns the active assets as Prometheus scrape targets
+//
+//	@Summary		Prometheus HTTP service discovery
+//	@Description	Returns the active assets in the Prometheus http_sd_config format, one target group per asset scraping hostname:port. Asset details are exposed as __meta_txlog_* labels (hostname, machine_id, environment, service, pod, os, agent_version, needs_restarting, critical_cves and label_<name>) for relabeling.
+//	@Tags			inventory
+//	@Produce		json
+//	@Param			port				query		int		false	"Port of each target (default 9100)"
+//	@Param			env					query		string	false	"Only include assets of this environment (friendly name or :env value)"
+//	@Param			svc					query		string	false	"Only include assets of this service (friendly name or :svc value)"
+//	@Param			pod					query		string	false	"Only include assets of this pod"
+//	@Param			os					query		string	false	"Only include assets running this OS"
+//	@Param			agent_version		query		string	false	"Only include assets running this agent version"
+//	@Param			needs_restarting	query		bool	false	"Only include assets that need (true) or do not need (false) a restart"
+//	@Success		200	{array}		models.PrometheusTargetGroup
+//	@Failure		400	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/v1/inventory/prometheus [get]
+func GetPrometheusTargets(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		port := defaultPrometheusPort
+		if portStr := c.Query("port"); portStr != "" {
+			parsed, err := strconv.Atoi(portStr)
+			if err != nil || parsed < 1 || parsed > 65535 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid port parameter"})
+				return
+			}
+			port = parsed
+		}
+
+		filter := models.InventoryFilter{
+			Environment:  c.Query("env"),
+			Service:      c.Query("svc"),
+			Pod:          c.Query("pod"),
+			OS:           c.Query("os"),
+			AgentVersion: c.Query("agent_version"),
+		}
+		if restartStr := c.Query("needs_restarting"); restartStr != "" {
+			needsRestarting, err := strconv.ParseBool(restartStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid needs_restarting parameter"})
+				return
+			}
+			filter.NeedsRestarting = &needsRestarting
+		}
+
+		hosts, err := models.NewInventoryManager(database).ListHosts(c.Request.Context(), filter)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error listing inventory hosts", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.BuildPrometheusTargets(inRequestScope(c, hosts), port))
+	}
+}
+
+// inRequestScope returns the hosts of the environment the request's API key
+// is bound to, and of the scope of the signed-in user, or all hosts when
+// neither is restricted.
+func inRequestScope(c *gin.Context, hosts []models.InventoryHost) []models.InventoryHost {
+	environment := c.GetString("api_key_environment")
+	var scope models.AccessScope
+	if value, exists := c.Get("user"); exists {
+		scope = value.(*models.User).Scope
+	}
+	if environment == "" && !scope.Restricted() {
+		return hosts
+	}
+
+	filter := models.InventoryFilter{Environment: environment}
+	var matched []models.InventoryHost
+	for _, h := range hosts {
+		if filter.Matches(h) && scope.AcceptsTopology(h.Topology) {
+			matched = append(matched, h)
+		}
+	}
+	return matched
+}
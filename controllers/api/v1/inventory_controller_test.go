@@ -0,0 +1,39 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The cases below are rejected before the database is touched, so no
+// connection is needed.
+func TestPrometheusTargets_InvalidParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/inventory/prometheus", GetPrometheusTargets(nil))
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"non-numeric port", "/v1/inventory/prometheus?port=http"},
+		{"zero port", "/v1/inventory/prometheus?port=0"},
+		{"port too large", "/v1/inventory/prometheus?port=65536"},
+		{"invalid needs_restarting", "/v1/inventory/prometheus?needs_restarting=maybe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
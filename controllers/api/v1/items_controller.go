@@ -59,7 +59,7 @@ func GetItemIDs(database *sql.DB) gin.HandlerFunc {
 			transactionID,
 		)
 		if err != nil {
-			logger.Error("Couldn't get saved item_ids for this transaction: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Couldn't get saved item_ids for this transaction", "error", err)
 			c.AbortWithStatusJSON(http.StatusBadRequest, "Couldn't get saved item_ids for this transaction.")
 			return
 		}
@@ -69,7 +69,7 @@ func GetItemIDs(database *sql.DB) gin.HandlerFunc {
 		for rows.Next() {
 			var id int
 			if err := rows.Scan(&id); err != nil {
-				logger.Error("Error scanning transaction_ids: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error scanning transaction_ids", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, "Error scanning transaction_ids")
 				return
 			}
@@ -166,7 +166,7 @@ func GetItems(database *sql.DB) gin.HandlerFunc {
 			return
 		}
 		if err != nil {
-			logger.Error("Error querying transaction: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying transaction", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -199,7 +199,7 @@ func GetItems(database *sql.DB) gin.HandlerFunc {
 		)
 
 		if err != nil {
-			logger.Error("Error querying items: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying items", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -219,7 +219,7 @@ func GetItems(database *sql.DB) gin.HandlerFunc {
 			)
 
 			if err != nil {
-				logger.Error("Error reading transaction item: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error reading transaction item", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 				return
 			}
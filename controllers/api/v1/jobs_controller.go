@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// GetVulnerabilityJobRuns returns the run history of the vulnerabilities job
+//
+//	@Summary		Vulnerability job run history
+//	@Description	Returns the most recent runs of the OSV vulnerabilities job, newest first. A run with status "running" carries live progress (phase, progress_current, progress_total).
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int	false	"Maximum number of runs to return (1-100, default 20)"
+//	@Success		200		{array}		models.JobRun
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/v1/admin/jobs/vulnerabilities/runs [get]
+func GetVulnerabilityJobRuns(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 20
+		if limitStr := c.Query("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+				return
+			}
+			limit = parsed
+		}
+
+		runs, err := models.NewJobRunManager(database).List("vulnerabilities", limit)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error listing vulnerability job runs", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, runs)
+	}
+}
@@ -53,7 +53,7 @@ func GetMachines(database *sql.DB) gin.HandlerFunc {
 		var paramCount int
 
 		if os != "" {
-			logger.Debug("os: " + os)
+			logger.DebugContext(c.Request.Context(), "Filtering assets by OS", "os", os)
 			if os == "Undefined OS" {
 				os = ""
 			}
@@ -67,7 +67,7 @@ func GetMachines(database *sql.DB) gin.HandlerFunc {
 		}
 
 		if agentVersion != "" {
-			logger.Debug("agent_version: " + agentVersion)
+			logger.DebugContext(c.Request.Context(), "Filtering assets by agent version", "agent_version", agentVersion)
 			if agentVersion == "with undefined version" {
 				agentVersion = ""
 			}
@@ -91,7 +91,7 @@ func GetMachines(database *sql.DB) gin.HandlerFunc {
 		if err != nil && agentVersion != "" {
 			pqErr, ok := err.(*pq.Error)
 			if ok && pqErr.Code == "42703" { // undefined_column
-				logger.Info("Falling back to executions table for agent_version filter")
+				logger.InfoContext(c.Request.Context(), "Falling back to executions table for agent_version filter")
 				query = `
     SELECT
       a.hostname,
@@ -141,7 +141,7 @@ func GetMachines(database *sql.DB) gin.HandlerFunc {
 		}
 
 		if err != nil {
-			logger.Error("Error querying assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying assets", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -155,7 +155,7 @@ func GetMachines(database *sql.DB) gin.HandlerFunc {
 				&machine.MachineID,
 			)
 			if err != nil {
-				logger.Error("Error iterating assets: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating assets", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 				return
 			}
@@ -196,7 +196,7 @@ func GetAssetsRequiringRestart(database *sql.DB) gin.HandlerFunc {
 		rows, err = database.QueryContext(c.Request.Context(), query)
 
 		if err != nil {
-			logger.Error("Error querying assets that require a restart: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying assets that require a restart", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -210,7 +210,7 @@ func GetAssetsRequiringRestart(database *sql.DB) gin.HandlerFunc {
 				&machine.MachineID,
 			)
 			if err != nil {
-				logger.Error("Error iterating assets: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating assets", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 				return
 			}
@@ -242,7 +242,7 @@ func GetMachineIDs(database *sql.DB) gin.HandlerFunc {
 		)
 
 		if err != nil {
-			logger.Error("Error querying machine_id: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying machine_id", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -258,7 +258,7 @@ func GetMachineIDs(database *sql.DB) gin.HandlerFunc {
 				&firstSeen,
 			)
 			if err != nil {
-				logger.Error("Error iterating machine_id: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating machine_id", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 				return
 			}
@@ -63,14 +63,14 @@ func GetMonthlyReport(database *sql.DB) gin.HandlerFunc {
 
 		packages, err := getMonthlyPackageReport(c.Request.Context(), database, month, year)
 		if err != nil {
-			logger.Error("Error getting monthly package report: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error getting monthly package report", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
 
 		assetCount, err := getTotalActiveAssetsForReport(c.Request.Context(), database)
 		if err != nil {
-			logger.Error("Error getting total active assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error getting total active assets", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -200,7 +200,7 @@ func GetFixedVulnerabilities(database *sql.DB) gin.HandlerFunc {
 		`
 		rows, err := database.QueryContext(c.Request.Context(), query, days)
 		if err != nil {
-			logger.Error("Error getting vulnerability series: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error getting vulnerability series", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query vulnerabilities series"})
 			return
 		}
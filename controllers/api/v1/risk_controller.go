@@ -0,0 +1,157 @@
+package v1
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// RiskResponse represents the response for the risk ranking endpoint
+type RiskResponse struct {
+	ComputedAt *time.Time         `json:"computed_at"`
+	Level      string             `json:"level"`
+	Items      []models.RiskGroup `json:"items"`
+}
+
+// RiskHistoryResponse represents the response for the risk history endpoint
+type RiskHistoryResponse struct {
+	Level       string                    `json:"level"`
+	Environment string                    `json:"environment,omitempty"`
+	Service     string                    `json:"service,omitempty"`
+	Pod         string                    `json:"pod,omitempty"`
+	Points      []models.RiskHistoryPoint `json:"points"`
+}
+
+// GetRisk returns the riskiest topology groups
+//
+//	@Summary		Risk ranking
+//	@Description	Returns the current risk score of topology groups (or single assets), highest first. An asset's score is the sum of CVSS x exploitability factor over its open vulnerabilities, multiplied by its criticality label weight; groups sum the scores of their assets.
+//	@Tags			risk
+//	@Accept			json
+//	@Produce		json
+//	@Param			level	query		string	false	"Aggregation level: fleet, environment, service (default), pod or asset"
+//	@Param			env		query		string	false	"Only include assets of this environment (match value)"
+//	@Param			svc		query		string	false	"Only include assets of this service (match value)"
+//	@Param			limit	query		int		false	"Maximum number of groups to return (1-500, default 20)"
+//	@Success		200		{object}	RiskResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/v1/risk [get]
+func GetRisk(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		level := c.DefaultQuery("level", models.RiskLevelService)
+		if !models.IsValidRiskLevel(level) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid level parameter"})
+			return
+		}
+
+		limit := 20
+		if limitStr := c.Query("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 500 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+				return
+			}
+			limit = parsed
+		}
+
+		rm := models.NewRiskManager(database)
+		items, err := rm.Rank(level, c.Query("env"), c.Query("svc"), limit)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error ranking risk", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		computedAt, err := rm.LastComputedAt()
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error reading risk computation time", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, RiskResponse{
+			ComputedAt: computedAt,
+			Level:      level,
+			Items:      items,
+		})
+	}
+}
+
+// GetRiskHistory returns the daily risk snapshots of a topology group
+//
+//	@Summary		Risk history
+//	@Description	Returns one point per day with the risk score of a topology group, oldest first, for trend charts. The group is identified by level plus the env, svc and pod parameters that level requires.
+//	@Tags			risk
+//	@Accept			json
+//	@Produce		json
+//	@Param			level	query		string	false	"Aggregation level: fleet (default), environment, service or pod"
+//	@Param			env		query		string	false	"Environment match value (required for environment, service and pod)"
+//	@Param			svc		query		string	false	"Service match value (required for service and pod)"
+//	@Param			pod		query		string	false	"Pod identifier (required for pod)"
+//	@Param			days	query		int		false	"Number of days to return (1-365, default 30)"
+//	@Success		200		{object}	RiskHistoryResponse
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/v1/risk/history [get]
+func GetRiskHistory(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		level := c.DefaultQuery("level", models.RiskLevelFleet)
+		if !models.IsValidRiskLevel(level) || level == models.RiskLevelAsset {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid level parameter"})
+			return
+		}
+
+		days := 30
+		if daysStr := c.Query("days"); daysStr != "" {
+			parsed, err := strconv.Atoi(daysStr)
+			if err != nil || parsed < 1 || parsed > 365 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days parameter"})
+				return
+			}
+			days = parsed
+		}
+
+		resp := RiskHistoryResponse{Level: level}
+		switch level {
+		case models.RiskLevelPod:
+			resp.Pod = c.Query("pod")
+			if resp.Pod == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "pod parameter is required"})
+				return
+			}
+			fallthrough
+		case models.RiskLevelService:
+			resp.Service = c.Query("svc")
+			if resp.Service == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "svc parameter is required"})
+				return
+			}
+			fallthrough
+		case models.RiskLevelEnvironment:
+			resp.Environment = c.Query("env")
+			if resp.Environment == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "env parameter is required"})
+				return
+			}
+		}
+
+		points, err := models.NewRiskManager(database).History(level, resp.Environment, resp.Service, resp.Pod, days)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error reading risk history", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		resp.Points = points
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
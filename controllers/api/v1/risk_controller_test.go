@@ -0,0 +1,45 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The cases below are rejected before the database is touched, so no
+// connection is needed.
+func TestRiskEndpoints_InvalidParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/risk", GetRisk(nil))
+	router.GET("/v1/risk/history", GetRiskHistory(nil))
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"unknown level", "/v1/risk?level=galaxy"},
+		{"zero limit", "/v1/risk?limit=0"},
+		{"limit too large", "/v1/risk?limit=501"},
+		{"non-numeric limit", "/v1/risk?limit=abc"},
+		{"history asset level", "/v1/risk/history?level=asset"},
+		{"history days too large", "/v1/risk/history?days=366"},
+		{"history environment without env", "/v1/risk/history?level=environment"},
+		{"history service without svc", "/v1/risk/history?level=service&env=prd"},
+		{"history pod without pod", "/v1/risk/history?level=pod&env=prd&svc=web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
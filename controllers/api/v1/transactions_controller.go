@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/txlog/server/forwarder"
 	"github.com/txlog/server/models"
 
 	"github.com/gin-gonic/gin"
@@ -45,7 +46,7 @@ func GetTransactionIDs(database *sql.DB) gin.HandlerFunc {
 				err = json.Unmarshal(data, &body)
 				if err != nil {
 					c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid JSON input")
-					logger.Error("Invalid JSON input: " + err.Error())
+					logger.ErrorContext(c.Request.Context(), "Invalid JSON input", "error", err)
 					return
 				}
 				machineID = body.MachineID
@@ -53,6 +54,12 @@ func GetTransactionIDs(database *sql.DB) gin.HandlerFunc {
 			}
 		}
 
+		if !machineAllowed(c, database, machineID, hostname) {
+			return
+		}
+
+		ctx := logger.With(c.Request.Context(), "machine_id", machineID, "hostname", hostname)
+
 		rows, err := database.QueryContext(c.Request.Context(), `
       SELECT transaction_id
       FROM public.transactions
@@ -63,7 +70,7 @@ func GetTransactionIDs(database *sql.DB) gin.HandlerFunc {
 			hostname,
 		)
 		if err != nil {
-			logger.Error("Couldn't get saved transaction_ids for this host: " + err.Error())
+			logger.ErrorContext(ctx, "Couldn't get saved transaction_ids for this host", "error", err)
 			c.AbortWithStatusJSON(http.StatusBadRequest, "Couldn't get saved transaction_ids for this host.")
 			return
 		}
@@ -73,7 +80,7 @@ func GetTransactionIDs(database *sql.DB) gin.HandlerFunc {
 		for rows.Next() {
 			var id int
 			if err := rows.Scan(&id); err != nil {
-				logger.Error("Error scanning transaction_ids: " + err.Error())
+				logger.ErrorContext(ctx, "Error scanning transaction_ids", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, "Error scanning transaction_ids")
 				return
 			}
@@ -137,7 +144,7 @@ func GetTransactions(database *sql.DB) gin.HandlerFunc {
 		)
 
 		if err != nil {
-			logger.Error("Error querying transactions: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying transactions", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -164,7 +171,7 @@ func GetTransactions(database *sql.DB) gin.HandlerFunc {
 			)
 
 			if err != nil {
-				logger.Error("Error iterating transactions: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating transactions", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 				return
 			}
@@ -206,10 +213,16 @@ func PostTransactions(database *sql.DB) gin.HandlerFunc {
 		err = json.Unmarshal(data, &body)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid JSON input")
-			logger.Error("Invalid JSON input: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Invalid JSON input", "error", err)
+			return
+		}
+
+		if !machineAllowed(c, database, body.MachineID, body.Hostname) {
 			return
 		}
 
+		ctx := logger.With(c.Request.Context(), "machine_id", body.MachineID, "hostname", body.Hostname, "transaction_id", body.TransactionID)
+
 		// Convert *time.Time to sql.NullTime
 		var beginTime sql.NullTime
 		if body.BeginTime != nil {
@@ -226,7 +239,7 @@ func PostTransactions(database *sql.DB) gin.HandlerFunc {
 		// Start database transaction
 		tx, err := database.BeginTx(c.Request.Context(), nil)
 		if err != nil {
-			logger.Error("Error beginning transaction: " + err.Error())
+			logger.ErrorContext(ctx, "Error beginning transaction", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
@@ -256,7 +269,7 @@ func PostTransactions(database *sql.DB) gin.HandlerFunc {
 
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Error inserting transaction: " + err.Error())
+			logger.ErrorContext(ctx, "Error inserting transaction", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
@@ -264,7 +277,7 @@ func PostTransactions(database *sql.DB) gin.HandlerFunc {
 		rowsAffected, err := result.RowsAffected()
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Error checking rows affected: " + err.Error())
+			logger.ErrorContext(ctx, "Error checking rows affected", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
@@ -297,7 +310,7 @@ func PostTransactions(database *sql.DB) gin.HandlerFunc {
 			_, err = tx.Exec(query, valueArgs...)
 			if err != nil {
 				tx.Rollback()
-				logger.Error("Error inserting transaction items: " + err.Error())
+				logger.ErrorContext(ctx, "Error inserting transaction items", "error", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 				return
 			}
@@ -312,19 +325,43 @@ func PostTransactions(database *sql.DB) gin.HandlerFunc {
 		err = assetManager.UpsertAsset(tx, body.Hostname, body.MachineID, *timestamp, sql.NullBool{}, sql.NullString{}, "", "")
 		if err != nil {
 			tx.Rollback()
-			logger.Error("Error upserting asset:" + err.Error())
+			logger.ErrorContext(ctx, "Error upserting asset", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update asset registry"})
 			return
 		}
 
+		// Queue webhook events; they are only delivered if the commit succeeds
+		err = models.EnqueueWebhookEvent(tx, models.WebhookEventTransactionIngested, models.WebhookTransactionData{
+			TransactionID: body.TransactionID,
+			MachineID:     body.MachineID,
+			Hostname:      body.Hostname,
+			BeginTime:     body.BeginTime,
+			EndTime:       body.EndTime,
+			Actions:       body.Actions,
+			User:          body.User,
+			CommandLine:   body.CommandLine,
+			ReturnCode:    body.ReturnCode,
+			ItemCount:     len(body.Items),
+		})
+		if err != nil {
+			logger.WarnContext(ctx, "Error queuing transaction webhook event", "error", err)
+		}
+		for _, anomaly := range models.TransactionAnomalies(body) {
+			if err := models.EnqueueWebhookEvent(tx, models.WebhookEventAnomalyDetected, anomaly); err != nil {
+				logger.WarnContext(ctx, "Error queuing anomaly webhook event", "error", err)
+			}
+		}
+
 		// Commit the database transaction
 		if err = tx.Commit(); err != nil {
 			tx.Rollback()
-			logger.Error("Error committing transaction: " + err.Error())
+			logger.ErrorContext(ctx, "Error committing transaction", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
 
+		forwarder.Publish(forwarder.TransactionEvents(body)...)
+
 		c.JSON(http.StatusOK, gin.H{"message": "Transaction created"})
 	}
 }
@@ -53,7 +53,7 @@ func GetTransactionVulnerabilities(database *sql.DB) gin.HandlerFunc {
 		)
 
 		if err != nil {
-			logger.Error("Error querying transaction vulnerabilities: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error querying transaction vulnerabilities", "error", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -63,7 +63,7 @@ func GetTransactionVulnerabilities(database *sql.DB) gin.HandlerFunc {
 		for rows.Next() {
 			var v TransactionVulnerability
 			if err := rows.Scan(&v.ID, &v.Summary, &v.Severity, &v.CvssScore, &v.Package, &v.Version, &v.Type); err != nil {
-				logger.Error("Error scanning vulnerability: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error scanning vulnerability", "error", err)
 				continue
 			}
 			vulns = append(vulns, v)
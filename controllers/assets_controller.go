@@ -2,12 +2,13 @@ package controllers
 
 import (
 	"database/sql"
-	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/txlog/server/audit"
 	logger "github.com/txlog/server/logger"
 	"github.com/txlog/server/models"
 	"github.com/txlog/server/util"
@@ -141,6 +142,21 @@ func GetAssetsIndex(database *sql.DB) gin.HandlerFunc {
 			whereClause += " AND last_seen < NOW() - INTERVAL '15 days'"
 		}
 
+		// Users restricted to some environments or services only see their assets
+		hostnames, scoped, err := scopedHostnames(c, database)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error resolving assets in the user's scope", "error", err)
+			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if scoped {
+			whereClause += " AND hostname = ANY($" + strconv.Itoa(paramNum) + ")"
+			queryArgs = append(queryArgs, pq.Array(hostnames))
+			paramNum++
+		}
+
 		// Count query - direct on assets table (no LATERAL JOIN needed since os is now stored in assets)
 		countQuery := `
 			SELECT COUNT(DISTINCT hostname)
@@ -149,7 +165,7 @@ func GetAssetsIndex(database *sql.DB) gin.HandlerFunc {
 
 		err = database.QueryRowContext(c.Request.Context(), countQuery, queryArgs...).Scan(&total)
 		if err != nil {
-			logger.Error("Error counting assets:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error counting assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"error": err.Error(),
 			})
@@ -177,7 +193,7 @@ func GetAssetsIndex(database *sql.DB) gin.HandlerFunc {
 		rows, err = database.QueryContext(c.Request.Context(), selectQuery, queryArgs...)
 
 		if err != nil {
-			logger.Error("Error listing assets:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error listing assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"error": err.Error(),
 			})
@@ -199,7 +215,7 @@ func GetAssetsIndex(database *sql.DB) gin.HandlerFunc {
 				&asset.NeedsRestarting,
 			)
 			if err != nil {
-				logger.Error("Error iterating assets:" + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating assets", "error", err)
 				c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 					"error": err.Error(),
 				})
@@ -223,7 +239,7 @@ func GetAssetsIndex(database *sql.DB) gin.HandlerFunc {
       FROM statistics;`)
 
 		if err != nil {
-			logger.Error("Error listing executions:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error listing executions", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"error": err.Error(),
 			})
@@ -243,7 +259,7 @@ func GetAssetsIndex(database *sql.DB) gin.HandlerFunc {
 				&statistic.UpdatedAt,
 			)
 			if err != nil {
-				logger.Error("Error iterating machine_id:" + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating machine_id", "error", err)
 				c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 					"error": err.Error(),
 				})
@@ -292,6 +308,28 @@ func DeleteMachineID(database *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Operators can only delete the assets in their scope
+		var hostname string
+		err := database.QueryRowContext(c.Request.Context(), `
+			SELECT hostname FROM assets WHERE machine_id = $1 ORDER BY is_active DESC LIMIT 1
+		`, machineID).Scan(&hostname)
+		if err != nil && err != sql.ErrNoRows {
+			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if inScope, err := assetInScope(c, database, hostname); err != nil || !inScope {
+			if err != nil {
+				logger.ErrorContext(c.Request.Context(), "Error resolving asset scope", "error", err)
+			}
+			c.HTML(http.StatusNotFound, "404.html", gin.H{
+				"Context": c,
+				"title":   "Not Found",
+			})
+			return
+		}
+
 		tx, err := database.BeginTx(c.Request.Context(), nil)
 		if err != nil {
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
@@ -302,7 +340,7 @@ func DeleteMachineID(database *sql.DB) gin.HandlerFunc {
 		defer func() {
 			if p := recover(); p != nil {
 				tx.Rollback()
-				logger.Error(fmt.Sprintf("Critical panic caught deleting machine %s: %v", machineID, p))
+				logger.ErrorContext(c.Request.Context(), "Critical panic caught deleting machine", "machine_id", machineID, "panic", p)
 				panic(p)
 			}
 		}()
@@ -350,6 +388,7 @@ func DeleteMachineID(database *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		audit.Record(c, database, models.AuditAssetDelete, "asset", machineID, gin.H{"hostname": hostname}, nil)
 		c.Redirect(http.StatusSeeOther, "/assets")
 
 	}
@@ -406,6 +445,17 @@ func GetMachineID(database *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Assets outside the user's scope are not found
+		if inScope, err := assetInScope(c, database, hostname); err != nil || !inScope {
+			if err != nil {
+				logger.ErrorContext(c.Request.Context(), "Error resolving asset scope", "error", err)
+			}
+			c.HTML(http.StatusNotFound, "404.html", gin.H{
+				"error": "Asset ID not found",
+			})
+			return
+		}
+
 		rows, err := database.QueryContext(c.Request.Context(), `
       SELECT id, machine_id, hostname, executed_at, success,
         details, transactions_processed, transactions_sent,
@@ -592,6 +642,24 @@ func GetMachineID(database *sql.DB) gin.HandlerFunc {
 			displayNeedsRestarting = false
 		}
 
+		// Risk score and criticality label. Both are optional: a missing
+		// score only means the risk job has not run since the asset appeared.
+		rm := models.NewRiskManager(database)
+		risk, err := rm.GetAssetRisk(machineID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error loading asset risk", "error", err)
+		}
+		labels, err := rm.GetAssetLabels(hostname)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error loading asset labels", "error", err)
+		}
+		criticality := labels[models.CriticalityLabel]
+		if criticality == "" {
+			criticality = models.DefaultCriticality
+		}
+
+		user := currentUser(c)
+
 		c.HTML(http.StatusOK, "machine_id.html", gin.H{
 			"Context":           c,
 			"title":             "Assets",
@@ -602,10 +670,87 @@ func GetMachineID(database *sql.DB) gin.HandlerFunc {
 			"other_assets":      otherAssets,
 			"needs_restarting":  displayNeedsRestarting,
 			"restarting_reason": restartingReason.String,
+			"risk":              risk,
+			"criticality":       criticality,
+			"criticalities":     models.Criticalities,
+			"canManage":         user == nil || user.Can(models.PermissionManageAssets),
 		})
 	}
 }
 
+// PostAdminAssetLabel sets a label on the logical asset (hostname) behind the
+// given machine ID and redirects back to the asset page. Form fields are
+// "name" and "value"; an empty value removes the label. The criticality label
+// only accepts low, medium, high or critical. The asset risk score picks up
+// the change on the next risk recalculation.
+func PostAdminAssetLabel(database *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		machineID := c.Param("machine_id")
+		name := strings.TrimSpace(c.PostForm("name"))
+		value := strings.TrimSpace(c.PostForm("value"))
+
+		if name == "" || len(name) > 63 || len(value) > 255 {
+			c.HTML(http.StatusBadRequest, "500.html", gin.H{
+				"error": "Invalid label name or value",
+			})
+			return
+		}
+		if name == models.CriticalityLabel && value != "" && !models.IsValidCriticality(value) {
+			c.HTML(http.StatusBadRequest, "500.html", gin.H{
+				"error": "Criticality must be one of: " + strings.Join(models.Criticalities, ", "),
+			})
+			return
+		}
+
+		var hostname string
+		err := database.QueryRowContext(c.Request.Context(), `
+			SELECT hostname FROM assets WHERE machine_id = $1 ORDER BY is_active DESC LIMIT 1
+		`, machineID).Scan(&hostname)
+		if err == sql.ErrNoRows {
+			c.HTML(http.StatusNotFound, "404.html", gin.H{
+				"Context": c,
+				"title":   "Not Found",
+			})
+			return
+		}
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if inScope, err := assetInScope(c, database, hostname); err != nil || !inScope {
+			if err != nil {
+				logger.ErrorContext(c.Request.Context(), "Error resolving asset scope", "error", err)
+			}
+			c.HTML(http.StatusNotFound, "404.html", gin.H{
+				"Context": c,
+				"title":   "Not Found",
+			})
+			return
+		}
+
+		rm := models.NewRiskManager(database)
+		labels, err := rm.GetAssetLabels(hostname)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error loading asset labels", "error", err)
+		}
+
+		if err := rm.SetAssetLabel(hostname, name, value); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error saving asset label", "error", err)
+			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		audit.Record(c, database, models.AuditAssetLabelsUpdate, "asset", machineID,
+			gin.H{"hostname": hostname, "name": name, "value": labels[name]},
+			gin.H{"hostname": hostname, "name": name, "value": value})
+		c.Redirect(http.StatusFound, "/assets/"+machineID)
+	}
+}
+
 // extractKeyword finds and removes a "prefix<value>" token from the search string.
 // The value is terminated by a space or end of string.
 // Returns the extracted value (trimmed) and modifies *search in-place.
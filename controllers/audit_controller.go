@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// GetAdminAudit renders the audit log, newest first, with the filters of
+// models.ParseAuditFilter as query parameters and 50 entries per page.
+func GetAdminAudit(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		page := 1
+		if p, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && p > 0 {
+			page = p
+		}
+
+		data := gin.H{
+			"Context": c,
+			"title":   "Audit Log",
+			"actor":   c.Query("actor"),
+			"action":  c.Query("action"),
+			"target":  c.Query("target"),
+			"search":  c.Query("search"),
+			"failed":  c.Query("failed"),
+			"from":    c.Query("from"),
+			"to":      c.Query("to"),
+			"entries": []models.AuditEntry{},
+			"page":    page,
+			"limit":   limit,
+		}
+
+		am := models.NewAuditManager(db)
+		if actions, err := am.Actions(); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error listing audit actions", "error", err)
+		} else {
+			data["actions"] = actions
+		}
+
+		filter, err := models.ParseAuditFilter(c.Query("actor"), c.Query("action"), c.Query("target"),
+			c.Query("search"), c.Query("failed"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			data["error"] = capitalize(err.Error()) + "."
+			data["totalPages"] = 1
+			data["totalRecords"] = 0
+			data["offset"] = 0
+			c.HTML(http.StatusBadRequest, "admin_audit.html", data)
+			return
+		}
+		filter.Limit = limit
+		filter.Offset = (page - 1) * limit
+
+		entries, total, err := am.List(filter)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error listing audit entries", "error", err)
+			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+				"Context": c,
+				"title":   "Internal Server Error",
+				"error":   "Failed to load the audit log",
+			})
+			return
+		}
+
+		totalPages := (total + limit - 1) / limit
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		data["entries"] = entries
+		data["totalPages"] = totalPages
+		data["totalRecords"] = total
+		data["offset"] = filter.Offset
+		if page > 1 {
+			data["newerURL"] = auditPageURL(c, page-1)
+		}
+		if page < totalPages {
+			data["olderURL"] = auditPageURL(c, page+1)
+		}
+
+		c.HTML(http.StatusOK, "admin_audit.html", data)
+	}
+}
+
+// auditPageURL returns the link to a page of the audit log with the filters
+// of the request.
+func auditPageURL(c *gin.Context, page int) string {
+	query := url.Values{}
+	for _, key := range []string{"actor", "action", "target", "search", "failed", "from", "to"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+	query.Set("page", strconv.Itoa(page))
+	return "/admin/audit?" + query.Encode()
+}
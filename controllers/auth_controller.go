@@ -2,26 +2,37 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
 	"github.com/txlog/server/auth"
 	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
 )
 
 func isSecureCookie() bool {
 	return os.Getenv("GIN_MODE") != "debug"
 }
 
+// setSessionCookie sends the cookie of a new session, which the browser
+// keeps for the maximum lifetime of the session.
+func setSessionCookie(c *gin.Context, sessionID string) {
+	c.SetCookie("session_id", sessionID, auth.Sessions().CookieMaxAge(), "/", "", isSecureCookie(), true)
+}
+
 // GetLogin displays the login page
-func GetLogin(oidcService *auth.OIDCService, ldapService *auth.LDAPService) gin.HandlerFunc {
+func GetLogin(oidcService *auth.OIDCService, ldapService *auth.LDAPService, localService *auth.LocalService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.HTML(http.StatusOK, "login.html", gin.H{
-			"title":        "Login - Txlog Server",
-			"ldap_enabled": ldapService != nil,
-			"oidc_enabled": oidcService != nil,
+			"title":          "Login - Txlog Server",
+			"ldap_enabled":   ldapService != nil,
+			"oidc_enabled":   oidcService != nil,
+			"local_enabled":  localService != nil,
+			"password_reset": c.Query("reset") == "done",
 		})
 	}
 }
@@ -31,7 +42,7 @@ func PostLogin(oidcService *auth.OIDCService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		state, err := auth.GenerateState()
 		if err != nil {
-			logger.Error("Failed to generate state: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to generate state", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
@@ -51,7 +62,7 @@ func GetCallback(oidcService *auth.OIDCService) gin.HandlerFunc {
 		state := c.Query("state")
 
 		if code == "" {
-			logger.Error("Authorization code is missing")
+			logger.ErrorContext(c.Request.Context(), "Authorization code is missing")
 			c.Redirect(http.StatusSeeOther, "/login?error=auth_failed")
 			return
 		}
@@ -59,7 +70,7 @@ func GetCallback(oidcService *auth.OIDCService) gin.HandlerFunc {
 		// Verify state parameter
 		storedState, err := c.Cookie("oidc_state")
 		if err != nil || storedState != state {
-			logger.Error("State parameter mismatch")
+			logger.ErrorContext(c.Request.Context(), "State parameter mismatch")
 			c.Redirect(http.StatusSeeOther, "/login?error=invalid_state")
 			return
 		}
@@ -73,7 +84,7 @@ func GetCallback(oidcService *auth.OIDCService) gin.HandlerFunc {
 		// Exchange code for tokens
 		token, err := oidcService.ExchangeCodeForTokens(ctx, code)
 		if err != nil {
-			logger.Error("Failed to exchange code for tokens: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to exchange code for tokens", "error", err)
 			c.Redirect(http.StatusSeeOther, "/login?error=token_exchange_failed")
 			return
 		}
@@ -81,7 +92,7 @@ func GetCallback(oidcService *auth.OIDCService) gin.HandlerFunc {
 		// Extract ID token
 		rawIDToken, ok := token.Extra("id_token").(string)
 		if !ok {
-			logger.Error("ID token is missing")
+			logger.ErrorContext(c.Request.Context(), "ID token is missing")
 			c.Redirect(http.StatusSeeOther, "/login?error=id_token_missing")
 			return
 		}
@@ -89,36 +100,53 @@ func GetCallback(oidcService *auth.OIDCService) gin.HandlerFunc {
 		// Verify ID token
 		idToken, err := oidcService.VerifyIDToken(ctx, rawIDToken)
 		if err != nil {
-			logger.Error("Failed to verify ID token: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to verify ID token", "error", err)
 			c.Redirect(http.StatusSeeOther, "/login?error=id_token_invalid")
 			return
 		}
 
 		// Create or update user
 		user, err := oidcService.CreateOrUpdateUser(ctx, idToken)
+		if errors.Is(err, auth.ErrOIDCUnauthorized) {
+			audit.RecordFailure(c, oidcService.DB, models.AuditLogin, idToken.Subject, "unauthorized_group")
+			c.Redirect(http.StatusSeeOther, "/login?error=unauthorized_group")
+			return
+		}
+		if errors.Is(err, auth.ErrLocalAccountConflict) {
+			audit.RecordFailure(c, oidcService.DB, models.AuditLogin, idToken.Subject, "local_account")
+			c.Redirect(http.StatusSeeOther, "/login?error=local_account")
+			return
+		}
 		if err != nil {
-			logger.Error("Failed to create/update user: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to create/update user", "error", err)
 			c.Redirect(http.StatusSeeOther, "/login?error=user_creation_failed")
 			return
 		}
 
 		if !user.IsActive {
-			logger.Warn("User " + user.Email + " is not active")
+			logger.WarnContext(c.Request.Context(), "Inactive user tried to log in", "user_id", user.ID)
+			audit.RecordFailure(c, oidcService.DB, models.AuditLogin, user.Email, "account_disabled")
 			c.Redirect(http.StatusSeeOther, "/login?error=account_disabled")
 			return
 		}
 
 		// Create user session
-		sessionID, err := oidcService.CreateUserSession(user.ID)
+		sessionID, err := oidcService.CreateUserSession(user.ID, c.Request.UserAgent(), c.ClientIP())
 		if err != nil {
-			logger.Error("Failed to create user session: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to create user session", "error", err)
 			c.Redirect(http.StatusSeeOther, "/login?error=session_creation_failed")
 			return
 		}
 
-		// Set session cookie
-		c.SetCookie("session_id", sessionID, 7*24*3600, "/", "", isSecureCookie(), true)
-		logger.Info("User " + user.Email + " logged in successfully")
+		// Without its tokens, the session still works but is not ended by
+		// the provider
+		if err := oidcService.StoreSessionTokens(sessionID, idToken, rawIDToken, token); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to store OIDC session tokens", "error", err)
+		}
+
+		setSessionCookie(c, sessionID)
+		logger.InfoContext(c.Request.Context(), "User logged in successfully", "user_id", user.ID)
+		audit.RecordUser(c, oidcService.DB, user, models.AuditLogin, gin.H{"method": "oidc"})
 		c.Redirect(http.StatusSeeOther, "/")
 	}
 }
@@ -130,18 +158,40 @@ func PostLDAPLogin(ldapService *auth.LDAPService) gin.HandlerFunc {
 		password := c.PostForm("password")
 
 		if username == "" || password == "" {
-			logger.Error("Username or password is empty")
+			logger.ErrorContext(c.Request.Context(), "Username or password is empty")
 			c.Redirect(http.StatusSeeOther, "/login?error=invalid_credentials")
 			return
 		}
 
+		// Refuse logins while the username or the address is locked out.
+		// The lockout fails open, so a database error does not lock
+		// everyone out.
+		lockedFor, err := ldapService.LockedFor(username, c.ClientIP())
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to check LDAP login lockout", "error", err)
+		} else if lockedFor > 0 {
+			logger.WarnContext(c.Request.Context(), "LDAP login refused after failed attempts", "ip", c.ClientIP(), "retry_after", lockedFor)
+			audit.RecordFailure(c, ldapService.DB, models.AuditLogin, username, "too_many_attempts")
+			c.Redirect(http.StatusSeeOther, "/login?error=too_many_attempts")
+			return
+		}
+
 		// Authenticate with LDAP
 		user, err := ldapService.Authenticate(username, password)
 		if err != nil {
-			logger.Error("LDAP authentication failed: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "LDAP authentication failed", "error", err)
 
 			// Categorize the error for better user feedback
 			errorCode := auth.CategorizeAuthError(err)
+			audit.RecordFailure(c, ldapService.DB, models.AuditLogin, username, errorCode)
+			if errorCode == "invalid_credentials" || errorCode == "user_not_found" {
+				lockedOut, err := ldapService.RecordLoginFailure(username, c.ClientIP())
+				if err != nil {
+					logger.ErrorContext(c.Request.Context(), "Failed to count LDAP login failure", "error", err)
+				} else if lockedOut {
+					logger.WarnContext(c.Request.Context(), "LDAP logins locked out after failed attempts", "ip", c.ClientIP(), "duration", ldapService.Lockout.Duration)
+				}
+			}
 			var redirectPath string
 			switch errorCode {
 			case "ldap_config_error":
@@ -154,6 +204,8 @@ func PostLDAPLogin(ldapService *auth.LDAPService) gin.HandlerFunc {
 				redirectPath = "/login?error=invalid_credentials"
 			case "unauthorized_group":
 				redirectPath = "/login?error=unauthorized_group"
+			case "local_account":
+				redirectPath = "/login?error=local_account"
 			default:
 				redirectPath = "/login?error=auth_failed"
 			}
@@ -162,39 +214,60 @@ func PostLDAPLogin(ldapService *auth.LDAPService) gin.HandlerFunc {
 		}
 
 		if !user.IsActive {
-			logger.Warn("User " + user.Email + " is not active")
+			logger.WarnContext(c.Request.Context(), "Inactive user tried to log in", "user_id", user.ID)
+			audit.RecordFailure(c, ldapService.DB, models.AuditLogin, user.Email, "account_disabled")
 			c.Redirect(http.StatusSeeOther, "/login?error=account_disabled")
 			return
 		}
 
 		// Create user session
-		sessionID, err := ldapService.CreateUserSession(user.ID)
+		sessionID, err := ldapService.CreateUserSession(user.ID, c.Request.UserAgent(), c.ClientIP())
 		if err != nil {
-			logger.Error("Failed to create user session: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to create user session", "error", err)
 			c.Redirect(http.StatusSeeOther, "/login?error=session_creation_failed")
 			return
 		}
 
-		// Set session cookie
-		c.SetCookie("session_id", sessionID, 7*24*3600, "/", "", isSecureCookie(), true)
-		logger.Info("User " + user.Email + " logged in successfully via LDAP")
+		if err := ldapService.ResetLoginFailures(username); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to reset LDAP login failures", "error", err)
+		}
+
+		setSessionCookie(c, sessionID)
+		logger.InfoContext(c.Request.Context(), "User logged in successfully via LDAP", "user_id", user.ID)
+		audit.RecordUser(c, ldapService.DB, user, models.AuditLogin, gin.H{"method": "ldap"})
 		c.Redirect(http.StatusSeeOther, "/")
 	}
 }
 
-// PostLogout logs out the user
-func PostLogout(oidcService *auth.OIDCService, ldapService *auth.LDAPService) gin.HandlerFunc {
+// PostLogout logs out the user. Users of an OIDC session are sent to the
+// provider to log out there too when OIDC_PROVIDER_LOGOUT is set.
+func PostLogout(oidcService *auth.OIDCService, ldapService *auth.LDAPService, localService *auth.LocalService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		redirect := "/"
 		sessionID, err := c.Cookie("session_id")
 		if err == nil && sessionID != "" {
 			// Try to invalidate session using whichever service is available
 			if oidcService != nil {
+				endSessionURL, err := oidcService.EndSessionURL(sessionID)
+				if err != nil {
+					logger.ErrorContext(c.Request.Context(), "Failed to build the provider logout URL", "error", err)
+				} else if endSessionURL != "" {
+					redirect = endSessionURL
+				}
+
+				audit.RecordLogout(c, oidcService.DB, sessionID)
 				if err := oidcService.InvalidateUserSession(sessionID); err != nil {
-					logger.Error("Failed to invalidate user session: " + err.Error())
+					logger.ErrorContext(c.Request.Context(), "Failed to invalidate user session", "error", err)
 				}
 			} else if ldapService != nil {
+				audit.RecordLogout(c, ldapService.DB, sessionID)
 				if err := ldapService.InvalidateUserSession(sessionID); err != nil {
-					logger.Error("Failed to invalidate user session: " + err.Error())
+					logger.ErrorContext(c.Request.Context(), "Failed to invalidate user session", "error", err)
+				}
+			} else if localService != nil {
+				audit.RecordLogout(c, localService.DB, sessionID)
+				if err := localService.InvalidateUserSession(sessionID); err != nil {
+					logger.ErrorContext(c.Request.Context(), "Failed to invalidate user session", "error", err)
 				}
 			}
 		}
@@ -202,6 +275,40 @@ func PostLogout(oidcService *auth.OIDCService, ldapService *auth.LDAPService) gi
 		// Clear session cookie
 		c.SetCookie("session_id", "", -1, "/", "", isSecureCookie(), true)
 
-		c.Redirect(http.StatusSeeOther, "/")
+		c.Redirect(http.StatusSeeOther, redirect)
+	}
+}
+
+// PostBackchannelLogout receives the logout tokens that the OIDC provider
+// sends when a user logs out there or is removed, and ends the matching
+// sessions. It answers as required by OpenID Connect Back-Channel Logout.
+// Expects form field: logout_token (string).
+func PostBackchannelLogout(oidcService *auth.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+
+		logoutToken := c.PostForm("logout_token")
+		if logoutToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "logout_token is missing"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		count, err := oidcService.BackchannelLogout(ctx, logoutToken)
+		if errors.Is(err, auth.ErrInvalidLogoutToken) {
+			logger.WarnContext(c.Request.Context(), "Invalid OIDC logout token", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "invalid logout_token"})
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to process OIDC back-channel logout", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "OIDC back-channel logout", "sessions", count)
+		c.Status(http.StatusOK)
 	}
 }
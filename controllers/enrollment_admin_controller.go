@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+)
+
+// PostAdminCreateEnrollmentToken creates an enrollment token and returns it
+// as JSON; it is only shown once.
+// Expects form fields: name (string), and optionally expires_on (YYYY-MM-DD)
+// and max_uses (number of machines).
+func PostAdminCreateEnrollmentToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.PostForm("name"))
+		if len(name) < 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be at least 3 characters"})
+			return
+		}
+
+		expiresAt, maxUses, err := models.ParseEnrollmentTokenLimits(c.PostForm("expires_on"), c.PostForm("max_uses"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, tokenHash, tokenPrefix, err := util.GenerateToken(util.EnrollmentTokenPrefix)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to generate enrollment token", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate enrollment token"})
+			return
+		}
+
+		var createdBy *int
+		if userInterface, exists := c.Get("user"); exists {
+			if user, ok := userInterface.(*models.User); ok {
+				createdBy = &user.ID
+			}
+		}
+
+		id, err := models.NewEnrollmentManager(db).CreateToken(name, tokenHash, tokenPrefix, expiresAt, maxUses, createdBy)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to insert enrollment token", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create enrollment token"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Enrollment token created", "enrollment_token_id", id, "name", name)
+		audit.Record(c, db, models.AuditEnrollmentTokenCreate, "enrollment_token", strconv.Itoa(id), nil, gin.H{"name": name, "token_prefix": tokenPrefix, "expires_at": expiresAt, "max_uses": maxUses})
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"id":      id,
+			"name":    name,
+			"token":   token,
+		})
+	}
+}
+
+// PostAdminRevokeEnrollmentToken stops an enrollment token from enrolling
+// more machines.
+// Expects form field: token_id (int).
+func PostAdminRevokeEnrollmentToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("token_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid enrollment token ID"})
+			return
+		}
+
+		if err := models.NewEnrollmentManager(db).RevokeToken(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to revoke enrollment token", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke enrollment token"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Enrollment token revoked", "enrollment_token_id", id)
+		audit.Record(c, db, models.AuditEnrollmentTokenRevoke, "enrollment_token", strconv.Itoa(id), gin.H{"is_active": true}, gin.H{"is_active": false})
+		c.Redirect(http.StatusSeeOther, "/admin?enrollment_token_revoked=1")
+	}
+}
+
+// DeleteAdminEnrollmentToken permanently deletes an enrollment token.
+// Expects form field: token_id (int).
+func DeleteAdminEnrollmentToken(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("token_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid enrollment token ID"})
+			return
+		}
+
+		if err := models.NewEnrollmentManager(db).DeleteToken(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete enrollment token", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete enrollment token"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Enrollment token deleted", "enrollment_token_id", id)
+		audit.Record(c, db, models.AuditEnrollmentTokenDelete, "enrollment_token", strconv.Itoa(id), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/admin?enrollment_token_deleted=1")
+	}
+}
+
+// PostAdminRevokeMachineCredential revokes the credential of an enrolled
+// machine, which can then enroll again.
+// Expects form field: credential_id (int).
+func PostAdminRevokeMachineCredential(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("credential_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid machine credential ID"})
+			return
+		}
+
+		if err := models.NewEnrollmentManager(db).RevokeCredential(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to revoke machine credential", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke machine credential"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Machine credential revoked", "machine_credential_id", id)
+		audit.Record(c, db, models.AuditMachineCredentialRevoke, "machine_credential", strconv.Itoa(id), gin.H{"is_active": true}, gin.H{"is_active": false})
+		c.Redirect(http.StatusSeeOther, "/admin?machine_credential_revoked=1")
+	}
+}
+
+// DeleteAdminMachineCredential permanently deletes the credential of an
+// enrolled machine. Until it enrolls again, the machine can upload data
+// with a regular API key.
+// Expects form field: credential_id (int).
+func DeleteAdminMachineCredential(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("credential_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid machine credential ID"})
+			return
+		}
+
+		if err := models.NewEnrollmentManager(db).DeleteCredential(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete machine credential", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete machine credential"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Machine credential deleted", "machine_credential_id", id)
+		audit.Record(c, db, models.AuditMachineCredentialDelete, "machine_credential", strconv.Itoa(id), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/admin?machine_credential_deleted=1")
+	}
+}
@@ -45,6 +45,12 @@ func GetExecutionID(database *sql.DB) gin.HandlerFunc {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		if inScope, err := assetInScope(c, database, execution.Hostname); err != nil || !inScope {
+			c.HTML(http.StatusNotFound, "404.html", gin.H{
+				"error": "Execution not found",
+			})
+			return
+		}
 		if executedAt.Valid {
 			execution.ExecutedAt = &executedAt.Time
 		}
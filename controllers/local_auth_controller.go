@@ -0,0 +1,480 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	"github.com/txlog/server/auth"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/notification"
+)
+
+// PostLocalLogin handles the login of local accounts with e-mail and password
+func PostLocalLogin(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.PostForm("email")
+		password := c.PostForm("password")
+
+		if email == "" || password == "" {
+			c.Redirect(http.StatusSeeOther, "/login?error=invalid_credentials")
+			return
+		}
+
+		user, totpRequired, err := localService.Authenticate(email, password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			logger.WarnContext(c.Request.Context(), "Local login failed", "email", email)
+			audit.RecordFailure(c, localService.DB, models.AuditLogin, email, "invalid_credentials")
+			c.Redirect(http.StatusSeeOther, "/login?error=invalid_credentials")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Local authentication failed", "error", err)
+			c.Redirect(http.StatusSeeOther, "/login?error=auth_failed")
+			return
+		}
+
+		if !user.IsActive {
+			logger.WarnContext(c.Request.Context(), "Inactive user tried to log in", "user_id", user.ID)
+			audit.RecordFailure(c, localService.DB, models.AuditLogin, user.Email, "account_disabled")
+			c.Redirect(http.StatusSeeOther, "/login?error=account_disabled")
+			return
+		}
+
+		if totpRequired {
+			pendingID, err := localService.BeginTOTPLogin(user.ID)
+			if err != nil {
+				logger.ErrorContext(c.Request.Context(), "Failed to start TOTP login", "error", err)
+				c.Redirect(http.StatusSeeOther, "/login?error=session_creation_failed")
+				return
+			}
+			c.SetCookie("totp_pending", pendingID, 300, "/auth/local/totp", "", isSecureCookie(), true)
+			c.Redirect(http.StatusSeeOther, "/auth/local/totp")
+			return
+		}
+
+		startLocalSession(c, localService, user)
+	}
+}
+
+// GetLocalTOTP displays the form asking for the TOTP code of a login
+func GetLocalTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pendingID, err := c.Cookie("totp_pending"); err != nil || pendingID == "" {
+			c.Redirect(http.StatusSeeOther, "/login")
+			return
+		}
+
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"title": "Two-factor authentication - Txlog Server",
+			"totp":  true,
+		})
+	}
+}
+
+// PostLocalTOTP completes a login with the TOTP code of the user
+func PostLocalTOTP(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pendingID, err := c.Cookie("totp_pending")
+		c.SetCookie("totp_pending", "", -1, "/auth/local/totp", "", isSecureCookie(), true)
+		if err != nil || pendingID == "" {
+			c.Redirect(http.StatusSeeOther, "/login")
+			return
+		}
+
+		user, err := localService.CompleteTOTPLogin(pendingID, c.PostForm("code"))
+		if errors.Is(err, auth.ErrInvalidTOTP) {
+			logger.WarnContext(c.Request.Context(), "Invalid TOTP code")
+			audit.RecordFailure(c, localService.DB, models.AuditLogin, "", "invalid_totp")
+			c.Redirect(http.StatusSeeOther, "/login?error=invalid_totp")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to complete TOTP login", "error", err)
+			c.Redirect(http.StatusSeeOther, "/login?error=auth_failed")
+			return
+		}
+
+		if !user.IsActive {
+			logger.WarnContext(c.Request.Context(), "Inactive user tried to log in", "user_id", user.ID)
+			audit.RecordFailure(c, localService.DB, models.AuditLogin, user.Email, "account_disabled")
+			c.Redirect(http.StatusSeeOther, "/login?error=account_disabled")
+			return
+		}
+
+		startLocalSession(c, localService, user)
+	}
+}
+
+// startLocalSession creates the session of a local login and sends the user
+// to the home page.
+func startLocalSession(c *gin.Context, localService *auth.LocalService, user *models.User) {
+	sessionID, err := localService.CreateUserSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to create user session", "error", err)
+		c.Redirect(http.StatusSeeOther, "/login?error=session_creation_failed")
+		return
+	}
+
+	setSessionCookie(c, sessionID)
+	logger.InfoContext(c.Request.Context(), "User logged in successfully with a local account", "user_id", user.ID)
+	audit.RecordUser(c, localService.DB, user, models.AuditLogin, gin.H{"method": "local", "totp": user.TOTPEnabled})
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+// GetPasswordReset displays the form that sets a password with a reset link
+func GetPasswordReset(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderPasswordReset(c, localService, http.StatusOK, c.Query("token"), "")
+	}
+}
+
+// PostPasswordReset sets the password of a user with a reset link
+func PostPasswordReset(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.PostForm("token")
+		password := c.PostForm("password")
+
+		if password != c.PostForm("password_confirm") {
+			renderPasswordReset(c, localService, http.StatusBadRequest, token, "The passwords do not match.")
+			return
+		}
+		if err := auth.ValidatePassword(password); err != nil {
+			renderPasswordReset(c, localService, http.StatusBadRequest, token, capitalize(err.Error())+".")
+			return
+		}
+
+		user, err := localService.ResetPassword(token, password)
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			renderPasswordReset(c, localService, http.StatusBadRequest, token, "")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to reset password", "error", err)
+			renderPasswordReset(c, localService, http.StatusInternalServerError, token, "Failed to set the password, please try again.")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Password set with a reset link", "user_id", user.ID)
+		audit.RecordUser(c, localService.DB, user, models.AuditPasswordReset, nil)
+		c.Redirect(http.StatusSeeOther, "/login?reset=done")
+	}
+}
+
+// renderPasswordReset renders the password reset page for token, which
+// explains that the link is no longer valid when it is unknown, used or
+// expired.
+func renderPasswordReset(c *gin.Context, localService *auth.LocalService, status int, token, message string) {
+	data := gin.H{
+		"title":               "Set a new password - Txlog Server",
+		"reset":               true,
+		"token":               token,
+		"min_password_length": auth.MinPasswordLength,
+		"reset_error":         message,
+	}
+
+	user, err := localService.PasswordResetUser(token)
+	switch {
+	case errors.Is(err, auth.ErrInvalidResetToken):
+		data["reset_error"] = "This password reset link is invalid, used or expired. Ask an administrator for a new one."
+		if status == http.StatusOK {
+			status = http.StatusNotFound
+		}
+	case err != nil:
+		logger.ErrorContext(c.Request.Context(), "Failed to find password reset", "error", err)
+		c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+			"Context": c,
+			"title":   "Internal Server Error",
+			"error":   "Failed to load the password reset",
+		})
+		return
+	default:
+		data["reset_user"] = user
+	}
+
+	c.HTML(status, "login.html", data)
+}
+
+// capitalize upper-cases the first letter of an error message shown as a
+// sentence.
+func capitalize(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-'a'+'A') + s[1:]
+}
+
+// GetAccountSettings renders the page where users with a password change it
+// and manage two-factor authentication
+func GetAccountSettings(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderAccountSettings(c, localService, http.StatusOK, "")
+	}
+}
+
+// renderAccountSettings renders the account security page, with an error
+// message when a form was rejected.
+func renderAccountSettings(c *gin.Context, localService *auth.LocalService, status int, message string) {
+	data := gin.H{
+		"Context":           c,
+		"title":             "Account Security",
+		"minPasswordLength": auth.MinPasswordLength,
+		"saved":             c.Query("saved"),
+		"error":             message,
+	}
+
+	user := currentUser(c)
+	if user != nil && user.HasPassword && !user.TOTPEnabled {
+		secret, err := localService.PendingTOTPSecret(user.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to load TOTP setup", "error", err)
+		} else if secret != "" {
+			data["totpSecret"] = secret
+			data["totpURI"] = auth.TOTPURI(user.Email, secret)
+		}
+	}
+
+	c.HTML(status, "account_settings.html", data)
+}
+
+// accountUser returns the signed-in user when they log in with a password,
+// and otherwise answers the request.
+func accountUser(c *gin.Context) *models.User {
+	user := currentUser(c)
+	if user == nil || !user.HasPassword {
+		c.HTML(http.StatusForbidden, "403.html", gin.H{
+			"Context": c,
+			"title":   "Access Denied",
+			"error":   "Your account does not log in with a password",
+		})
+		return nil
+	}
+	return user
+}
+
+// PostAccountPassword changes the password of the signed-in user
+func PostAccountPassword(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := accountUser(c)
+		if user == nil {
+			return
+		}
+
+		password := c.PostForm("password")
+		if password != c.PostForm("password_confirm") {
+			renderAccountSettings(c, localService, http.StatusBadRequest, "The new passwords do not match.")
+			return
+		}
+		if err := auth.ValidatePassword(password); err != nil {
+			renderAccountSettings(c, localService, http.StatusBadRequest, capitalize(err.Error())+".")
+			return
+		}
+
+		sessionID, _ := c.Cookie("session_id")
+		err := localService.ChangePassword(user.ID, c.PostForm("current_password"), password, sessionID)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			renderAccountSettings(c, localService, http.StatusBadRequest, "The current password is wrong.")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to change password", "error", err)
+			renderAccountSettings(c, localService, http.StatusInternalServerError, "Failed to change the password.")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Password changed", "user_id", user.ID)
+		audit.Record(c, localService.DB, models.AuditPasswordChange, "user", strconv.Itoa(user.ID), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/settings/account?saved=password")
+	}
+}
+
+// PostAccountTOTPSetup generates the TOTP secret the user adds to their
+// authenticator app
+func PostAccountTOTPSetup(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := accountUser(c)
+		if user == nil {
+			return
+		}
+
+		if _, err := localService.BeginTOTPSetup(user.ID); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to start TOTP setup", "error", err)
+			renderAccountSettings(c, localService, http.StatusBadRequest, capitalize(err.Error())+".")
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, "/settings/account#two-factor")
+	}
+}
+
+// PostAccountTOTPEnable turns on two-factor authentication once the user
+// enters a code of their authenticator app
+func PostAccountTOTPEnable(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := accountUser(c)
+		if user == nil {
+			return
+		}
+
+		err := localService.EnableTOTP(user.ID, c.PostForm("code"))
+		if errors.Is(err, auth.ErrInvalidTOTP) {
+			renderAccountSettings(c, localService, http.StatusBadRequest, "The authentication code is wrong or expired. Check the clock of your device and try again.")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to enable TOTP", "error", err)
+			renderAccountSettings(c, localService, http.StatusBadRequest, capitalize(err.Error())+".")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Two-factor authentication enabled", "user_id", user.ID)
+		audit.Record(c, localService.DB, models.AuditTOTPEnable, "user", strconv.Itoa(user.ID), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/settings/account?saved=totp_enabled")
+	}
+}
+
+// PostAccountTOTPDisable turns off two-factor authentication after checking
+// the password of the user
+func PostAccountTOTPDisable(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := accountUser(c)
+		if user == nil {
+			return
+		}
+
+		err := localService.VerifyPassword(user.ID, c.PostForm("current_password"))
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			renderAccountSettings(c, localService, http.StatusBadRequest, "The current password is wrong.")
+			return
+		}
+		if err == nil {
+			err = localService.DisableTOTP(user.ID)
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to disable TOTP", "error", err)
+			renderAccountSettings(c, localService, http.StatusInternalServerError, "Failed to disable two-factor authentication.")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Two-factor authentication disabled", "user_id", user.ID)
+		audit.Record(c, localService.DB, models.AuditTOTPDisable, "user", strconv.Itoa(user.ID), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/settings/account?saved=totp_disabled")
+	}
+}
+
+// PostAdminCreateLocalUser creates a local user and returns the link that
+// lets them set their password
+func PostAdminCreateLocalUser(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := models.ParseRole(c.PostForm("role"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+
+		user, err := localService.CreateUser(c.PostForm("email"), c.PostForm("name"), role)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create local user", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": capitalize(err.Error())})
+			return
+		}
+
+		link, expiresAt, err := issuePasswordReset(c, localService, user.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create password reset", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User created, but the password link could not be issued"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Local user created", "user_id", user.ID, "role", role)
+		audit.Record(c, localService.DB, models.AuditUserCreate, "user", strconv.Itoa(user.ID), nil, gin.H{"email": user.Email, "name": user.Name, "role": role})
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"id":         user.ID,
+			"email":      user.Email,
+			"link":       link,
+			"expires_at": expiresAt,
+			"message":    "User created. Send this link to " + user.Email + " to set their password - it won't be shown again!",
+		})
+	}
+}
+
+// PostAdminPasswordReset issues a password reset link for a user
+func PostAdminPasswordReset(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.PostForm("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		link, expiresAt, err := issuePasswordReset(c, localService, userID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create password reset", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": capitalize(err.Error())})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Password reset link issued", "user_id", userID)
+		audit.Record(c, localService.DB, models.AuditUserPasswordResetIssue, "user", strconv.Itoa(userID), nil, gin.H{"expires_at": expiresAt})
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"id":         userID,
+			"link":       link,
+			"expires_at": expiresAt,
+			"message":    "Send this link to the user to set a new password - it won't be shown again!",
+		})
+	}
+}
+
+// issuePasswordReset creates a reset token for a user on behalf of the
+// signed-in admin and returns its link.
+func issuePasswordReset(c *gin.Context, localService *auth.LocalService, userID int) (string, time.Time, error) {
+	var createdBy *int
+	if user := currentUser(c); user != nil {
+		createdBy = &user.ID
+	}
+
+	token, expiresAt, err := localService.CreatePasswordReset(userID, createdBy)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	baseURL := notification.PublicURL()
+	if baseURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + c.Request.Host
+	}
+	return baseURL + "/auth/local/reset?token=" + url.QueryEscape(token), expiresAt, nil
+}
+
+// PostAdminDisableTOTP turns off two-factor authentication for a user who
+// lost their authenticator app
+func PostAdminDisableTOTP(localService *auth.LocalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.PostForm("user_id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		if err := localService.DisableTOTP(userID); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to disable TOTP", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Two-factor authentication disabled by an admin", "user_id", userIDStr)
+		audit.Record(c, localService.DB, models.AuditUserTOTPDisable, "user", strconv.Itoa(userID), gin.H{"totp_enabled": true}, gin.H{"totp_enabled": false})
+		c.Redirect(http.StatusSeeOther, "/admin")
+	}
+}
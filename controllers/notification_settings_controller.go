@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/notification"
+)
+
+// digestSectionOption describes a digest section on the settings page.
+type digestSectionOption struct {
+	Value       string
+	Label       string
+	Description string
+}
+
+var digestSectionOptions = []digestSectionOption{
+	{models.DigestSectionRestart, "Assets requiring restart", "Active assets that still need a reboot or service restart."},
+	{models.DigestSectionFailedExecutions, "Failed executions", "Agent executions that did not succeed during the period."},
+	{models.DigestSectionVulnerabilities, "New critical vulnerabilities", "Critical vulnerabilities published during the period that affect installed packages."},
+	{models.DigestSectionAnomalies, "Anomalies", "High volume transactions, rapid package changes and downgrades."},
+}
+
+// currentUser returns the signed-in user, or nil when authentication is
+// disabled.
+func currentUser(c *gin.Context) *models.User {
+	if userInterface, exists := c.Get("user"); exists {
+		if user, ok := userInterface.(*models.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// GetNotificationSettings renders the page where users manage their e-mail
+// digest subscription.
+func GetNotificationSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, smtpConfigured := notification.SMTPConfigFromEnv()
+
+		data := gin.H{
+			"Context":        c,
+			"title":          "Notifications",
+			"smtpConfigured": smtpConfigured,
+			"sections":       digestSectionOptions,
+			"frequency":      "off",
+			"selected":       map[string]bool{},
+			"saved":          c.Query("saved") != "",
+			"sent":           c.Query("sent") != "",
+		}
+
+		user := currentUser(c)
+		if user == nil {
+			c.HTML(http.StatusOK, "notification_settings.html", data)
+			return
+		}
+
+		sub, err := models.NewDigestManager(db).GetSubscription(user.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error loading digest subscription", "error", err)
+			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
+				"Context": c,
+				"title":   "Internal Server Error",
+				"error":   "Failed to load notification settings",
+			})
+			return
+		}
+
+		selected := map[string]bool{}
+		for _, s := range models.DigestSections {
+			selected[s] = sub == nil || sub.Includes(s)
+		}
+		data["selected"] = selected
+		if sub != nil {
+			data["frequency"] = sub.Frequency
+			data["subscription"] = sub
+		}
+
+		c.HTML(http.StatusOK, "notification_settings.html", data)
+	}
+}
+
+// PostNotificationSettings saves the signed-in user's digest subscription.
+// Expects form fields: frequency ("off", "daily" or "weekly") and sections
+// (repeated; none means every section).
+func PostNotificationSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Digests require a signed-in user"})
+			return
+		}
+
+		dm := models.NewDigestManager(db)
+		frequency := c.PostForm("frequency")
+
+		if frequency == "off" {
+			if err := dm.DeleteSubscription(user.ID); err != nil {
+				logger.ErrorContext(c.Request.Context(), "Failed to delete digest subscription", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification settings"})
+				return
+			}
+			logger.InfoContext(c.Request.Context(), "Digest subscription removed", "user_id", user.ID)
+			c.Redirect(http.StatusSeeOther, "/settings/notifications?saved=1")
+			return
+		}
+
+		sections := c.PostFormArray("sections")
+		if !models.IsValidDigestFrequency(frequency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "frequency must be off, daily or weekly"})
+			return
+		}
+		for _, s := range sections {
+			if !models.IsValidDigestSection(s) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown digest section: " + s})
+				return
+			}
+		}
+		// Selecting every section is stored as "all", so sections added in
+		// later versions are included automatically.
+		if len(sections) == len(models.DigestSections) {
+			sections = nil
+		}
+
+		if err := dm.SaveSubscription(user.ID, frequency, sections); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to save digest subscription", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification settings"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Digest subscription saved", "user_id", user.ID, "frequency", frequency)
+		c.Redirect(http.StatusSeeOther, "/settings/notifications?saved=1")
+	}
+}
+
+// PostNotificationSettingsTest mails the signed-in user a digest right away,
+// using their current subscription (or a daily digest of every section when
+// not subscribed). It does not affect when the next scheduled digest is
+// sent, and is sent even when there is nothing to report.
+func PostNotificationSettingsTest(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Digests require a signed-in user"})
+			return
+		}
+
+		cfg, ok := notification.SMTPConfigFromEnv()
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "SMTP is not configured"})
+			return
+		}
+
+		dm := models.NewDigestManager(db)
+		sub, err := dm.GetSubscription(user.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error loading digest subscription", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load notification settings"})
+			return
+		}
+		if sub == nil {
+			sub = &models.DigestSubscription{Frequency: models.DigestDaily}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+		defer cancel()
+		digest, err := dm.BuildDigest(ctx, sub.Frequency, time.Now())
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error building digest", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build digest"})
+			return
+		}
+
+		if err := notification.SendDigest(cfg, user.Email, digest.WithSections(sub.Sections), notification.PublicURL()); err != nil {
+			logger.WarnContext(c.Request.Context(), "Digest test delivery failed", "user_id", user.ID, "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send digest: " + err.Error()})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Digest test sent", "user_id", user.ID)
+		c.Redirect(http.StatusSeeOther, "/settings/notifications?sent=1")
+	}
+}
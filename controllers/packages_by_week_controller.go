@@ -17,7 +17,7 @@ func GetPackagesByWeekIndex(database *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		graphData, err := getGraphData(c.Request.Context(), database)
 		if err != nil {
-			logger.Error("Error getting statistics:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error getting statistics", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"error": err.Error(),
 			})
@@ -113,14 +113,14 @@ func GetPackagesByMonth(database *sql.DB) gin.HandlerFunc {
 
 		csvData, err := getMonthlyPackageData(c.Request.Context(), database, month, year)
 		if err != nil {
-			logger.Error("Error getting monthly package data: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error getting monthly package data", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching package data: " + err.Error()})
 			return
 		}
 
 		assetCount, err := getTotalActiveAssets(c.Request.Context(), database)
 		if err != nil {
-			logger.Error("Error getting total active assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error getting total active assets", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching asset count: " + err.Error()})
 			return
 		}
@@ -31,10 +31,10 @@ func GetPackagesIndex(database *sql.DB) gin.HandlerFunc {
 		packageNames, total, err := getPackagesFromMaterializedView(c.Request.Context(), database, search, limit, offset)
 		if err != nil {
 			// Fallback to direct query if materialized view doesn't exist
-			logger.Debug("Using fallback query for packages: " + err.Error())
+			logger.DebugContext(c.Request.Context(), "Using fallback query for packages", "error", err)
 			packageNames, total, err = getPackagesFromDirectQuery(c.Request.Context(), database, search, limit, offset)
 			if err != nil {
-				logger.Error("Error listing packages:" + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error listing packages", "error", err)
 				c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 					"error": err.Error(),
 				})
@@ -436,7 +436,7 @@ func GetPackageByName(database *sql.DB) gin.HandlerFunc {
 		rows, err := database.QueryContext(c.Request.Context(), query, pkg.Name)
 
 		if err != nil {
-			logger.Error("Error listing packages:" + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error listing packages", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"error": err.Error(),
 			})
@@ -458,7 +458,7 @@ func GetPackageByName(database *sql.DB) gin.HandlerFunc {
 				&vulns,
 			)
 			if err != nil {
-				logger.Error("Error iterating packages:" + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Error iterating packages", "error", err)
 				c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 					"error": err.Error(),
 				})
@@ -97,7 +97,7 @@ func GetRootIndex(database *sql.DB) gin.HandlerFunc {
 		})
 
 		if err := g.Wait(); err != nil {
-			logger.Error("Error loading dashboard data: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Error loading dashboard data", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{
 				"error": err.Error(),
 			})
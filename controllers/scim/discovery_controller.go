@@ -0,0 +1,61 @@
+package scim
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/notification"
+)
+
+// GetServiceProviderConfig describes the SCIM features supported: PATCH and
+// equality filters, but not bulk operations, sorting, ETags or passwords.
+func GetServiceProviderConfig(c *gin.Context) {
+	render(c, http.StatusOK, gin.H{
+		"schemas":        []string{schemaServiceProvider},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "The token configured in SCIM_TOKEN, sent in the Authorization header.",
+			"primary":     true,
+		}},
+		"meta": gin.H{
+			"resourceType": "ServiceProviderConfig",
+			"location":     notification.PublicURL() + basePath + "/ServiceProviderConfig",
+		},
+	})
+}
+
+// GetResourceTypes lists the resources that can be provisioned: users and
+// groups.
+func GetResourceTypes(c *gin.Context) {
+	resourceType := func(name, endpoint, schema string) gin.H {
+		return gin.H{
+			"schemas":  []string{schemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta": gin.H{
+				"resourceType": "ResourceType",
+				"location":     notification.PublicURL() + basePath + "/ResourceTypes/" + name,
+			},
+		}
+	}
+	resources := []gin.H{
+		resourceType("User", "/Users", schemaUser),
+		resourceType("Group", "/Groups", schemaGroup),
+	}
+	render(c, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
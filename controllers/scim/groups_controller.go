@@ -0,0 +1,332 @@
+package scim
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	"github.com/txlog/server/auth"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// stateOfGroup returns what a PATCH request can change in a group, also
+// recorded in the audit log.
+func stateOfGroup(g models.SCIMGroup) groupState {
+	state := groupState{DisplayName: g.DisplayName, ExternalID: g.ExternalID, Members: []int{}}
+	for _, m := range g.Members {
+		state.Members = append(state.Members, m.ID)
+	}
+	return state
+}
+
+// GetGroups lists the groups. The filter query parameter accepts
+// displayName or externalId compared with eq.
+func GetGroups(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startIndex, count, err := parsePage(c)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		var filter models.SCIMGroupFilter
+		if f := c.Query("filter"); f != "" {
+			attribute, value, err := parseFilter(f)
+			if err != nil {
+				fail(c, http.StatusBadRequest, scimTypeInvalidFilter, err.Error())
+				return
+			}
+			switch attribute {
+			case "displayname":
+				filter.DisplayName = value
+			case "externalid":
+				filter.ExternalID = value
+			default:
+				fail(c, http.StatusBadRequest, scimTypeInvalidFilter, "groups cannot be filtered by "+attribute)
+				return
+			}
+		}
+
+		groups, total, err := models.NewSCIMManager(db).ListGroups(filter, startIndex-1, count)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to list SCIM groups", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		resources := make([]groupResource, len(groups))
+		for i, g := range groups {
+			resources[i] = toGroupResource(g)
+		}
+		render(c, http.StatusOK, listResponse{
+			Schemas:      []string{schemaListResponse},
+			TotalResults: total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	}
+}
+
+// GetGroup returns a group with its members.
+func GetGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := loadGroup(c, db)
+		if !ok {
+			return
+		}
+		render(c, http.StatusOK, toGroupResource(*group))
+	}
+}
+
+// PostGroup creates a group and sets the roles of its members.
+func PostGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resource groupResource
+		if err := c.ShouldBindJSON(&resource); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, "Invalid group: "+err.Error())
+			return
+		}
+		state, err := fromGroupResource(resource)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		id, err := models.NewSCIMManager(db).CreateGroup(state.DisplayName, state.ExternalID, state.Members)
+		if errors.Is(err, models.ErrSCIMConflict) {
+			fail(c, http.StatusConflict, scimTypeUniqueness, "A group with this displayName already exists")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create SCIM group", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "SCIM group created", "group_id", id, "display_name", state.DisplayName)
+		audit.Record(c, db, models.AuditSCIMGroupCreate, "scim_group", strconv.Itoa(id), nil, state)
+
+		if err := syncRoles(c, db, state.Members); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to set roles of SCIM group members", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		group, ok := reloadGroup(c, db, id)
+		if !ok {
+			return
+		}
+		c.Header("Location", location("Groups", id))
+		render(c, http.StatusCreated, toGroupResource(*group))
+	}
+}
+
+// PutGroup replaces the name and members of a group, and sets the roles of
+// the users who joined or left it.
+func PutGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := loadGroup(c, db)
+		if !ok {
+			return
+		}
+
+		var resource groupResource
+		if err := c.ShouldBindJSON(&resource); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, "Invalid group: "+err.Error())
+			return
+		}
+		after, err := fromGroupResource(resource)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		saveGroup(c, db, *before, after)
+	}
+}
+
+// PatchGroup renames a group or adds and removes members, and sets the
+// roles of the users who joined or left it.
+func PatchGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := loadGroup(c, db)
+		if !ok {
+			return
+		}
+
+		var req patchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, "Invalid patch: "+err.Error())
+			return
+		}
+		ops, err := patchOps(req)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, err.Error())
+			return
+		}
+		after := stateOfGroup(*before)
+		if err := applyGroupPatch(&after, ops); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		saveGroup(c, db, *before, after)
+	}
+}
+
+// DeleteGroup deletes a group and sets the roles of its former members.
+func DeleteGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := loadGroup(c, db)
+		if !ok {
+			return
+		}
+
+		found, err := models.NewSCIMManager(db).DeleteGroup(before.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete SCIM group", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		if !found {
+			fail(c, http.StatusNotFound, "", "Group not found")
+			return
+		}
+
+		state := stateOfGroup(*before)
+		logger.InfoContext(c.Request.Context(), "SCIM group deleted", "group_id", before.ID, "display_name", before.DisplayName)
+		audit.Record(c, db, models.AuditSCIMGroupDelete, "scim_group", strconv.Itoa(before.ID), state, nil)
+
+		if err := syncRoles(c, db, state.Members); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to set roles of SCIM group members", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// fromGroupResource returns the state described by a SCIM group.
+func fromGroupResource(r groupResource) (groupState, error) {
+	members, err := memberIDs(r.Members)
+	if err != nil {
+		return groupState{}, err
+	}
+	state := groupState{DisplayName: r.DisplayName, ExternalID: r.ExternalID, Members: members}
+	if state.DisplayName == "" {
+		return groupState{}, errors.New("displayName is required")
+	}
+	return state, nil
+}
+
+// loadGroup returns the group named in the path, or writes a 404 or 500
+// response and returns false.
+func loadGroup(c *gin.Context, db *sql.DB) (*models.SCIMGroup, bool) {
+	id, ok := pathID(c)
+	if !ok {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return nil, false
+	}
+	return reloadGroup(c, db, id)
+}
+
+// reloadGroup returns a group, or writes a 404 or 500 response and returns
+// false.
+func reloadGroup(c *gin.Context, db *sql.DB, id int) (*models.SCIMGroup, bool) {
+	group, err := models.NewSCIMManager(db).GetGroup(id)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to get SCIM group", "error", err)
+		fail(c, http.StatusInternalServerError, "", "Database error")
+		return nil, false
+	}
+	if group == nil {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return nil, false
+	}
+	return group, true
+}
+
+// saveGroup stores the new name and members of a group, records the change,
+// sets the roles of the users who joined or left it and writes the group.
+func saveGroup(c *gin.Context, db *sql.DB, before models.SCIMGroup, after groupState) {
+	found, err := models.NewSCIMManager(db).UpdateGroup(before.ID, after.DisplayName, after.ExternalID, after.Members)
+	if errors.Is(err, models.ErrSCIMConflict) {
+		fail(c, http.StatusConflict, scimTypeUniqueness, "Another group has this displayName")
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to update SCIM group", "error", err)
+		fail(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	if !found {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	group, ok := reloadGroup(c, db, before.ID)
+	if !ok {
+		return
+	}
+
+	beforeState, afterState := stateOfGroup(before), stateOfGroup(*group)
+	logger.InfoContext(c.Request.Context(), "SCIM group updated", "group_id", before.ID, "display_name", group.DisplayName)
+	audit.Record(c, db, models.AuditSCIMGroupUpdate, "scim_group", strconv.Itoa(before.ID), beforeState, afterState)
+
+	// A renamed group can map to another role, so every member is checked
+	affected := append(slices.Clone(beforeState.Members), afterState.Members...)
+	if err := syncRoles(c, db, affected); err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to set roles of SCIM group members", "error", err)
+		fail(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	render(c, http.StatusOK, toGroupResource(*group))
+}
+
+// syncRoles sets the role of users from their groups when the
+// OIDC_*_GROUP variables map groups to roles: the highest role of their
+// groups. Users in no mapped group are deactivated and signed out, as OIDC
+// logins refuse them. Roles are otherwise left to admins.
+func syncRoles(c *gin.Context, db *sql.DB, userIDs []int) error {
+	if !auth.IsOIDCGroupMappingConfigured() {
+		return nil
+	}
+
+	sm := models.NewSCIMManager(db)
+	slices.Sort(userIDs)
+	for _, id := range slices.Compact(userIDs) {
+		names, err := sm.UserGroupNames(id)
+		if err != nil {
+			return err
+		}
+		role := auth.RoleFromGroups(names)
+		if role == "" {
+			deactivated, err := sm.Deactivate(id)
+			if err != nil {
+				return err
+			}
+			if deactivated {
+				logger.InfoContext(c.Request.Context(), "SCIM user deactivated, in no group mapped to a role", "user_id", id)
+				audit.Record(c, db, models.AuditUserDeactivate, "user", strconv.Itoa(id), gin.H{"is_active": true}, gin.H{"is_active": false})
+				endSessions(c, db, id)
+			}
+			continue
+		}
+
+		previous, err := sm.SetRole(id, role)
+		if err != nil {
+			return err
+		}
+		if previous != "" && previous != role {
+			logger.InfoContext(c.Request.Context(), "Role of SCIM user changed by its groups", "user_id", id, "role", role)
+			audit.Record(c, db, models.AuditUserUpdate, "user", strconv.Itoa(id), gin.H{"role": previous}, gin.H{"role": role})
+		}
+	}
+	return nil
+}
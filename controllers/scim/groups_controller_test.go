@@ -0,0 +1,94 @@
+package scim
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	"github.com/txlog/server/models"
+)
+
+func setupSCIMTestDB(t *testing.T) *sql.DB {
+	connStr := "host=localhost port=5432 user=postgres password=postgres dbname=txlog_test sslmode=disable"
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Skip("Skipping test: PostgreSQL not available")
+	}
+
+	if err := db.Ping(); err != nil {
+		t.Skip("Skipping test: Cannot connect to PostgreSQL")
+	}
+
+	return db
+}
+
+func cleanupSCIMTestData(t *testing.T, db *sql.DB) {
+	_, err := db.Exec("DELETE FROM scim_groups WHERE display_name LIKE 'scim-test-%'")
+	if err != nil {
+		t.Logf("Warning: Failed to cleanup SCIM groups: %v", err)
+	}
+	_, err = db.Exec("DELETE FROM users WHERE email LIKE 'scim-test-%'")
+	if err != nil {
+		t.Logf("Warning: Failed to cleanup users: %v", err)
+	}
+}
+
+func TestPatchGroup_DeactivatesUserInNoMappedGroup(t *testing.T) {
+	db := setupSCIMTestDB(t)
+	defer db.Close()
+	cleanupSCIMTestData(t, db)
+	defer cleanupSCIMTestData(t, db)
+
+	t.Setenv("OIDC_ADMIN_GROUP", "scim-test-admins")
+
+	sm := models.NewSCIMManager(db)
+	userID, _, err := sm.CreateUser(models.SCIMUser{UserName: "scim-test-alice@example.com", Email: "scim-test-alice@example.com", Name: "Alice", IsActive: true})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	groupID, err := sm.CreateGroup("scim-test-admins", "", []int{userID})
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO user_sessions (id, user_id, expires_at, absolute_expires_at)
+		VALUES ('scim-test-session', $1, NOW() + INTERVAL '1 hour', NOW() + INTERVAL '1 hour')
+	`, userID)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PATCH("/scim/v2/Groups/:id", PatchGroup(db))
+
+	w := httptest.NewRecorder()
+	body := `{"Operations":[{"op":"remove","path":"members"}]}`
+	req, _ := http.NewRequest("PATCH", "/scim/v2/Groups/"+strconv.Itoa(groupID), bytes.NewBufferString(body))
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	user, err := sm.GetUser(userID)
+	if err != nil || user == nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user.IsActive {
+		t.Error("Expected the user in no mapped group to be deactivated")
+	}
+
+	var sessions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user_sessions WHERE user_id = $1`, userID).Scan(&sessions); err != nil {
+		t.Fatalf("Failed to count sessions: %v", err)
+	}
+	if sessions != 0 {
+		t.Errorf("Expected the sessions of the deactivated user to end, found %d", sessions)
+	}
+}
@@ -0,0 +1,530 @@
+// Package scim implements the SCIM 2.0 API (RFC 7643 and 7644) through
+// which the identity provider provisions users and groups.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/notification"
+)
+
+// SCIM schemas and messages.
+const (
+	schemaUser            = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup           = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaListResponse    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaError           = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaServiceProvider = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType    = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// SCIM error types used in responses.
+const (
+	scimTypeInvalidFilter = "invalidFilter"
+	scimTypeInvalidSyntax = "invalidSyntax"
+	scimTypeInvalidValue  = "invalidValue"
+	scimTypeUniqueness    = "uniqueness"
+)
+
+const (
+	contentType = "application/scim+json"
+	basePath    = "/scim/v2"
+
+	// defaultCount and maxCount bound the resources of a list response.
+	defaultCount = 100
+	maxCount     = 1000
+
+	// maxAttributeLength is the size of the users columns.
+	maxAttributeLength = 255
+)
+
+type meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// reference points to a member of a group or a group of a user.
+type reference struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type userResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *name       `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []email     `json:"emails,omitempty"`
+	Active      *flexBool   `json:"active,omitempty"`
+	Groups      []reference `json:"groups,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+type groupResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []reference `json:"members,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+type listResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+type errorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// flexBool is a boolean that also accepts the strings "true" and "false",
+// in any case, which some identity providers send in PATCH requests.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v bool
+	if err := json.Unmarshal(data, &v); err == nil {
+		*b = flexBool(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("must be a boolean")
+	}
+	v, err := strconv.ParseBool(strings.ToLower(s))
+	if err != nil {
+		return errors.New("must be a boolean")
+	}
+	*b = flexBool(v)
+	return nil
+}
+
+// render writes a SCIM response.
+func render(c *gin.Context, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to encode SCIM response", "error", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, contentType, body)
+}
+
+// fail writes a SCIM error. scimType may be empty.
+func fail(c *gin.Context, status int, scimType, detail string) {
+	render(c, status, errorResponse{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// location returns the URL of a resource, absolute when PUBLIC_URL is set.
+func location(kind string, id int) string {
+	return notification.PublicURL() + basePath + "/" + kind + "/" + strconv.Itoa(id)
+}
+
+// pathID returns the ID in the path of a request, or false if it cannot
+// name a resource.
+func pathID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	return id, err == nil && id > 0
+}
+
+// toUserResource returns the SCIM representation of a user.
+func toUserResource(u models.SCIMUser) userResource {
+	active := flexBool(u.IsActive)
+	r := userResource{
+		Schemas:     []string{schemaUser},
+		ID:          strconv.Itoa(u.ID),
+		ExternalID:  u.ExternalID,
+		UserName:    u.UserName,
+		Name:        &name{Formatted: u.Name},
+		DisplayName: u.Name,
+		Emails:      []email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     location("Users", u.ID),
+		},
+	}
+	for _, g := range u.Groups {
+		r.Groups = append(r.Groups, reference{Value: strconv.Itoa(g.ID), Ref: location("Groups", g.ID), Display: g.Display})
+	}
+	return r
+}
+
+// fromUserResource returns the user described by a SCIM resource. The
+// e-mail address is the primary one, or the userName if it has none; the
+// name is the displayName or the name, or the userName. Users are active
+// unless the resource says otherwise.
+func fromUserResource(r userResource) (models.SCIMUser, error) {
+	u := models.SCIMUser{
+		UserName:   strings.TrimSpace(r.UserName),
+		ExternalID: r.ExternalID,
+		Email:      primaryEmail(r.Emails),
+		Name:       strings.TrimSpace(r.DisplayName),
+		IsActive:   r.Active == nil || bool(*r.Active),
+	}
+	if u.Name == "" && r.Name != nil {
+		u.Name = formattedName(*r.Name)
+	}
+	return u, completeUser(&u)
+}
+
+// completeUser fills the e-mail address and name of a user from its
+// userName when they are missing, and validates the result.
+func completeUser(u *models.SCIMUser) error {
+	if u.UserName == "" {
+		return errors.New("userName is required")
+	}
+	if u.Email == "" && strings.Contains(u.UserName, "@") {
+		u.Email = u.UserName
+	}
+	if u.Email == "" {
+		return errors.New("an e-mail address is required")
+	}
+	if u.Name == "" {
+		u.Name = u.UserName
+	}
+	if len(u.UserName) > maxAttributeLength || len(u.Email) > maxAttributeLength || len(u.Name) > maxAttributeLength {
+		return errors.New("userName, e-mail address and name must be at most 255 characters")
+	}
+	return nil
+}
+
+// primaryEmail returns the primary address of emails, or the first one.
+func primaryEmail(emails []email) string {
+	for _, e := range emails {
+		if e.Primary && strings.TrimSpace(e.Value) != "" {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	for _, e := range emails {
+		if strings.TrimSpace(e.Value) != "" {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	return ""
+}
+
+// formattedName returns the formatted name, or the given and family names.
+func formattedName(n name) string {
+	if f := strings.TrimSpace(n.Formatted); f != "" {
+		return f
+	}
+	return strings.TrimSpace(n.GivenName + " " + n.FamilyName)
+}
+
+// toGroupResource returns the SCIM representation of a group.
+func toGroupResource(g models.SCIMGroup) groupResource {
+	r := groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          strconv.Itoa(g.ID),
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Meta: &meta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: g.UpdatedAt,
+			Location:     location("Groups", g.ID),
+		},
+	}
+	for _, m := range g.Members {
+		r.Members = append(r.Members, reference{Value: strconv.Itoa(m.ID), Ref: location("Users", m.ID), Display: m.Display})
+	}
+	return r
+}
+
+// memberIDs returns the user IDs of references.
+func memberIDs(refs []reference) ([]int, error) {
+	ids := []int{}
+	for _, ref := range refs {
+		id, err := strconv.Atoi(ref.Value)
+		if err != nil {
+			return nil, errors.New("member " + strconv.Quote(ref.Value) + " is not a user ID")
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// filterPattern matches the only filters supported: an attribute equal to
+// a string, as in userName eq "alice@example.com".
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// parseFilter returns the attribute, in lower case, and the value of an
+// equality filter.
+func parseFilter(filter string) (string, string, error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", errors.New("only filters of the form attribute eq \"value\" are supported")
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return "", "", errors.New("invalid string in filter")
+	}
+	return strings.ToLower(match[1]), value, nil
+}
+
+// parsePage returns the startIndex and count of a list request. Indexes
+// below 1 are read as 1, and counts are capped at maxCount.
+func parsePage(c *gin.Context) (int, int, error) {
+	startIndex, count := 1, defaultCount
+	if s := c.Query("startIndex"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, errors.New("startIndex must be an integer")
+		}
+		startIndex = max(v, 1)
+	}
+	if s := c.Query("count"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, errors.New("count must be an integer")
+		}
+		count = min(max(v, 0), maxCount)
+	}
+	return startIndex, count, nil
+}
+
+// patchRequest is the body of a PATCH request.
+type patchRequest struct {
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchOps returns the operations of a PATCH request, whose op is one of
+// add, replace or remove in any case, with the op in lower case.
+func patchOps(req patchRequest) ([]patchOperation, error) {
+	if len(req.Operations) == 0 {
+		return nil, errors.New("no operations")
+	}
+	ops := make([]patchOperation, len(req.Operations))
+	for i, op := range req.Operations {
+		op.Op = strings.ToLower(op.Op)
+		if op.Op != "add" && op.Op != "replace" && op.Op != "remove" {
+			return nil, errors.New("unknown operation " + strconv.Quote(op.Op))
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
+
+// expand returns the attributes an operation sets: its path and value, or
+// each member of its value when it has no path.
+func expand(op patchOperation) (map[string]json.RawMessage, error) {
+	if op.Path != "" {
+		return map[string]json.RawMessage{op.Path: op.Value}, nil
+	}
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &attributes); err != nil {
+		return nil, errors.New("an operation without path needs an object value")
+	}
+	return attributes, nil
+}
+
+// attributePath returns a path in lower case, without the schema of the
+// core resources that some identity providers prefix it with.
+func attributePath(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	for _, schema := range []string{schemaUser, schemaGroup} {
+		path = strings.TrimPrefix(path, strings.ToLower(schema)+":")
+	}
+	return path
+}
+
+// applyUserPatch applies PATCH operations to a user. Attributes that are
+// not stored, such as phone numbers, are ignored, as is removing required
+// ones.
+func applyUserPatch(u *models.SCIMUser, ops []patchOperation) error {
+	for _, op := range ops {
+		attributes, err := expand(op)
+		if err != nil {
+			return err
+		}
+		for path, value := range attributes {
+			if err := applyUserAttribute(u, op.Op, attributePath(path), value); err != nil {
+				return errors.New(path + ": " + err.Error())
+			}
+		}
+	}
+	return completeUser(u)
+}
+
+func applyUserAttribute(u *models.SCIMUser, op, path string, value json.RawMessage) error {
+	if op == "remove" {
+		if path == "externalid" {
+			u.ExternalID = ""
+		}
+		return nil
+	}
+
+	switch {
+	case path == "active":
+		var active flexBool
+		if err := json.Unmarshal(value, &active); err != nil {
+			return err
+		}
+		u.IsActive = bool(active)
+	case path == "username":
+		return json.Unmarshal(value, &u.UserName)
+	case path == "externalid":
+		return json.Unmarshal(value, &u.ExternalID)
+	case path == "displayname" || path == "name.formatted":
+		return json.Unmarshal(value, &u.Name)
+	case path == "name":
+		var n name
+		if err := json.Unmarshal(value, &n); err != nil {
+			return err
+		}
+		if f := formattedName(n); f != "" {
+			u.Name = f
+		}
+	case path == "emails":
+		var emails []email
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return err
+		}
+		if e := primaryEmail(emails); e != "" {
+			u.Email = e
+		}
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		return json.Unmarshal(value, &u.Email)
+	}
+	return nil
+}
+
+// groupState is what a PATCH request can change in a group.
+type groupState struct {
+	DisplayName string `json:"display_name"`
+	ExternalID  string `json:"external_id,omitempty"`
+	Members     []int  `json:"members"`
+}
+
+// memberFilterPattern matches a path that selects a member by ID, as in
+// members[value eq "12"].
+var memberFilterPattern = regexp.MustCompile(`(?i)^members\[(.*)\]$`)
+
+// applyGroupPatch applies PATCH operations to a group.
+func applyGroupPatch(g *groupState, ops []patchOperation) error {
+	for _, op := range ops {
+		attributes, err := expand(op)
+		if err != nil {
+			return err
+		}
+		for path, value := range attributes {
+			if err := applyGroupAttribute(g, op.Op, attributePath(path), value); err != nil {
+				return errors.New(path + ": " + err.Error())
+			}
+		}
+	}
+	if strings.TrimSpace(g.DisplayName) == "" {
+		return errors.New("displayName is required")
+	}
+	return nil
+}
+
+func applyGroupAttribute(g *groupState, op, path string, value json.RawMessage) error {
+	if match := memberFilterPattern.FindStringSubmatch(path); match != nil {
+		if op != "remove" {
+			return errors.New("members can only be removed by filter")
+		}
+		attribute, id, err := parseFilter(match[1])
+		if err != nil || attribute != "value" {
+			return errors.New("members can only be selected by value")
+		}
+		g.Members = slices.DeleteFunc(g.Members, func(m int) bool { return strconv.Itoa(m) == id })
+		return nil
+	}
+
+	switch path {
+	case "displayname":
+		if op == "remove" {
+			return errors.New("displayName is required")
+		}
+		return json.Unmarshal(value, &g.DisplayName)
+	case "externalid":
+		if op == "remove" {
+			g.ExternalID = ""
+			return nil
+		}
+		return json.Unmarshal(value, &g.ExternalID)
+	case "members":
+		var refs []reference
+		if op != "remove" || !isNull(value) {
+			if err := json.Unmarshal(value, &refs); err != nil {
+				return errors.New("members must be a list of references")
+			}
+		}
+		ids, err := memberIDs(refs)
+		if err != nil {
+			return err
+		}
+		switch {
+		case op == "replace":
+			g.Members = ids
+		case op == "add":
+			for _, id := range ids {
+				if !slices.Contains(g.Members, id) {
+					g.Members = append(g.Members, id)
+				}
+			}
+		case isNull(value):
+			g.Members = []int{}
+		default:
+			g.Members = slices.DeleteFunc(g.Members, func(m int) bool { return slices.Contains(ids, m) })
+		}
+	}
+	return nil
+}
+
+// isNull reports whether a JSON value is missing or null.
+func isNull(value json.RawMessage) bool {
+	v := strings.TrimSpace(string(value))
+	return v == "" || v == "null"
+}
@@ -0,0 +1,236 @@
+package scim
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/txlog/server/models"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter        string
+		wantAttribute string
+		wantValue     string
+		wantErr       bool
+	}{
+		{`userName eq "alice@example.com"`, "username", "alice@example.com", false},
+		{`externalId EQ "00u1"`, "externalid", "00u1", false},
+		{`emails.value eq "a\"b"`, "emails.value", `a"b`, false},
+		{`  displayName eq "Txlog Admins"  `, "displayname", "Txlog Admins", false},
+		{`userName sw "alice"`, "", "", true},
+		{`userName eq "a" and active eq true`, "", "", true},
+		{`userName eq alice`, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			attribute, value, err := parseFilter(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attribute != tt.wantAttribute || value != tt.wantValue {
+				t.Errorf("parseFilter() = %q, %q, want %q, %q", attribute, value, tt.wantAttribute, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestFromUserResource(t *testing.T) {
+	inactive := flexBool(false)
+	tests := []struct {
+		name     string
+		resource userResource
+		want     models.SCIMUser
+		wantErr  bool
+	}{
+		{
+			name: "primary email and display name",
+			resource: userResource{
+				UserName:    "alice",
+				DisplayName: "Alice Liddell",
+				Emails:      []email{{Value: "alice@home.example"}, {Value: "alice@example.com", Primary: true}},
+			},
+			want: models.SCIMUser{UserName: "alice", Email: "alice@example.com", Name: "Alice Liddell", IsActive: true},
+		},
+		{
+			name:     "email from userName and name parts",
+			resource: userResource{UserName: "bob@example.com", Name: &name{GivenName: "Bob", FamilyName: "Smith"}, Active: &inactive},
+			want:     models.SCIMUser{UserName: "bob@example.com", Email: "bob@example.com", Name: "Bob Smith"},
+		},
+		{
+			name:     "no email",
+			resource: userResource{UserName: "carol"},
+			wantErr:  true,
+		},
+		{
+			name:     "no userName",
+			resource: userResource{Emails: []email{{Value: "dave@example.com"}}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fromUserResource(tt.resource)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fromUserResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !userEqual(got, tt.want) {
+				t.Errorf("fromUserResource() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	base := models.SCIMUser{ID: 3, UserName: "alice@example.com", ExternalID: "00u1", Email: "alice@example.com", Name: "Alice", IsActive: true}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    models.SCIMUser
+		wantErr bool
+	}{
+		{
+			name: "deactivate with path",
+			body: `{"Operations":[{"op":"replace","path":"active","value":false}]}`,
+			want: models.SCIMUser{ID: 3, UserName: "alice@example.com", ExternalID: "00u1", Email: "alice@example.com", Name: "Alice"},
+		},
+		{
+			name: "deactivate with string value and no path",
+			body: `{"Operations":[{"op":"Replace","value":{"active":"False"}}]}`,
+			want: models.SCIMUser{ID: 3, UserName: "alice@example.com", ExternalID: "00u1", Email: "alice@example.com", Name: "Alice"},
+		},
+		{
+			name: "rename and change email",
+			body: `{"Operations":[
+				{"op":"replace","path":"urn:ietf:params:scim:schemas:core:2.0:User:displayName","value":"Alice Liddell"},
+				{"op":"replace","path":"emails[type eq \"work\"].value","value":"alice@corp.example"},
+				{"op":"remove","path":"externalId"},
+				{"op":"add","path":"phoneNumbers","value":[{"value":"555"}]}
+			]}`,
+			want: models.SCIMUser{ID: 3, UserName: "alice@example.com", Email: "alice@corp.example", Name: "Alice Liddell", IsActive: true},
+		},
+		{
+			name:    "empty userName",
+			body:    `{"Operations":[{"op":"replace","path":"userName","value":""}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid active",
+			body:    `{"Operations":[{"op":"replace","path":"active","value":"maybe"}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := mustPatchOps(t, tt.body)
+			got := base
+			err := applyUserPatch(&got, ops)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyUserPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !userEqual(got, tt.want) {
+				t.Errorf("applyUserPatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantName    string
+		wantMembers []int
+		wantErr     bool
+	}{
+		{
+			name:        "add members",
+			body:        `{"Operations":[{"op":"add","path":"members","value":[{"value":"2"},{"value":"4"}]}]}`,
+			wantName:    "Admins",
+			wantMembers: []int{1, 2, 4},
+		},
+		{
+			name:        "remove member by filter",
+			body:        `{"Operations":[{"op":"remove","path":"members[value eq \"2\"]"}]}`,
+			wantName:    "Admins",
+			wantMembers: []int{1},
+		},
+		{
+			name:        "remove members by value",
+			body:        `{"Operations":[{"op":"remove","path":"members","value":[{"value":"1"}]}]}`,
+			wantName:    "Admins",
+			wantMembers: []int{2},
+		},
+		{
+			name:        "remove all members",
+			body:        `{"Operations":[{"op":"remove","path":"members"}]}`,
+			wantName:    "Admins",
+			wantMembers: []int{},
+		},
+		{
+			name:        "replace without path",
+			body:        `{"Operations":[{"op":"replace","value":{"id":"7","displayName":"Operators","members":[{"value":"3"}]}}]}`,
+			wantName:    "Operators",
+			wantMembers: []int{3},
+		},
+		{
+			name:    "non-numeric member",
+			body:    `{"Operations":[{"op":"add","path":"members","value":[{"value":"alice"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "remove displayName",
+			body:    `{"Operations":[{"op":"remove","path":"displayName"}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := mustPatchOps(t, tt.body)
+			got := groupState{DisplayName: "Admins", Members: []int{1, 2}}
+			err := applyGroupPatch(&got, ops)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyGroupPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.DisplayName != tt.wantName || !slices.Equal(got.Members, tt.wantMembers) {
+				t.Errorf("applyGroupPatch() = %q %v, want %q %v", got.DisplayName, got.Members, tt.wantName, tt.wantMembers)
+			}
+		})
+	}
+}
+
+func TestPatchOps(t *testing.T) {
+	if _, err := patchOps(patchRequest{}); err == nil {
+		t.Error("patchOps() accepted a request without operations")
+	}
+	if _, err := patchOps(patchRequest{Operations: []patchOperation{{Op: "move"}}}); err == nil {
+		t.Error("patchOps() accepted an unknown operation")
+	}
+}
+
+func mustPatchOps(t *testing.T, body string) []patchOperation {
+	t.Helper()
+	var req patchRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("invalid test body: %v", err)
+	}
+	ops, err := patchOps(req)
+	if err != nil {
+		t.Fatalf("patchOps() error = %v", err)
+	}
+	return ops
+}
+
+func userEqual(a, b models.SCIMUser) bool {
+	return a.ID == b.ID && a.UserName == b.UserName && a.ExternalID == b.ExternalID &&
+		a.Email == b.Email && a.Name == b.Name && a.IsActive == b.IsActive
+}
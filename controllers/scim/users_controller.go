@@ -0,0 +1,296 @@
+package scim
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// userState is the state of a provisioned user recorded in the audit log.
+type userState struct {
+	UserName string `json:"user_name"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	IsActive bool   `json:"is_active"`
+}
+
+func stateOfUser(u models.SCIMUser) userState {
+	return userState{UserName: u.UserName, Email: u.Email, Name: u.Name, IsActive: u.IsActive}
+}
+
+// GetUsers lists the provisioned users. The filter query parameter accepts
+// userName, externalId or emails compared with eq.
+func GetUsers(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startIndex, count, err := parsePage(c)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		var filter models.SCIMUserFilter
+		if f := c.Query("filter"); f != "" {
+			attribute, value, err := parseFilter(f)
+			if err != nil {
+				fail(c, http.StatusBadRequest, scimTypeInvalidFilter, err.Error())
+				return
+			}
+			switch attribute {
+			case "username":
+				filter.UserName = value
+			case "externalid":
+				filter.ExternalID = value
+			case "emails", "emails.value":
+				filter.Email = value
+			default:
+				fail(c, http.StatusBadRequest, scimTypeInvalidFilter, "users cannot be filtered by "+attribute)
+				return
+			}
+		}
+
+		users, total, err := models.NewSCIMManager(db).ListUsers(filter, startIndex-1, count)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to list SCIM users", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		resources := make([]userResource, len(users))
+		for i, u := range users {
+			resources[i] = toUserResource(u)
+		}
+		render(c, http.StatusOK, listResponse{
+			Schemas:      []string{schemaListResponse},
+			TotalResults: total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	}
+}
+
+// GetUser returns a provisioned user.
+func GetUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		render(c, http.StatusOK, toUserResource(*user))
+	}
+}
+
+// PostUser provisions a user. A user with the same e-mail address who has
+// already logged in is linked to the identity provider rather than
+// created.
+func PostUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resource userResource
+		if err := c.ShouldBindJSON(&resource); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, "Invalid user: "+err.Error())
+			return
+		}
+		user, err := fromUserResource(resource)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		sm := models.NewSCIMManager(db)
+		id, created, err := sm.CreateUser(user)
+		if errors.Is(err, models.ErrSCIMConflict) {
+			fail(c, http.StatusConflict, scimTypeUniqueness, "A user with this userName or e-mail address is already provisioned, or is a local or LDAP account")
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create SCIM user", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+
+		idStr := strconv.Itoa(id)
+		if created {
+			logger.InfoContext(c.Request.Context(), "SCIM user created", "user_id", id)
+			audit.Record(c, db, models.AuditUserCreate, "user", idStr, nil, stateOfUser(user))
+		} else {
+			logger.InfoContext(c.Request.Context(), "Existing user linked to SCIM", "user_id", id)
+			audit.Record(c, db, models.AuditUserUpdate, "user", idStr, nil, stateOfUser(user))
+			if !user.IsActive {
+				endSessions(c, db, id)
+			}
+		}
+
+		saved, err := sm.GetUser(id)
+		if err != nil || saved == nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get SCIM user", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		c.Header("Location", location("Users", id))
+		render(c, http.StatusCreated, toUserResource(*saved))
+	}
+}
+
+// PutUser replaces the attributes of a provisioned user. Deactivating it
+// ends its sessions at once.
+func PutUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+
+		var resource userResource
+		if err := c.ShouldBindJSON(&resource); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, "Invalid user: "+err.Error())
+			return
+		}
+		after, err := fromUserResource(resource)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+		after.ID = before.ID
+
+		saveUser(c, db, *before, after)
+	}
+}
+
+// PatchUser changes some attributes of a provisioned user, as active to
+// deactivate it, which ends its sessions at once.
+func PatchUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+
+		var req patchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, "Invalid patch: "+err.Error())
+			return
+		}
+		ops, err := patchOps(req)
+		if err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidSyntax, err.Error())
+			return
+		}
+		after := *before
+		if err := applyUserPatch(&after, ops); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeInvalidValue, err.Error())
+			return
+		}
+
+		saveUser(c, db, *before, after)
+	}
+}
+
+// DeleteUser deactivates a provisioned user, ends its sessions and unlinks
+// it from the identity provider. The user is kept, with its history.
+func DeleteUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+
+		found, err := models.NewSCIMManager(db).DeleteUser(before.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete SCIM user", "error", err)
+			fail(c, http.StatusInternalServerError, "", "Database error")
+			return
+		}
+		if !found {
+			fail(c, http.StatusNotFound, "", "User not found")
+			return
+		}
+		endSessions(c, db, before.ID)
+
+		logger.InfoContext(c.Request.Context(), "SCIM user deleted", "user_id", before.ID)
+		after := stateOfUser(*before)
+		after.IsActive = false
+		audit.Record(c, db, models.AuditUserDeactivate, "user", strconv.Itoa(before.ID), stateOfUser(*before), after)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// loadUser returns the provisioned user named in the path, or writes a
+// 404 or 500 response and returns false.
+func loadUser(c *gin.Context, db *sql.DB) (*models.SCIMUser, bool) {
+	id, ok := pathID(c)
+	if !ok {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+	user, err := models.NewSCIMManager(db).GetUser(id)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to get SCIM user", "error", err)
+		fail(c, http.StatusInternalServerError, "", "Database error")
+		return nil, false
+	}
+	if user == nil {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// saveUser stores the new attributes of a user, records the change and
+// writes the user. A user that is no longer active loses its sessions.
+func saveUser(c *gin.Context, db *sql.DB, before, after models.SCIMUser) {
+	sm := models.NewSCIMManager(db)
+	found, err := sm.UpdateUser(after)
+	if errors.Is(err, models.ErrSCIMConflict) {
+		fail(c, http.StatusConflict, scimTypeUniqueness, "Another user has this userName or e-mail address")
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to update SCIM user", "error", err)
+		fail(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	if !found {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+
+	idStr := strconv.Itoa(after.ID)
+	if stateOfUser(before) != stateOfUser(after) {
+		action := models.AuditUserUpdate
+		if before.IsActive && !after.IsActive {
+			action = models.AuditUserDeactivate
+		}
+		logger.InfoContext(c.Request.Context(), "SCIM user updated", "user_id", after.ID, "is_active", after.IsActive)
+		audit.Record(c, db, action, "user", idStr, stateOfUser(before), stateOfUser(after))
+	}
+	if !after.IsActive {
+		endSessions(c, db, after.ID)
+	}
+
+	saved, err := sm.GetUser(after.ID)
+	if err != nil || saved == nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to get SCIM user", "error", err)
+		fail(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	render(c, http.StatusOK, toUserResource(*saved))
+}
+
+// endSessions ends the sessions of a deactivated user. Its personal access
+// tokens already stop working with the user.
+func endSessions(c *gin.Context, db *sql.DB, userID int) {
+	count, err := models.NewSessionManager(db).RevokeAll(userID)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to end sessions of deactivated user", "user_id", userID, "error", err)
+		return
+	}
+	if count > 0 {
+		logger.InfoContext(c.Request.Context(), "Sessions of deactivated user ended", "user_id", userID, "sessions", count)
+	}
+}
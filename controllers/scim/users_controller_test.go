@@ -0,0 +1,48 @@
+package scim
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPostUser_RefusesLocalAccount(t *testing.T) {
+	db := setupSCIMTestDB(t)
+	defer db.Close()
+	cleanupSCIMTestData(t, db)
+	defer cleanupSCIMTestData(t, db)
+
+	_, err := db.Exec(`
+		INSERT INTO users (sub, email, name, is_active, role)
+		VALUES ('local:scim-test-admin', 'scim-test-admin@example.com', 'Admin', true, 'admin')
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create local account: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/scim/v2/Users", PostUser(db))
+
+	w := httptest.NewRecorder()
+	body := `{"userName":"scim-test-admin@example.com","active":false}`
+	req, _ := http.NewRequest("POST", "/scim/v2/Users", bytes.NewBufferString(body))
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	var active bool
+	var userName *string
+	err = db.QueryRow(`SELECT is_active, scim_user_name FROM users WHERE sub = 'local:scim-test-admin'`).Scan(&active, &userName)
+	if err != nil {
+		t.Fatalf("Failed to get local account: %v", err)
+	}
+	if !active || userName != nil {
+		t.Error("Expected the local account to be left alone")
+	}
+}
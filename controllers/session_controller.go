@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	"github.com/txlog/server/auth"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+)
+
+// GetSessionSettings renders the page where users see and end their
+// sessions
+func GetSessionSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderSessionSettings(c, db, http.StatusOK, "")
+	}
+}
+
+// renderSessionSettings renders the sessions page, with an error message
+// when a form was rejected.
+func renderSessionSettings(c *gin.Context, db *sql.DB, status int, message string) {
+	data := gin.H{
+		"Context":     c,
+		"title":       "Sessions",
+		"sessions":    []models.Session{},
+		"idleTimeout": util.FormatDuration(auth.Sessions().IdleTimeout),
+		"maxLifetime": util.FormatDuration(auth.Sessions().MaxLifetime),
+		"saved":       c.Query("saved"),
+		"error":       message,
+	}
+
+	if user := currentUser(c); user != nil {
+		sessionID, _ := c.Cookie("session_id")
+		sessions, err := models.NewSessionManager(db).ListForUser(user.ID, sessionID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to list sessions", "error", err)
+			data["error"] = "Failed to load your sessions."
+			status = http.StatusInternalServerError
+		} else {
+			data["sessions"] = sessions
+		}
+	}
+
+	c.HTML(status, "session_settings.html", data)
+}
+
+// PostSessionRevoke ends a session of the signed-in user. Ending the current
+// session logs the user out.
+// Expects form field: ref (int).
+func PostSessionRevoke(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sessions require a signed-in user"})
+			return
+		}
+
+		ref, err := strconv.ParseInt(c.PostForm("ref"), 10, 64)
+		if err != nil {
+			renderSessionSettings(c, db, http.StatusBadRequest, "Invalid session.")
+			return
+		}
+
+		// Find out whether the current session is the one being ended
+		sessionID, _ := c.Cookie("session_id")
+		sm := models.NewSessionManager(db)
+		sessions, err := sm.ListForUser(user.ID, sessionID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to list sessions", "error", err)
+			renderSessionSettings(c, db, http.StatusInternalServerError, "Failed to end the session.")
+			return
+		}
+		current := false
+		for _, s := range sessions {
+			if s.Ref == ref {
+				current = s.Current
+			}
+		}
+
+		found, err := sm.Revoke(user.ID, ref)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to revoke session", "error", err)
+			renderSessionSettings(c, db, http.StatusInternalServerError, "Failed to end the session.")
+			return
+		}
+		if !found {
+			renderSessionSettings(c, db, http.StatusNotFound, "The session has already ended.")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Session revoked", "session_ref", ref)
+		audit.Record(c, db, models.AuditSessionRevoke, "session", strconv.FormatInt(ref, 10), nil, nil)
+
+		if current {
+			c.SetCookie("session_id", "", -1, "/", "", isSecureCookie(), true)
+			c.Redirect(http.StatusSeeOther, "/login")
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/settings/sessions?saved=revoked")
+	}
+}
+
+// PostSessionRevokeOthers ends every session of the signed-in user except
+// the current one
+func PostSessionRevokeOthers(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sessions require a signed-in user"})
+			return
+		}
+
+		sessionID, _ := c.Cookie("session_id")
+		count, err := models.NewSessionManager(db).RevokeOthers(user.ID, sessionID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to revoke sessions", "error", err)
+			renderSessionSettings(c, db, http.StatusInternalServerError, "Failed to end your other sessions.")
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Other sessions revoked", "count", count)
+		audit.Record(c, db, models.AuditSessionRevokeOthers, "user", strconv.Itoa(user.ID), nil, gin.H{"sessions": count})
+		c.Redirect(http.StatusSeeOther, "/settings/sessions?saved=revoked_others")
+	}
+}
+
+// PostAdminTerminateSessions ends every session of a user, who has to log
+// in again
+// Expects form field: user_id (int).
+func PostAdminTerminateSessions(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.PostForm("user_id")
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		count, err := models.NewSessionManager(db).RevokeAll(userID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to terminate user sessions", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to terminate sessions"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "User sessions terminated", "user_id", userIDStr, "count", count)
+		audit.Record(c, db, models.AuditUserSessionsTerminate, "user", userIDStr, nil, gin.H{"sessions": count})
+		c.Redirect(http.StatusSeeOther, "/admin?sessions_terminated=1")
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	"github.com/txlog/server/forwarder"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// PostAdminSyslogCreate creates a syslog forwarder.
+// Expects form fields: name (string), address (host:port), protocol (udp,
+// tcp or tls), format (cef or json) and environments (comma-separated; empty
+// means every environment).
+func PostAdminSyslogCreate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.PostForm("name"))
+		address := strings.TrimSpace(c.PostForm("address"))
+		protocol := c.PostForm("protocol")
+		format := c.PostForm("format")
+
+		var environments []string
+		for _, e := range strings.Split(c.PostForm("environments"), ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				environments = append(environments, e)
+			}
+		}
+
+		if err := models.ValidateSyslogForwarder(name, address, protocol, format); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		f, err := models.NewSyslogForwarderManager(db).CreateForwarder(name, address, protocol, format, environments)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create syslog forwarder", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create syslog forwarder"})
+			return
+		}
+
+		reloadForwarders()
+		logger.InfoContext(c.Request.Context(), "Syslog forwarder created", "forwarder_id", f.ID, "name", f.Name)
+		audit.Record(c, db, models.AuditSyslogCreate, "syslog_forwarder", strconv.Itoa(f.ID), nil, gin.H{"name": name, "address": address, "protocol": protocol, "format": format, "environments": environments})
+		c.Redirect(http.StatusSeeOther, "/admin?syslog_saved=1")
+	}
+}
+
+// PostAdminSyslogToggle enables or disables a syslog forwarder.
+// Expects form fields: id (int), active ("true" or "false").
+func PostAdminSyslogToggle(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		active := c.PostForm("active") == "true"
+
+		if err := models.NewSyslogForwarderManager(db).SetForwarderActive(id, active); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to update syslog forwarder", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update syslog forwarder"})
+			return
+		}
+
+		reloadForwarders()
+		logger.InfoContext(c.Request.Context(), "Syslog forwarder toggled", "forwarder_id", id, "active", active)
+		audit.Record(c, db, models.AuditSyslogToggle, "syslog_forwarder", strconv.Itoa(id), gin.H{"active": !active}, gin.H{"active": active})
+		c.Redirect(http.StatusSeeOther, "/admin?syslog_saved=1")
+	}
+}
+
+// PostAdminSyslogDelete deletes a syslog forwarder.
+// Expects form field: id (int).
+func PostAdminSyslogDelete(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		if err := models.NewSyslogForwarderManager(db).DeleteForwarder(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete syslog forwarder", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete syslog forwarder"})
+			return
+		}
+
+		reloadForwarders()
+		logger.InfoContext(c.Request.Context(), "Syslog forwarder deleted", "forwarder_id", id)
+		audit.Record(c, db, models.AuditSyslogDelete, "syslog_forwarder", strconv.Itoa(id), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/admin?syslog_deleted=1")
+	}
+}
+
+// reloadForwarders applies forwarder changes on this instance right away;
+// other instances pick them up on their next scheduled reload.
+func reloadForwarders() {
+	if err := forwarder.Reload(); err != nil {
+		logger.Error("Failed to reload syslog forwarders", "error", err)
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+)
+
+// GetTokenSettings renders the page where users manage their personal
+// access tokens
+func GetTokenSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderTokenSettings(c, db, http.StatusOK, gin.H{"saved": c.Query("saved")})
+	}
+}
+
+// renderTokenSettings renders the personal access tokens page with extra
+// data, such as an error message or the secret of a new token.
+func renderTokenSettings(c *gin.Context, db *sql.DB, status int, extra gin.H) {
+	data := gin.H{
+		"Context":          c,
+		"title":            "API Tokens",
+		"tokens":           []models.ApiKey{},
+		"scopes":           []string{},
+		"environmentNames": []models.EnvironmentName{},
+		"maxTokens":        models.MaxPersonalTokens,
+	}
+
+	if user := currentUser(c); user != nil {
+		data["scopes"] = models.PersonalTokenScopes(user.Role)
+
+		tokens, err := models.NewPersonalTokenManager(db).ListForUser(user.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to list personal access tokens", "error", err)
+			data["error"] = "Failed to load your tokens."
+			status = http.StatusInternalServerError
+		} else {
+			data["tokens"] = tokens
+		}
+
+		environmentNames, err := models.NewTopologyManager(db).ListEnvironmentNames()
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to get environment names", "error", err)
+		} else {
+			data["environmentNames"] = environmentNames
+		}
+	}
+
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	// The secret of a new token is only shown once
+	c.Header("Cache-Control", "no-store")
+	c.HTML(status, "token_settings.html", data)
+}
+
+// PostTokenCreate creates a personal access token for the signed-in user
+// and shows its secret once. The token acts as the user, so it can only be
+// granted the scopes of the user's role.
+// Expects form fields: name (string), scopes (repeated), and optionally
+// expires_on (YYYY-MM-DD), allowed_cidrs and environment, as for API keys.
+func PostTokenCreate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tokens require a signed-in user"})
+			return
+		}
+
+		name := strings.TrimSpace(c.PostForm("name"))
+		if len(name) < 3 || len(name) > 255 {
+			renderTokenSettings(c, db, http.StatusBadRequest, gin.H{"error": "Name must be between 3 and 255 characters."})
+			return
+		}
+
+		restrictions, err := parseAPIKeyRestrictions(c)
+		if err != nil {
+			renderTokenSettings(c, db, http.StatusBadRequest, gin.H{"error": "Invalid token: " + err.Error() + "."})
+			return
+		}
+		allowed := models.PersonalTokenScopes(user.Role)
+		for _, scope := range restrictions.Scopes {
+			if !slices.Contains(allowed, scope) {
+				renderTokenSettings(c, db, http.StatusForbidden, gin.H{"error": "Your role cannot grant the " + scope + " scope."})
+				return
+			}
+		}
+
+		tm := models.NewPersonalTokenManager(db)
+		count, err := tm.CountActive(user.ID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to count personal access tokens", "error", err)
+			renderTokenSettings(c, db, http.StatusInternalServerError, gin.H{"error": "Failed to create the token."})
+			return
+		}
+		if count >= models.MaxPersonalTokens {
+			renderTokenSettings(c, db, http.StatusBadRequest, gin.H{"error": "You already have " + strconv.Itoa(count) + " active tokens. Revoke one first."})
+			return
+		}
+
+		secret, keyHash, keyPrefix, err := util.GenerateToken(util.PersonalTokenPrefix)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to generate personal access token", "error", err)
+			renderTokenSettings(c, db, http.StatusInternalServerError, gin.H{"error": "Failed to create the token."})
+			return
+		}
+
+		tokenID, err := tm.Create(user.ID, name, keyHash, keyPrefix, restrictions)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create personal access token", "error", err)
+			renderTokenSettings(c, db, http.StatusInternalServerError, gin.H{"error": "Failed to create the token."})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Personal access token created", "api_key_id", tokenID, "scopes", restrictions.Scopes)
+		audit.Record(c, db, models.AuditPersonalTokenCreate, "api_key", strconv.Itoa(tokenID), nil, gin.H{"name": name, "key_prefix": keyPrefix, "restrictions": restrictions})
+		renderTokenSettings(c, db, http.StatusOK, gin.H{"newToken": secret, "newTokenName": name})
+	}
+}
+
+// PostTokenRevoke revokes a personal access token of the signed-in user.
+// Expects form field: token_id (int).
+func PostTokenRevoke(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tokens require a signed-in user"})
+			return
+		}
+
+		tokenIDStr := c.PostForm("token_id")
+		tokenID, err := strconv.Atoi(tokenIDStr)
+		if err != nil {
+			renderTokenSettings(c, db, http.StatusBadRequest, gin.H{"error": "Invalid token."})
+			return
+		}
+
+		found, err := models.NewPersonalTokenManager(db).Revoke(user.ID, tokenID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to revoke personal access token", "error", err)
+			renderTokenSettings(c, db, http.StatusInternalServerError, gin.H{"error": "Failed to revoke the token."})
+			return
+		}
+		if !found {
+			renderTokenSettings(c, db, http.StatusNotFound, gin.H{"error": "The token has already been revoked."})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Personal access token revoked", "api_key_id", tokenID)
+		audit.Record(c, db, models.AuditPersonalTokenRevoke, "api_key", tokenIDStr, gin.H{"is_active": true}, gin.H{"is_active": false})
+		c.Redirect(http.StatusSeeOther, "/settings/tokens?saved=revoked")
+	}
+}
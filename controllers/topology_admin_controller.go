@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
 	logger "github.com/txlog/server/logger"
 	"github.com/txlog/server/models"
 )
@@ -31,12 +32,13 @@ func PostAdminTopologyCreatePattern(db *sql.DB) gin.HandlerFunc {
 		tm := models.NewTopologyManager(db)
 		p, err := tm.CreatePattern(template, order)
 		if err != nil {
-			logger.Error("Failed to create topology pattern: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to create topology pattern", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Topology pattern created: " + p.Template)
+		logger.InfoContext(c.Request.Context(), "Topology pattern created", "template", p.Template)
+		audit.Record(c, db, models.AuditTopologyPatternCreate, "topology_pattern", strconv.Itoa(p.ID), nil, patternState(p))
 		c.Redirect(http.StatusSeeOther, "/admin?topology_saved=1")
 	}
 }
@@ -57,13 +59,15 @@ func PostAdminTopologyUpdatePattern(db *sql.DB) gin.HandlerFunc {
 		order, _ := strconv.Atoi(orderStr)
 
 		tm := models.NewTopologyManager(db)
+		before := findPattern(c, tm, id)
 		if err := tm.UpdatePattern(id, template, order); err != nil {
-			logger.Error("Failed to update topology pattern: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to update topology pattern", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Topology pattern updated: id=" + idStr)
+		logger.InfoContext(c.Request.Context(), "Topology pattern updated", "pattern_id", idStr)
+		audit.Record(c, db, models.AuditTopologyPatternUpdate, "topology_pattern", idStr, before, gin.H{"template": template, "display_order": order})
 		c.Redirect(http.StatusSeeOther, "/admin?topology_saved=1")
 	}
 }
@@ -80,13 +84,15 @@ func PostAdminTopologyDeletePattern(db *sql.DB) gin.HandlerFunc {
 		}
 
 		tm := models.NewTopologyManager(db)
+		before := findPattern(c, tm, id)
 		if err := tm.DeletePattern(id); err != nil {
-			logger.Error("Failed to delete topology pattern: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete topology pattern", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Topology pattern deleted: id=" + idStr)
+		logger.InfoContext(c.Request.Context(), "Topology pattern deleted", "pattern_id", idStr)
+		audit.Record(c, db, models.AuditTopologyPatternDelete, "topology_pattern", idStr, before, nil)
 		c.Redirect(http.StatusSeeOther, "/admin?topology_deleted=1")
 	}
 }
@@ -110,7 +116,7 @@ func GetAdminTopologyPreview(db *sql.DB) gin.HandlerFunc {
 		}
 		hostnames, err := tm.PreviewPattern(res.CompiledPattern)
 		if err != nil {
-			logger.Error("Failed to preview topology pattern: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to preview topology pattern", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -135,7 +141,7 @@ func GetAdminTopologyPreviewEnv(db *sql.DB) gin.HandlerFunc {
 		tm := models.NewTopologyManager(db)
 		hostnames, err := tm.PreviewEnvironment(matchValue)
 		if err != nil {
-			logger.Error("Failed to preview environment match: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to preview environment match", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -159,7 +165,7 @@ func GetAdminTopologyPreviewSvc(db *sql.DB) gin.HandlerFunc {
 		tm := models.NewTopologyManager(db)
 		hostnames, err := tm.PreviewService(matchValue)
 		if err != nil {
-			logger.Error("Failed to preview service match: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to preview service match", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -190,12 +196,13 @@ func PostAdminTopologyCreateEnvironment(db *sql.DB) gin.HandlerFunc {
 		tm := models.NewTopologyManager(db)
 		e, err := tm.CreateEnvironmentName(matchValue, name)
 		if err != nil {
-			logger.Error("Failed to create environment name: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to create environment name", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Environment name created: " + e.MatchValue + " -> " + e.Name)
+		logger.InfoContext(c.Request.Context(), "Environment name created", "match_value", e.MatchValue, "name", e.Name)
+		audit.Record(c, db, models.AuditTopologyNameCreate, "environment_name", strconv.Itoa(e.ID), nil, environmentState(e))
 		c.Redirect(http.StatusSeeOther, "/admin?topology_saved=1")
 	}
 }
@@ -215,13 +222,15 @@ func PostAdminTopologyUpdateEnvironment(db *sql.DB) gin.HandlerFunc {
 		name := c.PostForm("name")
 
 		tm := models.NewTopologyManager(db)
+		before := findEnvironmentName(c, tm, id)
 		if err := tm.UpdateEnvironmentName(id, matchValue, name); err != nil {
-			logger.Error("Failed to update environment name: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to update environment name", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Environment name updated: id=" + idStr)
+		logger.InfoContext(c.Request.Context(), "Environment name updated", "environment_id", idStr)
+		audit.Record(c, db, models.AuditTopologyNameUpdate, "environment_name", idStr, before, gin.H{"match_value": matchValue, "name": name})
 		c.Redirect(http.StatusSeeOther, "/admin?topology_saved=1")
 	}
 }
@@ -238,13 +247,15 @@ func PostAdminTopologyDeleteEnvironment(db *sql.DB) gin.HandlerFunc {
 		}
 
 		tm := models.NewTopologyManager(db)
+		before := findEnvironmentName(c, tm, id)
 		if err := tm.DeleteEnvironmentName(id); err != nil {
-			logger.Error("Failed to delete environment name: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete environment name", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Environment name deleted: id=" + idStr)
+		logger.InfoContext(c.Request.Context(), "Environment name deleted", "environment_id", idStr)
+		audit.Record(c, db, models.AuditTopologyNameDelete, "environment_name", idStr, before, nil)
 		c.Redirect(http.StatusSeeOther, "/admin?topology_deleted=1")
 	}
 }
@@ -275,12 +286,13 @@ func PostAdminTopologyCreateService(db *sql.DB) gin.HandlerFunc {
 		tm := models.NewTopologyManager(db)
 		s, err := tm.CreateServiceName(matchValue, name, hasPods, envIDs)
 		if err != nil {
-			logger.Error("Failed to create service name: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to create service name", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Service name created: " + s.MatchValue + " -> " + s.Name)
+		logger.InfoContext(c.Request.Context(), "Service name created", "match_value", s.MatchValue, "name", s.Name)
+		audit.Record(c, db, models.AuditTopologyNameCreate, "service_name", strconv.Itoa(s.ID), nil, gin.H{"match_value": matchValue, "name": name, "has_pods": hasPods, "environment_ids": envIDs})
 		c.Redirect(http.StatusSeeOther, "/admin?topology_saved=1")
 	}
 }
@@ -326,13 +338,15 @@ func PostAdminTopologyUpdateService(db *sql.DB) gin.HandlerFunc {
 		}
 
 		tm := models.NewTopologyManager(db)
+		before := findServiceName(c, tm, id)
 		if err := tm.UpdateServiceName(id, matchValue, name, hasPods, envIDs); err != nil {
-			logger.Error("Failed to update service name: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to update service name", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Service name updated: id=" + idStr)
+		logger.InfoContext(c.Request.Context(), "Service name updated", "service_id", idStr)
+		audit.Record(c, db, models.AuditTopologyNameUpdate, "service_name", idStr, before, gin.H{"match_value": matchValue, "name": name, "has_pods": hasPods, "environment_ids": envIDs})
 		c.Redirect(http.StatusSeeOther, "/admin?topology_saved=1")
 	}
 }
@@ -349,13 +363,73 @@ func PostAdminTopologyDeleteService(db *sql.DB) gin.HandlerFunc {
 		}
 
 		tm := models.NewTopologyManager(db)
+		before := findServiceName(c, tm, id)
 		if err := tm.DeleteServiceName(id); err != nil {
-			logger.Error("Failed to delete service name: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to delete service name", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		logger.Info("Service name deleted: id=" + idStr)
+		logger.InfoContext(c.Request.Context(), "Service name deleted", "service_id", idStr)
+		audit.Record(c, db, models.AuditTopologyNameDelete, "service_name", idStr, before, nil)
 		c.Redirect(http.StatusSeeOther, "/admin?topology_deleted=1")
 	}
 }
+
+// findPattern returns the audit state of a topology pattern, or nil when it
+// cannot be loaded.
+func findPattern(c *gin.Context, tm *models.TopologyManager, id int) gin.H {
+	patterns, err := tm.ListPatterns()
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to list topology patterns", "error", err)
+		return nil
+	}
+	for i := range patterns {
+		if patterns[i].ID == id {
+			return patternState(&patterns[i])
+		}
+	}
+	return nil
+}
+
+// patternState returns the audit state of a topology pattern.
+func patternState(p *models.TopologyPattern) gin.H {
+	return gin.H{"template": p.Template, "display_order": p.DisplayOrder}
+}
+
+// findEnvironmentName returns the audit state of an environment name
+// mapping, or nil when it cannot be loaded.
+func findEnvironmentName(c *gin.Context, tm *models.TopologyManager, id int) gin.H {
+	names, err := tm.ListEnvironmentNames()
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to list environment names", "error", err)
+		return nil
+	}
+	for i := range names {
+		if names[i].ID == id {
+			return environmentState(&names[i])
+		}
+	}
+	return nil
+}
+
+// environmentState returns the audit state of an environment name mapping.
+func environmentState(e *models.EnvironmentName) gin.H {
+	return gin.H{"match_value": e.MatchValue, "name": e.Name}
+}
+
+// findServiceName returns the audit state of a service name mapping, or nil
+// when it cannot be loaded.
+func findServiceName(c *gin.Context, tm *models.TopologyManager, id int) gin.H {
+	names, err := tm.ListServiceNames()
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to list service names", "error", err)
+		return nil
+	}
+	for _, s := range names {
+		if s.ID == id {
+			return gin.H{"match_value": s.MatchValue, "name": s.Name, "has_pods": s.HasPods, "environment_ids": s.EnvironmentIDs}
+		}
+	}
+	return nil
+}
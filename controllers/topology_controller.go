@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"database/sql"
+	"math"
 	"net/http"
 	"slices"
 
@@ -26,6 +27,11 @@ type TopologyView struct {
 	TotalAssets       int  // sum of all assets across pods + out-of-topology
 	TotalNeedsRestart int  // sum of needs_restarting across all pods
 	SelectionRequired bool // true if user needs to select env/svc to see data
+
+	RiskiestServices  []models.RiskGroup // shown while no service is selected
+	RiskScore         float64            // sum of the asset risk scores of the selected service
+	RiskOpenVulns     int
+	RiskCriticalVulns int
 }
 
 // PodView represents one pod group within the topology view.
@@ -34,6 +40,7 @@ type PodView struct {
 	Assets       []PodAsset
 	TotalAssets  int
 	NeedsRestart int
+	RiskScore    float64
 }
 
 // PodAsset is a single asset row within a pod.
@@ -44,6 +51,9 @@ type PodAsset struct {
 	OS              string
 	AgentVersion    string
 	NeedsRestarting bool
+	RiskScore       float64
+	OpenVulns       int
+	CriticalVulns   int
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -59,13 +69,20 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 		// Check if any patterns are configured.
 		patterns, err := tm.ListPatterns()
 		if err != nil {
-			logger.Error("Failed to list topology patterns: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to list topology patterns", "error", err)
 		}
 		hasPatterns := len(patterns) > 0
 
-		// Load dropdowns.
+		// Load dropdowns, limited to the user's scope.
+		scope := userScope(c)
 		envs, _ := tm.ListEnvironmentNames()
 		svcs, _ := tm.ListServiceNames()
+		envs = slices.DeleteFunc(envs, func(e models.EnvironmentName) bool {
+			return !scope.AcceptsEnvironment(e.Name, e.MatchValue)
+		})
+		svcs = slices.DeleteFunc(svcs, func(s models.ServiceName) bool {
+			return !scope.AcceptsService(s.Name, s.MatchValue)
+		})
 
 		// Resolve selected env/svc from query params.
 		envParam := c.Query("env")
@@ -122,6 +139,27 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 		// Check if we have both selections.
 		if selectedEnv == nil || selectedSvc == nil {
 			view.SelectionRequired = true
+
+			envFilter := ""
+			if selectedEnv != nil {
+				envFilter = selectedEnv.MatchValue
+			}
+			limit := 5
+			if scope.Restricted() {
+				limit = 0
+			}
+			riskiest, err := models.NewRiskManager(db).Rank(models.RiskLevelService, envFilter, "", limit)
+			if err != nil {
+				logger.ErrorContext(c.Request.Context(), "Failed to rank service risk", "error", err)
+			}
+			if scope.Restricted() {
+				riskiest = slices.DeleteFunc(riskiest, func(g models.RiskGroup) bool {
+					return !scope.AcceptsEnvironment(g.EnvironmentName, g.Environment) || !scope.AcceptsService(g.ServiceName, g.Service)
+				})
+				riskiest = riskiest[:min(len(riskiest), 5)]
+			}
+			view.RiskiestServices = riskiest
+
 			c.HTML(http.StatusOK, "topology.html", gin.H{
 				"Context": c,
 				"title":   "Topology - Txlog Server",
@@ -143,12 +181,22 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 		assetsQuery := buildTopologyAssetsQuery(envCondition, svcCondition)
 		rows, err := db.QueryContext(c.Request.Context(), assetsQuery)
 		if err != nil {
-			logger.Error("Failed to query topology assets: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Failed to query topology assets", "error", err)
 			c.HTML(http.StatusInternalServerError, "500.html", gin.H{"error": err.Error()})
 			return
 		}
 		defer rows.Close()
 
+		// Current risk scores of the selected service, keyed by machine_id.
+		assetRisks := map[string]models.AssetRisk{}
+		risks, err := models.NewRiskManager(db).ListAssetRisks(envCondition, svcCondition)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to load asset risk scores", "error", err)
+		}
+		for _, r := range risks {
+			assetRisks[r.MachineID] = r
+		}
+
 		// Group assets by pod ID.
 		podMap := map[string]*PodView{}
 		var podOrder []string
@@ -167,7 +215,7 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 				&agentVersion, &os,
 				&needsRestarting,
 			); err != nil {
-				logger.Error("Failed to scan topology row: " + err.Error())
+				logger.ErrorContext(c.Request.Context(), "Failed to scan topology row", "error", err)
 				continue
 			}
 
@@ -179,10 +227,18 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 				AgentVersion:    agentVersion.String,
 				NeedsRestarting: needsRestarting.Bool,
 			}
+			if r, ok := assetRisks[machineID]; ok {
+				asset.RiskScore = r.Score
+				asset.OpenVulns = r.OpenVulns
+				asset.CriticalVulns = r.CriticalVulns
+			}
 
 			if !podID.Valid || podID.String == "" {
-				// No topology pattern matched — Out of Topology
-				outOfTopology = append(outOfTopology, asset)
+				// No topology pattern matched — Out of Topology, which is
+				// outside every restricted scope
+				if !scope.Restricted() {
+					outOfTopology = append(outOfTopology, asset)
+				}
 				continue
 			}
 
@@ -201,6 +257,10 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 			if asset.NeedsRestarting {
 				pv.NeedsRestart++
 			}
+			pv.RiskScore += asset.RiskScore
+			view.RiskScore += asset.RiskScore
+			view.RiskOpenVulns += asset.OpenVulns
+			view.RiskCriticalVulns += asset.CriticalVulns
 		}
 
 		// Build ordered pods slice.
@@ -209,6 +269,7 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 		totalNeedsRestart := 0
 		for _, pid := range podOrder {
 			pv := *podMap[pid]
+			pv.RiskScore = math.Round(pv.RiskScore*100) / 100
 			totalAssets += pv.TotalAssets
 			totalNeedsRestart += pv.NeedsRestart
 			pods = append(pods, pv)
@@ -219,6 +280,7 @@ func GetTopologyIndex(db *sql.DB) gin.HandlerFunc {
 		view.OutOfTopology = outOfTopology
 		view.TotalAssets = totalAssets
 		view.TotalNeedsRestart = totalNeedsRestart
+		view.RiskScore = math.Round(view.RiskScore*100) / 100
 
 		c.HTML(http.StatusOK, "topology.html", gin.H{
 			"Context": c,
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/audit"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+)
+
+// PostAdminWebhookCreate creates a webhook subscription.
+// Expects form fields: name (string), url (string), secret (optional string,
+// generated when empty) and events (repeated; none means every event).
+func PostAdminWebhookCreate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.PostForm("name"))
+		url := strings.TrimSpace(c.PostForm("url"))
+		events := c.PostFormArray("events")
+
+		if err := models.ValidateWebhookSubscription(name, url, events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret := strings.TrimSpace(c.PostForm("secret"))
+		if secret == "" {
+			var err error
+			secret, err = util.GenerateWebhookSecret()
+			if err != nil {
+				logger.ErrorContext(c.Request.Context(), "Failed to generate webhook secret", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+				return
+			}
+		}
+
+		sub, err := models.NewWebhookManager(db).CreateSubscription(name, url, secret, events)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to create webhook subscription", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook subscription"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Webhook subscription created", "subscription_id", sub.ID, "name", sub.Name)
+		audit.Record(c, db, models.AuditWebhookCreate, "webhook", strconv.Itoa(sub.ID), nil, gin.H{"name": sub.Name, "url": url, "events": events})
+		c.Redirect(http.StatusSeeOther, "/admin?webhook_saved=1")
+	}
+}
+
+// PostAdminWebhookToggle enables or disables a webhook subscription.
+// Expects form fields: id (int), active ("true" or "false").
+func PostAdminWebhookToggle(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		active := c.PostForm("active") == "true"
+
+		if err := models.NewWebhookManager(db).SetSubscriptionActive(id, active); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to update webhook subscription", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook subscription"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Webhook subscription toggled", "subscription_id", id, "active", active)
+		audit.Record(c, db, models.AuditWebhookToggle, "webhook", strconv.Itoa(id), gin.H{"active": !active}, gin.H{"active": active})
+		c.Redirect(http.StatusSeeOther, "/admin?webhook_saved=1")
+	}
+}
+
+// PostAdminWebhookDelete deletes a webhook subscription and its delivery log.
+// Expects form field: id (int).
+func PostAdminWebhookDelete(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.PostForm("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		if err := models.NewWebhookManager(db).DeleteSubscription(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to delete webhook subscription", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook subscription"})
+			return
+		}
+
+		logger.InfoContext(c.Request.Context(), "Webhook subscription deleted", "subscription_id", id)
+		audit.Record(c, db, models.AuditWebhookDelete, "webhook", strconv.Itoa(id), nil, nil)
+		c.Redirect(http.StatusSeeOther, "/admin?webhook_deleted=1")
+	}
+}
+
+// PostAdminWebhookRetry queues a failed delivery again.
+// Expects form field: id (int64).
+func PostAdminWebhookRetry(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.PostForm("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		if err := models.NewWebhookManager(db).RetryDelivery(id); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to retry webhook delivery", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry webhook delivery"})
+			return
+		}
+
+		audit.Record(c, db, models.AuditWebhookRetry, "webhook_delivery", strconv.FormatInt(id, 10), nil, nil)
+
+		c.Redirect(http.StatusSeeOther, "/admin?webhook_retried=1")
+	}
+}
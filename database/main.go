@@ -13,6 +13,7 @@ import (
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/lib/pq"
 	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/tracing"
 )
 
 var Db *sql.DB
@@ -31,7 +32,8 @@ var migrationsFS embed.FS
 //   - PGSQL_PASSWORD: Database password
 //   - PGSQL_SSLMODE: SSL mode for connection
 //
-// 2. Establishes connection to the database and configures connection pool
+// 2. Establishes connection to the database and configures connection pool.
+// When tracing is enabled, the connection is instrumented by tracing.OpenDB
 //
 // 3. Sets up database migrations:
 //   - Creates a postgres driver instance
@@ -52,9 +54,9 @@ func ConnectDatabase() {
 		os.Getenv("PGSQL_SSLMODE"),
 	)
 
-	db, errSql := sql.Open("postgres", psqlSetup)
+	db, errSql := tracing.OpenDB("postgres", psqlSetup)
 	if errSql != nil {
-		logger.Error("There is an error while connecting to the database: " + errSql.Error())
+		logger.Error("There is an error while connecting to the database", "error", errSql)
 		panic(errSql)
 	} else {
 		Db = db
@@ -70,41 +72,41 @@ func ConnectDatabase() {
 
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
-		logger.Error("Failed to create database driver: " + err.Error())
+		logger.Error("Failed to create database driver", "error", err)
 		return
 	}
 
 	source, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		logger.Error("Failed to create migration source: " + err.Error())
+		logger.Error("Failed to create migration source", "error", err)
 		return
 	}
 
 	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
 	if err != nil {
-		logger.Error("Failed to create migration instance: " + err.Error())
+		logger.Error("Failed to create migration instance", "error", err)
 		return
 	}
 
 	// Check if database is in a dirty state
 	version, dirty, err := m.Version()
 	if err != nil && err != migrate.ErrNilVersion {
-		logger.Error("Failed to get migration version: " + err.Error())
+		logger.Error("Failed to get migration version", "error", err)
 	}
 
 	// If database is dirty, try to force to the current version and retry
 	if dirty {
-		logger.Warn(fmt.Sprintf("Database is in dirty state at version %d. Attempting to fix...", version))
+		logger.Warn("Database is in dirty state. Attempting to fix...", "version", version)
 		if err := m.Force(int(version)); err != nil {
-			logger.Error("Failed to force migration version: " + err.Error())
+			logger.Error("Failed to force migration version", "error", err)
 			logger.Error("Manual intervention required. Run: migrate force <version>")
 			return
 		}
-		logger.Info(fmt.Sprintf("Forced database to clean state at version %d", version))
+		logger.Info("Forced database to clean state", "version", version)
 	}
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		logger.Error("Failed to apply migrations: " + err.Error())
+		logger.Error("Failed to apply migrations", "error", err)
 		logger.Error("Migration may be incomplete. Check database state and consider manual migration.")
 	} else if err == migrate.ErrNoChange {
 		logger.Info("Migrations: no new migrations to apply.")
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_job_runs_job_started;
+DROP TABLE IF EXISTS job_runs;
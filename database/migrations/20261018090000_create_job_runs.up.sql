@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id                    BIGSERIAL PRIMARY KEY,
+    job_name              VARCHAR(64)  NOT NULL,
+    trigger               VARCHAR(16)  NOT NULL DEFAULT 'cron',
+    status                VARCHAR(16)  NOT NULL DEFAULT 'running',
+    phase                 VARCHAR(32)  NOT NULL DEFAULT '',
+    progress_current      INT          NOT NULL DEFAULT 0,
+    progress_total        INT          NOT NULL DEFAULT 0,
+    packages_checked      INT          NOT NULL DEFAULT 0,
+    vulnerabilities_found INT          NOT NULL DEFAULT 0,
+    error_count           INT          NOT NULL DEFAULT 0,
+    last_error            TEXT,
+    started_at            TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at            TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    finished_at           TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_started ON job_runs (job_name, started_at DESC);
+
+COMMENT ON TABLE job_runs IS 'History of background job executions (one row per run), including live progress while the run is active';
+COMMENT ON COLUMN job_runs.job_name IS 'Scheduler job identifier, e.g. vulnerabilities';
+COMMENT ON COLUMN job_runs.trigger IS 'What started the run: cron or manual';
+COMMENT ON COLUMN job_runs.status IS 'running, succeeded, failed or interrupted (server stopped before the run finished)';
+COMMENT ON COLUMN job_runs.phase IS 'Current step of a running job, e.g. fetching or scoring';
+COMMENT ON COLUMN job_runs.progress_current IS 'Items processed so far in the current phase';
+COMMENT ON COLUMN job_runs.progress_total IS 'Total items to process in the current phase';
+COMMENT ON COLUMN job_runs.packages_checked IS 'Number of package/ecosystem pairs queried against OSV';
+COMMENT ON COLUMN job_runs.vulnerabilities_found IS 'Number of distinct vulnerabilities returned by OSV during the run';
+COMMENT ON COLUMN job_runs.error_count IS 'Number of non-fatal errors (failed OSV batches, failed upserts) during the run';
+COMMENT ON COLUMN job_runs.last_error IS 'Most recent error message recorded during the run';
+COMMENT ON COLUMN job_runs.updated_at IS 'Last progress update; used to detect stalled runs';
+COMMENT ON COLUMN job_runs.finished_at IS 'When the run ended; NULL while running';
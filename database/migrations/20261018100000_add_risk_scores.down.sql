@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS risk_score_history;
+DROP INDEX IF EXISTS idx_asset_risk_scores_topology;
+DROP TABLE IF EXISTS asset_risk_scores;
+DROP TABLE IF EXISTS asset_labels;
+ALTER TABLE vulnerabilities DROP COLUMN IF EXISTS exploitability_score;
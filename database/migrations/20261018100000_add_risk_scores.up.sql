@@ -0,0 +1,59 @@
+-- CVSS 3.x exploitability sub-score (0.1-3.9), NULL when the advisory carries no CVSS vector
+ALTER TABLE vulnerabilities ADD COLUMN IF NOT EXISTS exploitability_score DECIMAL(3,1);
+
+COMMENT ON COLUMN vulnerabilities.exploitability_score IS 'CVSS 3.x exploitability sub-score (8.22 x AV x AC x PR x UI); NULL when OSV provided no CVSS vector';
+
+CREATE TABLE IF NOT EXISTS asset_labels (
+    hostname    TEXT         NOT NULL,
+    name        VARCHAR(63)  NOT NULL,
+    value       VARCHAR(255) NOT NULL,
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hostname, name)
+);
+
+COMMENT ON TABLE asset_labels IS 'Free-form key/value labels attached to a logical asset (hostname), so they survive machine_id replacements';
+COMMENT ON COLUMN asset_labels.name IS 'Label name, e.g. criticality';
+COMMENT ON COLUMN asset_labels.value IS 'Label value; for criticality one of low, medium, high, critical';
+
+CREATE TABLE IF NOT EXISTS asset_risk_scores (
+    machine_id      TEXT          PRIMARY KEY,
+    hostname        TEXT          NOT NULL,
+    environment     TEXT          NOT NULL DEFAULT '',
+    service         TEXT          NOT NULL DEFAULT '',
+    pod             TEXT          NOT NULL DEFAULT '',
+    criticality     VARCHAR(16)   NOT NULL DEFAULT 'medium',
+    open_vulns      INT           NOT NULL DEFAULT 0,
+    critical_vulns  INT           NOT NULL DEFAULT 0,
+    high_vulns      INT           NOT NULL DEFAULT 0,
+    medium_vulns    INT           NOT NULL DEFAULT 0,
+    low_vulns       INT           NOT NULL DEFAULT 0,
+    max_cvss        DECIMAL(4,1)  NOT NULL DEFAULT 0,
+    score           DECIMAL(12,2) NOT NULL DEFAULT 0,
+    computed_at     TIMESTAMPTZ   NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_risk_scores_topology ON asset_risk_scores (environment, service, pod);
+
+COMMENT ON TABLE asset_risk_scores IS 'Current risk score of every active asset, rebuilt by the risk scheduler job';
+COMMENT ON COLUMN asset_risk_scores.environment IS 'Topology environment match_value (or raw :env capture); empty when unresolved';
+COMMENT ON COLUMN asset_risk_scores.service IS 'Topology service match_value (or raw :svc capture); empty when unresolved';
+COMMENT ON COLUMN asset_risk_scores.pod IS 'Topology pod (:seq capture); Default when the hostname carries none';
+COMMENT ON COLUMN asset_risk_scores.open_vulns IS 'Distinct vulnerabilities affecting packages currently installed on the asset';
+COMMENT ON COLUMN asset_risk_scores.score IS 'Sum of CVSS x exploitability factor over open vulnerabilities, multiplied by the criticality weight';
+
+CREATE TABLE IF NOT EXISTS risk_score_history (
+    snapshot_date   DATE          NOT NULL,
+    scope           VARCHAR(16)   NOT NULL,
+    environment     TEXT          NOT NULL DEFAULT '',
+    service         TEXT          NOT NULL DEFAULT '',
+    pod             TEXT          NOT NULL DEFAULT '',
+    score           DECIMAL(14,2) NOT NULL DEFAULT 0,
+    asset_count     INT           NOT NULL DEFAULT 0,
+    open_vulns      INT           NOT NULL DEFAULT 0,
+    critical_vulns  INT           NOT NULL DEFAULT 0,
+    PRIMARY KEY (snapshot_date, scope, environment, service, pod)
+);
+
+COMMENT ON TABLE risk_score_history IS 'Daily risk snapshot per topology level (fleet, environment, service, pod) for trend charts; the last run of the day wins';
+COMMENT ON COLUMN risk_score_history.scope IS 'fleet, environment, service or pod';
+COMMENT ON COLUMN risk_score_history.open_vulns IS 'Sum of open vulnerabilities across the assets of the group';
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS exposure_notifications (
+    vulnerability_id  VARCHAR(100) NOT NULL,
+    machine_id        TEXT         NOT NULL,
+    channel           VARCHAR(32)  NOT NULL,
+    hostname          TEXT         NOT NULL,
+    packages          TEXT         NOT NULL DEFAULT '',
+    status            VARCHAR(16)  NOT NULL DEFAULT 'pending',
+    attempts          INT          NOT NULL DEFAULT 0,
+    last_error        TEXT,
+    detected_at       TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    sent_at           TIMESTAMPTZ,
+    PRIMARY KEY (vulnerability_id, machine_id, channel)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exposure_notifications_pending ON exposure_notifications (channel) WHERE status = 'pending';
+
+COMMENT ON TABLE exposure_notifications IS 'One row per vulnerability, asset and delivery channel. Deduplicates new exposure notifications and retries failed deliveries. No foreign key to vulnerabilities so that an OSV reset does not re-trigger them';
+COMMENT ON COLUMN exposure_notifications.channel IS 'Delivery channel: webhook or email';
+COMMENT ON COLUMN exposure_notifications.packages IS 'Comma-separated name-version-release of the affected packages on the asset';
+COMMENT ON COLUMN exposure_notifications.status IS 'pending, sent or failed (gave up after the maximum number of attempts)';
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id          SERIAL       PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL,
+    url         TEXT         NOT NULL,
+    secret      TEXT         NOT NULL,
+    events      TEXT[]       NOT NULL DEFAULT '{}',
+    is_active   BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE webhook_subscriptions IS 'Admin-managed endpoints that receive server events as signed JSON POSTs';
+COMMENT ON COLUMN webhook_subscriptions.secret IS 'HMAC-SHA256 key used to sign the X-Txlog-Signature header';
+COMMENT ON COLUMN webhook_subscriptions.events IS 'Events delivered to this endpoint; empty means every event';
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id                BIGSERIAL    PRIMARY KEY,
+    subscription_id   INT          NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event             VARCHAR(64)  NOT NULL,
+    payload           JSONB        NOT NULL,
+    status            VARCHAR(16)  NOT NULL DEFAULT 'pending',
+    attempts          INT          NOT NULL DEFAULT 0,
+    next_attempt_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_status_code  INT,
+    last_error        TEXT,
+    created_at        TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    delivered_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
+
+COMMENT ON TABLE webhook_deliveries IS 'Durable delivery queue and log of webhook events, one row per event and subscription';
+COMMENT ON COLUMN webhook_deliveries.status IS 'pending (queued or waiting for a retry), succeeded or failed (gave up after the maximum number of attempts)';
+COMMENT ON COLUMN webhook_deliveries.next_attempt_at IS 'When the next attempt is due; pushed back with exponential backoff after each failure';
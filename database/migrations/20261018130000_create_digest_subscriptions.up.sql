@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id       INT          PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency     VARCHAR(16)  NOT NULL,
+    sections      TEXT[]       NOT NULL DEFAULT '{}',
+    last_sent_at  TIMESTAMPTZ,
+    last_error    TEXT,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE digest_subscriptions IS 'Per-user e-mail digest subscriptions, sent to users.email';
+COMMENT ON COLUMN digest_subscriptions.frequency IS 'daily or weekly';
+COMMENT ON COLUMN digest_subscriptions.sections IS 'Digest sections to include: restart, failed_executions, vulnerabilities, anomalies; empty means all';
+COMMENT ON COLUMN digest_subscriptions.last_sent_at IS 'When the last digest was sent or skipped for having nothing to report';
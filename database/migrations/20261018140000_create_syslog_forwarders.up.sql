@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS syslog_forwarders (
+    id            SERIAL       PRIMARY KEY,
+    name          VARCHAR(100) NOT NULL,
+    address       TEXT         NOT NULL,
+    protocol      VARCHAR(8)   NOT NULL DEFAULT 'udp',
+    format        VARCHAR(8)   NOT NULL DEFAULT 'cef',
+    environments  TEXT[]       NOT NULL DEFAULT '{}',
+    is_active     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE syslog_forwarders IS 'Admin-managed syslog collectors (SIEM) that receive transaction, package change, anomaly and admin action events';
+COMMENT ON COLUMN syslog_forwarders.address IS 'Collector host:port';
+COMMENT ON COLUMN syslog_forwarders.protocol IS 'udp, tcp or tls';
+COMMENT ON COLUMN syslog_forwarders.format IS 'Message payload: cef or json';
+COMMENT ON COLUMN syslog_forwarders.environments IS 'Topology environment names whose asset events are forwarded; empty means every asset. Admin actions are always forwarded';
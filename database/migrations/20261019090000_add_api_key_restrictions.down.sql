@@ -0,0 +1,6 @@
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_scopes_check;
+ALTER TABLE api_keys
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS allowed_cidrs,
+    DROP COLUMN IF EXISTS environment;
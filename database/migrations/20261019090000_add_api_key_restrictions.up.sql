@@ -0,0 +1,14 @@
+ALTER TABLE api_keys
+    ADD COLUMN IF NOT EXISTS scopes        TEXT[]      NOT NULL DEFAULT '{ingest,read,admin}',
+    ADD COLUMN IF NOT EXISTS expires_at    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS allowed_cidrs CIDR[]      NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS environment   VARCHAR(255);
+
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_scopes_check;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_scopes_check
+    CHECK (cardinality(scopes) > 0 AND scopes <@ ARRAY['ingest', 'read', 'admin']);
+
+COMMENT ON COLUMN api_keys.scopes IS 'Granted scopes: ingest (agent uploads), read (read endpoints and inventories) and admin (every endpoint). Keys created before scopes existed have all three';
+COMMENT ON COLUMN api_keys.expires_at IS 'Moment the key stops being accepted; NULL means it never expires';
+COMMENT ON COLUMN api_keys.allowed_cidrs IS 'Networks the key may be used from; empty means any address';
+COMMENT ON COLUMN api_keys.environment IS 'Topology environment the key is bound to; NULL means every environment';
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS enrollment_tokens (
+    id            SERIAL       PRIMARY KEY,
+    name          VARCHAR(255) NOT NULL,
+    token_hash    VARCHAR(64)  NOT NULL UNIQUE,
+    token_prefix  VARCHAR(16)  NOT NULL,
+    max_uses      INT,
+    use_count     INT          NOT NULL DEFAULT 0,
+    expires_at    TIMESTAMPTZ,
+    is_active     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_by    INT          REFERENCES users(id) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_used_at  TIMESTAMPTZ,
+    CONSTRAINT enrollment_tokens_name_check CHECK (char_length(name) >= 3),
+    CONSTRAINT enrollment_tokens_max_uses_check CHECK (max_uses IS NULL OR max_uses > 0)
+);
+
+COMMENT ON TABLE enrollment_tokens IS 'Admin-issued tokens that agents exchange for a per-machine credential at POST /v1/enroll';
+COMMENT ON COLUMN enrollment_tokens.token_hash IS 'SHA-256 hash of the token';
+COMMENT ON COLUMN enrollment_tokens.max_uses IS 'Number of machines the token can enroll; NULL means unlimited';
+COMMENT ON COLUMN enrollment_tokens.expires_at IS 'When the token stops enrolling machines; NULL means never';
+
+CREATE TABLE IF NOT EXISTS machine_credentials (
+    id                   SERIAL       PRIMARY KEY,
+    machine_id           TEXT         NOT NULL UNIQUE,
+    hostname             TEXT         NOT NULL,
+    credential_hash      VARCHAR(64)  NOT NULL UNIQUE,
+    credential_prefix    VARCHAR(16)  NOT NULL,
+    enrollment_token_id  INT          REFERENCES enrollment_tokens(id) ON DELETE SET NULL,
+    is_active            BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at           TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_used_at         TIMESTAMPTZ
+);
+
+COMMENT ON TABLE machine_credentials IS 'Per-machine agent credentials issued at enrollment; each one can only submit data for its own machine_id';
+COMMENT ON COLUMN machine_credentials.hostname IS 'Hostname reported by the agent when it enrolled';
+COMMENT ON COLUMN machine_credentials.credential_hash IS 'SHA-256 hash of the credential';
+COMMENT ON COLUMN machine_credentials.is_active IS 'Revoked credentials are rejected; the machine can then enroll again';
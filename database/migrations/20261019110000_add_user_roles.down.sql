@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN DEFAULT false;
+
+UPDATE users SET is_admin = (role = 'admin');
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role,
+    DROP COLUMN IF EXISTS environments,
+    DROP COLUMN IF EXISTS services;
+
+COMMENT ON COLUMN users.is_admin IS 'Whether the user has administrative privileges (can manage other users, API keys, system settings)';
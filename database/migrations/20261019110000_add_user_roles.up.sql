@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role         VARCHAR(32) NOT NULL DEFAULT 'viewer',
+    ADD COLUMN IF NOT EXISTS environments TEXT[]      NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS services     TEXT[]      NOT NULL DEFAULT '{}';
+
+UPDATE users SET role = 'admin' WHERE is_admin IS TRUE;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('viewer', 'operator', 'security_analyst', 'admin'));
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+
+COMMENT ON COLUMN users.role IS 'Role of the user: viewer (read only), operator (manages assets), security_analyst (runs vulnerability scans) or admin (everything)';
+COMMENT ON COLUMN users.environments IS 'Topology environments the user can see, by name or match value; empty means every environment';
+COMMENT ON COLUMN users.services IS 'Topology services the user can see, by name or match value; empty means every service';
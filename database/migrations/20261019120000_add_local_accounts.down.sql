@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS password_resets;
+
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS totp_pending;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS password_hash,
+    DROP COLUMN IF EXISTS password_changed_at,
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,29 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS password_hash       TEXT,
+    ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS totp_secret         TEXT,
+    ADD COLUMN IF NOT EXISTS totp_enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS totp_last_step      BIGINT  NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN users.password_hash IS 'bcrypt hash of the local password; NULL for users who only log in with OIDC or LDAP';
+COMMENT ON COLUMN users.totp_secret IS 'Base32 TOTP secret, set while two-factor authentication is being enabled and once enabled';
+COMMENT ON COLUMN users.totp_enabled IS 'Whether local logins also require a TOTP code';
+COMMENT ON COLUMN users.totp_last_step IS 'Time step of the last TOTP code accepted, so a code cannot be used twice';
+
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS totp_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN user_sessions.totp_pending IS 'Inactive session of a local login waiting for its TOTP code';
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    token_hash  VARCHAR(64)  PRIMARY KEY,
+    user_id     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by  INT          REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ  NOT NULL,
+    used_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);
+
+COMMENT ON TABLE password_resets IS 'One-time links, issued by admins, that let a local user set a new password';
+COMMENT ON COLUMN password_resets.token_hash IS 'SHA-256 hash of the token in the link';
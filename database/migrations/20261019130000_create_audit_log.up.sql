@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id           BIGSERIAL    PRIMARY KEY,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    actor_type   VARCHAR(32)  NOT NULL,
+    actor_id     INT,
+    actor_name   TEXT         NOT NULL DEFAULT '',
+    action       VARCHAR(64)  NOT NULL,
+    target_type  VARCHAR(64)  NOT NULL DEFAULT '',
+    target_id    TEXT         NOT NULL DEFAULT '',
+    success      BOOLEAN      NOT NULL DEFAULT TRUE,
+    before_state JSONB,
+    after_state  JSONB,
+    ip_address   TEXT         NOT NULL DEFAULT '',
+    request_id   TEXT         NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+COMMENT ON TABLE audit_log IS 'Append-only record of administrative and security-relevant actions';
+COMMENT ON COLUMN audit_log.actor_type IS 'user, api_key, machine_credential, client_certificate or anonymous';
+COMMENT ON COLUMN audit_log.actor_id IS 'ID of the user or API key; not a foreign key, so entries outlive the actor';
+COMMENT ON COLUMN audit_log.actor_name IS 'E-mail of the user or name of the key at the time of the action';
+COMMENT ON COLUMN audit_log.action IS 'What was done, such as asset.delete or auth.login';
+COMMENT ON COLUMN audit_log.success IS 'False for refused attempts, such as failed logins';
+COMMENT ON COLUMN audit_log.before_state IS 'State of the target before the action, for updates and deletions';
+COMMENT ON COLUMN audit_log.after_state IS 'State of the target after the action, for creations and updates';
+
+-- Entries can only be added: updates, deletions and truncation are refused
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
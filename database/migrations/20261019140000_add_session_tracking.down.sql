@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_user_sessions_ref;
+
+ALTER TABLE user_sessions
+    DROP COLUMN IF EXISTS ref,
+    DROP COLUMN IF EXISTS absolute_expires_at,
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip_address;
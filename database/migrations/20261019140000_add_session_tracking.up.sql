@@ -0,0 +1,19 @@
+ALTER TABLE user_sessions
+    ADD COLUMN IF NOT EXISTS ref                 BIGSERIAL,
+    ADD COLUMN IF NOT EXISTS absolute_expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS last_seen_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS user_agent          TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ip_address          TEXT        NOT NULL DEFAULT '';
+
+-- Sessions created before sliding expiry end when they used to
+UPDATE user_sessions SET absolute_expires_at = expires_at WHERE absolute_expires_at IS NULL;
+ALTER TABLE user_sessions ALTER COLUMN absolute_expires_at SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_ref ON user_sessions(ref);
+
+COMMENT ON COLUMN user_sessions.ref IS 'Public reference of the session, used to revoke it without exposing its ID';
+COMMENT ON COLUMN user_sessions.expires_at IS 'When the session ends: the idle timeout after its last request, capped by absolute_expires_at';
+COMMENT ON COLUMN user_sessions.absolute_expires_at IS 'When the session ends whatever its activity, the maximum lifetime after login';
+COMMENT ON COLUMN user_sessions.last_seen_at IS 'Time of the last request of the session, updated at most once a minute';
+COMMENT ON COLUMN user_sessions.user_agent IS 'User-Agent of the browser that logged in';
+COMMENT ON COLUMN user_sessions.ip_address IS 'Client IP address at login';
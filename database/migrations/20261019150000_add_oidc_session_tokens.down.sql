@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_user_sessions_oidc_sid;
+DROP INDEX IF EXISTS idx_user_sessions_oidc_subject;
+
+ALTER TABLE user_sessions
+    DROP COLUMN IF EXISTS oidc_subject,
+    DROP COLUMN IF EXISTS oidc_sid,
+    DROP COLUMN IF EXISTS oidc_id_token,
+    DROP COLUMN IF EXISTS oidc_refresh_token,
+    DROP COLUMN IF EXISTS oidc_checked_at;
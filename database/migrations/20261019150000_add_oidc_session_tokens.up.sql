@@ -0,0 +1,15 @@
+ALTER TABLE user_sessions
+    ADD COLUMN IF NOT EXISTS oidc_subject       TEXT,
+    ADD COLUMN IF NOT EXISTS oidc_sid           TEXT,
+    ADD COLUMN IF NOT EXISTS oidc_id_token      TEXT,
+    ADD COLUMN IF NOT EXISTS oidc_refresh_token TEXT,
+    ADD COLUMN IF NOT EXISTS oidc_checked_at    TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_oidc_subject ON user_sessions(oidc_subject) WHERE oidc_subject IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_user_sessions_oidc_sid ON user_sessions(oidc_sid) WHERE oidc_sid IS NOT NULL;
+
+COMMENT ON COLUMN user_sessions.oidc_subject IS 'Subject (sub) of the ID token of an OIDC login, NULL for other logins';
+COMMENT ON COLUMN user_sessions.oidc_sid IS 'Session ID (sid) of the identity provider, matched by back-channel logouts';
+COMMENT ON COLUMN user_sessions.oidc_id_token IS 'Raw ID token, sent as id_token_hint when logging out of the provider';
+COMMENT ON COLUMN user_sessions.oidc_refresh_token IS 'Refresh token used to check that the provider still accepts the user';
+COMMENT ON COLUMN user_sessions.oidc_checked_at IS 'When the provider last accepted the refresh token';
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    kind            VARCHAR(16)  NOT NULL,
+    key             TEXT         NOT NULL,
+    failures        INT          NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ,
+    PRIMARY KEY (kind, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failure_at ON login_failures(last_failure_at);
+
+COMMENT ON TABLE login_failures IS 'Failed logins per username and client IP, shared by every instance to slow down password guessing';
+COMMENT ON COLUMN login_failures.kind IS 'username or ip';
+COMMENT ON COLUMN login_failures.key IS 'Login method and username, such as ldap:jdoe, or the client IP address';
+COMMENT ON COLUMN login_failures.failures IS 'Failures in a row, forgotten once the lockout duration passes without one';
+COMMENT ON COLUMN login_failures.locked_until IS 'Logins are refused until then: a short delay after each failure, the lockout after too many';
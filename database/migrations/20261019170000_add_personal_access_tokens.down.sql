@@ -0,0 +1,3 @@
+DELETE FROM api_keys WHERE user_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_api_keys_user_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,6 @@
+ALTER TABLE api_keys
+    ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id) WHERE user_id IS NOT NULL;
+
+COMMENT ON COLUMN api_keys.user_id IS 'Owner of a personal access token, whose role and scope apply to its requests; NULL for keys shared by admins';
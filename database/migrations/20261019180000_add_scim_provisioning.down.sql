@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS scim_group_members;
+DROP TABLE IF EXISTS scim_groups;
+
+DROP INDEX IF EXISTS idx_users_scim_user_name;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS scim_user_name,
+    DROP COLUMN IF EXISTS scim_external_id;
@@ -0,0 +1,30 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS scim_user_name   TEXT,
+    ADD COLUMN IF NOT EXISTS scim_external_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_scim_user_name ON users(LOWER(scim_user_name)) WHERE scim_user_name IS NOT NULL;
+
+COMMENT ON COLUMN users.scim_user_name IS 'userName of a user provisioned over SCIM; NULL for users the identity provider does not manage';
+COMMENT ON COLUMN users.scim_external_id IS 'externalId the identity provider sent for a user provisioned over SCIM';
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id            SERIAL       PRIMARY KEY,
+    display_name  TEXT         NOT NULL UNIQUE,
+    external_id   TEXT,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE scim_groups IS 'Groups pushed by the identity provider over SCIM, whose names map to roles';
+COMMENT ON COLUMN scim_groups.display_name IS 'Name of the group, matched against the OIDC_*_GROUP variables';
+COMMENT ON COLUMN scim_groups.external_id IS 'externalId the identity provider sent for the group, also matched against the OIDC_*_GROUP variables';
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id  INTEGER  NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id   INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user_id ON scim_group_members(user_id);
+
+COMMENT ON TABLE scim_group_members IS 'Users in each SCIM group';
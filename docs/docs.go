@@ -24,6 +24,63 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/v1/admin/jobs/vulnerabilities/runs": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns the most recent runs of the OSV vulnerabilities job, newest first. A run with status \"running\" carries live progress (phase, progress_current, progress_total).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Vulnerability job run history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of runs to return (1-100, default 20)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.JobRun"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
         "/v1/assets/requiring-restart": {
             "get": {
                 "security": [
@@ -62,6 +119,188 @@ const docTemplate = `{
                 }
             }
         },
+        "/v1/audit": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns the audit log of administrative and security-relevant actions, newest first, as JSON or CSV.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Audit log export",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Part of the actor name (e-mail, API key name or hostname)",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, or a kind of action ending with a dot, as in user.",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target type or ID",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Text in the actor, target or states",
+                        "name": "search",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only refused attempts, such as failed logins",
+                        "name": "failed",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start date (YYYY-MM-DD) or time (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End date (YYYY-MM-DD, included) or time (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries to return (1-10000, default 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Response format: json (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditEntry"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/enroll": {
+            "post": {
+                "description": "Exchanges an enrollment token for a credential bound to the machine ID, to be sent as X-API-Key on later requests. The credential can only upload data for that machine and is only returned once. A machine with an active credential cannot enroll again until an admin revokes it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Enroll a machine",
+                "parameters": [
+                    {
+                        "description": "Enrollment token and machine",
+                        "name": "Enrollment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.EnrollmentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.EnrollmentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
         "/v1/executions": {
             "get": {
                 "security": [
@@ -181,6 +420,130 @@ const docTemplate = `{
                 }
             }
         },
+        "/v1/inventory/ansible": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns every active asset in the Ansible dynamic inventory script format (--list), including _meta.hostvars. Hosts are grouped by topology environment (env_*), service (svc_*) and pod (pod_\u003cenv\u003e_\u003cservice\u003e_\u003cpod\u003e), OS (os_*), agent version (agent_*), restart flag (needs_restarting) and labels (label_\u003cname\u003e_\u003cvalue\u003e). Host variables are prefixed with txlog_.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "inventory"
+                ],
+                "summary": "Ansible dynamic inventory",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/inventory/prometheus": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns the active assets in the Prometheus http_sd_config format, one target group per asset scraping hostname:port. Asset details are exposed as __meta_txlog_* labels (hostname, machine_id, environment, service, pod, os, agent_version, needs_restarting, critical_cves and label_\u003cname\u003e) for relabeling.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "inventory"
+                ],
+                "summary": "Prometheus HTTP service discovery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Port of each target (default 9100)",
+                        "name": "port",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets of this environment (friendly name or :env value)",
+                        "name": "env",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets of this service (friendly name or :svc value)",
+                        "name": "svc",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets of this pod",
+                        "name": "pod",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets running this OS",
+                        "name": "os",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets running this agent version",
+                        "name": "agent_version",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only include assets that need (true) or do not need (false) a restart",
+                        "name": "needs_restarting",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PrometheusTargetGroup"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
         "/v1/items": {
             "get": {
                 "security": [
@@ -420,19 +783,144 @@ const docTemplate = `{
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Returns daily aggregated data on vulnerabilities fixed by transactions",
+                "description": "Returns daily aggregated data on vulnerabilities fixed by transactions",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Get vulnerability mitigation metrics over time",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Number of days to look back (default 30)",
+                        "name": "days",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/v1.VulnerabilitySeries"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/reports/monthly": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns a list of package updates for a specific month/year, including the number of assets in the period, OS version, package RPM, servers affected, and total updates",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Get monthly package update report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Month (1-12)",
+                        "name": "month",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Year (e.g., 2024)",
+                        "name": "year",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.MonthlyReportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request - invalid parameters",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/risk": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns the current risk score of topology groups (or single assets), highest first. An asset's score is the sum of CVSS x exploitability factor over its open vulnerabilities, multiplied by its criticality label weight; groups sum the scores of their assets.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "reports"
+                    "risk"
                 ],
-                "summary": "Get vulnerability mitigation metrics over time",
+                "summary": "Risk ranking",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Aggregation level: fleet, environment, service (default), pod or asset",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets of this environment (match value)",
+                        "name": "env",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include assets of this service (match value)",
+                        "name": "svc",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "Number of days to look back (default 30)",
-                        "name": "days",
+                        "description": "Maximum number of groups to return (1-500, default 20)",
+                        "name": "limit",
                         "in": "query"
                     }
                 ],
@@ -440,14 +928,20 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/v1.VulnerabilitySeries"
+                            "$ref": "#/definitions/v1.RiskResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     },
                     "500": {
-                        "description": "Internal server error",
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -458,46 +952,65 @@ const docTemplate = `{
                 }
             }
         },
-        "/v1/reports/monthly": {
+        "/v1/risk/history": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Returns a list of package updates for a specific month/year, including the number of assets in the period, OS version, package RPM, servers affected, and total updates",
+                "description": "Returns one point per day with the risk score of a topology group, oldest first, for trend charts. The group is identified by level plus the env, svc and pod parameters that level requires.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "reports"
+                    "risk"
                 ],
-                "summary": "Get monthly package update report",
+                "summary": "Risk history",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Month (1-12)",
-                        "name": "month",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "Aggregation level: fleet (default), environment, service or pod",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Environment match value (required for environment, service and pod)",
+                        "name": "env",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Service match value (required for service and pod)",
+                        "name": "svc",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pod identifier (required for pod)",
+                        "name": "pod",
+                        "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "Year (e.g., 2024)",
-                        "name": "year",
-                        "in": "query",
-                        "required": true
+                        "description": "Number of days to return (1-365, default 30)",
+                        "name": "days",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/v1.MonthlyReportResponse"
+                            "$ref": "#/definitions/v1.RiskHistoryResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad request - invalid parameters",
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -506,7 +1019,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Internal server error",
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -630,6 +1143,20 @@ const docTemplate = `{
                     "transactions"
                 ],
                 "summary": "Get saved transactions IDs for a host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Machine ID",
+                        "name": "machine_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hostname",
+                        "name": "hostname",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -732,6 +1259,75 @@ const docTemplate = `{
                 "AnomalyDowngrade"
             ]
         },
+        "models.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor_id": {
+                    "type": "integer"
+                },
+                "actor_name": {
+                    "type": "string"
+                },
+                "actor_type": {
+                    "type": "string"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip_address": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "success": {
+                    "type": "boolean"
+                },
+                "target_id": {
+                    "type": "string"
+                },
+                "target_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.EnrollmentRequest": {
+            "type": "object",
+            "properties": {
+                "enrollment_token": {
+                    "type": "string"
+                },
+                "hostname": {
+                    "type": "string"
+                },
+                "machine_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.EnrollmentResponse": {
+            "type": "object",
+            "properties": {
+                "credential": {
+                    "type": "string"
+                },
+                "machine_id": {
+                    "type": "string"
+                }
+            }
+        },
         "models.Execution": {
             "type": "object",
             "required": [
@@ -776,6 +1372,53 @@ const docTemplate = `{
                 }
             }
         },
+        "models.JobRun": {
+            "type": "object",
+            "properties": {
+                "error_count": {
+                    "type": "integer"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "job_name": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "packages_checked": {
+                    "type": "integer"
+                },
+                "phase": {
+                    "type": "string"
+                },
+                "progress_current": {
+                    "type": "integer"
+                },
+                "progress_total": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "trigger": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "vulnerabilities_found": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.Package": {
             "type": "object",
             "required": [
@@ -799,6 +1442,97 @@ const docTemplate = `{
                 }
             }
         },
+        "models.PrometheusTargetGroup": {
+            "type": "object",
+            "properties": {
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "targets": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.RiskGroup": {
+            "type": "object",
+            "properties": {
+                "asset_count": {
+                    "type": "integer"
+                },
+                "critical_vulns": {
+                    "type": "integer"
+                },
+                "criticality": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "environment_name": {
+                    "type": "string"
+                },
+                "high_vulns": {
+                    "type": "integer"
+                },
+                "hostname": {
+                    "type": "string"
+                },
+                "level": {
+                    "type": "string"
+                },
+                "machine_id": {
+                    "type": "string"
+                },
+                "max_asset_score": {
+                    "type": "number"
+                },
+                "max_cvss": {
+                    "type": "number"
+                },
+                "open_vulns": {
+                    "type": "integer"
+                },
+                "pod": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "service_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.RiskHistoryPoint": {
+            "type": "object",
+            "properties": {
+                "asset_count": {
+                    "type": "integer"
+                },
+                "critical_vulns": {
+                    "type": "integer"
+                },
+                "date": {
+                    "description": "YYYY-MM-DD",
+                    "type": "string"
+                },
+                "open_vulns": {
+                    "type": "integer"
+                },
+                "score": {
+                    "type": "number"
+                }
+            }
+        },
         "models.Transaction": {
             "type": "object",
             "properties": {
@@ -978,6 +1712,46 @@ const docTemplate = `{
                 }
             }
         },
+        "v1.RiskHistoryResponse": {
+            "type": "object",
+            "properties": {
+                "environment": {
+                    "type": "string"
+                },
+                "level": {
+                    "type": "string"
+                },
+                "pod": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.RiskHistoryPoint"
+                    }
+                },
+                "service": {
+                    "type": "string"
+                }
+            }
+        },
+        "v1.RiskResponse": {
+            "type": "object",
+            "properties": {
+                "computed_at": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.RiskGroup"
+                    }
+                },
+                "level": {
+                    "type": "string"
+                }
+            }
+        },
         "v1.VulnerabilitySeries": {
             "type": "object",
             "properties": {
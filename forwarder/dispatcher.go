@@ -0,0 +1,248 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/txlog/server/models"
+)
+
+// intakeQueueSize bounds the events waiting to be routed. Publish never
+// blocks: events arriving on a full queue are dropped and counted.
+const intakeQueueSize = 10000
+
+// environmentCacheTTL is how long a hostname's resolved topology
+// environment is reused before it is looked up again.
+const environmentCacheTTL = 5 * time.Minute
+
+type environmentCacheEntry struct {
+	environment string
+	expiresAt   time.Time
+}
+
+// Dispatcher routes events to the configured syslog forwarders. Events are
+// handed over through a bounded queue, so publishers such as the ingestion
+// endpoints are never slowed down by a collector; a single goroutine
+// resolves each asset's environment, applies the forwarders' environment
+// filters and queues the formatted message on each matching sink.
+type Dispatcher struct {
+	db         *sql.DB
+	tlsConfig  *tls.Config
+	serverHost string
+	intake     chan Event
+	dropped    atomic.Uint64
+
+	mu         sync.RWMutex
+	forwarders []models.SyslogForwarder
+	sinks      map[int]*sink
+
+	// envCache is only used by the routing goroutine.
+	envCache map[string]environmentCacheEntry
+}
+
+// NewDispatcher returns a dispatcher that reads forwarders from db and
+// verifies TLS collectors with tlsConfig. Call Run in a goroutine and Reload
+// to load the forwarders.
+func NewDispatcher(db *sql.DB, tlsConfig *tls.Config) *Dispatcher {
+	serverHost, _ := os.Hostname()
+	return &Dispatcher{
+		db:         db,
+		tlsConfig:  tlsConfig,
+		serverHost: serverHost,
+		intake:     make(chan Event, intakeQueueSize),
+		sinks:      map[int]*sink{},
+		envCache:   map[string]environmentCacheEntry{},
+	}
+}
+
+// Publish queues events for forwarding without blocking. It does nothing
+// when no forwarder is active.
+func (d *Dispatcher) Publish(events ...Event) {
+	d.mu.RLock()
+	active := len(d.forwarders) > 0
+	d.mu.RUnlock()
+	if !active {
+		return
+	}
+
+	for _, e := range events {
+		select {
+		case d.intake <- e:
+		default:
+			d.dropped.Add(1)
+		}
+	}
+}
+
+// Run routes published events until the process exits.
+func (d *Dispatcher) Run() {
+	for e := range d.intake {
+		if e.IsAssetEvent() {
+			e.Environment = d.environment(e.Hostname)
+		}
+
+		d.mu.RLock()
+		for _, f := range d.forwarders {
+			if e.IsAssetEvent() && !f.AcceptsEnvironment(e.Environment) {
+				continue
+			}
+			if s, ok := d.sinks[f.ID]; ok {
+				s.enqueue(FormatSyslog(e, f.Format, d.serverHost))
+			}
+		}
+		d.mu.RUnlock()
+	}
+}
+
+// Reload reads the active forwarders from the database. Sinks whose
+// address and protocol did not change keep their connection and queue.
+func (d *Dispatcher) Reload() error {
+	all, err := models.NewSyslogForwarderManager(d.db).ListForwarders()
+	if err != nil {
+		return err
+	}
+
+	var active []models.SyslogForwarder
+	for _, f := range all {
+		if f.IsActive {
+			active = append(active, f)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sinks := make(map[int]*sink, len(active))
+	for _, f := range active {
+		if s, ok := d.sinks[f.ID]; ok && s.cfg.Address == f.Address && s.cfg.Protocol == f.Protocol {
+			sinks[f.ID] = s
+			delete(d.sinks, f.ID)
+			continue
+		}
+		sinks[f.ID] = newSink(f, d.tlsConfig)
+	}
+	for _, s := range d.sinks {
+		s.stop()
+	}
+
+	d.forwarders = active
+	d.sinks = sinks
+	return nil
+}
+
+// Stats returns the delivery counters of each active forwarder by ID.
+func (d *Dispatcher) Stats() map[int]SinkStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := make(map[int]SinkStats, len(d.sinks))
+	for id, s := range d.sinks {
+		stats[id] = s.stats()
+	}
+	return stats
+}
+
+// Dropped returns how many events were dropped because the routing queue
+// was full.
+func (d *Dispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// environment returns the friendly topology environment of a hostname, the
+// raw :env value when it has no friendly name, or "" when the hostname is
+// outside the topology.
+func (d *Dispatcher) environment(hostname string) string {
+	now := time.Now()
+	if entry, ok := d.envCache[hostname]; ok && now.Before(entry.expiresAt) {
+		return entry.environment
+	}
+
+	environment := ""
+	if rt, err := models.NewTopologyManager(d.db).ResolveHostname(hostname); err == nil && rt != nil {
+		environment = rt.EnvironmentName
+		if environment == "" {
+			environment = rt.EnvironmentValue
+		}
+	}
+
+	d.envCache[hostname] = environmentCacheEntry{environment: environment, expiresAt: now.Add(environmentCacheTTL)}
+	return environment
+}
+
+// TLSConfigFromEnv returns the TLS settings used for tls forwarders. When
+// SYSLOG_TLS_CA_FILE is set, collectors are verified against the
+// certificates in that PEM file instead of the system roots.
+func TLSConfigFromEnv() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	caFile := os.Getenv("SYSLOG_TLS_CA_FILE")
+	if caFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("SYSLOG_TLS_CA_FILE contains no PEM certificates")
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+var defaultDispatcher *Dispatcher
+
+// Start creates the process-wide dispatcher, loads the forwarders and
+// starts routing events. It must be called once at startup, before events
+// are published.
+func Start(db *sql.DB) error {
+	tlsConfig, err := TLSConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	d := NewDispatcher(db, tlsConfig)
+	defaultDispatcher = d
+	go d.Run()
+	return d.Reload()
+}
+
+// Publish queues events on the process-wide dispatcher. It does nothing
+// when forwarding was not started.
+func Publish(events ...Event) {
+	if d := defaultDispatcher; d != nil {
+		d.Publish(events...)
+	}
+}
+
+// Reload re-reads the forwarders of the process-wide dispatcher.
+func Reload() error {
+	if d := defaultDispatcher; d != nil {
+		return d.Reload()
+	}
+	return nil
+}
+
+// Stats returns the delivery counters of the process-wide dispatcher.
+func Stats() map[int]SinkStats {
+	if d := defaultDispatcher; d != nil {
+		return d.Stats()
+	}
+	return map[int]SinkStats{}
+}
+
+// Dropped returns the routing queue drops of the process-wide dispatcher.
+func Dropped() uint64 {
+	if d := defaultDispatcher; d != nil {
+		return d.Dropped()
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package forwarder
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/txlog/server/models"
+)
+
+// Event types, used as the syslog MSGID and the CEF signature ID.
+const (
+	EventTransactionIngested = "transaction.ingested"
+	EventPackageChanged      = "package.changed"
+	EventAnomalyDetected     = "anomaly.detected"
+	EventAdminAction         = "admin.action"
+)
+
+// Field is a key/value pair of event data. Keys are the JSON names; the
+// CEF formatter maps them to CEF extension keys.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Event is a server event forwarded to syslog collectors.
+type Event struct {
+	Time time.Time
+	Type string
+	// Name is a short human-readable description.
+	Name string
+	// Severity follows CEF: 0 (lowest) to 10 (highest).
+	Severity int
+	// Hostname and MachineID identify the asset the event is about; they are
+	// empty for admin actions.
+	Hostname  string
+	MachineID string
+	// Environment is the asset's topology environment, resolved by the
+	// dispatcher before the event is formatted.
+	Environment string
+	Fields      []Field
+}
+
+// IsAssetEvent reports whether the event is about an asset, and so is
+// subject to the forwarders' environment filters.
+func (e Event) IsAssetEvent() bool {
+	return e.MachineID != ""
+}
+
+// TransactionEvents returns the events of an ingested transaction: the
+// transaction itself, one event per package change and one per anomaly
+// visible in the transaction.
+func TransactionEvents(t models.Transaction) []Event {
+	at := time.Now()
+	if t.BeginTime != nil {
+		at = *t.BeginTime
+	}
+
+	events := make([]Event, 0, len(t.Items)+1)
+	events = append(events, Event{
+		Time:      at,
+		Type:      EventTransactionIngested,
+		Name:      "Package transaction",
+		Severity:  3,
+		Hostname:  t.Hostname,
+		MachineID: t.MachineID,
+		Fields: []Field{
+			{"transaction_id", t.TransactionID},
+			{"user", t.User},
+			{"action", t.Actions},
+			{"command_line", t.CommandLine},
+			{"return_code", t.ReturnCode},
+			{"item_count", strconv.Itoa(len(t.Items))},
+		},
+	})
+
+	for _, item := range t.Items {
+		version := item.Version
+		if item.Release != "" {
+			version += "-" + item.Release
+		}
+		events = append(events, Event{
+			Time:      at,
+			Type:      EventPackageChanged,
+			Name:      "Package " + strings.ToLower(item.Action),
+			Severity:  3,
+			Hostname:  t.Hostname,
+			MachineID: t.MachineID,
+			Fields: []Field{
+				{"transaction_id", t.TransactionID},
+				{"user", t.User},
+				{"action", item.Action},
+				{"package", strings.TrimPrefix(item.Name, "Change ")},
+				{"version", version},
+				{"arch", item.Arch},
+				{"repo", item.Repo},
+			},
+		})
+	}
+
+	for _, a := range models.TransactionAnomalies(t) {
+		events = append(events, AnomalyEvent(a))
+	}
+
+	return events
+}
+
+// AnomalyEvent returns the event of a detected anomaly.
+func AnomalyEvent(a models.TransactionAnomaly) Event {
+	severity := 3
+	switch a.Severity {
+	case models.SeverityMedium:
+		severity = 6
+	case models.SeverityHigh:
+		severity = 8
+	}
+	return Event{
+		Time:      a.DetectedAt,
+		Type:      EventAnomalyDetected,
+		Name:      "Transaction anomaly",
+		Severity:  severity,
+		Hostname:  a.Hostname,
+		MachineID: a.MachineID,
+		Fields: []Field{
+			{"anomaly", string(a.Type)},
+			{"description", a.Description},
+		},
+	}
+}
+
+// AdminActionEvent returns the event of a change made from the admin
+// interface.
+func AdminActionEvent(user, method, path, clientIP string, status int, at time.Time) Event {
+	severity := 5
+	if status >= 400 {
+		severity = 7
+	}
+	return Event{
+		Time:     at,
+		Type:     EventAdminAction,
+		Name:     "Admin action",
+		Severity: severity,
+		Fields: []Field{
+			{"user", user},
+			{"method", method},
+			{"path", path},
+			{"status", strconv.Itoa(status)},
+			{"client_ip", clientIP},
+		},
+	}
+}
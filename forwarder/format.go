@@ -0,0 +1,187 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/version"
+)
+
+// syslogFacility is local0. Collectors usually route on the APP-NAME
+// ("txlog") or on the CEF header rather than on the facility.
+const syslogFacility = 16
+
+// appName is the RFC 5424 APP-NAME of every message.
+const appName = "txlog"
+
+// cefKey is the CEF extension key a field is sent as. Custom string and
+// number keys (csN, cnN) also carry a label.
+type cefKey struct {
+	Key   string
+	Label string
+}
+
+// cefKeys maps event field keys to CEF extension keys. Fields without an
+// entry are only sent in JSON payloads.
+var cefKeys = map[string]cefKey{
+	"transaction_id": {Key: "externalId"},
+	"user":           {Key: "suser"},
+	"action":         {Key: "act"},
+	"return_code":    {Key: "outcome"},
+	"item_count":     {Key: "cnt"},
+	"package":        {Key: "cs1", Label: "package"},
+	"version":        {Key: "cs2", Label: "version"},
+	"command_line":   {Key: "cs3", Label: "commandLine"},
+	"repo":           {Key: "cs5", Label: "repo"},
+	"arch":           {Key: "cs6", Label: "arch"},
+	"anomaly":        {Key: "cat"},
+	"description":    {Key: "msg"},
+	"method":         {Key: "requestMethod"},
+	"path":           {Key: "request"},
+	"status":         {Key: "cn1", Label: "statusCode"},
+	"client_ip":      {Key: "src"},
+}
+
+// syslogSeverity maps a CEF severity (0-10) to a syslog severity.
+func syslogSeverity(cef int) int {
+	switch {
+	case cef >= 9:
+		return 3 // error
+	case cef >= 7:
+		return 4 // warning
+	case cef >= 4:
+		return 5 // notice
+	default:
+		return 6 // informational
+	}
+}
+
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+
+// FormatCEF renders the event as an ArcSight Common Event Format message.
+func FormatCEF(e Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|Txlog|Txlog Server|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(version.SemVer),
+		cefHeaderEscaper.Replace(e.Type),
+		cefHeaderEscaper.Replace(e.Name),
+		e.Severity)
+
+	ext := []string{"rt=" + strconv.FormatInt(e.Time.UnixMilli(), 10)}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefValueEscaper.Replace(value))
+		}
+	}
+
+	add("dhost", e.Hostname)
+	add("deviceExternalId", e.MachineID)
+	if e.Environment != "" {
+		add("cs4", e.Environment)
+		add("cs4Label", "environment")
+	}
+	for _, f := range e.Fields {
+		k, ok := cefKeys[f.Key]
+		if !ok || f.Value == "" {
+			continue
+		}
+		add(k.Key, f.Value)
+		if k.Label != "" {
+			add(k.Key+"Label", k.Label)
+		}
+	}
+
+	b.WriteString(strings.Join(ext, " "))
+	return b.String()
+}
+
+// FormatJSON renders the event as a single-line JSON object. Keys are
+// written in a fixed order so collectors can rely on it.
+func FormatJSON(e Event) string {
+	var b bytes.Buffer
+	write := func(key string, value any) {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte('{')
+		}
+		k, _ := json.Marshal(key)
+		v, _ := json.Marshal(value)
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	write("time", e.Time.UTC().Format(time.RFC3339Nano))
+	write("event", e.Type)
+	write("name", e.Name)
+	write("severity", e.Severity)
+	if e.IsAssetEvent() {
+		write("hostname", e.Hostname)
+		write("machine_id", e.MachineID)
+		write("environment", e.Environment)
+	}
+	for _, f := range e.Fields {
+		write(f.Key, f.Value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// FormatSyslog renders the event as an RFC 5424 message with a CEF or JSON
+// payload. The HOSTNAME is the asset's hostname for asset events and
+// serverHost otherwise.
+func FormatSyslog(e Event, format, serverHost string) []byte {
+	host := e.Hostname
+	if host == "" {
+		host = serverHost
+	}
+
+	msg := FormatCEF(e)
+	if format == models.SyslogFormatJSON {
+		msg = FormatJSON(e)
+	}
+
+	pri := syslogFacility*8 + syslogSeverity(e.Severity)
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s - %s - %s",
+		pri,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(host, 255),
+		appName,
+		headerField(e.Type, 32),
+		msg))
+}
+
+// headerField makes s a valid RFC 5424 header field: printable US-ASCII
+// without spaces, at most max characters, or "-" when empty.
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// frame prepares a message for the wire. Stream transports use octet
+// counting (RFC 6587, RFC 5425); UDP sends one message per datagram.
+func frame(msg []byte, protocol string) []byte {
+	if protocol == models.SyslogProtocolUDP {
+		return msg
+	}
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}
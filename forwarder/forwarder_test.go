@@ -0,0 +1,261 @@
+package forwarder
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/version"
+)
+
+var eventTime = time.Date(2026, 10, 18, 14, 30, 0, 0, time.UTC)
+
+func sampleTransaction() models.Transaction {
+	return models.Transaction{
+		TransactionID: "42",
+		MachineID:     "abc123",
+		Hostname:      "web-01",
+		BeginTime:     &eventTime,
+		Actions:       "Upgrade, Downgrade",
+		User:          "root <root>",
+		CommandLine:   "dnf update -y",
+		ReturnCode:    "Success",
+		Items: []models.TransactionItem{
+			{Action: "Upgrade", Name: "openssl", Version: "3.0.7", Release: "27.el9", Arch: "x86_64", Repo: "baseos"},
+			{Action: "Downgrade", Name: "curl", Version: "7.76.1", Release: "26.el9", Arch: "x86_64", Repo: "baseos"},
+		},
+	}
+}
+
+func TestTransactionEvents(t *testing.T) {
+	events := TransactionEvents(sampleTransaction())
+
+	wantTypes := []string{EventTransactionIngested, EventPackageChanged, EventPackageChanged, EventAnomalyDetected}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("got %d events, want %d", len(events), len(wantTypes))
+	}
+	for i, e := range events {
+		if e.Type != wantTypes[i] {
+			t.Errorf("event %d type = %q, want %q", i, e.Type, wantTypes[i])
+		}
+		if !e.IsAssetEvent() || e.Hostname != "web-01" {
+			t.Errorf("event %d should be an asset event of web-01", i)
+		}
+		if !e.Time.Equal(eventTime) {
+			t.Errorf("event %d time = %v, want %v", i, e.Time, eventTime)
+		}
+	}
+
+	if events[1].Name != "Package upgrade" {
+		t.Errorf("package event name = %q", events[1].Name)
+	}
+	if events[3].Severity != 3 {
+		t.Errorf("downgrade anomaly severity = %d, want 3", events[3].Severity)
+	}
+}
+
+func TestAdminActionEvent(t *testing.T) {
+	ok := AdminActionEvent("admin@example.com", "POST", "/admin/webhooks/create", "10.0.0.1", 303, eventTime)
+	if ok.IsAssetEvent() {
+		t.Error("admin actions are not asset events")
+	}
+	if ok.Severity != 5 {
+		t.Errorf("severity = %d, want 5", ok.Severity)
+	}
+
+	failed := AdminActionEvent("admin@example.com", "POST", "/admin/webhooks/create", "10.0.0.1", 400, eventTime)
+	if failed.Severity != 7 {
+		t.Errorf("failed action severity = %d, want 7", failed.Severity)
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	e := Event{
+		Time:        eventTime,
+		Type:        EventPackageChanged,
+		Name:        "Package a|b",
+		Severity:    3,
+		Hostname:    "web-01",
+		MachineID:   "abc123",
+		Environment: "Production",
+		Fields: []Field{
+			{"package", "openssl"},
+			{"command_line", `dnf install x=1 c:\tmp` + "\nnext"},
+			{"unmapped", "ignored"},
+			{"repo", ""},
+		},
+	}
+
+	got := FormatCEF(e)
+	wantPrefix := "CEF:0|Txlog|Txlog Server|" + version.SemVer + "|package.changed|Package a\\|b|3|"
+	if !strings.HasPrefix(got, wantPrefix) {
+		t.Fatalf("header = %q, want prefix %q", got, wantPrefix)
+	}
+
+	ext := strings.TrimPrefix(got, wantPrefix)
+	for _, want := range []string{
+		"rt=" + strconv.FormatInt(eventTime.UnixMilli(), 10),
+		"dhost=web-01",
+		"deviceExternalId=abc123",
+		"cs4=Production cs4Label=environment",
+		"cs1=openssl cs1Label=package",
+		`cs3=dnf install x\=1 c:\\tmp\nnext cs3Label=commandLine`,
+	} {
+		if !strings.Contains(ext, want) {
+			t.Errorf("extension %q does not contain %q", ext, want)
+		}
+	}
+	if strings.Contains(ext, "ignored") || strings.Contains(ext, "cs5") {
+		t.Errorf("extension %q should skip unmapped and empty fields", ext)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	e := Event{
+		Time:      eventTime,
+		Type:      EventTransactionIngested,
+		Name:      "Package transaction",
+		Severity:  3,
+		Hostname:  "web-01",
+		MachineID: "abc123",
+		Fields:    []Field{{"transaction_id", "42"}, {"user", `root "admin"`}},
+	}
+
+	got := FormatJSON(e)
+	if !strings.HasPrefix(got, `{"time":"2026-10-18T14:30:00Z","event":"transaction.ingested",`) {
+		t.Errorf("keys are not in the documented order: %s", got)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("invalid JSON %q: %v", got, err)
+	}
+	if decoded["environment"] != "" || decoded["user"] != `root "admin"` || decoded["severity"] != float64(3) {
+		t.Errorf("unexpected payload: %v", decoded)
+	}
+
+	admin := FormatJSON(AdminActionEvent("a@example.com", "POST", "/admin/delete", "10.0.0.1", 303, eventTime))
+	if strings.Contains(admin, "hostname") {
+		t.Errorf("admin action should not carry asset keys: %s", admin)
+	}
+}
+
+func TestFormatSyslog(t *testing.T) {
+	e := AnomalyEvent(models.TransactionAnomaly{
+		Type:        models.AnomalyHighVolume,
+		Hostname:    "web 01",
+		MachineID:   "abc123",
+		DetectedAt:  eventTime,
+		Description: "Transaction with 150 packages",
+		Severity:    models.SeverityHigh,
+	})
+
+	got := string(FormatSyslog(e, models.SyslogFormatJSON, "txlog-server"))
+	want := "<132>1 2026-10-18T14:30:00.000000Z web01 txlog - anomaly.detected - {"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("FormatSyslog() = %q, want prefix %q", got, want)
+	}
+
+	admin := string(FormatSyslog(AdminActionEvent("a", "POST", "/admin", "", 200, eventTime), models.SyslogFormatCEF, "txlog-server"))
+	if !strings.HasPrefix(admin, "<133>1 2026-10-18T14:30:00.000000Z txlog-server txlog - admin.action - CEF:0|") {
+		t.Errorf("admin action message = %q", admin)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	msg := []byte("<134>1 - - txlog - - - hello")
+	if got := string(frame(msg, models.SyslogProtocolUDP)); got != string(msg) {
+		t.Errorf("udp frame = %q", got)
+	}
+	if got := string(frame(msg, models.SyslogProtocolTCP)); got != "28 "+string(msg) {
+		t.Errorf("tcp frame = %q", got)
+	}
+}
+
+// readFrames reads n octet-counted messages from conn.
+func readFrames(t *testing.T, conn net.Conn, n int) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	var msgs []string
+	for len(msgs) < n {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("reading frame length: %v", err)
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatalf("invalid frame length %q", size)
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("reading frame: %v", err)
+		}
+		msgs = append(msgs, string(buf))
+	}
+	return msgs
+}
+
+func TestDispatcherRoutesByEnvironment(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	prod := models.SyslogForwarder{ID: 1, Address: ln.Addr().String(), Protocol: models.SyslogProtocolTCP, Format: models.SyslogFormatJSON, Environments: []string{"Production"}}
+
+	d := NewDispatcher(nil, nil)
+	d.forwarders = []models.SyslogForwarder{prod}
+	d.sinks = map[int]*sink{prod.ID: newSink(prod, nil)}
+	defer d.sinks[prod.ID].stop()
+	expires := time.Now().Add(time.Hour)
+	d.envCache["web-01"] = environmentCacheEntry{environment: "Production", expiresAt: expires}
+	d.envCache["dev-01"] = environmentCacheEntry{environment: "Development", expiresAt: expires}
+	go d.Run()
+
+	dev := sampleTransaction()
+	dev.Hostname = "dev-01"
+	d.Publish(TransactionEvents(dev)[0])
+	d.Publish(TransactionEvents(sampleTransaction())[0])
+	d.Publish(AdminActionEvent("a@example.com", "POST", "/admin/delete", "10.0.0.1", 303, eventTime))
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msgs := readFrames(t, conn, 2)
+	if !strings.Contains(msgs[0], " web-01 txlog - transaction.ingested - ") || !strings.Contains(msgs[0], `"environment":"Production"`) {
+		t.Errorf("first message = %q, want the Production transaction", msgs[0])
+	}
+	if !strings.Contains(msgs[1], " admin.action - ") {
+		t.Errorf("second message = %q, want the admin action", msgs[1])
+	}
+
+	stats := d.Stats()[prod.ID]
+	deadline := time.Now().Add(5 * time.Second)
+	for stats.Sent < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		stats = d.Stats()[prod.ID]
+	}
+	if stats.Sent != 2 || stats.Dropped != 0 {
+		t.Errorf("stats = %+v, want 2 sent and none dropped", stats)
+	}
+}
+
+func TestPublishWithoutForwarders(t *testing.T) {
+	d := NewDispatcher(nil, nil)
+	d.Publish(TransactionEvents(sampleTransaction())...)
+	if len(d.intake) != 0 || d.Dropped() != 0 {
+		t.Error("events should be discarded when no forwarder is active")
+	}
+}
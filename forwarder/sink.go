@@ -0,0 +1,178 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/txlog/server/models"
+)
+
+// sinkQueueSize bounds how many messages are buffered per forwarder while
+// its collector is slow or unreachable. Messages arriving on a full queue
+// are dropped and counted.
+const sinkQueueSize = 10000
+
+const (
+	dialTimeout   = 5 * time.Second
+	writeTimeout  = 5 * time.Second
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// SinkStats reports the delivery counters of one forwarder since it was
+// last (re)configured on this instance.
+type SinkStats struct {
+	Queued      int
+	Sent        uint64
+	Dropped     uint64
+	LastError   string
+	LastErrorAt *time.Time
+}
+
+// sink owns the connection to one collector and sends its queued messages
+// in order from a single goroutine.
+type sink struct {
+	cfg       models.SyslogForwarder
+	tlsConfig *tls.Config
+	queue     chan []byte
+	done      chan struct{}
+	conn      net.Conn
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func newSink(cfg models.SyslogForwarder, tlsConfig *tls.Config) *sink {
+	s := &sink{
+		cfg:       cfg,
+		tlsConfig: tlsConfig,
+		queue:     make(chan []byte, sinkQueueSize),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// enqueue buffers a formatted message without blocking.
+func (s *sink) enqueue(msg []byte) {
+	select {
+	case s.queue <- msg:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// stop ends the sender goroutine; messages still queued are discarded.
+func (s *sink) stop() {
+	close(s.done)
+}
+
+func (s *sink) stats() SinkStats {
+	st := SinkStats{
+		Queued:  len(s.queue),
+		Sent:    s.sent.Load(),
+		Dropped: s.dropped.Load(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastError != "" {
+		at := s.lastErrorAt
+		st.LastError = s.lastError
+		st.LastErrorAt = &at
+	}
+	return st
+}
+
+func (s *sink) run() {
+	defer s.closeConn()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.queue:
+			if !s.send(msg) {
+				return
+			}
+		}
+	}
+}
+
+// send writes one message, reconnecting with exponential backoff until it
+// succeeds. Stream transports keep retrying so messages are not lost while
+// the collector restarts; UDP gives up after one attempt. It returns false
+// when the sink was stopped meanwhile.
+func (s *sink) send(msg []byte) bool {
+	delay := minRetryDelay
+	for {
+		err := s.write(msg)
+		if err == nil {
+			s.sent.Add(1)
+			return true
+		}
+
+		s.mu.Lock()
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		s.mu.Unlock()
+		s.closeConn()
+
+		if s.cfg.Protocol == models.SyslogProtocolUDP {
+			s.dropped.Add(1)
+			return true
+		}
+
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (s *sink) write(msg []byte) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := s.conn.Write(frame(msg, s.cfg.Protocol))
+	return err
+}
+
+func (s *sink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	switch s.cfg.Protocol {
+	case models.SyslogProtocolTLS:
+		cfg := s.tlsConfig.Clone()
+		if host, _, err := net.SplitHostPort(s.cfg.Address); err == nil {
+			cfg.ServerName = host
+		}
+		return tls.DialWithDialer(dialer, "tcp", s.cfg.Address, cfg)
+	case models.SyslogProtocolTCP:
+		return dialer.Dial("tcp", s.cfg.Address)
+	default:
+		return dialer.Dial("udp", s.cfg.Address)
+	}
+}
+
+func (s *sink) closeConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
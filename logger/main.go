@@ -1,39 +1,208 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
-var logger *slog.Logger
+// modulePath is stripped from package paths, so per-package levels are
+// configured with paths relative to the repository, e.g. "scheduler".
+const modulePath = "github.com/txlog/server/"
 
-// InitLogger initializes a structured logger (slog) with a configurable log
-// level. The log level can be set through the LOG_LEVEL environment variable
-// with values: "DEBUG", "INFO", "WARN", or "ERROR". If LOG_LEVEL is not set or
-// has an invalid value, it defaults to INFO level. The logger outputs to stdout
-// using text format.
+// packageLevel is a LOG_PACKAGE_LEVELS entry.
+type packageLevel struct {
+	pkg   string
+	level slog.Level
+}
+
+var (
+	handler       slog.Handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	defaultLevel               = slog.LevelInfo
+	packageLevels []packageLevel
+
+	// packages caches the package path of each call site, keyed by PC.
+	packages sync.Map
+)
+
+// contextKey is the context key for the fields added by With.
+type contextKey struct{}
+
+var levelMap = map[string]slog.Level{
+	"DEBUG": slog.LevelDebug,
+	"INFO":  slog.LevelInfo,
+	"WARN":  slog.LevelWarn,
+	"ERROR": slog.LevelError,
+}
+
+// InitLogger initializes a structured logger (slog) from the environment:
+//
+//   - LOG_LEVEL sets the level: "DEBUG", "INFO", "WARN", or "ERROR". It
+//     defaults to INFO when not set or invalid.
+//   - LOG_FORMAT selects "text" (the default) or "json" output on stdout.
+//   - LOG_PACKAGE_LEVELS overrides the level of some packages, as a comma
+//     separated list such as "scheduler=DEBUG,controllers=WARN". A package
+//     also covers its subpackages, and the longest match wins.
+//
+// The logger also becomes the default slog logger, so that output from the
+// standard log package uses the same format.
 func InitLogger() {
-	levelMap := map[string]slog.Level{
-		"DEBUG": slog.LevelDebug,
-		"INFO":  slog.LevelInfo,
-		"WARN":  slog.LevelWarn,
-		"ERROR": slog.LevelError,
-	}
+	configure(os.Stdout)
+}
+
+// configure sets up the logger from the environment, writing to w.
+func configure(w io.Writer) {
+	var problems []string
 
-	levelStr := os.Getenv("LOG_LEVEL")
-	level, ok := levelMap[strings.ToUpper(levelStr)]
+	level, ok := levelMap[strings.ToUpper(os.Getenv("LOG_LEVEL"))]
 	if !ok {
 		level = slog.LevelInfo
 	}
+	defaultLevel = level
+
+	packageLevels = nil
+	for _, entry := range strings.Split(os.Getenv("LOG_PACKAGE_LEVELS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pkg, levelStr, _ := strings.Cut(entry, "=")
+		level, ok := levelMap[strings.ToUpper(strings.TrimSpace(levelStr))]
+		pkg = strings.Trim(strings.TrimSpace(pkg), "/")
+		if !ok || pkg == "" {
+			problems = append(problems, "ignoring invalid LOG_PACKAGE_LEVELS entry "+entry)
+			continue
+		}
+		packageLevels = append(packageLevels, packageLevel{pkg: pkg, level: level})
+	}
+	slices.SortStableFunc(packageLevels, func(a, b packageLevel) int {
+		return len(b.pkg) - len(a.pkg)
+	})
+
+	// Levels are checked before records reach the handler, since the
+	// handler does not know which package a record comes from
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		handler = slog.NewTextHandler(w, opts)
+		problems = append(problems, "unknown LOG_FORMAT "+format+", using text")
+	}
+
+	slog.SetDefault(slog.New(contextHandler{handler}))
+
+	for _, problem := range problems {
+		Warn(problem)
+	}
+}
 
-	logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+// contextHandler adds the fields stored in the context by With to records
+// logged through the default slog logger.
+type contextHandler struct {
+	slog.Handler
 }
 
-// Error logs an error message using the logger instance. It accepts a string
-// parameter that contains the message to be logged at the ERROR level.
-func Error(msg string) {
-	logger.Error(msg)
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(fields(ctx)...)
+	return h.Handler.Handle(ctx, r)
+}
+
+// With returns a copy of ctx carrying the given fields, which are added to
+// every line logged with that context through the Context functions. The
+// arguments are key-value pairs or slog.Attr values, as in slog.
+//
+// Example:
+//
+//	ctx = logger.With(ctx, "machine_id", machineID)
+//	logger.InfoContext(ctx, "Asset updated")
+func With(ctx context.Context, args ...any) context.Context {
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+
+	attrs := slices.Clip(fields(ctx))
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// fields returns the fields added to ctx by With.
+func fields(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return attrs
+}
+
+// log writes a record for the caller of the exported function that called
+// it, if the caller's package logs at level.
+func log(ctx context.Context, level slog.Level, msg string, args []any) {
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	if level < levelFor(pcs[0]) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.AddAttrs(fields(ctx)...)
+	r.Add(args...)
+	if err := handler.Handle(ctx, r); err != nil {
+		fmt.Fprintln(os.Stderr, "logger: "+err.Error())
+	}
+}
+
+// levelFor returns the level of the package that contains pc.
+func levelFor(pc uintptr) slog.Level {
+	if len(packageLevels) == 0 {
+		return defaultLevel
+	}
+	pkg := packageOf(pc)
+	for _, pl := range packageLevels {
+		if pkg == pl.pkg || strings.HasPrefix(pkg, pl.pkg+"/") {
+			return pl.level
+		}
+	}
+	return defaultLevel
+}
+
+// packageOf returns the path of the package that contains pc, relative to
+// the module, e.g. "controllers/api/v1" or "main".
+func packageOf(pc uintptr) string {
+	if pkg, ok := packages.Load(pc); ok {
+		return pkg.(string)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	name := frame.Function
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		name = name[:slash+1+dot]
+	}
+	pkg := strings.TrimPrefix(name, modulePath)
+
+	packages.Store(pc, pkg)
+	return pkg
+}
+
+// Error logs an error message using the logger instance. The optional
+// arguments are key-value pairs added to the line as fields, as in slog.
+//
+// Example:
+//
+//	logger.Error("Error inserting transaction", "machine_id", machineID, "error", err)
+func Error(msg string, args ...any) {
+	log(context.Background(), slog.LevelError, msg, args)
 }
 
 // Info logs a message at the info level. It serves as a convenience wrapper
@@ -41,8 +210,9 @@ func Error(msg string) {
 //
 // Parameters:
 //   - msg: The message string to be logged
-func Info(msg string) {
-	logger.Info(msg)
+//   - args: Optional key-value pairs added to the line as fields
+func Info(msg string, args ...any) {
+	log(context.Background(), slog.LevelInfo, msg, args)
 }
 
 // Debug logs a debug-level message. It forwards the message to the underlying
@@ -51,14 +221,36 @@ func Info(msg string) {
 //
 // Parameters:
 //   - msg: The debug message to be logged
-func Debug(msg string) {
-	logger.Debug(msg)
+//   - args: Optional key-value pairs added to the line as fields
+func Debug(msg string, args ...any) {
+	log(context.Background(), slog.LevelDebug, msg, args)
 }
 
 // Warn logs a message at the WARN level. It provides a convenient way to log
 // warnings that should be noted but don't necessarily indicate an error
-// condition. The message is passed directly to the underlying logger
-// implementation.
-func Warn(msg string) {
-	logger.Warn(msg)
+// condition. The optional arguments are key-value pairs added as fields.
+func Warn(msg string, args ...any) {
+	log(context.Background(), slog.LevelWarn, msg, args)
+}
+
+// ErrorContext is like Error, and also logs the fields stored in ctx by
+// With, such as the request ID.
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelError, msg, args)
+}
+
+// InfoContext is like Info, and also logs the fields stored in ctx by With.
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelInfo, msg, args)
+}
+
+// DebugContext is like Debug, and also logs the fields stored in ctx by
+// With.
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelDebug, msg, args)
+}
+
+// WarnContext is like Warn, and also logs the fields stored in ctx by With.
+func WarnContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelWarn, msg, args)
 }
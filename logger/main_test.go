@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONFormatWithContextFields(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_PACKAGE_LEVELS", "")
+	var buf bytes.Buffer
+	configure(&buf)
+
+	ctx := With(context.Background(), "request_id", "abc123")
+	InfoContext(ctx, "Transaction saved", "machine_id", "m1", "hostname", "web-1")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	want := map[string]any{
+		"level":      "INFO",
+		"msg":        "Transaction saved",
+		"request_id": "abc123",
+		"machine_id": "m1",
+		"hostname":   "web-1",
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s = %v, want %v", k, line[k], v)
+		}
+	}
+}
+
+func TestWithKeepsParentFields(t *testing.T) {
+	parent := With(context.Background(), "request_id", "abc123")
+	child := With(parent, "api_key_id", 7)
+	sibling := With(parent, "job", "risk")
+
+	if got := len(fields(child)); got != 2 {
+		t.Errorf("child has %d fields, want 2", got)
+	}
+	if got := fields(sibling)[1].Key; got != "job" {
+		t.Errorf("sibling field = %s, want job: With must not share the parent's slice", got)
+	}
+}
+
+func TestPackageLevels(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "text")
+	t.Setenv("LOG_LEVEL", "WARN")
+	t.Setenv("LOG_PACKAGE_LEVELS", "logger=DEBUG, scheduler=ERROR, bogus")
+	var buf bytes.Buffer
+	configure(&buf)
+
+	if !strings.Contains(buf.String(), "bogus") {
+		t.Errorf("invalid entry was not reported: %q", buf.String())
+	}
+	buf.Reset()
+
+	Debug("debug from the logger package")
+	if !strings.Contains(buf.String(), "debug from the logger package") {
+		t.Error("package level did not override LOG_LEVEL")
+	}
+}
+
+func TestLevelFor(t *testing.T) {
+	packageLevels = []packageLevel{
+		{pkg: "controllers/api/v1", level: -4},
+		{pkg: "controllers", level: 8},
+	}
+	defaultLevel = 0
+	defer func() { packageLevels = nil }()
+
+	tests := []struct {
+		pkg  string
+		want int
+	}{
+		{"controllers", 8},
+		{"controllers/api/v1", -4},
+		{"controllersx", 0},
+		{"scheduler", 0},
+	}
+	for i, tt := range tests {
+		// Fake call sites, already resolved in the cache
+		pc := uintptr(1<<40 + i)
+		packages.Store(pc, tt.pkg)
+		if got := levelFor(pc); int(got) != tt.want {
+			t.Errorf("levelFor(%s) = %d, want %d", tt.pkg, got, tt.want)
+		}
+	}
+}
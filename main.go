@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"embed"
-	"fmt"
 	"html/template"
 	"io/fs"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload"
@@ -16,12 +19,18 @@ import (
 	"github.com/txlog/server/auth"
 	"github.com/txlog/server/controllers"
 	v1API "github.com/txlog/server/controllers/api/v1"
+	scimAPI "github.com/txlog/server/controllers/scim"
 	"github.com/txlog/server/database"
 	_ "github.com/txlog/server/docs"
+	"github.com/txlog/server/forwarder"
 	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/metrics"
 	"github.com/txlog/server/middleware"
 	"github.com/txlog/server/models"
+	"github.com/txlog/server/ratelimit"
 	"github.com/txlog/server/scheduler"
+	"github.com/txlog/server/tlsserver"
+	"github.com/txlog/server/tracing"
 	"github.com/txlog/server/util"
 	"github.com/txlog/server/version"
 )
@@ -55,28 +64,49 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Tracing must be set up before the database is opened, so the
+	// connection is instrumented
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logger.Error("Failed to initialize tracing", "error", err)
+	} else if tracing.Enabled() {
+		logger.Info("Tracing: exporting spans over OTLP.")
+		flushTracesOnExit(shutdownTracing)
+	}
+
 	database.ConnectDatabase()
 
+	// Administration commands, such as create-admin, run instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(database.Db, os.Args[1:], os.Stdin))
+	}
+
 	// Sync topology pattern regular expressions
 	tm := models.NewTopologyManager(database.Db)
 	if count, err := tm.SyncCompiledPatterns(); err != nil {
-		logger.Error("Failed to sync compiled topology patterns at startup: " + err.Error())
+		logger.Error("Failed to sync compiled topology patterns at startup", "error", err)
 	} else if count > 0 {
-		logger.Info(fmt.Sprintf("Topology: %d patterns synchronized with the current template engine.", count))
+		logger.Info("Topology: patterns synchronized with the current template engine.", "patterns", count)
 	} else {
 		logger.Info("Topology: all patterns are up to date.")
 	}
 
-	scheduler.StartScheduler(database.Db)
+	if err := forwarder.Start(database.Db); err != nil {
+		logger.Error("Failed to start syslog forwarding", "error", err)
+	}
 
-	// Inject the background task trigger into controllers safely without direct package cycle
-	controllers.SetSchedulerOSVTrigger(func() { scheduler.UpdateVulnerabilitiesJob(database.Db) })
+	sessions, err := auth.SessionConfigFromEnv()
+	if err != nil {
+		logger.Error("Invalid session configuration", "error", err)
+		os.Exit(1)
+	}
+	auth.ConfigureSessions(sessions)
 
 	// Initialize OIDC service (optional)
 	var oidcService *auth.OIDCService
-	oidcService, err := auth.NewOIDCService(database.Db)
+	oidcService, err = auth.NewOIDCService(database.Db)
 	if err != nil {
-		logger.Error("Failed to initialize OIDC service: " + err.Error())
+		logger.Error("Failed to initialize OIDC service", "error", err)
 		os.Exit(1)
 	}
 
@@ -84,7 +114,15 @@ func main() {
 	var ldapService *auth.LDAPService
 	ldapService, err = auth.NewLDAPService(database.Db)
 	if err != nil {
-		logger.Error("Failed to initialize LDAP service: " + err.Error())
+		logger.Error("Failed to initialize LDAP service", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize local accounts (optional)
+	var localService *auth.LocalService
+	localService, err = auth.NewLocalService(database.Db)
+	if err != nil {
+		logger.Error("Failed to initialize local accounts", "error", err)
 		os.Exit(1)
 	}
 
@@ -95,20 +133,63 @@ func main() {
 	if ldapService != nil {
 		logger.Info("LDAP authentication enabled")
 	}
-	if oidcService == nil && ldapService == nil {
+	if localService != nil {
+		logger.Info("Local accounts enabled")
+	}
+	authEnabled := oidcService != nil || ldapService != nil || localService != nil
+	if !authEnabled {
 		logger.Info("No authentication configured - API endpoints accessible without API key")
 	} else {
 		logger.Info("API key authentication required for /v1 endpoints")
 	}
 
-	r := gin.Default()
+	// The scheduler starts after the OIDC service, whose sessions it revalidates
+	scheduler.StartScheduler(database.Db, oidcService)
+
+	// Inject the background task trigger into controllers safely without direct package cycle
+	controllers.SetSchedulerOSVTrigger(func() { scheduler.UpdateVulnerabilitiesJob(database.Db, models.JobTriggerManual) })
+
+	// Serve HTTPS, with optional client certificate authentication (optional)
+	var tlsReloader *tlsserver.Reloader
+	if tlsConfig := tlsserver.ConfigFromEnv(); tlsConfig.Enabled() {
+		tlsReloader, err = tlsserver.NewReloader(tlsConfig)
+		if err != nil {
+			logger.Error("Failed to load TLS certificates", "error", err)
+			os.Exit(1)
+		}
+		if tlsConfig.ClientCAFile != "" {
+			if _, err := tlsserver.ClientIdentityField(); err != nil {
+				logger.Error("Invalid client certificate configuration", "error", err)
+				os.Exit(1)
+			}
+			logger.Info("Client certificate authentication enabled for /v1 endpoints")
+		}
+		go tlsReloader.Watch(context.Background(), tlsserver.ReloadInterval)
+	}
+
+	rateLimits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		logger.Error("Invalid rate limit configuration", "error", err)
+		os.Exit(1)
+	}
+	ratelimit.Configure(rateLimits)
+
+	r := gin.New()
 	r.SetTrustedProxies(nil)
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.AccessLogMiddleware())
+	r.Use(gin.Recovery())
+	if tracing.Enabled() {
+		r.Use(tracing.Middleware())
+	}
+	r.Use(metrics.Middleware())
 	r.Use(func(c *gin.Context) {
 		c.SetSameSite(http.SameSiteLaxMode)
 		c.Next()
 	})
 	r.Use(EnvironmentVariablesMiddleware())
 	r.Use(middleware.AuthMiddleware(database.Db))
+	r.Use(middleware.CSRFMiddleware())
 
 	funcMap := template.FuncMap{
 		"add":              util.Add,
@@ -153,18 +234,27 @@ func main() {
 
 	healthcheck.New(r, util.CheckConfig(), util.Check(database.Db))
 
+	// Prometheus metrics, protected by an API key when authentication is enabled
+	metrics.RegisterDB(database.Db)
+	if authEnabled {
+		r.GET("/metrics", middleware.APIKeyMiddleware(database.Db), middleware.RequireScope(models.APIKeyScopeRead), metrics.Handler())
+	} else {
+		r.GET("/metrics", metrics.Handler())
+	}
+
 	r.NoRoute(controllers.Get404)
 
-	// Authentication routes (if OIDC or LDAP is configured)
-	if oidcService != nil || ldapService != nil {
-		r.GET("/login", controllers.GetLogin(oidcService, ldapService))
-		r.POST("/auth/logout", controllers.PostLogout(oidcService, ldapService))
+	// Authentication routes (if OIDC, LDAP or local accounts are configured)
+	if authEnabled {
+		r.GET("/login", controllers.GetLogin(oidcService, ldapService, localService))
+		r.POST("/auth/logout", controllers.PostLogout(oidcService, ldapService, localService))
 	}
 
 	// OIDC-specific routes
 	if oidcService != nil {
 		r.POST("/auth/login", controllers.PostLogin(oidcService))
 		r.GET("/auth/callback", controllers.GetCallback(oidcService))
+		r.POST("/auth/backchannel-logout", controllers.PostBackchannelLogout(oidcService))
 	}
 
 	// LDAP-specific routes
@@ -172,22 +262,59 @@ func main() {
 		r.POST("/auth/ldap/login", controllers.PostLDAPLogin(ldapService))
 	}
 
+	// Local account routes; the password reset pages are reached signed out
+	if localService != nil {
+		r.POST("/auth/local/login", controllers.PostLocalLogin(localService))
+		r.GET("/auth/local/totp", controllers.GetLocalTOTP())
+		r.POST("/auth/local/totp", controllers.PostLocalTOTP(localService))
+		r.GET("/auth/local/reset", controllers.GetPasswordReset(localService))
+		r.POST("/auth/local/reset", controllers.PostPasswordReset(localService))
+
+		r.GET("/settings/account", controllers.GetAccountSettings(localService))
+		r.POST("/settings/account/password", controllers.PostAccountPassword(localService))
+		r.POST("/settings/account/totp/setup", controllers.PostAccountTOTPSetup(localService))
+		r.POST("/settings/account/totp/enable", controllers.PostAccountTOTPEnable(localService))
+		r.POST("/settings/account/totp/disable", controllers.PostAccountTOTPDisable(localService))
+	}
+
+	// Pages with data of the whole fleet are refused to users restricted to
+	// some environments or services; the home page sends them to their assets
+	fleet := middleware.RequireFleetAccess("")
+
 	// Main application routes
-	r.GET("/", controllers.GetRootIndex(database.Db))
+	r.GET("/", middleware.RequireFleetAccess("/assets"), controllers.GetRootIndex(database.Db))
 	r.GET("/assets", controllers.GetAssetsIndex(database.Db))
-	r.GET("/packages", controllers.GetPackagesIndex(database.Db))
+	r.GET("/packages", fleet, controllers.GetPackagesIndex(database.Db))
 	r.GET("/topology", controllers.GetTopologyIndex(database.Db))
 
+	// Asset management, for operators, limited to the assets in their scope
+	assetGroup := r.Group("/admin/assets")
+	assetGroup.Use(middleware.RequirePermission(models.PermissionManageAssets), middleware.AdminActionForwardMiddleware())
+	{
+		assetGroup.DELETE("/:machine_id", controllers.DeleteMachineID(database.Db))
+		assetGroup.POST("/:machine_id/labels", controllers.PostAdminAssetLabel(database.Db))
+	}
+
+	// Vulnerability updates, for security analysts
+	r.POST("/analytics/security/osv-update", middleware.RequirePermission(models.PermissionScanVulnerabilities), middleware.AdminActionForwardMiddleware(), controllers.PostSecurityRunOSVUpdate(database.Db))
+
 	// Admin routes (requires admin middleware)
 	adminGroup := r.Group("/admin")
-	adminGroup.Use(middleware.AdminMiddleware())
+	adminGroup.Use(middleware.AdminMiddleware(), middleware.AdminActionForwardMiddleware())
 	{
 		adminGroup.GET("", controllers.GetAdminIndex(database.Db))
+		adminGroup.GET("/audit", controllers.GetAdminAudit(database.Db))
 		adminGroup.POST("/migrations/run", controllers.PostAdminRunMigrations(database.Db))
 		adminGroup.POST("/migrations/run_osv_update", controllers.PostAdminRunOSVUpdate(database.Db))
 		adminGroup.POST("/migrations/reset_osv", controllers.PostAdminResetOSV(database.Db))
 		adminGroup.POST("/cleanup/inactive-assets", controllers.PostAdminCleanupInactiveAssets(database.Db))
-		adminGroup.DELETE("/assets/:machine_id", controllers.DeleteMachineID(database.Db))
+		adminGroup.POST("/webhooks/create", controllers.PostAdminWebhookCreate(database.Db))
+		adminGroup.POST("/webhooks/toggle", controllers.PostAdminWebhookToggle(database.Db))
+		adminGroup.POST("/webhooks/delete", controllers.PostAdminWebhookDelete(database.Db))
+		adminGroup.POST("/webhooks/deliveries/retry", controllers.PostAdminWebhookRetry(database.Db))
+		adminGroup.POST("/syslog/create", controllers.PostAdminSyslogCreate(database.Db))
+		adminGroup.POST("/syslog/toggle", controllers.PostAdminSyslogToggle(database.Db))
+		adminGroup.POST("/syslog/delete", controllers.PostAdminSyslogDelete(database.Db))
 
 		// Topology configuration routes
 		adminGroup.GET("/topology/preview", controllers.GetAdminTopologyPreview(database.Db))
@@ -204,29 +331,83 @@ func main() {
 		adminGroup.POST("/topology/services/delete", controllers.PostAdminTopologyDeleteService(database.Db))
 	}
 
-	// Admin routes that require OIDC or LDAP (user and API key management)
-	if oidcService != nil || ldapService != nil {
+	// Admin routes that require authentication (user and API key management)
+	if authEnabled {
 		adminAuthGroup := r.Group("/admin")
-		adminAuthGroup.Use(middleware.AdminMiddleware())
+		adminAuthGroup.Use(middleware.AdminMiddleware(), middleware.AdminActionForwardMiddleware())
 		{
 			adminAuthGroup.POST("/update", controllers.PostAdminUpdateUser(database.Db))
 			adminAuthGroup.POST("/delete", controllers.PostAdminDeleteUser(database.Db))
+			adminAuthGroup.POST("/users/sessions/terminate", controllers.PostAdminTerminateSessions(database.Db))
+			if localService != nil {
+				adminAuthGroup.POST("/users/create", controllers.PostAdminCreateLocalUser(localService))
+				adminAuthGroup.POST("/users/password-reset", controllers.PostAdminPasswordReset(localService))
+				adminAuthGroup.POST("/users/totp/disable", controllers.PostAdminDisableTOTP(localService))
+			}
 			adminAuthGroup.POST("/apikeys/create", controllers.PostAdminCreateAPIKey(database.Db))
+			adminAuthGroup.POST("/apikeys/update", controllers.PostAdminUpdateAPIKey(database.Db))
 			adminAuthGroup.POST("/apikeys/revoke", controllers.PostAdminRevokeAPIKey(database.Db))
 			adminAuthGroup.POST("/apikeys/delete", controllers.DeleteAdminAPIKey(database.Db))
+			adminAuthGroup.POST("/enrollment/tokens/create", controllers.PostAdminCreateEnrollmentToken(database.Db))
+			adminAuthGroup.POST("/enrollment/tokens/revoke", controllers.PostAdminRevokeEnrollmentToken(database.Db))
+			adminAuthGroup.POST("/enrollment/tokens/delete", controllers.DeleteAdminEnrollmentToken(database.Db))
+			adminAuthGroup.POST("/enrollment/credentials/revoke", controllers.PostAdminRevokeMachineCredential(database.Db))
+			adminAuthGroup.POST("/enrollment/credentials/delete", controllers.DeleteAdminMachineCredential(database.Db))
+		}
+
+		// Sessions of the signed-in user
+		r.GET("/settings/sessions", controllers.GetSessionSettings(database.Db))
+		r.POST("/settings/sessions/revoke", controllers.PostSessionRevoke(database.Db))
+		r.POST("/settings/sessions/revoke-others", controllers.PostSessionRevokeOthers(database.Db))
+
+		// Personal access tokens of the signed-in user
+		r.GET("/settings/tokens", controllers.GetTokenSettings(database.Db))
+		r.POST("/settings/tokens/create", controllers.PostTokenCreate(database.Db))
+		r.POST("/settings/tokens/revoke", controllers.PostTokenRevoke(database.Db))
+
+		// Agent enrollment, authenticated by the enrollment token itself
+		r.POST("/v1/enroll", ratelimit.IPMiddleware(ratelimit.Ingest), ratelimit.Middleware(ratelimit.Ingest), v1API.PostEnroll(database.Db))
+
+		// User provisioning by the identity provider, authenticated by SCIM_TOKEN
+		if scimToken := os.Getenv("SCIM_TOKEN"); scimToken != "" {
+			if len(scimToken) < middleware.MinSCIMTokenLength {
+				logger.Error("SCIM_TOKEN is too short", "min_length", middleware.MinSCIMTokenLength)
+				os.Exit(1)
+			}
+			scimGroup := r.Group("/scim/v2", middleware.SCIMTokenMiddleware(scimToken))
+			scimGroup.GET("/ServiceProviderConfig", scimAPI.GetServiceProviderConfig)
+			scimGroup.GET("/ResourceTypes", scimAPI.GetResourceTypes)
+			scimGroup.GET("/Users", scimAPI.GetUsers(database.Db))
+			scimGroup.POST("/Users", scimAPI.PostUser(database.Db))
+			scimGroup.GET("/Users/:id", scimAPI.GetUser(database.Db))
+			scimGroup.PUT("/Users/:id", scimAPI.PutUser(database.Db))
+			scimGroup.PATCH("/Users/:id", scimAPI.PatchUser(database.Db))
+			scimGroup.DELETE("/Users/:id", scimAPI.DeleteUser(database.Db))
+			scimGroup.GET("/Groups", scimAPI.GetGroups(database.Db))
+			scimGroup.POST("/Groups", scimAPI.PostGroup(database.Db))
+			scimGroup.GET("/Groups/:id", scimAPI.GetGroup(database.Db))
+			scimGroup.PUT("/Groups/:id", scimAPI.PutGroup(database.Db))
+			scimGroup.PATCH("/Groups/:id", scimAPI.PatchGroup(database.Db))
+			scimGroup.DELETE("/Groups/:id", scimAPI.DeleteGroup(database.Db))
+			logger.Info("SCIM provisioning enabled")
 		}
 	}
 	r.GET("/assets/:machine_id", controllers.GetMachineID(database.Db))
 	r.GET("/executions/:execution_id", controllers.GetExecutionID(database.Db))
 	r.GET("/insights", controllers.GetInsightsIndex)
 	r.GET("/license", controllers.GetLicensesIndex)
-	r.GET("/analytics/progression", controllers.GetPackagesByWeekIndex(database.Db))
-	r.GET("/api/packages-by-month", controllers.GetPackagesByMonth(database.Db))
-	r.GET("/packages/:name", controllers.GetPackageByName(database.Db))
+	r.GET("/analytics/progression", fleet, controllers.GetPackagesByWeekIndex(database.Db))
+	r.GET("/api/packages-by-month", fleet, controllers.GetPackagesByMonth(database.Db))
+	r.GET("/packages/:name", fleet, controllers.GetPackageByName(database.Db))
 
 	// Analytics pages
-	r.GET("/analytics/anomalies", controllers.GetAnalyticsAnomalies(database.Db))
-	r.GET("/analytics/security", controllers.GetAnalyticsSecurity(database.Db))
+	r.GET("/analytics/anomalies", fleet, controllers.GetAnalyticsAnomalies(database.Db))
+	r.GET("/analytics/security", fleet, controllers.GetAnalyticsSecurity(database.Db))
+
+	// Personal settings; digests and exposure alerts cover the whole fleet
+	r.GET("/settings/notifications", fleet, controllers.GetNotificationSettings(database.Db))
+	r.POST("/settings/notifications", fleet, controllers.PostNotificationSettings(database.Db))
+	r.POST("/settings/notifications/test", fleet, controllers.PostNotificationSettingsTest(database.Db))
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(
 		swaggerfiles.Handler,
@@ -235,43 +416,103 @@ func main() {
 		ginSwagger.DefaultModelsExpandDepth(-1),
 	))
 
+	// Request budgets per client IP, counted before the API key is checked so
+	// that requests with invalid keys are limited too; see ratelimit.Config
 	v1Group := r.Group("/v1")
+	ingestGroup := r.Group("/v1", ratelimit.IPMiddleware(ratelimit.Ingest))
+	readGroup := r.Group("/v1", ratelimit.IPMiddleware(ratelimit.Read))
 
-	// Only require API key when authentication is enabled (OIDC or LDAP)
-	if oidcService != nil || ldapService != nil {
-		v1Group.Use(middleware.APIKeyMiddleware(database.Db))
+	// Only require API key when authentication is enabled (OIDC, LDAP or local accounts)
+	if authEnabled {
+		for _, group := range []*gin.RouterGroup{v1Group, ingestGroup, readGroup} {
+			group.Use(middleware.APIKeyMiddleware(database.Db))
+		}
 	}
 	{
+		// Scopes required from API keys; see models.APIKeyScopes
+		ingest := middleware.RequireScopeInEnvironment(database.Db, models.APIKeyScopeIngest)
+		read := middleware.RequireScope(models.APIKeyScopeRead)
+		readInEnvironment := middleware.RequireScopeInEnvironment(database.Db, models.APIKeyScopeRead)
+		readForMachine := middleware.RequireScopeForMachine(database.Db, models.APIKeyScopeRead)
+		admin := middleware.RequireScope(models.APIKeyScopeAdmin)
+
+		// Request budgets per API key; see ratelimit.Config
+		ingestLimit := ratelimit.Middleware(ratelimit.Ingest)
+		readLimit := ratelimit.Middleware(ratelimit.Read)
+
 		// txlog version
 		v1Group.GET("/version", v1API.GetVersions(version.SemVer))
 
 		// txlog build
-		v1Group.GET("/transactions/ids", v1API.GetTransactionIDs(database.Db))
-		v1Group.POST("/transactions", v1API.PostTransactions(database.Db))
-		v1Group.POST("/executions", v1API.PostExecutions(database.Db))
+		ingestGroup.GET("/transactions/ids", ingestLimit, ingest, v1API.GetTransactionIDs(database.Db))
+		ingestGroup.POST("/transactions", ingestLimit, ingest, v1API.PostTransactions(database.Db))
+		ingestGroup.POST("/executions", ingestLimit, ingest, v1API.PostExecutions(database.Db))
 
 		// Assets requiring restart
-		v1Group.GET("/assets/requiring-restart", v1API.GetAssetsRequiringRestart(database.Db))
+		readGroup.GET("/assets/requiring-restart", readLimit, read, v1API.GetAssetsRequiringRestart(database.Db))
 
 		// Package listing
-		v1Group.GET("/packages/:name/:version/:release/assets", v1API.GetAssetsUsingPackageVersion(database.Db))
+		readGroup.GET("/packages/:name/:version/:release/assets", readLimit, read, v1API.GetAssetsUsingPackageVersion(database.Db))
 
 		// Reports endpoints
-		v1Group.GET("/reports/monthly", v1API.GetMonthlyReport(database.Db))
-		v1Group.GET("/reports/anomalies", v1API.GetAnomalies(database.Db))
-		v1Group.GET("/reports/fixed-vulnerabilities", v1API.GetFixedVulnerabilities(database.Db))
+		readGroup.GET("/reports/monthly", readLimit, read, v1API.GetMonthlyReport(database.Db))
+		readGroup.GET("/reports/anomalies", readLimit, read, v1API.GetAnomalies(database.Db))
+		readGroup.GET("/reports/fixed-vulnerabilities", readLimit, read, v1API.GetFixedVulnerabilities(database.Db))
+
+		// Inventories for external tools
+		readGroup.GET("/inventory/ansible", readLimit, readInEnvironment, v1API.GetAnsibleInventory(database.Db))
+		readGroup.GET("/inventory/prometheus", readLimit, readInEnvironment, v1API.GetPrometheusTargets(database.Db))
+
+		// Risk scores
+		readGroup.GET("/risk", readLimit, read, v1API.GetRisk(database.Db))
+		readGroup.GET("/risk/history", readLimit, read, v1API.GetRiskHistory(database.Db))
 
 		// Endpoints for agent pre-v1.6.0
-		v1Group.GET("/machines/ids", v1API.GetMachineIDs(database.Db))
-		v1Group.GET("/machines", v1API.GetMachines(database.Db))
-		v1Group.GET("/executions", v1API.GetExecutions(database.Db))
-		v1Group.GET("/transactions", v1API.GetTransactions(database.Db))
-		v1Group.GET("/items/ids", v1API.GetItemIDs(database.Db))
-		v1Group.GET("/items", v1API.GetItems(database.Db))
-		v1Group.GET("/vulnerabilities", v1API.GetTransactionVulnerabilities(database.Db))
+		readGroup.GET("/machines/ids", readLimit, read, v1API.GetMachineIDs(database.Db))
+		readGroup.GET("/machines", readLimit, read, v1API.GetMachines(database.Db))
+		readGroup.GET("/executions", readLimit, readForMachine, v1API.GetExecutions(database.Db))
+		readGroup.GET("/transactions", readLimit, readForMachine, v1API.GetTransactions(database.Db))
+		readGroup.GET("/items/ids", readLimit, readForMachine, v1API.GetItemIDs(database.Db))
+		readGroup.GET("/items", readLimit, readForMachine, v1API.GetItems(database.Db))
+		readGroup.GET("/vulnerabilities", readLimit, readForMachine, v1API.GetTransactionVulnerabilities(database.Db))
+
+		// Background job status
+		readGroup.GET("/admin/jobs/vulnerabilities/runs", readLimit, admin, v1API.GetVulnerabilityJobRuns(database.Db))
+
+		// Audit log export
+		readGroup.GET("/audit", readLimit, admin, v1API.GetAudit(database.Db))
+	}
+
+	if tlsReloader == nil {
+		r.Run()
+		return
 	}
 
-	r.Run()
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	logger.Info("Listening and serving HTTPS", "address", addr)
+	if err := tlsserver.ListenAndServe(addr, r, tlsReloader); err != nil {
+		logger.Error("HTTPS server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// flushTracesOnExit exports the spans still buffered when the process is
+// asked to stop, then exits.
+func flushTracesOnExit(shutdown func(context.Context) error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+		os.Exit(0)
+	}()
 }
 
 func EnvironmentVariablesMiddleware() gin.HandlerFunc {
@@ -280,8 +521,16 @@ func EnvironmentVariablesMiddleware() gin.HandlerFunc {
 	staticEnvVars := map[string]string{
 		"instance":                 os.Getenv("INSTANCE"),
 		"logLevel":                 os.Getenv("LOG_LEVEL"),
+		"logFormat":                os.Getenv("LOG_FORMAT"),
+		"logPackageLevels":         os.Getenv("LOG_PACKAGE_LEVELS"),
 		"ginMode":                  os.Getenv("GIN_MODE"),
 		"port":                     os.Getenv("PORT"),
+		"tlsCertFile":              os.Getenv("TLS_CERT_FILE"),
+		"tlsKeyFile":               os.Getenv("TLS_KEY_FILE"),
+		"tlsClientCaFile":          os.Getenv("TLS_CLIENT_CA_FILE"),
+		"tlsClientIdentity":        os.Getenv("TLS_CLIENT_IDENTITY"),
+		"sessionIdleTimeout":       os.Getenv("SESSION_IDLE_TIMEOUT"),
+		"sessionMaxLifetime":       os.Getenv("SESSION_MAX_LIFETIME"),
 		"pgsqlHost":                os.Getenv("PGSQL_HOST"),
 		"pgsqlPort":                os.Getenv("PGSQL_PORT"),
 		"pgsqlUser":                os.Getenv("PGSQL_USER"),
@@ -292,10 +541,24 @@ func EnvironmentVariablesMiddleware() gin.HandlerFunc {
 		"cronRetentionExpression":  os.Getenv("CRON_RETENTION_EXPRESSION"),
 		"cronStatisticsExpression": os.Getenv("CRON_STATS_EXPRESSION"),
 		"cronOsvExpression":        os.Getenv("CRON_OSV_EXPRESSION"),
+		"cronRiskExpression":       os.Getenv("CRON_RISK_EXPRESSION"),
+		"cronWebhookExpression":    os.Getenv("CRON_WEBHOOK_EXPRESSION"),
+		"cronDigestExpression":     os.Getenv("CRON_DIGEST_EXPRESSION"),
+		"publicUrl":                os.Getenv("PUBLIC_URL"),
 		"oidcIssuerUrl":            os.Getenv("OIDC_ISSUER_URL"),
 		"oidcClientId":             os.Getenv("OIDC_CLIENT_ID"),
 		"oidcClientSecret":         util.MaskString(os.Getenv("OIDC_CLIENT_SECRET")),
 		"oidcRedirectUrl":          os.Getenv("OIDC_REDIRECT_URL"),
+		"oidcRoleClaim":            os.Getenv("OIDC_ROLE_CLAIM"),
+		"oidcGroupsClaim":          os.Getenv("OIDC_GROUPS_CLAIM"),
+		"oidcAdminGroup":           os.Getenv("OIDC_ADMIN_GROUP"),
+		"oidcSecurityGroup":        os.Getenv("OIDC_SECURITY_ANALYST_GROUP"),
+		"oidcOperatorGroup":        os.Getenv("OIDC_OPERATOR_GROUP"),
+		"oidcViewerGroup":          os.Getenv("OIDC_VIEWER_GROUP"),
+		"oidcProviderLogout":       os.Getenv("OIDC_PROVIDER_LOGOUT"),
+		"oidcPostLogoutUrl":        os.Getenv("OIDC_POST_LOGOUT_REDIRECT_URL"),
+		"oidcRevalidateInterval":   os.Getenv("OIDC_REVALIDATE_INTERVAL"),
+		"scimToken":                util.MaskString(os.Getenv("SCIM_TOKEN")),
 		"ldapHost":                 os.Getenv("LDAP_HOST"),
 		"ldapPort":                 os.Getenv("LDAP_PORT"),
 		"ldapUseTls":               os.Getenv("LDAP_USE_TLS"),
@@ -304,8 +567,23 @@ func EnvironmentVariablesMiddleware() gin.HandlerFunc {
 		"ldapBaseDn":               os.Getenv("LDAP_BASE_DN"),
 		"ldapUserFilter":           os.Getenv("LDAP_USER_FILTER"),
 		"ldapAdminGroup":           os.Getenv("LDAP_ADMIN_GROUP"),
+		"ldapOperatorGroup":        os.Getenv("LDAP_OPERATOR_GROUP"),
+		"ldapSecurityGroup":        os.Getenv("LDAP_SECURITY_ANALYST_GROUP"),
 		"ldapViewerGroup":          os.Getenv("LDAP_VIEWER_GROUP"),
 		"ldapGroupFilter":          os.Getenv("LDAP_GROUP_FILTER"),
+		"ldapNestedGroups":         os.Getenv("LDAP_NESTED_GROUPS"),
+		"ldapGroupBaseDn":          os.Getenv("LDAP_GROUP_BASE_DN"),
+		"ldapLockoutThreshold":     os.Getenv("LDAP_LOCKOUT_THRESHOLD"),
+		"ldapLockoutIpThreshold":   os.Getenv("LDAP_LOCKOUT_IP_THRESHOLD"),
+		"ldapLockoutDuration":      os.Getenv("LDAP_LOCKOUT_DURATION"),
+		"smtpHost":                 os.Getenv("SMTP_HOST"),
+		"smtpPort":                 os.Getenv("SMTP_PORT"),
+		"smtpFrom":                 os.Getenv("SMTP_FROM"),
+		"smtpTls":                  os.Getenv("SMTP_TLS"),
+		"exposureWebhookUrl":       util.MaskString(os.Getenv("EXPOSURE_WEBHOOK_URL")),
+		"exposureWebhookSeverity":  os.Getenv("EXPOSURE_WEBHOOK_MIN_SEVERITY"),
+		"exposureEmailTo":          os.Getenv("EXPOSURE_EMAIL_TO"),
+		"exposureEmailSeverity":    os.Getenv("EXPOSURE_EMAIL_MIN_SEVERITY"),
 	}
 
 	return func(c *gin.Context) {
@@ -324,9 +602,11 @@ func EnvironmentVariablesMiddleware() gin.HandlerFunc {
 			c.Set("user", userInterface)
 		}
 
-		// Add OIDC status to template context
+		// Add authentication status to template context
+		c.Set("auth_enabled", auth.IsEnabled())
 		c.Set("oidc_enabled", auth.IsConfigured())
 		c.Set("ldap_enabled", auth.IsLDAPConfigured())
+		c.Set("local_enabled", auth.IsLocalConfigured())
 
 		c.Next()
 	}
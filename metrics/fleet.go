@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// fleetQueryTimeout bounds the fleet queries run on each scrape.
+const fleetQueryTimeout = 10 * time.Second
+
+var (
+	activeAssetsDesc = prometheus.NewDesc(
+		"txlog_assets_active",
+		"Active assets.",
+		nil, nil)
+	needsRestartingDesc = prometheus.NewDesc(
+		"txlog_assets_needing_restart",
+		"Active assets whose last execution reported that a restart is required.",
+		nil, nil)
+	openVulnsDesc = prometheus.NewDesc(
+		"txlog_open_vulnerabilities",
+		"Open vulnerabilities on active assets by severity, counted once per affected asset, as of the last risk calculation.",
+		[]string{"severity"}, nil)
+	agentVersionsDesc = prometheus.NewDesc(
+		"txlog_assets_by_agent_version",
+		"Active assets by agent version.",
+		[]string{"version"}, nil)
+)
+
+// fleetCollector reads the fleet gauges from the database on each scrape,
+// so every instance reports the same values and agent versions no longer in
+// use disappear from the output.
+type fleetCollector struct {
+	manager *models.FleetManager
+}
+
+func newFleetCollector(db *sql.DB) *fleetCollector {
+	return &fleetCollector{manager: models.NewFleetManager(db)}
+}
+
+// Describe implements prometheus.Collector.
+func (fc *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeAssetsDesc
+	ch <- needsRestartingDesc
+	ch <- openVulnsDesc
+	ch <- agentVersionsDesc
+}
+
+// Collect implements prometheus.Collector. When the database cannot be
+// queried the fleet gauges are left out of the scrape and the error is
+// logged, so the other metrics are still served.
+func (fc *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), fleetQueryTimeout)
+	defer cancel()
+
+	stats, err := fc.manager.Stats(ctx)
+	if err != nil {
+		logger.Warn("Metrics: could not collect fleet statistics", "error", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(activeAssetsDesc, prometheus.GaugeValue, float64(stats.ActiveAssets))
+	ch <- prometheus.MustNewConstMetric(needsRestartingDesc, prometheus.GaugeValue, float64(stats.NeedsRestarting))
+	for severity, count := range stats.OpenVulns {
+		ch <- prometheus.MustNewConstMetric(openVulnsDesc, prometheus.GaugeValue, float64(count), severity)
+	}
+	for version, count := range stats.AgentVersions {
+		ch <- prometheus.MustNewConstMetric(agentVersionsDesc, prometheus.GaugeValue, float64(count), version)
+	}
+}
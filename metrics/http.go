@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests that matched no route, so scanners probing
+// random paths cannot create new series.
+const unmatchedRoute = "unmatched"
+
+// Middleware counts every request and observes its latency. Requests are
+// labelled with the route pattern (e.g. /assets/:machine_id), never the raw
+// path, and with the name of the API key that authenticated them, if any.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status()), c.GetString("api_key_name")).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Job outcomes recorded by ObserveJob.
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobSkipped   = "skipped"
+)
+
+// registry holds every metric served on /metrics. A dedicated registry keeps
+// metrics registered by dependencies on the default one out of the output.
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "txlog_http_requests_total",
+		Help: "HTTP requests by method, route, status code and API key name.",
+	}, []string{"method", "route", "status", "api_key"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "txlog_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "txlog_scheduler_job_runs_total",
+		Help: "Scheduler job runs by job and outcome (succeeded, failed, or skipped because another instance held the lock).",
+	}, []string{"job", "outcome"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "txlog_scheduler_job_duration_seconds",
+		Help:    "Duration of the scheduler job runs that were not skipped.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 8),
+	}, []string{"job"})
+
+	jobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "txlog_scheduler_job_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of each scheduler job on this instance.",
+	}, []string{"job"})
+
+	osvRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "txlog_osv_requests_total",
+		Help: "Requests to the OSV API by endpoint (querybatch, vulns) and outcome (success, error).",
+	}, []string{"endpoint", "outcome"})
+
+	osvPackagesChecked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "txlog_osv_packages_checked_total",
+		Help: "Package versions checked against OSV by the vulnerabilities job.",
+	})
+
+	osvNewLinks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "txlog_osv_new_package_vulnerabilities_total",
+		Help: "Package versions newly found to be affected by a vulnerability.",
+	})
+
+	osvVulnerabilitiesFound = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "txlog_osv_vulnerabilities_found",
+		Help: "Distinct vulnerabilities returned by OSV in the last vulnerabilities job run on this instance.",
+	})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "txlog_rate_limited_requests_total",
+		Help: "API requests refused with 429 by route class (ingest, read) and the budget that was spent (key, ip).",
+	}, []string{"class", "limit"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		jobRuns,
+		jobDuration,
+		jobLastSuccess,
+		osvRequests,
+		osvPackagesChecked,
+		osvNewLinks,
+		osvVulnerabilitiesFound,
+		rateLimited,
+	)
+}
+
+// RegisterDB adds the connection pool statistics of db and the fleet gauges
+// computed from its tables. It must be called once, at startup.
+func RegisterDB(db *sql.DB) {
+	registry.MustRegister(
+		collectors.NewDBStatsCollector(db, "txlog"),
+		newFleetCollector(db),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return gin.WrapH(h)
+}
+
+// ObserveJob records a scheduler job run. The duration is only recorded for
+// runs that were not skipped.
+func ObserveJob(job, outcome string, duration time.Duration) {
+	jobRuns.WithLabelValues(job, outcome).Inc()
+	if outcome == JobSkipped {
+		return
+	}
+	jobDuration.WithLabelValues(job).Observe(duration.Seconds())
+	if outcome == JobSucceeded {
+		jobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+}
+
+// ObserveOSVRequest counts a request to the OSV API endpoint.
+func ObserveOSVRequest(endpoint string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	osvRequests.WithLabelValues(endpoint, outcome).Inc()
+}
+
+// AddOSVPackagesChecked counts package versions checked against OSV.
+func AddOSVPackagesChecked(n int) {
+	osvPackagesChecked.Add(float64(n))
+}
+
+// AddOSVNewPackageVulnerabilities counts new package/vulnerability links.
+func AddOSVNewPackageVulnerabilities(n int) {
+	osvNewLinks.Add(float64(n))
+}
+
+// SetOSVVulnerabilitiesFound sets the distinct vulnerabilities found by the
+// running vulnerabilities job.
+func SetOSVVulnerabilitiesFound(n int) {
+	osvVulnerabilitiesFound.Set(float64(n))
+}
+
+// ObserveRateLimited counts a request refused by the rate limiter.
+func ObserveRateLimited(class, limit string) {
+	rateLimited.WithLabelValues(class, limit).Inc()
+}
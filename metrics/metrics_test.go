@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/assets/:machine_id", func(c *gin.Context) {
+		c.Set("api_key_name", "ci")
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/assets/abc", "/assets/def", "/wp-login.php"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/assets/:machine_id", "200", "ci")); got != 2 {
+		t.Errorf("requests for route = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404", "")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+}
+
+func TestObserveJob(t *testing.T) {
+	ObserveJob("test_job", JobSucceeded, time.Second)
+	ObserveJob("test_job", JobFailed, time.Second)
+	ObserveJob("test_job", JobSkipped, 0)
+
+	for _, outcome := range []string{JobSucceeded, JobFailed, JobSkipped} {
+		if got := testutil.ToFloat64(jobRuns.WithLabelValues("test_job", outcome)); got != 1 {
+			t.Errorf("%s runs = %v, want 1", outcome, got)
+		}
+	}
+	if got := testutil.CollectAndCount(jobDuration, "txlog_scheduler_job_duration_seconds"); got != 1 {
+		t.Errorf("duration series = %d, want 1", got)
+	}
+	if testutil.ToFloat64(jobLastSuccess.WithLabelValues("test_job")) == 0 {
+		t.Error("last success timestamp was not set")
+	}
+}
+
+func TestObserveOSVRequest(t *testing.T) {
+	ObserveOSVRequest("vulns", nil)
+	ObserveOSVRequest("vulns", errors.New("timeout"))
+
+	if got := testutil.ToFloat64(osvRequests.WithLabelValues("vulns", "error")); got != 1 {
+		t.Errorf("error requests = %v, want 1", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", Handler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "go_goroutines") {
+		t.Error("runtime metrics missing from the output")
+	}
+}
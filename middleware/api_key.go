@@ -5,18 +5,29 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/tlsserver"
+	"github.com/txlog/server/util"
 )
 
-// APIKeyMiddleware validates API keys for /v1 endpoints
-// It also allows access for users authenticated via session cookie
+// APIKeyMiddleware validates API keys for /v1 endpoints, rejecting expired
+// keys and keys used from outside their allowed networks. The key is stored
+// as "api_key" in the context for RequireScope. The owner of a personal
+// access token is stored as "user", so the token acts with the owner's role
+// and scope and its requests are attributed to them.
+// It also allows access for users authenticated via session cookie, and for
+// agents that present a client certificate signed by TLS_CLIENT_CA_FILE
 func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
+	// Validated at startup when mTLS is configured
+	identityField, _ := tlsserver.ClientIdentityField()
+
 	return func(c *gin.Context) {
 		// First, try to get API key from header (no DB query needed yet)
 		apiKey := c.GetHeader("X-API-Key")
@@ -33,14 +44,27 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 		// This avoids unnecessary session DB queries when API key is present
 		if apiKey == "" {
 			if sessionID, err := c.Cookie("session_id"); err == nil && sessionID != "" {
-				if isValidSession(db, sessionID) {
+				// The user is stored for RequireScope, which applies its
+				// role and scope
+				if user, err := getUserBySessionID(db, sessionID); err == nil && user.IsActive {
+					c.Set("user", user)
+					c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "user_id", user.ID))
+					touchSession(c, db, sessionID)
 					c.Next()
 					return
 				}
 			}
 
-			// No API key and no valid session
-			logger.Warn("API request without API key from " + c.ClientIP())
+			// Agents authenticated by a verified client certificate
+			if identity := tlsserver.ClientIdentity(c.Request.TLS, identityField); identity != nil {
+				c.Set("client_certificate", identity)
+				c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "client_certificate", identity.Name()))
+				c.Next()
+				return
+			}
+
+			// No API key, no valid session and no client certificate
+			logger.WarnContext(c.Request.Context(), "API request without API key", "client_ip", c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "API key required. Please provide X-API-Key header.",
 			})
@@ -50,7 +74,7 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 
 		// Validate API key format (should start with txlog_)
 		if !strings.HasPrefix(apiKey, "txlog_") {
-			logger.Warn("API request with invalid key format from " + c.ClientIP())
+			logger.WarnContext(c.Request.Context(), "API request with invalid key format", "client_ip", c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid API key format.",
 			})
@@ -62,18 +86,35 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 		hash := sha256.Sum256([]byte(apiKey))
 		keyHash := hex.EncodeToString(hash[:])
 
+		// Machine credentials issued at enrollment. A regular key may start
+		// with the same prefix by chance, so unknown ones fall through.
+		if strings.HasPrefix(apiKey, util.MachineCredentialPrefix) && authenticateMachine(c, db, keyHash) {
+			return
+		}
+
 		// Check if API key exists and is active
-		var keyID int
-		var isActive bool
+		var key models.ApiKey
+		var environment sql.NullString
 		query := `
-			SELECT id, is_active
+			SELECT id, name, is_active, scopes, expires_at, allowed_cidrs, environment, user_id
 			FROM api_keys
 			WHERE key_hash = $1
 		`
-		err := db.QueryRow(query, keyHash).Scan(&keyID, &isActive)
+		err := db.QueryRow(query, keyHash).Scan(
+			&key.ID,
+			&key.Name,
+			&key.IsActive,
+			pq.Array(&key.Scopes),
+			&key.ExpiresAt,
+			pq.Array(&key.AllowedCIDRs),
+			&environment,
+			&key.UserID,
+		)
+		key.Environment = environment.String
+		keyID := key.ID
 
 		if err == sql.ErrNoRows {
-			logger.Warn("API request with non-existent key from " + c.ClientIP())
+			logger.WarnContext(c.Request.Context(), "API request with non-existent key", "client_ip", c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid API key.",
 			})
@@ -82,7 +123,7 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 		}
 
 		if err != nil {
-			logger.Error("Database error validating API key: " + err.Error())
+			logger.ErrorContext(c.Request.Context(), "Database error validating API key", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Internal server error.",
 			})
@@ -90,8 +131,8 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		if !isActive {
-			logger.Warn(fmt.Sprintf("API request with inactive key (ID: %d) from %s", keyID, c.ClientIP()))
+		if !key.IsActive {
+			logger.WarnContext(c.Request.Context(), "API request with inactive key", "api_key_id", keyID, "client_ip", c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid API key.",
 			})
@@ -99,7 +140,46 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Update last_used_at timestamp (async, don't block request)
+		if key.IsExpired(time.Now()) {
+			logger.WarnContext(c.Request.Context(), "API request with expired key", "api_key_id", keyID, "client_ip", c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "API key expired.",
+			})
+			c.Abort()
+			return
+		}
+
+		if !key.AllowsAddress(c.ClientIP()) {
+			logger.WarnContext(c.Request.Context(), "API request with key from a disallowed address", "api_key_id", keyID, "client_ip", c.ClientIP())
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "API key not allowed from this address.",
+			})
+			c.Abort()
+			return
+		}
+
+		// Personal access tokens act as their owner, who must still be active
+		var owner *models.User
+		if key.IsPersonal() {
+			owner, err = getUserByID(db, *key.UserID)
+			if err != nil && err != sql.ErrNoRows {
+				logger.ErrorContext(c.Request.Context(), "Database error loading the owner of a personal access token", "api_key_id", keyID, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Internal server error.",
+				})
+				c.Abort()
+				return
+			}
+			if err != nil || !owner.IsActive {
+				logger.WarnContext(c.Request.Context(), "API request with the token of an inactive user", "api_key_id", keyID, "client_ip", c.ClientIP())
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid API key.",
+				})
+				c.Abort()
+				return
+			}
+		}
+
 		// Update last_used_at timestamp (async, don't block request)
 		go func(id int) {
 			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -107,26 +187,64 @@ func APIKeyMiddleware(db *sql.DB) gin.HandlerFunc {
 			updateQuery := `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`
 			_, err := db.ExecContext(ctx, updateQuery, time.Now(), id)
 			if err != nil {
-				logger.Error("Failed to update last_used_at for API key: " + err.Error())
+				logger.Error("Failed to update last_used_at for API key", "api_key_id", id, "error", err)
 			}
 		}(keyID)
 
-		// Store API key ID in context for potential logging
+		// Store API key ID and name in context for logging and metrics, and
+		// the key itself for RequireScope
+		c.Set("api_key", &key)
 		c.Set("api_key_id", keyID)
+		c.Set("api_key_name", key.Name)
+		if key.Environment != "" {
+			c.Set("api_key_environment", key.Environment)
+		}
+		c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "api_key_id", keyID))
+		if owner != nil {
+			c.Set("user", owner)
+			c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "user_id", owner.ID))
+		}
 
 		c.Next()
 	}
 }
 
-// isValidSession checks if a session ID corresponds to a valid, active session
-func isValidSession(db *sql.DB, sessionID string) bool {
-	query := `
-		SELECT COUNT(*)
-		FROM user_sessions s
-		INNER JOIN users u ON s.user_id = u.id
-		WHERE s.id = $1 AND s.is_active = true AND s.expires_at > NOW() AND u.is_active = true
-	`
-	var count int
-	err := db.QueryRow(query, sessionID).Scan(&count)
-	return err == nil && count > 0
+// authenticateMachine authenticates a request made with a machine
+// credential. It returns false, without handling the request, when no
+// credential has the given hash.
+func authenticateMachine(c *gin.Context, db *sql.DB, credentialHash string) bool {
+	em := models.NewEnrollmentManager(db)
+	credential, err := em.CredentialByHash(credentialHash)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Database error validating machine credential", "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Internal server error.",
+		})
+		return true
+	}
+	if credential == nil {
+		return false
+	}
+
+	if !credential.IsActive {
+		logger.WarnContext(c.Request.Context(), "API request with revoked machine credential", "machine_credential_id", credential.ID, "client_ip", c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid API key.",
+		})
+		return true
+	}
+
+	go func(id int) {
+		if err := em.TouchCredential(id); err != nil {
+			logger.Error("Failed to update last_used_at for machine credential", "machine_credential_id", id, "error", err)
+		}
+	}(credential.ID)
+
+	// Store the credential for RequireScope and the ingest handlers, which
+	// only accept data for its machine ID
+	c.Set("machine_credential", credential)
+	c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "machine_credential_id", credential.ID))
+
+	c.Next()
+	return true
 }
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// RequireScope rejects requests made with an API key that lacks scope, and
+// with keys bound to an environment, since the route returns data of the
+// whole fleet. Browser sessions are held to the same rules through the
+// user's role and scope. It must run after APIKeyMiddleware. Requests with
+// authentication disabled are let through.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := checkScope(c, scope)
+		if !ok {
+			return
+		}
+		if key != nil && key.Environment != "" {
+			logger.WarnContext(c.Request.Context(), "API request outside the key's environment", "path", c.FullPath(), "environment", key.Environment)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API key is restricted to environment " + key.Environment + ".",
+			})
+			return
+		}
+		if user, ok := sessionUser(c); ok && user.Scope.Restricted() {
+			abortOutsideUserScope(c, user)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScopeForMachine is like RequireScope, for routes that return the
+// data of the single asset named by the machine_id query parameter. Keys
+// bound to an environment, and users restricted to some environments or
+// services, are admitted when the asset is theirs.
+func RequireScopeForMachine(db *sql.DB, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := checkScope(c, scope)
+		if !ok {
+			return
+		}
+		user, _ := sessionUser(c)
+		keyBound := key != nil && key.Environment != ""
+		userRestricted := user != nil && user.Scope.Restricted()
+		machineID := c.Query("machine_id")
+		if (!keyBound && !userRestricted) || machineID == "" {
+			c.Next()
+			return
+		}
+
+		topology, err := resolveMachine(db, machineID)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error resolving machine for API request scope", "machine_id", machineID, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error."})
+			return
+		}
+		if keyBound && !key.AcceptsTopology(topology) {
+			logger.WarnContext(c.Request.Context(), "API request for a machine outside the key's environment", "machine_id", machineID, "environment", key.Environment)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API key is restricted to environment " + key.Environment + ".",
+			})
+			return
+		}
+		if userRestricted && !user.Scope.AcceptsTopology(topology) {
+			abortOutsideUserScope(c, user)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScopeInEnvironment is like RequireScope, but also admits keys bound
+// to an environment. For the ingest scope, the hostname of the request, from
+// the hostname query parameter or the JSON body, must resolve to that
+// environment. For other scopes the handler limits its response to the
+// environment, which is stored as "api_key_environment" in the context, and
+// to the scope of the signed-in user.
+func RequireScopeInEnvironment(db *sql.DB, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := checkScope(c, scope)
+		if !ok {
+			return
+		}
+		if key == nil || key.Environment == "" || scope != models.APIKeyScopeIngest {
+			c.Next()
+			return
+		}
+
+		hostname := requestHostname(c)
+		topology, err := models.NewTopologyManager(db).ResolveHostname(hostname)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Error resolving hostname for API key environment", "hostname", hostname, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error."})
+			return
+		}
+		if !key.AcceptsTopology(topology) {
+			logger.WarnContext(c.Request.Context(), "API request for a host outside the key's environment", "hostname", hostname, "environment", key.Environment)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API key is restricted to environment " + key.Environment + ".",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkScope aborts the request with 403 when its API key lacks scope.
+// Machine credentials and client certificates only have the ingest scope,
+// and browser sessions of users other than admins only the read scope.
+// Personal access tokens need both their own scope and their owner's role.
+// It returns the key, nil for requests without one, and whether the request
+// may go on.
+func checkScope(c *gin.Context, scope string) (*models.ApiKey, bool) {
+	_, credential := c.Get("machine_credential")
+	_, certificate := c.Get("client_certificate")
+	if credential || certificate {
+		if scope != models.APIKeyScopeIngest {
+			logger.WarnContext(c.Request.Context(), "API request with an agent identity outside ingestion", "path", c.FullPath())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Agent credentials can only upload data.",
+			})
+			return nil, false
+		}
+		return nil, true
+	}
+
+	var key *models.ApiKey
+	if value, exists := c.Get("api_key"); exists {
+		key = value.(*models.ApiKey)
+		if !key.HasScope(scope) {
+			logger.WarnContext(c.Request.Context(), "API request without the required scope", "path", c.FullPath(), "scope", scope)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API key lacks the " + scope + " scope.",
+			})
+			return key, false
+		}
+	}
+
+	if user, ok := sessionUser(c); ok {
+		if scope != models.APIKeyScopeRead && !user.IsAdmin() {
+			logger.WarnContext(c.Request.Context(), "API request outside the user's role", "path", c.FullPath(), "role", user.Role)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Your role only allows reading data.",
+			})
+			return key, false
+		}
+	}
+	return key, true
+}
+
+// requestHostname returns the hostname an agent request is about, from the
+// hostname query parameter or the JSON body. The body is put back for the
+// handler.
+func requestHostname(c *gin.Context) string {
+	if hostname := c.Query("hostname"); hostname != "" {
+		return hostname
+	}
+
+	data, err := c.GetRawData()
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+
+	var body struct {
+		Hostname string `json:"hostname"`
+	}
+	json.Unmarshal(data, &body)
+	return body.Hostname
+}
+
+// abortOutsideUserScope refuses data outside the scope of the signed-in
+// user.
+func abortOutsideUserScope(c *gin.Context, user *models.User) {
+	logger.WarnContext(c.Request.Context(), "API request outside the user's scope", "path", c.FullPath(), "scope", user.Scope.String())
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": "Your account is restricted to " + user.Scope.String() + ".",
+	})
+}
+
+// resolveMachine resolves the hostname of the asset with machineID. It
+// returns nil for unknown machines and hostnames outside the topology.
+func resolveMachine(db *sql.DB, machineID string) (*models.ResolvedTopology, error) {
+	var hostname string
+	err := db.QueryRow(`
+		SELECT hostname FROM assets WHERE machine_id = $1 ORDER BY is_active DESC LIMIT 1
+	`, machineID).Scan(&hostname)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return models.NewTopologyManager(db).ResolveHostname(hostname)
+}
@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/models"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		key  *models.ApiKey
+		want int
+	}{
+		{"session", nil, http.StatusOK},
+		{"read key", &models.ApiKey{APIKeyRestrictions: models.APIKeyRestrictions{Scopes: []string{"read"}}}, http.StatusOK},
+		{"admin key", &models.ApiKey{APIKeyRestrictions: models.APIKeyRestrictions{Scopes: []string{"admin"}}}, http.StatusOK},
+		{"ingest key", &models.ApiKey{APIKeyRestrictions: models.APIKeyRestrictions{Scopes: []string{"ingest"}}}, http.StatusForbidden},
+		{"bound key", &models.ApiKey{APIKeyRestrictions: models.APIKeyRestrictions{Scopes: []string{"read"}, Environment: "Production"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.key != nil {
+					c.Set("api_key", tt.key)
+				}
+			})
+			r.GET("/", RequireScope(models.APIKeyScopeRead), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScopeInEnvironment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Keys bound to an environment reach read handlers, which filter by
+	// api_key_environment; the database is only used for ingest.
+	tests := []struct {
+		name string
+		key  *models.ApiKey
+		want int
+	}{
+		{"bound read key", &models.ApiKey{APIKeyRestrictions: models.APIKeyRestrictions{Scopes: []string{"read"}, Environment: "Production"}}, http.StatusOK},
+		{"bound ingest key", &models.ApiKey{APIKeyRestrictions: models.APIKeyRestrictions{Scopes: []string{"ingest"}, Environment: "Production"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("api_key", tt.key)
+			})
+			r.GET("/", RequireScopeInEnvironment(nil, models.APIKeyScopeRead), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScope_AgentIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	identities := map[string]any{
+		"machine_credential": &models.MachineCredential{ID: 1, MachineID: "abc"},
+		"client_certificate": &models.CertificateIdentity{Names: []string{"web01"}, Field: models.CertificateIdentityHostname},
+	}
+	for key, value := range identities {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(key, value)
+		})
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.GET("/ingest", RequireScopeInEnvironment(nil, models.APIKeyScopeIngest), ok)
+		r.GET("/read", RequireScope(models.APIKeyScopeRead), ok)
+
+		tests := map[string]int{"/ingest": http.StatusOK, "/read": http.StatusForbidden}
+		for path, want := range tests {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != want {
+				t.Errorf("%s %s: status = %d, want %d", key, path, w.Code, want)
+			}
+		}
+	}
+}
+
+func TestRequireScope_SessionUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viewer := &models.User{Role: models.RoleViewer}
+	restricted := &models.User{Role: models.RoleAdmin, Scope: models.AccessScope{Environments: []string{"Production"}}}
+	tests := []struct {
+		name  string
+		user  *models.User
+		scope string
+		want  int
+	}{
+		{"viewer reads", viewer, models.APIKeyScopeRead, http.StatusOK},
+		{"viewer administers", viewer, models.APIKeyScopeAdmin, http.StatusForbidden},
+		{"admin administers", &models.User{Role: models.RoleAdmin}, models.APIKeyScopeAdmin, http.StatusOK},
+		{"restricted user reads the fleet", restricted, models.APIKeyScopeRead, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("user", tt.user)
+			})
+			r.GET("/", RequireScope(tt.scope), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScope_PersonalToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owner := 7
+	token := func(scopes ...string) *models.ApiKey {
+		return &models.ApiKey{UserID: &owner, APIKeyRestrictions: models.APIKeyRestrictions{Scopes: scopes}}
+	}
+	admin := &models.User{Role: models.RoleAdmin}
+	tests := []struct {
+		name  string
+		key   *models.ApiKey
+		user  *models.User
+		scope string
+		want  int
+	}{
+		{"read token reads", token("read"), &models.User{Role: models.RoleViewer}, models.APIKeyScopeRead, http.StatusOK},
+		{"admin token of an admin", token("admin"), admin, models.APIKeyScopeAdmin, http.StatusOK},
+		{"read token of an admin administers", token("read"), admin, models.APIKeyScopeAdmin, http.StatusForbidden},
+		{"admin token of a demoted user", token("admin"), &models.User{Role: models.RoleOperator}, models.APIKeyScopeAdmin, http.StatusForbidden},
+		{"token of a restricted user", token("read"), &models.User{Role: models.RoleViewer, Scope: models.AccessScope{Services: []string{"Billing"}}}, models.APIKeyScopeRead, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("api_key", tt.key)
+				c.Set("user", tt.user)
+			})
+			r.GET("/", RequireScope(tt.scope), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OIDC_CLIENT_ID", "txlog")
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+
+	tests := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"viewer", &models.User{Role: models.RoleViewer}, http.StatusForbidden},
+		{"security analyst", &models.User{Role: models.RoleSecurityAnalyst}, http.StatusForbidden},
+		{"operator", &models.User{Role: models.RoleOperator}, http.StatusOK},
+		{"admin", &models.User{Role: models.RoleAdmin}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.user != nil {
+					c.Set("user", tt.user)
+				}
+			})
+			r.GET("/", RequirePermission(models.PermissionManageAssets), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireFleetAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	restricted := &models.User{Role: models.RoleViewer, Scope: models.AccessScope{Services: []string{"billing"}}}
+	r := gin.New()
+	r.SetHTMLTemplate(template.Must(template.New("403.html").Parse("{{ .error }}")))
+	r.Use(func(c *gin.Context) {
+		if c.Query("restricted") != "" {
+			c.Set("user", restricted)
+		} else {
+			c.Set("user", &models.User{Role: models.RoleViewer})
+		}
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/", RequireFleetAccess("/assets"), ok)
+	r.GET("/packages", RequireFleetAccess(""), ok)
+
+	tests := map[string]int{
+		"/":                      http.StatusOK,
+		"/?restricted=1":         http.StatusTemporaryRedirect,
+		"/packages":              http.StatusOK,
+		"/packages?restricted=1": http.StatusForbidden,
+	}
+	for path, want := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, want)
+		}
+		if want == http.StatusForbidden && !strings.Contains(w.Body.String(), "service billing") {
+			t.Errorf("%s: body = %q, want the user's scope", path, w.Body.String())
+		}
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"github.com/txlog/server/auth"
+	logger "github.com/txlog/server/logger"
 	"github.com/txlog/server/models"
 )
 
@@ -16,22 +18,24 @@ func isSecureCookie() bool {
 }
 
 // AuthMiddleware checks for valid user sessions
-// If neither OIDC nor LDAP is configured, it allows all requests through
+// If no authentication is configured, it allows all requests through
 func AuthMiddleware(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// If neither OIDC nor LDAP is configured, skip authentication entirely
-		if !auth.IsConfigured() && !auth.IsLDAPConfigured() {
+		// If no authentication is configured, skip authentication entirely
+		if !auth.IsEnabled() {
 			c.Next()
 			return
 		}
 
-		// Skip authentication for API endpoints and health checks
+		// Skip authentication for API endpoints, health checks and metrics
 		path := c.Request.URL.Path
 		if strings.HasPrefix(path, "/v1/") ||
+			strings.HasPrefix(path, "/scim/") ||
 			strings.HasPrefix(path, "/health") ||
 			strings.HasPrefix(path, "/auth/") ||
 			strings.HasPrefix(path, "/images/") ||
 			strings.HasPrefix(path, "/css/") ||
+			path == "/metrics" ||
 			path == "/login" ||
 			path == "/logout" {
 			c.Next()
@@ -53,18 +57,20 @@ func AuthMiddleware(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Set user in context for use in handlers
+		// Set user in context for use in handlers and in log lines
 		c.Set("user", user)
+		c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "user_id", user.ID))
+		touchSession(c, db, sessionID)
 		c.Next()
 	}
 }
 
 // AdminMiddleware checks if user has admin privileges
-// If neither OIDC nor LDAP is configured, it allows all requests through
+// If no authentication is configured, it allows all requests through
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// If neither OIDC nor LDAP is configured, skip admin check
-		if !auth.IsConfigured() && !auth.IsLDAPConfigured() {
+		// If no authentication is configured, skip admin check
+		if !auth.IsEnabled() {
 			c.Next()
 			return
 		}
@@ -77,7 +83,7 @@ func AdminMiddleware() gin.HandlerFunc {
 		}
 
 		user, ok := userInterface.(*models.User)
-		if !ok || !user.IsAdmin {
+		if !ok || !user.IsAdmin() {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
 			c.Abort()
 			return
@@ -87,21 +93,111 @@ func AdminMiddleware() gin.HandlerFunc {
 	}
 }
 
+// RequirePermission checks that the user's role grants permission
+// If no authentication is configured, it allows all requests through
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.IsEnabled() {
+			c.Next()
+			return
+		}
+
+		user, ok := sessionUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		if !user.Can(permission) {
+			logger.WarnContext(c.Request.Context(), "Request without the required permission", "path", c.FullPath(), "role", user.Role, "permission", permission)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your role does not allow this action"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireFleetAccess refuses pages that show data of the whole fleet to
+// users restricted to some environments or services. With a redirect, they
+// are sent there instead of getting a 403 page.
+func RequireFleetAccess(redirect string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := sessionUser(c)
+		if !ok || !user.Scope.Restricted() {
+			c.Next()
+			return
+		}
+
+		if redirect != "" {
+			c.Redirect(http.StatusTemporaryRedirect, redirect)
+			c.Abort()
+			return
+		}
+
+		logger.WarnContext(c.Request.Context(), "Fleet-wide page requested by a restricted user", "path", c.FullPath(), "scope", user.Scope.String())
+		c.HTML(http.StatusForbidden, "403.html", gin.H{
+			"error": "Your account can only see the assets of " + user.Scope.String() + ".",
+		})
+		c.Abort()
+	}
+}
+
+// sessionUser returns the user signed in to the request, if any.
+func sessionUser(c *gin.Context) (*models.User, bool) {
+	value, exists := c.Get("user")
+	if !exists {
+		return nil, false
+	}
+	user, ok := value.(*models.User)
+	return user, ok
+}
+
+// touchSession extends the session of a request by the idle timeout. A
+// failure is logged only: the session stays valid until its current end.
+func touchSession(c *gin.Context, db *sql.DB, sessionID string) {
+	if err := models.NewSessionManager(db).Touch(sessionID, auth.Sessions().IdleTimeout); err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to extend session", "error", err)
+	}
+}
+
 func getUserBySessionID(db *sql.DB, sessionID string) (*models.User, error) {
-	query := `
-		SELECT u.id, u.sub, u.email, u.name, COALESCE(u.picture, '') as picture, u.is_active, u.is_admin,
-		       u.created_at, u.updated_at, u.last_login_at
-		FROM users u
+	query := userQuery + `
 		INNER JOIN user_sessions s ON u.id = s.user_id
 		WHERE s.id = $1 AND s.is_active = true AND s.expires_at > NOW()
 	`
+	return scanUser(db.QueryRow(query, sessionID))
+}
 
+// getUserByID loads the owner of a personal access token, with the same
+// fields as getUserBySessionID.
+func getUserByID(db *sql.DB, userID int) (*models.User, error) {
+	return scanUser(db.QueryRow(userQuery+` WHERE u.id = $1`, userID))
+}
+
+// userQuery selects the users of requests, with their role and scope.
+const userQuery = `
+	SELECT u.id, u.sub, u.email, u.name, COALESCE(u.picture, '') as picture, u.is_active, u.role,
+	       u.environments, u.services, u.sub LIKE 'local:%', u.password_hash IS NOT NULL, u.totp_enabled,
+	       u.created_at, u.updated_at, u.last_login_at
+	FROM users u
+`
+
+// scanUser reads a row of userQuery.
+func scanUser(row *sql.Row) (*models.User, error) {
 	user := &models.User{}
-	err := db.QueryRow(query, sessionID).Scan(
+	err := row.Scan(
 		&user.ID, &user.Sub, &user.Email, &user.Name, &user.Picture,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
-		&user.LastLoginAt,
+		&user.IsActive, &user.Role, pq.Array(&user.Scope.Environments), pq.Array(&user.Scope.Services),
+		&user.IsLocal, &user.HasPassword, &user.TOTPEnabled, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
 	)
 
+	// Admins always see the whole fleet
+	if user.IsAdmin() {
+		user.Scope = models.AccessScope{}
+	}
+
 	return user, err
 }
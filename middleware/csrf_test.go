@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CSRFMiddleware())
+	r.GET("/form", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/admin/action", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.POST("/v1/transactions", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.POST("/auth/backchannel-logout", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.POST("/scim/v2/Users", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == CSRFCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !validCSRFToken(cookie.Value) || cookie.HttpOnly {
+		t.Fatalf("GET did not set a readable CSRF cookie: %+v", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("GET with a valid CSRF cookie replaced it: %+v", w.Result().Cookies())
+	}
+
+	other, err := newCSRFToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie string
+		header string
+		field  string
+		want   int
+	}{
+		{"header", "/admin/action", cookie.Value, cookie.Value, "", http.StatusNoContent},
+		{"form field", "/admin/action", cookie.Value, "", cookie.Value, http.StatusNoContent},
+		{"missing token", "/admin/action", cookie.Value, "", "", http.StatusForbidden},
+		{"wrong token", "/admin/action", cookie.Value, other, "", http.StatusForbidden},
+		{"no cookie", "/admin/action", "", cookie.Value, "", http.StatusForbidden},
+		{"tampered cookie", "/admin/action", "x", "x", "", http.StatusForbidden},
+		{"api", "/v1/transactions", "", "", "", http.StatusNoContent},
+		{"back-channel logout", "/auth/backchannel-logout", "", "", "", http.StatusNoContent},
+		{"scim", "/scim/v2/Users", "", "", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.field != "" {
+				form.Set(CSRFField, tt.field)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/forwarder"
+	"github.com/txlog/server/models"
+)
+
+// AdminActionForwardMiddleware publishes every state-changing admin request
+// to the syslog forwarders once it has been handled. Read-only requests are
+// not forwarded.
+func AdminActionForwardMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			return
+		}
+
+		user := "anonymous"
+		if u, exists := c.Get("user"); exists {
+			if u, ok := u.(*models.User); ok {
+				user = u.Email
+			}
+		}
+
+		forwarder.Publish(forwarder.AdminActionEvent(user, c.Request.Method, c.Request.URL.Path, c.ClientIP(), c.Writer.Status(), time.Now()))
+	}
+}
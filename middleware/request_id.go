@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+)
+
+// RequestIDHeader carries the request ID, in requests from proxies that
+// already assigned one and in every response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs accepted from clients.
+const maxRequestIDLength = 64
+
+// RequestIDMiddleware gives every request an ID, taken from the
+// X-Request-ID header when it holds a valid one and generated otherwise. The
+// ID is returned in the X-Request-ID response header, stored as
+// "request_id" in the gin context, and added to every line logged with the
+// request context.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "request_id", id))
+
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware logs one line per request once it has been handled.
+// The line carries the fields added to the request context by the other
+// middleware: the request ID, and the API key or user that made the
+// request. Health checks are logged at DEBUG level, server errors at WARN.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		args := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		}
+
+		ctx := c.Request.Context()
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.WarnContext(ctx, "HTTP request", args...)
+		case strings.HasPrefix(c.Request.URL.Path, "/health"):
+			logger.DebugContext(ctx, "HTTP request", args...)
+		default:
+			logger.InfoContext(ctx, "HTTP request", args...)
+		}
+	}
+}
+
+// validRequestID reports whether id can be used as is: IDs from clients
+// end up in logs, so they are limited to a short run of letters, digits
+// and the punctuation of common ID formats.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("request_id"))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"none", "", false},
+		{"valid", "req-42.abc_DEF:1", true},
+		{"injection", "abc\" level=ERROR", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.incoming != "" {
+			req.Header.Set(RequestIDHeader, tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		if id != w.Body.String() {
+			t.Errorf("%s: response header %q does not match the context ID %q", tt.name, id, w.Body.String())
+		}
+		if tt.keep && id != tt.incoming {
+			t.Errorf("%s: ID = %q, want the incoming %q", tt.name, id, tt.incoming)
+		}
+		if !tt.keep && (id == tt.incoming || len(id) != 32) {
+			t.Errorf("%s: ID = %q, want a generated one", tt.name, id)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+)
+
+// MinSCIMTokenLength is the shortest SCIM_TOKEN accepted at startup.
+const MinSCIMTokenLength = 32
+
+// SCIMTokenMiddleware authenticates the SCIM client of the identity
+// provider with the bearer token configured in SCIM_TOKEN, and marks the
+// request so the audit log names it as the actor.
+func SCIMTokenMiddleware(token string) gin.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+	return func(c *gin.Context) {
+		sent, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		got := sha256.Sum256([]byte(strings.TrimSpace(sent)))
+		if !ok || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			logger.WarnContext(c.Request.Context(), "SCIM request refused without a valid token", "path", c.Request.URL.Path)
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			c.Data(http.StatusUnauthorized, "application/scim+json", []byte(
+				`{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"401","detail":"Invalid or missing bearer token."}`,
+			))
+			c.Abort()
+			return
+		}
+
+		c.Set("scim_client", true)
+		c.Next()
+	}
+}
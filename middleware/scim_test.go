@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSCIMTokenMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const token = "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"valid", "Bearer " + token, http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "Bearer " + token + "x", http.StatusUnauthorized},
+		{"not bearer", "Basic " + token, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/scim/v2/Users", SCIMTokenMiddleware(token), func(c *gin.Context) {
+				if !c.GetBool("scim_client") {
+					t.Error("request not marked as made by the SCIM client")
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
@@ -1,6 +1,15 @@
 package models
 
-import "time"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
 
 // ===== Transaction Anomaly Models =====
 
@@ -69,3 +78,281 @@ type AnomalySummary struct {
 	BySeverity    map[string]int `json:"by_severity"`
 	AffectedHosts int            `json:"affected_hosts"`
 }
+
+// Thresholds shared by the anomaly report and ingest-time detection.
+const (
+	HighVolumeThreshold     = 50  // packages in one transaction
+	HighVolumeHighThreshold = 100 // above this, a high volume anomaly is high severity
+)
+
+// TransactionAnomalies returns the anomalies visible in a single transaction
+// as it is ingested: high volume and downgrades. Rapid changes span several
+// transactions and are only reported by /v1/reports/anomalies.
+func TransactionAnomalies(t Transaction) []TransactionAnomaly {
+	var anomalies []TransactionAnomaly
+
+	detectedAt := time.Now()
+	if t.BeginTime != nil {
+		detectedAt = *t.BeginTime
+	}
+
+	if count := len(t.Items); count > HighVolumeThreshold {
+		severity := SeverityMedium
+		if count > HighVolumeHighThreshold {
+			severity = SeverityHigh
+		}
+		anomalies = append(anomalies, TransactionAnomaly{
+			Type:        AnomalyHighVolume,
+			MachineID:   t.MachineID,
+			Hostname:    t.Hostname,
+			DetectedAt:  detectedAt,
+			Description: fmt.Sprintf("Transaction with %d packages (threshold: %d)", count, HighVolumeThreshold),
+			Severity:    severity,
+			Details: HighVolumeDetails{
+				TransactionID:   atoiOrZero(t.TransactionID),
+				PackageCount:    count,
+				TransactionTime: detectedAt.Format(time.RFC3339),
+			},
+		})
+	}
+
+	for _, item := range t.Items {
+		if item.Action != "Downgrade" {
+			continue
+		}
+		pkg := strings.TrimPrefix(item.Name, "Change ")
+		anomalies = append(anomalies, TransactionAnomaly{
+			Type:        AnomalyDowngrade,
+			MachineID:   t.MachineID,
+			Hostname:    t.Hostname,
+			DetectedAt:  detectedAt,
+			Description: fmt.Sprintf("Package '%s' was downgraded to version %s", pkg, item.Version),
+			Severity:    SeverityLow,
+			Details: DowngradeDetails{
+				Package:   pkg,
+				ToVersion: item.Version,
+			},
+		})
+	}
+
+	return anomalies
+}
+
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// DetectAnomalies scans the transactions of the last days for high volume
+// transactions, rapid changes to the same package and downgrades. When
+// severityFilter is set, only anomalies of that severity are returned.
+func DetectAnomalies(ctx context.Context, database *sql.DB, days int, severityFilter string) (*AnomalyReport, error) {
+	report := &AnomalyReport{
+		TimeWindow: fmt.Sprintf("%d days", days),
+		Anomalies:  make([]TransactionAnomaly, 0),
+		Summary: AnomalySummary{
+			ByType:     make(map[string]int),
+			BySeverity: make(map[string]int),
+		},
+	}
+
+	affectedHosts := make(map[string]bool)
+
+	// Detect high volume transactions (more than HighVolumeThreshold packages in a single transaction)
+	highVolumeQuery := `
+		SELECT
+			t.transaction_id,
+			t.machine_id,
+			t.hostname,
+			t.begin_time,
+			COUNT(*) as package_count
+		FROM transactions t
+		JOIN transaction_items ti ON t.transaction_id = ti.transaction_id AND t.machine_id = ti.machine_id
+		WHERE t.begin_time >= NOW() - make_interval(days => $1)
+		GROUP BY t.transaction_id, t.machine_id, t.hostname, t.begin_time
+		HAVING COUNT(*) > $2
+		ORDER BY package_count DESC
+	`
+
+	rows, err := database.QueryContext(ctx, highVolumeQuery, days, HighVolumeThreshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txID int
+		var machineID, hostname string
+		var beginTime time.Time
+		var packageCount int
+
+		if err := rows.Scan(&txID, &machineID, &hostname, &beginTime, &packageCount); err != nil {
+			return nil, err
+		}
+
+		severity := SeverityMedium
+		if packageCount > HighVolumeHighThreshold {
+			severity = SeverityHigh
+		}
+
+		if severityFilter != "" && string(severity) != severityFilter {
+			continue
+		}
+
+		anomaly := TransactionAnomaly{
+			Type:        AnomalyHighVolume,
+			MachineID:   machineID,
+			Hostname:    hostname,
+			DetectedAt:  beginTime,
+			Description: fmt.Sprintf("Transaction with %d packages (threshold: %d)", packageCount, HighVolumeThreshold),
+			Severity:    severity,
+			Details: HighVolumeDetails{
+				TransactionID:   txID,
+				PackageCount:    packageCount,
+				TransactionTime: beginTime.Format(time.RFC3339),
+			},
+		}
+
+		report.Anomalies = append(report.Anomalies, anomaly)
+		affectedHosts[machineID] = true
+	}
+
+	// Detect rapid changes (same package changed >3 times in 24h)
+	rapidChangeQuery := `
+		WITH PackageChanges AS (
+			SELECT
+				ti.machine_id,
+				t.hostname,
+				CASE
+					WHEN ti.package LIKE 'Change %' THEN SUBSTRING(ti.package FROM 8)
+					ELSE ti.package
+				END AS package,
+				ti.action,
+				t.begin_time,
+				DATE_TRUNC('day', t.begin_time) as change_day
+			FROM transaction_items ti
+			JOIN transactions t ON ti.transaction_id = t.transaction_id AND ti.machine_id = t.machine_id
+			WHERE t.begin_time >= NOW() - make_interval(days => $1)
+				AND ti.action IN ('Install', 'Upgrade', 'Downgrade', 'Erase', 'Reinstall')
+		)
+		SELECT
+			machine_id,
+			hostname,
+			package,
+			change_day,
+			COUNT(*) as change_count,
+			ARRAY_AGG(DISTINCT action) as actions
+		FROM PackageChanges
+		GROUP BY machine_id, hostname, package, change_day
+		HAVING COUNT(*) > 3
+		ORDER BY change_count DESC
+	`
+
+	rows2, err := database.QueryContext(ctx, rapidChangeQuery, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows2.Close()
+
+	for rows2.Next() {
+		var machineID, hostname, pkg string
+		var changeDay time.Time
+		var changeCount int
+		var actions []string
+
+		if err := rows2.Scan(&machineID, &hostname, &pkg, &changeDay, &changeCount, pq.Array(&actions)); err != nil {
+			return nil, err
+		}
+
+		severity := SeverityMedium
+		if changeCount > 5 {
+			severity = SeverityHigh
+		}
+
+		if severityFilter != "" && string(severity) != severityFilter {
+			continue
+		}
+
+		anomaly := TransactionAnomaly{
+			Type:        AnomalyRapidChange,
+			MachineID:   machineID,
+			Hostname:    hostname,
+			DetectedAt:  changeDay,
+			Description: fmt.Sprintf("Package '%s' changed %d times in 24h", pkg, changeCount),
+			Severity:    severity,
+			Details: RapidChangeDetails{
+				Package:     pkg,
+				ChangeCount: changeCount,
+				TimeWindow:  "24 hours",
+				Actions:     actions,
+			},
+		}
+
+		report.Anomalies = append(report.Anomalies, anomaly)
+		affectedHosts[machineID] = true
+	}
+
+	// Detect downgrades
+	downgradeQuery := `
+		SELECT
+			ti.machine_id,
+			t.hostname,
+			CASE
+				WHEN ti.package LIKE 'Change %' THEN SUBSTRING(ti.package FROM 8)
+				ELSE ti.package
+			END AS package,
+			ti.version as to_version,
+			t.begin_time
+		FROM transaction_items ti
+		JOIN transactions t ON ti.transaction_id = t.transaction_id AND ti.machine_id = t.machine_id
+		WHERE t.begin_time >= NOW() - make_interval(days => $1)
+			AND ti.action = 'Downgrade'
+		ORDER BY t.begin_time DESC
+	`
+
+	rows3, err := database.QueryContext(ctx, downgradeQuery, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows3.Close()
+
+	for rows3.Next() {
+		var machineID, hostname, pkg, toVersion string
+		var beginTime time.Time
+
+		if err := rows3.Scan(&machineID, &hostname, &pkg, &toVersion, &beginTime); err != nil {
+			return nil, err
+		}
+
+		severity := SeverityLow
+		if severityFilter != "" && string(severity) != severityFilter {
+			continue
+		}
+
+		anomaly := TransactionAnomaly{
+			Type:        AnomalyDowngrade,
+			MachineID:   machineID,
+			Hostname:    hostname,
+			DetectedAt:  beginTime,
+			Description: fmt.Sprintf("Package '%s' was downgraded to version %s", pkg, toVersion),
+			Severity:    severity,
+			Details: DowngradeDetails{
+				Package:   pkg,
+				ToVersion: toVersion,
+			},
+		}
+
+		report.Anomalies = append(report.Anomalies, anomaly)
+		affectedHosts[machineID] = true
+	}
+
+	// Calculate summary
+	for _, anomaly := range report.Anomalies {
+		report.Summary.TotalCount++
+		report.Summary.ByType[string(anomaly.Type)]++
+		report.Summary.BySeverity[string(anomaly.Severity)]++
+	}
+	report.Summary.AffectedHosts = len(affectedHosts)
+
+	return report, nil
+}
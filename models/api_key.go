@@ -1,9 +1,24 @@
 package models
 
 import (
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
 	"time"
 )
 
+// API key scopes. A key is granted the scopes it lists; the admin scope
+// grants every scope.
+const (
+	APIKeyScopeIngest = "ingest" // agents: upload transactions and executions
+	APIKeyScopeRead   = "read"   // reporting: read endpoints and inventories
+	APIKeyScopeAdmin  = "admin"  // administrative endpoints
+)
+
+// APIKeyScopes lists the scopes in the order they are displayed.
+var APIKeyScopes = []string{APIKeyScopeIngest, APIKeyScopeRead, APIKeyScopeAdmin}
+
 // ApiKey represents an API key for authenticating API requests
 type ApiKey struct {
 	ID          int        `json:"id" db:"id"`
@@ -15,6 +30,34 @@ type ApiKey struct {
 	IsActive    bool       `json:"is_active" db:"is_active"`
 	CreatedBy   *int       `json:"created_by" db:"created_by"`
 	CreatorName string     `json:"creator_name,omitempty" db:"creator_name"` // Joined from users table
+	UserID      *int       `json:"user_id,omitempty" db:"user_id"`           // Owner of a personal access token; nil for shared keys
+	OwnerName   string     `json:"owner_name,omitempty" db:"owner_name"`     // Joined from users table
+
+	APIKeyRestrictions
+}
+
+// IsPersonal reports whether the key is a personal access token, which acts
+// as its owner.
+func (k ApiKey) IsPersonal() bool {
+	return k.UserID != nil
+}
+
+// PersonalTokenScopes returns the scopes a user with role may grant to their
+// personal access tokens: every scope for admins, and read for other roles,
+// as for their browser sessions.
+func PersonalTokenScopes(role string) []string {
+	if role == RoleAdmin {
+		return APIKeyScopes
+	}
+	return []string{APIKeyScopeRead}
+}
+
+// APIKeyRestrictions limit what an API key can do and from where.
+type APIKeyRestrictions struct {
+	Scopes       []string   `json:"scopes" db:"scopes"`
+	ExpiresAt    *time.Time `json:"expires_at" db:"expires_at"`             // nil: never expires
+	AllowedCIDRs []string   `json:"allowed_cidrs" db:"allowed_cidrs"`       // empty: any address
+	Environment  string     `json:"environment,omitempty" db:"environment"` // empty: every environment
 }
 
 // ApiKeyWithSecret is used only when creating a new API key to return the actual key once
@@ -22,3 +65,136 @@ type ApiKeyWithSecret struct {
 	ApiKey
 	Secret string `json:"secret"` // The actual API key (only shown once)
 }
+
+// HasScope reports whether the key is granted scope.
+func (r APIKeyRestrictions) HasScope(scope string) bool {
+	return slices.Contains(r.Scopes, scope) || slices.Contains(r.Scopes, APIKeyScopeAdmin)
+}
+
+// IsExpired reports whether the key has expired at now.
+func (r APIKeyRestrictions) IsExpired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// ListsScope reports whether scope is one of the key's scopes. Unlike
+// HasScope, it does not consider the scopes implied by admin.
+func (r APIKeyRestrictions) ListsScope(scope string) bool {
+	return slices.Contains(r.Scopes, scope)
+}
+
+// Expired reports whether the key has expired by now.
+func (r APIKeyRestrictions) Expired() bool {
+	return r.IsExpired(time.Now())
+}
+
+// ExpiresOn returns the last day the key is valid, in the form entered in
+// the admin panel, or "" when the key never expires.
+func (r APIKeyRestrictions) ExpiresOn() string {
+	if r.ExpiresAt == nil {
+		return ""
+	}
+	return r.ExpiresAt.UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+}
+
+// AllowsAddress reports whether a request from ip may use the key. Keys
+// without an allowlist are accepted from any address.
+func (r APIKeyRestrictions) AllowsAddress(ip string) bool {
+	if len(r.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range r.AllowedCIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsTopology reports whether an asset resolved to t belongs to the
+// environment the key is bound to. The environment matches the friendly
+// name or the raw :env value, without regard to case. Keys that are not
+// bound accept every asset; bound keys never accept assets outside the
+// topology.
+func (r APIKeyRestrictions) AcceptsTopology(t *ResolvedTopology) bool {
+	if r.Environment == "" {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return strings.EqualFold(r.Environment, t.EnvironmentName) || strings.EqualFold(r.Environment, t.EnvironmentValue)
+}
+
+// ParseAPIKeyRestrictions validates the restrictions entered for a key in
+// the admin panel. expiresOn is an optional date (YYYY-MM-DD) through which
+// the key is valid; it must not be in the past. cidrs is a list of networks
+// or addresses separated by commas, spaces or new lines. Scopes are
+// returned in display order and networks in canonical form.
+func ParseAPIKeyRestrictions(scopes []string, expiresOn, cidrs, environment string, now time.Time) (APIKeyRestrictions, error) {
+	var r APIKeyRestrictions
+
+	for _, scope := range scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			return r, errors.New("unknown scope " + scope)
+		}
+	}
+	for _, scope := range APIKeyScopes {
+		if slices.Contains(scopes, scope) {
+			r.Scopes = append(r.Scopes, scope)
+		}
+	}
+	if len(r.Scopes) == 0 {
+		return r, errors.New("select at least one scope")
+	}
+
+	expiresAt, err := parseExpiryDate(expiresOn, now)
+	if err != nil {
+		return r, err
+	}
+	r.ExpiresAt = expiresAt
+
+	r.AllowedCIDRs = []string{}
+	for _, field := range strings.FieldsFunc(cidrs, func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\n' || c == '\r' || c == '\t'
+	}) {
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(field)
+			if addrErr != nil {
+				return r, errors.New("invalid network " + field)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cidr := prefix.Masked().String()
+		if !slices.Contains(r.AllowedCIDRs, cidr) {
+			r.AllowedCIDRs = append(r.AllowedCIDRs, cidr)
+		}
+	}
+
+	r.Environment = strings.TrimSpace(environment)
+	return r, nil
+}
+
+// parseExpiryDate parses an optional date (YYYY-MM-DD) through which a
+// secret is valid, and returns when it expires: the start of the next day,
+// in UTC. The date must not be in the past.
+func parseExpiryDate(expiresOn string, now time.Time) (*time.Time, error) {
+	expiresOn = strings.TrimSpace(expiresOn)
+	if expiresOn == "" {
+		return nil, nil
+	}
+	day, err := time.Parse(time.DateOnly, expiresOn)
+	if err != nil {
+		return nil, errors.New("expiry date must be YYYY-MM-DD")
+	}
+	expiresAt := day.AddDate(0, 0, 1)
+	if !expiresAt.After(now) {
+		return nil, errors.New("expiry date must not be in the past")
+	}
+	return &expiresAt, nil
+}
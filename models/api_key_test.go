@@ -0,0 +1,150 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseAPIKeyRestrictions(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		scopes      []string
+		expiresOn   string
+		cidrs       string
+		wantScopes  []string
+		wantExpires string
+		wantCIDRs   []string
+		wantErr     bool
+	}{
+		{"all scopes", []string{"admin", "ingest", "read"}, "", "", []string{"ingest", "read", "admin"}, "", []string{}, false},
+		{"expires today", []string{"ingest"}, "2026-10-19", "", []string{"ingest"}, "2026-10-20T00:00:00Z", []string{}, false},
+		{"networks", []string{"read"}, "", "10.1.2.3/8, 192.168.0.7\n2001:db8::1 10.0.0.0/8", []string{"read"}, "", []string{"10.0.0.0/8", "192.168.0.7/32", "2001:db8::1/128"}, false},
+		{"no scope", nil, "", "", nil, "", nil, true},
+		{"unknown scope", []string{"write"}, "", "", nil, "", nil, true},
+		{"past expiry", []string{"ingest"}, "2026-10-18", "", nil, "", nil, true},
+		{"bad date", []string{"ingest"}, "19/10/2026", "", nil, "", nil, true},
+		{"bad network", []string{"ingest"}, "", "10.0.0.0/33", nil, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseAPIKeyRestrictions(tt.scopes, tt.expiresOn, tt.cidrs, " Production ", now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAPIKeyRestrictions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !slices.Equal(r.Scopes, tt.wantScopes) {
+				t.Errorf("Scopes = %v, want %v", r.Scopes, tt.wantScopes)
+			}
+			var expires string
+			if r.ExpiresAt != nil {
+				expires = r.ExpiresAt.Format(time.RFC3339)
+			}
+			if expires != tt.wantExpires {
+				t.Errorf("ExpiresAt = %q, want %q", expires, tt.wantExpires)
+			}
+			if r.ExpiresOn() != tt.expiresOn {
+				t.Errorf("ExpiresOn() = %q, want %q", r.ExpiresOn(), tt.expiresOn)
+			}
+			if !slices.Equal(r.AllowedCIDRs, tt.wantCIDRs) {
+				t.Errorf("AllowedCIDRs = %v, want %v", r.AllowedCIDRs, tt.wantCIDRs)
+			}
+			if r.Environment != "Production" {
+				t.Errorf("Environment = %q, want Production", r.Environment)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRestrictionsHasScope(t *testing.T) {
+	ingest := APIKeyRestrictions{Scopes: []string{APIKeyScopeIngest}}
+	if !ingest.HasScope(APIKeyScopeIngest) || ingest.HasScope(APIKeyScopeRead) || ingest.HasScope(APIKeyScopeAdmin) {
+		t.Error("ingest key should only be granted the ingest scope")
+	}
+
+	admin := APIKeyRestrictions{Scopes: []string{APIKeyScopeAdmin}}
+	for _, scope := range APIKeyScopes {
+		if !admin.HasScope(scope) {
+			t.Errorf("admin key should be granted the %s scope", scope)
+		}
+	}
+	if admin.ListsScope(APIKeyScopeRead) {
+		t.Error("ListsScope should not report scopes implied by admin")
+	}
+}
+
+func TestPersonalTokenScopes(t *testing.T) {
+	if got := PersonalTokenScopes(RoleAdmin); len(got) != len(APIKeyScopes) {
+		t.Errorf("PersonalTokenScopes(admin) = %v, want every scope", got)
+	}
+	for _, role := range []string{RoleViewer, RoleOperator, RoleSecurityAnalyst} {
+		if got := PersonalTokenScopes(role); len(got) != 1 || got[0] != APIKeyScopeRead {
+			t.Errorf("PersonalTokenScopes(%s) = %v, want [read]", role, got)
+		}
+	}
+}
+
+func TestAPIKeyRestrictionsIsExpired(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	r := APIKeyRestrictions{ExpiresAt: &expiresAt}
+
+	if r.IsExpired(expiresAt.Add(-time.Second)) {
+		t.Error("key should be valid until its expiry time")
+	}
+	if !r.IsExpired(expiresAt) {
+		t.Error("key should be expired at its expiry time")
+	}
+	if (APIKeyRestrictions{}).IsExpired(expiresAt) {
+		t.Error("key without expiry should never expire")
+	}
+}
+
+func TestAPIKeyRestrictionsAllowsAddress(t *testing.T) {
+	if !(APIKeyRestrictions{}).AllowsAddress("203.0.113.9") {
+		t.Error("key without allowlist should accept any address")
+	}
+
+	r := APIKeyRestrictions{AllowedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.20.30.40", true},
+		{"::ffff:10.20.30.40", true},
+		{"2001:db8::5", true},
+		{"192.168.1.1", false},
+		{"not-an-ip", false},
+	}
+	for _, tt := range tests {
+		if got := r.AllowsAddress(tt.ip); got != tt.want {
+			t.Errorf("AllowsAddress(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyRestrictionsAcceptsTopology(t *testing.T) {
+	prod := &ResolvedTopology{EnvironmentValue: "prd", EnvironmentName: "Production"}
+
+	if !(APIKeyRestrictions{}).AcceptsTopology(nil) {
+		t.Error("unbound key should accept assets outside the topology")
+	}
+
+	r := APIKeyRestrictions{Environment: "production"}
+	if !r.AcceptsTopology(prod) {
+		t.Error("environment should match the friendly name without regard to case")
+	}
+	if !(APIKeyRestrictions{Environment: "PRD"}).AcceptsTopology(prod) {
+		t.Error("environment should match the raw value")
+	}
+	if r.AcceptsTopology(&ResolvedTopology{EnvironmentValue: "stg", EnvironmentName: "Staging"}) {
+		t.Error("other environment should be rejected")
+	}
+	if r.AcceptsTopology(nil) {
+		t.Error("bound key should reject assets outside the topology")
+	}
+}
@@ -18,12 +18,25 @@ func NewAssetManager(db *sql.DB) *AssetManager {
 func (am *AssetManager) UpsertAsset(tx *sql.Tx, hostname string, machineID string, timestamp time.Time, needsRestarting sql.NullBool, restartingReason sql.NullString, os string, agentVersion string) error {
 	var existingAssetID int
 	var existingIsActive bool
+	var existingNeedsRestarting sql.NullBool
 
 	err := tx.QueryRow(`
-		SELECT asset_id, is_active
+		SELECT asset_id, is_active, needs_restarting
 		FROM assets
 		WHERE hostname = $1 AND machine_id = $2
-	`, hostname, machineID).Scan(&existingAssetID, &existingIsActive)
+	`, hostname, machineID).Scan(&existingAssetID, &existingIsActive, &existingNeedsRestarting)
+
+	eventData := WebhookAssetData{
+		MachineID:    machineID,
+		Hostname:     hostname,
+		OS:           os,
+		AgentVersion: agentVersion,
+		Timestamp:    timestamp,
+	}
+	if needsRestarting.Valid {
+		eventData.NeedsRestarting = &needsRestarting.Bool
+		eventData.RestartingReason = restartingReason.String
+	}
 
 	if err == sql.ErrNoRows {
 		err = am.deactivateAssetsByMachineID(tx, machineID)
@@ -50,17 +63,18 @@ func (am *AssetManager) UpsertAsset(tx *sql.Tx, hostname string, machineID strin
 				VALUES ($1, $2, $3, $3, TRUE, CURRENT_TIMESTAMP, $4, $5, $6)
 			`, hostname, machineID, timestamp, needsRestarting, restartingReason, os)
 			if err != nil {
-				logger.Error("Error inserting asset: " + err.Error())
+				logger.Error("Error inserting asset", "error", err)
 				return err
 			}
 		} else {
 			tx.Exec("RELEASE SAVEPOINT upsert_agent_version")
 		}
 
-		logger.Debug("Created new asset: hostname=" + hostname + " machine_id=" + machineID)
+		logger.Debug("Created new asset", "hostname", hostname, "machine_id", machineID)
+		am.emit(tx, WebhookEventAssetCreated, eventData)
 		return nil
 	} else if err != nil {
-		logger.Error("Error checking existing asset: " + err.Error())
+		logger.Error("Error checking existing asset", "error", err)
 		return err
 	}
 
@@ -80,7 +94,7 @@ func (am *AssetManager) UpsertAsset(tx *sql.Tx, hostname string, machineID strin
 			WHERE asset_id = $5
 		`, timestamp, needsRestarting, restartingReason, os, existingAssetID)
 		if err != nil {
-			logger.Error("Error updating asset last_seen: " + err.Error())
+			logger.Error("Error updating asset last_seen", "error", err)
 			return err
 		}
 	} else {
@@ -105,46 +119,87 @@ func (am *AssetManager) UpsertAsset(tx *sql.Tx, hostname string, machineID strin
 		`, existingAssetID)
 
 		if err != nil {
-			logger.Error("Error reactivating asset: " + err.Error())
+			logger.Error("Error reactivating asset", "error", err)
 			return err
 		}
 
-		logger.Info("Reactivated asset: hostname=" + hostname + " machine_id=" + machineID)
+		logger.Info("Reactivated asset", "hostname", hostname, "machine_id", machineID)
+		am.emit(tx, WebhookEventAssetReactivated, eventData)
+	}
+
+	// Executions report needs_restarting; transactions leave it NULL, which
+	// is not a change.
+	if needsRestarting.Valid && existingNeedsRestarting.Valid && needsRestarting.Bool != existingNeedsRestarting.Bool {
+		am.emit(tx, WebhookEventNeedsRestartingChanged, eventData)
+	}
+
+	return nil
+}
+
+// emit queues a webhook event in the asset transaction. Failing to queue it
+// never fails the upsert.
+func (am *AssetManager) emit(tx *sql.Tx, event string, data any) {
+	if err := EnqueueWebhookEvent(tx, event, data); err != nil {
+		logger.Warn("Error queuing webhook event", "event", event, "error", err)
+	}
+}
+
+// emitDeactivated queues an asset.deactivated event for every asset returned
+// by a deactivation query (machine_id, hostname rows).
+func (am *AssetManager) emitDeactivated(tx *sql.Tx, rows *sql.Rows) error {
+	var deactivated []WebhookAssetData
+	for rows.Next() {
+		var d WebhookAssetData
+		if err := rows.Scan(&d.MachineID, &d.Hostname); err != nil {
+			rows.Close()
+			return err
+		}
+		d.Timestamp = time.Now()
+		deactivated = append(deactivated, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
+	for _, d := range deactivated {
+		am.emit(tx, WebhookEventAssetDeactivated, d)
+	}
 	return nil
 }
 
 func (am *AssetManager) deactivateAssetsByMachineID(tx *sql.Tx, machineID string) error {
-	_, err := tx.Exec(`
+	rows, err := tx.Query(`
 		UPDATE assets
 		SET is_active = FALSE, deactivated_at = CURRENT_TIMESTAMP
 		WHERE machine_id = $1
 		AND is_active = TRUE
+		RETURNING machine_id, hostname
 	`, machineID)
 
 	if err != nil {
-		logger.Error("Error deactivating old assets by machine_id: " + err.Error())
+		logger.Error("Error deactivating old assets by machine_id", "error", err)
 		return err
 	}
 
-	return nil
+	return am.emitDeactivated(tx, rows)
 }
 
 func (am *AssetManager) deactivateAssetsByHostname(tx *sql.Tx, hostname string) error {
-	_, err := tx.Exec(`
+	rows, err := tx.Query(`
 		UPDATE assets
 		SET is_active = FALSE, deactivated_at = CURRENT_TIMESTAMP
 		WHERE hostname = $1
 		AND is_active = TRUE
+		RETURNING machine_id, hostname
 	`, hostname)
 
 	if err != nil {
-		logger.Error("Error deactivating old assets by hostname: " + err.Error())
+		logger.Error("Error deactivating old assets by hostname", "error", err)
 		return err
 	}
 
-	return nil
+	return am.emitDeactivated(tx, rows)
 }
 
 func (am *AssetManager) GetActiveAsset(hostname string) (*Asset, error) {
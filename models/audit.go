@@ -0,0 +1,296 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Audit actor types.
+const (
+	AuditActorUser              = "user"
+	AuditActorAPIKey            = "api_key"
+	AuditActorMachineCredential = "machine_credential"
+	AuditActorClientCertificate = "client_certificate"
+	AuditActorSCIM              = "scim"
+	AuditActorAnonymous         = "anonymous"
+)
+
+// Audit actions. The part before the dot is the kind of target.
+const (
+	AuditLogin                   = "auth.login"
+	AuditLogout                  = "auth.logout"
+	AuditProviderLogout          = "auth.provider_logout"
+	AuditPasswordReset           = "auth.password_reset"
+	AuditPasswordChange          = "account.password_change"
+	AuditTOTPEnable              = "account.totp_enable"
+	AuditTOTPDisable             = "account.totp_disable"
+	AuditSessionRevoke           = "account.session_revoke"
+	AuditSessionRevokeOthers     = "account.sessions_revoke_others"
+	AuditPersonalTokenCreate     = "account.token_create"
+	AuditPersonalTokenRevoke     = "account.token_revoke"
+	AuditUserCreate              = "user.create"
+	AuditUserUpdate              = "user.update"
+	AuditUserDeactivate          = "user.deactivate"
+	AuditUserPasswordResetIssue  = "user.password_reset_issue"
+	AuditUserTOTPDisable         = "user.totp_disable"
+	AuditUserSessionsTerminate   = "user.sessions_terminate"
+	AuditAPIKeyCreate            = "api_key.create"
+	AuditAPIKeyUpdate            = "api_key.update"
+	AuditAPIKeyRevoke            = "api_key.revoke"
+	AuditAPIKeyDelete            = "api_key.delete"
+	AuditEnrollmentTokenCreate   = "enrollment_token.create"
+	AuditEnrollmentTokenRevoke   = "enrollment_token.revoke"
+	AuditEnrollmentTokenDelete   = "enrollment_token.delete"
+	AuditMachineEnroll           = "machine_credential.enroll"
+	AuditMachineCredentialRevoke = "machine_credential.revoke"
+	AuditMachineCredentialDelete = "machine_credential.delete"
+	AuditSCIMGroupCreate         = "scim_group.create"
+	AuditSCIMGroupUpdate         = "scim_group.update"
+	AuditSCIMGroupDelete         = "scim_group.delete"
+	AuditAssetDelete             = "asset.delete"
+	AuditAssetLabelsUpdate       = "asset.labels_update"
+	AuditAssetCleanupInactive    = "asset.cleanup_inactive"
+	AuditOSVUpdate               = "osv.update"
+	AuditOSVReset                = "osv.reset"
+	AuditMigrationsRun           = "migrations.run"
+	AuditWebhookCreate           = "webhook.create"
+	AuditWebhookToggle           = "webhook.toggle"
+	AuditWebhookDelete           = "webhook.delete"
+	AuditWebhookRetry            = "webhook.retry"
+	AuditSyslogCreate            = "syslog.create"
+	AuditSyslogToggle            = "syslog.toggle"
+	AuditSyslogDelete            = "syslog.delete"
+	AuditTopologyPatternCreate   = "topology.pattern_create"
+	AuditTopologyPatternUpdate   = "topology.pattern_update"
+	AuditTopologyPatternDelete   = "topology.pattern_delete"
+	AuditTopologyNameCreate      = "topology.name_create"
+	AuditTopologyNameUpdate      = "topology.name_update"
+	AuditTopologyNameDelete      = "topology.name_delete"
+)
+
+// AuditEntry is a recorded administrative or security-relevant action.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    *int            `json:"actor_id"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Success    bool            `json:"success"`
+	Before     json.RawMessage `json:"before" swaggertype:"object"`
+	After      json.RawMessage `json:"after" swaggertype:"object"`
+	IPAddress  string          `json:"ip_address"`
+	RequestID  string          `json:"request_id"`
+}
+
+// AuditFilter selects audit entries. Empty fields do not filter.
+type AuditFilter struct {
+	// Actor matches the actor name, without regard to case.
+	Actor string
+	// Action matches the action, or all actions of a kind when it ends
+	// with a dot, as in "user.".
+	Action string
+	// Target matches the target type or ID.
+	Target string
+	// Search matches the actor, target and states, without regard to case.
+	Search string
+	// FailedOnly keeps the refused attempts.
+	FailedOnly bool
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// ParseAuditFilter reads the filters of the audit log page and export.
+// from and to are dates (YYYY-MM-DD), in UTC, or RFC 3339 times; a date in
+// to includes the whole day. failed keeps the refused attempts when "true".
+func ParseAuditFilter(actor, action, target, search, failed, from, to string) (AuditFilter, error) {
+	f := AuditFilter{
+		Actor:      strings.TrimSpace(actor),
+		Action:     strings.TrimSpace(action),
+		Target:     strings.TrimSpace(target),
+		Search:     strings.TrimSpace(search),
+		FailedOnly: failed == "true",
+	}
+
+	var err error
+	if f.From, err = parseAuditTime(from, false); err != nil {
+		return f, errors.New("from must be YYYY-MM-DD or an RFC 3339 time")
+	}
+	if f.To, err = parseAuditTime(to, true); err != nil {
+		return f, errors.New("to must be YYYY-MM-DD or an RFC 3339 time")
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return f, errors.New("from must be before to")
+	}
+	return f, nil
+}
+
+// parseAuditTime parses an optional date or time. A date is the start of
+// the day, or the start of the next day when it ends a range.
+func parseAuditTime(value string, end bool) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return &day, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// AuditManager records and lists entries of the audit_log table.
+type AuditManager struct {
+	db *sql.DB
+}
+
+// NewAuditManager returns a new AuditManager backed by the given DB.
+func NewAuditManager(db *sql.DB) *AuditManager {
+	return &AuditManager{db: db}
+}
+
+// Record appends an entry to the audit log.
+func (m *AuditManager) Record(e AuditEntry) error {
+	_, err := m.db.Exec(`
+		INSERT INTO audit_log (
+			actor_type, actor_id, actor_name, action, target_type, target_id,
+			success, before_state, after_state, ip_address, request_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, e.ActorType, e.ActorID, e.ActorName, e.Action, e.TargetType, e.TargetID,
+		e.Success, nullJSON(e.Before), nullJSON(e.After), e.IPAddress, e.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// nullJSON returns a JSON document for a JSONB column, or nil for SQL NULL.
+func nullJSON(doc json.RawMessage) any {
+	if len(doc) == 0 || string(doc) == "null" {
+		return nil
+	}
+	return string(doc)
+}
+
+// where returns the WHERE clause and arguments of a filter.
+func (f AuditFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if f.Actor != "" {
+		add("actor_name ILIKE ?", "%"+escapeLike(f.Actor)+"%")
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		add("action LIKE ?", escapeLike(f.Action)+"%")
+	} else if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.Target != "" {
+		add("(target_type = ? OR target_id = ?)", f.Target)
+	}
+	if f.Search != "" {
+		add("(actor_name || ' ' || target_id || ' ' || COALESCE(before_state::text, '') || ' ' || COALESCE(after_state::text, '')) ILIKE ?", "%"+escapeLike(f.Search)+"%")
+	}
+	if f.FailedOnly {
+		conditions = append(conditions, "NOT success")
+	}
+	if f.From != nil {
+		add("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < ?", *f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// List returns the entries selected by a filter, newest first, and the
+// number of entries selected without the limit and offset.
+func (m *AuditManager) List(f AuditFilter) ([]AuditEntry, int, error) {
+	where, args := f.where()
+
+	var total int
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM audit_log `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	query := `
+		SELECT id, created_at, actor_type, actor_id, actor_name, action, target_type, target_id,
+		       success, before_state, after_state, ip_address, request_id
+		FROM audit_log ` + where + ` ORDER BY created_at DESC, id DESC`
+	if f.Limit > 0 {
+		args = append(args, f.Limit, f.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var actorID sql.NullInt64
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorType, &actorID, &e.ActorName, &e.Action,
+			&e.TargetType, &e.TargetID, &e.Success, &before, &after, &e.IPAddress, &e.RequestID); err != nil {
+			return nil, 0, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			e.ActorID = &id
+		}
+		e.Before = before
+		e.After = after
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// Actions returns the distinct actions recorded, for filters.
+func (m *AuditManager) Actions() ([]string, error) {
+	rows, err := m.db.Query(`SELECT DISTINCT action FROM audit_log ORDER BY action`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []string
+	for rows.Next() {
+		var action string
+		if err := rows.Scan(&action); err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseAuditFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{"no dates", "", "", "", "", false},
+		{"dates", "2026-10-01", "2026-10-19", "2026-10-01T00:00:00Z", "2026-10-20T00:00:00Z", false},
+		{"times", "2026-10-19T08:00:00Z", "2026-10-19T09:30:00Z", "2026-10-19T08:00:00Z", "2026-10-19T09:30:00Z", false},
+		{"same day", "2026-10-19", "2026-10-19", "2026-10-19T00:00:00Z", "2026-10-20T00:00:00Z", false},
+		{"reversed", "2026-10-19", "2026-10-01", "", "", true},
+		{"bad date", "19/10/2026", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseAuditFilter(" alice ", "user.", "", "", "true", tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAuditFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if f.Actor != "alice" || f.Action != "user." || !f.FailedOnly {
+				t.Errorf("ParseAuditFilter() = %+v", f)
+			}
+			if got := formatAuditTime(f.From); got != tt.wantFrom {
+				t.Errorf("From = %q, want %q", got, tt.wantFrom)
+			}
+			if got := formatAuditTime(f.To); got != tt.wantTo {
+				t.Errorf("To = %q, want %q", got, tt.wantTo)
+			}
+		})
+	}
+}
+
+func formatAuditTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func TestAuditFilterWhere(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		filter    AuditFilter
+		wantWhere string
+		wantArgs  []any
+	}{
+		{"empty", AuditFilter{}, "", nil},
+		{"action", AuditFilter{Action: "api_key.revoke"}, "WHERE action = $1", []any{"api_key.revoke"}},
+		{"action kind", AuditFilter{Action: "user."}, "WHERE action LIKE $1", []any{"user.%"}},
+		{"actor escaped", AuditFilter{Actor: "a_b%"}, "WHERE actor_name ILIKE $1", []any{`%a\_b\%%`}},
+		{
+			"combined",
+			AuditFilter{Target: "asset", FailedOnly: true, From: &from},
+			"WHERE (target_type = $1 OR target_id = $1) AND NOT success AND created_at >= $2",
+			[]any{"asset", from},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where()
+			if where != tt.wantWhere {
+				t.Errorf("where() = %q, want %q", where, tt.wantWhere)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("where() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import "strings"
+
+// Request fields that the names of an agent's client certificate can be
+// mapped to.
+const (
+	CertificateIdentityHostname  = "hostname"
+	CertificateIdentityMachineID = "machine_id"
+)
+
+// CertificateIdentity is an agent authenticated with a TLS client
+// certificate. It can only submit data for the host its certificate names.
+type CertificateIdentity struct {
+	Names []string // DNS SANs and subject common name of the certificate
+	Field string   // CertificateIdentityHostname or CertificateIdentityMachineID
+}
+
+// Allows reports whether the certificate names the host with the given
+// machine ID and hostname. Names are compared without regard to case.
+func (ci CertificateIdentity) Allows(machineID, hostname string) bool {
+	value := hostname
+	if ci.Field == CertificateIdentityMachineID {
+		value = machineID
+	}
+	if value == "" {
+		return false
+	}
+	for _, name := range ci.Names {
+		if strings.EqualFold(name, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the first name of the certificate, for logging.
+func (ci CertificateIdentity) Name() string {
+	if len(ci.Names) == 0 {
+		return ""
+	}
+	return ci.Names[0]
+}
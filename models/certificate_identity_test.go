@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestCertificateIdentityAllows(t *testing.T) {
+	tests := []struct {
+		name      string
+		identity  CertificateIdentity
+		machineID string
+		hostname  string
+		want      bool
+	}{
+		{"hostname SAN", CertificateIdentity{Names: []string{"web01", "web01.example.com"}, Field: CertificateIdentityHostname}, "abc", "WEB01.example.com", true},
+		{"other hostname", CertificateIdentity{Names: []string{"web01.example.com"}, Field: CertificateIdentityHostname}, "abc", "web02.example.com", false},
+		{"machine_id", CertificateIdentity{Names: []string{"abc"}, Field: CertificateIdentityMachineID}, "abc", "web01", true},
+		{"hostname with machine_id field", CertificateIdentity{Names: []string{"web01"}, Field: CertificateIdentityMachineID}, "abc", "web01", false},
+		{"empty value", CertificateIdentity{Names: []string{""}, Field: CertificateIdentityHostname}, "abc", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.identity.Allows(tt.machineID, tt.hostname); got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.machineID, tt.hostname, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Digest frequencies.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digest sections, stored in digest_subscriptions.sections.
+const (
+	DigestSectionRestart          = "restart"
+	DigestSectionFailedExecutions = "failed_executions"
+	DigestSectionVulnerabilities  = "vulnerabilities"
+	DigestSectionAnomalies        = "anomalies"
+)
+
+// DigestSections lists every digest section in the order they are rendered.
+var DigestSections = []string{
+	DigestSectionRestart,
+	DigestSectionFailedExecutions,
+	DigestSectionVulnerabilities,
+	DigestSectionAnomalies,
+}
+
+// DigestListLimit caps how many rows of each section a digest lists; the
+// section total still counts every row.
+const DigestListLimit = 50
+
+// digestDueTolerance lets a digest go out slightly before a full period has
+// elapsed, so a job scheduled at a fixed time does not skip a day because
+// the previous run finished a few seconds later.
+const digestDueTolerance = time.Hour
+
+// IsValidDigestFrequency reports whether f is a known digest frequency.
+func IsValidDigestFrequency(f string) bool {
+	return f == DigestDaily || f == DigestWeekly
+}
+
+// IsValidDigestSection reports whether s is a known digest section.
+func IsValidDigestSection(s string) bool {
+	for _, section := range DigestSections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// DigestPeriod returns the time window covered by a digest.
+func DigestPeriod(frequency string) time.Duration {
+	if frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// DigestSubscription is a user's e-mail digest subscription.
+type DigestSubscription struct {
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Frequency  string     `json:"frequency"`
+	Sections   []string   `json:"sections"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// Includes reports whether the section is part of the subscription. An
+// empty section list means every section.
+func (s DigestSubscription) Includes(section string) bool {
+	if len(s.Sections) == 0 {
+		return true
+	}
+	for _, v := range s.Sections {
+		if v == section {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDue reports whether a new digest should be sent at now.
+func (s DigestSubscription) IsDue(now time.Time) bool {
+	if s.LastSentAt == nil {
+		return true
+	}
+	return !now.Before(s.LastSentAt.Add(DigestPeriod(s.Frequency) - digestDueTolerance))
+}
+
+// DigestRestartAsset is an active asset that needs a restart.
+type DigestRestartAsset struct {
+	MachineID string
+	Hostname  string
+	Reason    string
+	LastSeen  time.Time
+}
+
+// DigestFailedExecution is an agent execution that did not succeed.
+type DigestFailedExecution struct {
+	ID         int
+	MachineID  string
+	Hostname   string
+	ExecutedAt time.Time
+	Details    string
+}
+
+// DigestVulnerability is a critical vulnerability published during the
+// digest period that affects packages installed on active assets.
+type DigestVulnerability struct {
+	ID          string
+	Summary     string
+	CVSSScore   float64
+	PublishedAt *time.Time
+	AssetCount  int
+}
+
+// Digest is the content of one digest e-mail.
+type Digest struct {
+	Frequency string
+	Since     time.Time
+	Until     time.Time
+
+	AssetsRequiringRestart []DigestRestartAsset
+	RestartTotal           int
+	FailedExecutions       []DigestFailedExecution
+	FailedTotal            int
+	Vulnerabilities        []DigestVulnerability
+	VulnerabilityTotal     int
+	Anomalies              []TransactionAnomaly
+	AnomalyTotal           int
+
+	sections []string
+}
+
+// WithSections returns a copy of the digest restricted to the given
+// sections; an empty list keeps every section.
+func (d Digest) WithSections(sections []string) Digest {
+	d.sections = sections
+	return d
+}
+
+// Has reports whether the section is part of the digest.
+func (d Digest) Has(section string) bool {
+	return DigestSubscription{Sections: d.sections}.Includes(section)
+}
+
+// IsEmpty reports whether none of the digest's sections has anything to
+// report.
+func (d Digest) IsEmpty() bool {
+	return (!d.Has(DigestSectionRestart) || d.RestartTotal == 0) &&
+		(!d.Has(DigestSectionFailedExecutions) || d.FailedTotal == 0) &&
+		(!d.Has(DigestSectionVulnerabilities) || d.VulnerabilityTotal == 0) &&
+		(!d.Has(DigestSectionAnomalies) || d.AnomalyTotal == 0)
+}
+
+// DigestManager stores digest subscriptions and gathers digest content.
+type DigestManager struct {
+	db *sql.DB
+}
+
+// NewDigestManager returns a new DigestManager backed by the given DB.
+func NewDigestManager(db *sql.DB) *DigestManager {
+	return &DigestManager{db: db}
+}
+
+const digestSubscriptionColumns = `
+    u.id, u.name, u.email, ds.frequency, ds.sections, ds.last_sent_at, COALESCE(ds.last_error, '')
+FROM digest_subscriptions ds
+JOIN users u ON u.id = ds.user_id`
+
+func scanDigestSubscription(scanner interface{ Scan(...any) error }) (DigestSubscription, error) {
+	var s DigestSubscription
+	var lastSentAt sql.NullTime
+	err := scanner.Scan(&s.UserID, &s.Name, &s.Email, &s.Frequency, pq.Array(&s.Sections), &lastSentAt, &s.LastError)
+	if lastSentAt.Valid {
+		s.LastSentAt = &lastSentAt.Time
+	}
+	return s, err
+}
+
+// ListSubscriptions returns the subscriptions of active users.
+func (dm *DigestManager) ListSubscriptions() ([]DigestSubscription, error) {
+	rows, err := dm.db.Query(`SELECT` + digestSubscriptionColumns + `
+WHERE u.is_active = TRUE
+ORDER BY u.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []DigestSubscription
+	for rows.Next() {
+		s, err := scanDigestSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// GetSubscription returns the user's subscription, or nil when the user is
+// not subscribed.
+func (dm *DigestManager) GetSubscription(userID int) (*DigestSubscription, error) {
+	s, err := scanDigestSubscription(dm.db.QueryRow(`SELECT`+digestSubscriptionColumns+`
+WHERE ds.user_id = $1`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveSubscription creates or updates the user's subscription. Changing it
+// does not reset when the last digest was sent.
+func (dm *DigestManager) SaveSubscription(userID int, frequency string, sections []string) error {
+	if !IsValidDigestFrequency(frequency) {
+		return errors.New("frequency must be daily or weekly")
+	}
+	for _, s := range sections {
+		if !IsValidDigestSection(s) {
+			return errors.New("unknown digest section: " + s)
+		}
+	}
+	if sections == nil {
+		sections = []string{}
+	}
+	_, err := dm.db.Exec(`
+INSERT INTO digest_subscriptions (user_id, frequency, sections)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET frequency = EXCLUDED.frequency, sections = EXCLUDED.sections, updated_at = NOW()`,
+		userID, frequency, pq.Array(sections))
+	return err
+}
+
+// DeleteSubscription unsubscribes the user.
+func (dm *DigestManager) DeleteSubscription(userID int) error {
+	_, err := dm.db.Exec(`DELETE FROM digest_subscriptions WHERE user_id = $1`, userID)
+	return err
+}
+
+// MarkSent records that the user's digest went out, or was skipped for
+// having nothing to report, at the given time.
+func (dm *DigestManager) MarkSent(userID int, at time.Time) error {
+	_, err := dm.db.Exec(`
+UPDATE digest_subscriptions SET last_sent_at = $2, last_error = NULL WHERE user_id = $1`,
+		userID, at)
+	return err
+}
+
+// MarkFailed records a failed delivery. The digest stays due and is retried
+// on the next run.
+func (dm *DigestManager) MarkFailed(userID int, sendErr error) error {
+	_, err := dm.db.Exec(`
+UPDATE digest_subscriptions SET last_error = $2 WHERE user_id = $1`,
+		userID, sendErr.Error())
+	return err
+}
+
+// BuildDigest gathers every section of a digest of the given frequency
+// covering the period that ends at now.
+func (dm *DigestManager) BuildDigest(ctx context.Context, frequency string, now time.Time) (*Digest, error) {
+	d := &Digest{
+		Frequency: frequency,
+		Since:     now.Add(-DigestPeriod(frequency)),
+		Until:     now,
+	}
+
+	if err := dm.restartAssets(ctx, d); err != nil {
+		return nil, err
+	}
+	if err := dm.failedExecutions(ctx, d); err != nil {
+		return nil, err
+	}
+	if err := dm.newCriticalVulnerabilities(ctx, d); err != nil {
+		return nil, err
+	}
+
+	days := int(DigestPeriod(frequency).Hours() / 24)
+	report, err := DetectAnomalies(ctx, dm.db, days, "")
+	if err != nil {
+		return nil, err
+	}
+	d.AnomalyTotal = len(report.Anomalies)
+	d.Anomalies = report.Anomalies
+	if len(d.Anomalies) > DigestListLimit {
+		d.Anomalies = d.Anomalies[:DigestListLimit]
+	}
+
+	return d, nil
+}
+
+func (dm *DigestManager) restartAssets(ctx context.Context, d *Digest) error {
+	rows, err := dm.db.QueryContext(ctx, `
+SELECT machine_id, hostname, COALESCE(restarting_reason, ''), last_seen, COUNT(*) OVER ()
+FROM assets
+WHERE is_active = TRUE AND needs_restarting = TRUE
+ORDER BY hostname
+LIMIT $1`, DigestListLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a DigestRestartAsset
+		if err := rows.Scan(&a.MachineID, &a.Hostname, &a.Reason, &a.LastSeen, &d.RestartTotal); err != nil {
+			return err
+		}
+		d.AssetsRequiringRestart = append(d.AssetsRequiringRestart, a)
+	}
+	return rows.Err()
+}
+
+func (dm *DigestManager) failedExecutions(ctx context.Context, d *Digest) error {
+	rows, err := dm.db.QueryContext(ctx, `
+SELECT id, machine_id, hostname, executed_at, COALESCE(details, ''), COUNT(*) OVER ()
+FROM executions
+WHERE success = FALSE AND executed_at >= $1 AND executed_at < $2
+ORDER BY executed_at DESC
+LIMIT $3`, d.Since, d.Until, DigestListLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e DigestFailedExecution
+		if err := rows.Scan(&e.ID, &e.MachineID, &e.Hostname, &e.ExecutedAt, &e.Details, &d.FailedTotal); err != nil {
+			return err
+		}
+		d.FailedExecutions = append(d.FailedExecutions, e)
+	}
+	return rows.Err()
+}
+
+func (dm *DigestManager) newCriticalVulnerabilities(ctx context.Context, d *Digest) error {
+	rows, err := dm.db.QueryContext(ctx, `
+WITH `+installedPackagesCTE+`
+SELECT
+    v.id,
+    COALESCE(v.summary, ''),
+    COALESCE(v.cvss_score, 0),
+    v.published_at,
+    COUNT(DISTINCT i.machine_id),
+    COUNT(*) OVER ()
+FROM installed i
+JOIN active ac ON ac.machine_id = i.machine_id
+JOIN package_vulnerabilities pv ON pv.package_name = i.package AND pv.version = i.version
+     AND pv.release = i.release
+     AND (
+         (NOT ac.is_rh_family AND pv.ecosystem = ac.ecosystem_prefix) OR
+         (ac.is_rh_family AND pv.ecosystem LIKE ac.ecosystem_prefix || '::%')
+     )
+JOIN vulnerabilities v ON v.id = pv.vulnerability_id
+WHERE v.severity = 'CRITICAL' AND v.published_at >= $1 AND v.published_at < $2
+GROUP BY v.id, v.summary, v.cvss_score, v.published_at
+ORDER BY COALESCE(v.cvss_score, 0) DESC, v.id
+LIMIT $3`, d.Since, d.Until, DigestListLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v DigestVulnerability
+		var publishedAt sql.NullTime
+		if err := rows.Scan(&v.ID, &v.Summary, &v.CVSSScore, &publishedAt, &v.AssetCount, &d.VulnerabilityTotal); err != nil {
+			return err
+		}
+		if publishedAt.Valid {
+			v.PublishedAt = &publishedAt.Time
+		}
+		d.Vulnerabilities = append(d.Vulnerabilities, v)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestSubscriptionIsDue(t *testing.T) {
+	now := time.Date(2026, 10, 18, 7, 0, 5, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	tests := []struct {
+		name     string
+		sub      DigestSubscription
+		expected bool
+	}{
+		{"never sent", DigestSubscription{Frequency: DigestDaily}, true},
+		{"daily, sent yesterday", DigestSubscription{Frequency: DigestDaily, LastSentAt: ago(24 * time.Hour)}, true},
+		{"daily, previous run finished late", DigestSubscription{Frequency: DigestDaily, LastSentAt: ago(24*time.Hour - 30*time.Second)}, true},
+		{"daily, sent this morning", DigestSubscription{Frequency: DigestDaily, LastSentAt: ago(2 * time.Hour)}, false},
+		{"weekly, sent yesterday", DigestSubscription{Frequency: DigestWeekly, LastSentAt: ago(24 * time.Hour)}, false},
+		{"weekly, sent a week ago", DigestSubscription{Frequency: DigestWeekly, LastSentAt: ago(7 * 24 * time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.IsDue(now); got != tt.expected {
+				t.Errorf("IsDue() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDigestSubscriptionIncludes(t *testing.T) {
+	all := DigestSubscription{}
+	for _, s := range DigestSections {
+		if !all.Includes(s) {
+			t.Errorf("subscription without sections should include %q", s)
+		}
+	}
+
+	restart := DigestSubscription{Sections: []string{DigestSectionRestart}}
+	if !restart.Includes(DigestSectionRestart) || restart.Includes(DigestSectionAnomalies) {
+		t.Errorf("Includes() does not honour the section list %v", restart.Sections)
+	}
+}
+
+func TestDigestIsEmpty(t *testing.T) {
+	d := Digest{Frequency: DigestDaily, AnomalyTotal: 2}
+
+	if d.IsEmpty() {
+		t.Error("digest with anomalies should not be empty")
+	}
+	if !d.WithSections([]string{DigestSectionRestart, DigestSectionFailedExecutions}).IsEmpty() {
+		t.Error("digest should be empty when the sections with content are not selected")
+	}
+	if d.WithSections([]string{DigestSectionAnomalies}).IsEmpty() {
+		t.Error("digest should not be empty when a selected section has content")
+	}
+}
+
+func TestDigestValidation(t *testing.T) {
+	for _, f := range []string{DigestDaily, DigestWeekly} {
+		if !IsValidDigestFrequency(f) {
+			t.Errorf("IsValidDigestFrequency(%q) = false", f)
+		}
+	}
+	if IsValidDigestFrequency("monthly") {
+		t.Error("IsValidDigestFrequency(\"monthly\") = true")
+	}
+	if IsValidDigestSection("policies") {
+		t.Error("IsValidDigestSection(\"policies\") = true")
+	}
+	if DigestPeriod(DigestWeekly) != 7*DigestPeriod(DigestDaily) {
+		t.Errorf("DigestPeriod(weekly) = %v, want seven days", DigestPeriod(DigestWeekly))
+	}
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enrollment errors returned to agents.
+var (
+	ErrInvalidEnrollmentToken = errors.New("invalid, expired or used up enrollment token")
+	ErrMachineAlreadyEnrolled = errors.New("machine already enrolled")
+)
+
+// EnrollmentToken is an admin-issued secret that lets agents register and
+// receive a MachineCredential.
+type EnrollmentToken struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	MaxUses     *int       `json:"max_uses"` // nil: unlimited
+	UseCount    int        `json:"use_count"`
+	ExpiresAt   *time.Time `json:"expires_at"` // nil: never expires
+	IsActive    bool       `json:"is_active"`
+	CreatorName string     `json:"creator_name,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+// Usable reports whether the token can still enroll machines.
+func (t EnrollmentToken) Usable() bool {
+	if !t.IsActive || (t.ExpiresAt != nil && !time.Now().Before(*t.ExpiresAt)) {
+		return false
+	}
+	return t.MaxUses == nil || t.UseCount < *t.MaxUses
+}
+
+// ExpiresOn returns the last day the token is valid, or "" when it never
+// expires.
+func (t EnrollmentToken) ExpiresOn() string {
+	return APIKeyRestrictions{ExpiresAt: t.ExpiresAt}.ExpiresOn()
+}
+
+// MachineCredential is the secret of one enrolled machine. It can only
+// submit data for its own machine ID.
+type MachineCredential struct {
+	ID                  int        `json:"id"`
+	MachineID           string     `json:"machine_id"`
+	Hostname            string     `json:"hostname"`
+	CredentialPrefix    string     `json:"credential_prefix"`
+	EnrollmentTokenName string     `json:"enrollment_token_name,omitempty"`
+	IsActive            bool       `json:"is_active"`
+	CreatedAt           time.Time  `json:"created_at"`
+	LastUsedAt          *time.Time `json:"last_used_at"`
+}
+
+// EnrollmentRequest is sent by an agent to POST /v1/enroll.
+type EnrollmentRequest struct {
+	EnrollmentToken string `json:"enrollment_token"`
+	MachineID       string `json:"machine_id"`
+	Hostname        string `json:"hostname"`
+}
+
+// EnrollmentResponse returns the credential of a newly enrolled machine. It
+// is only shown once.
+type EnrollmentResponse struct {
+	MachineID  string `json:"machine_id"`
+	Credential string `json:"credential"`
+}
+
+// ParseEnrollmentTokenLimits validates the limits entered for an enrollment
+// token in the admin panel: an optional expiry date (YYYY-MM-DD), through
+// which the token is valid, and an optional maximum number of machines.
+func ParseEnrollmentTokenLimits(expiresOn, maxUses string, now time.Time) (*time.Time, *int, error) {
+	expiresAt, err := parseExpiryDate(expiresOn, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maxUses = strings.TrimSpace(maxUses)
+	if maxUses == "" {
+		return expiresAt, nil, nil
+	}
+	n, err := strconv.Atoi(maxUses)
+	if err != nil || n < 1 {
+		return nil, nil, errors.New("maximum number of machines must be a positive number")
+	}
+	return expiresAt, &n, nil
+}
+
+// EnrollmentManager stores enrollment tokens and machine credentials.
+type EnrollmentManager struct {
+	db *sql.DB
+}
+
+// NewEnrollmentManager returns a new EnrollmentManager backed by the given
+// DB.
+func NewEnrollmentManager(db *sql.DB) *EnrollmentManager {
+	return &EnrollmentManager{db: db}
+}
+
+// ListTokens returns every enrollment token, newest first.
+func (em *EnrollmentManager) ListTokens() ([]EnrollmentToken, error) {
+	rows, err := em.db.Query(`
+		SELECT et.id, et.name, et.token_prefix, et.max_uses, et.use_count, et.expires_at,
+			et.is_active, COALESCE(u.name, 'System'), et.created_at, et.last_used_at
+		FROM enrollment_tokens et
+		LEFT JOIN users u ON et.created_by = u.id
+		ORDER BY et.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []EnrollmentToken
+	for rows.Next() {
+		var t EnrollmentToken
+		var maxUses sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.Name, &t.TokenPrefix, &maxUses, &t.UseCount, &t.ExpiresAt,
+			&t.IsActive, &t.CreatorName, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		if maxUses.Valid {
+			n := int(maxUses.Int64)
+			t.MaxUses = &n
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// CreateToken stores a new enrollment token by the hash of its secret.
+func (em *EnrollmentManager) CreateToken(name, tokenHash, tokenPrefix string, expiresAt *time.Time, maxUses *int, createdBy *int) (int, error) {
+	var id int
+	err := em.db.QueryRow(`
+		INSERT INTO enrollment_tokens (name, token_hash, token_prefix, expires_at, max_uses, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, name, tokenHash, tokenPrefix, expiresAt, maxUses, createdBy).Scan(&id)
+	return id, err
+}
+
+// RevokeToken stops a token from enrolling more machines. Credentials
+// already issued with it keep working.
+func (em *EnrollmentManager) RevokeToken(id int) error {
+	_, err := em.db.Exec(`UPDATE enrollment_tokens SET is_active = false WHERE id = $1`, id)
+	return err
+}
+
+// DeleteToken removes a token. Credentials issued with it keep working.
+func (em *EnrollmentManager) DeleteToken(id int) error {
+	_, err := em.db.Exec(`DELETE FROM enrollment_tokens WHERE id = $1`, id)
+	return err
+}
+
+// Enroll spends one use of the enrollment token with the given hash and
+// stores a credential for machineID. A machine that already has an active
+// credential cannot enroll again until an admin revokes or deletes it.
+func (em *EnrollmentManager) Enroll(tokenHash, machineID, hostname, credentialHash, credentialPrefix string) error {
+	tx, err := em.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tokenID int
+	err = tx.QueryRow(`
+		UPDATE enrollment_tokens
+		SET use_count = use_count + 1, last_used_at = NOW()
+		WHERE token_hash = $1
+		AND is_active = true
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_uses IS NULL OR use_count < max_uses)
+		RETURNING id
+	`, tokenHash).Scan(&tokenID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidEnrollmentToken
+	}
+	if err != nil {
+		return err
+	}
+
+	// Replaces a revoked credential, never an active one
+	var credentialID int
+	err = tx.QueryRow(`
+		INSERT INTO machine_credentials (machine_id, hostname, credential_hash, credential_prefix, enrollment_token_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (machine_id) DO UPDATE
+		SET hostname = EXCLUDED.hostname,
+			credential_hash = EXCLUDED.credential_hash,
+			credential_prefix = EXCLUDED.credential_prefix,
+			enrollment_token_id = EXCLUDED.enrollment_token_id,
+			is_active = true,
+			created_at = NOW(),
+			last_used_at = NULL
+		WHERE machine_credentials.is_active = false
+		RETURNING id
+	`, machineID, hostname, credentialHash, credentialPrefix, tokenID).Scan(&credentialID)
+	if err == sql.ErrNoRows {
+		return ErrMachineAlreadyEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CredentialByHash returns the credential with the given hash, or nil when
+// there is none.
+func (em *EnrollmentManager) CredentialByHash(credentialHash string) (*MachineCredential, error) {
+	var mc MachineCredential
+	err := em.db.QueryRow(`
+		SELECT id, machine_id, hostname, credential_prefix, is_active, created_at, last_used_at
+		FROM machine_credentials
+		WHERE credential_hash = $1
+	`, credentialHash).Scan(&mc.ID, &mc.MachineID, &mc.Hostname, &mc.CredentialPrefix, &mc.IsActive, &mc.CreatedAt, &mc.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mc, nil
+}
+
+// IsEnrolled reports whether machineID has an active credential.
+func (em *EnrollmentManager) IsEnrolled(machineID string) (bool, error) {
+	var enrolled bool
+	err := em.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM machine_credentials WHERE machine_id = $1 AND is_active = true)
+	`, machineID).Scan(&enrolled)
+	return enrolled, err
+}
+
+// TouchCredential records that a credential was just used.
+func (em *EnrollmentManager) TouchCredential(id int) error {
+	_, err := em.db.Exec(`UPDATE machine_credentials SET last_used_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+// ListCredentials returns every machine credential, newest first.
+func (em *EnrollmentManager) ListCredentials() ([]MachineCredential, error) {
+	rows, err := em.db.Query(`
+		SELECT mc.id, mc.machine_id, mc.hostname, mc.credential_prefix, COALESCE(et.name, ''),
+			mc.is_active, mc.created_at, mc.last_used_at
+		FROM machine_credentials mc
+		LEFT JOIN enrollment_tokens et ON mc.enrollment_token_id = et.id
+		ORDER BY mc.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []MachineCredential
+	for rows.Next() {
+		var mc MachineCredential
+		if err := rows.Scan(&mc.ID, &mc.MachineID, &mc.Hostname, &mc.CredentialPrefix, &mc.EnrollmentTokenName,
+			&mc.IsActive, &mc.CreatedAt, &mc.LastUsedAt); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, mc)
+	}
+
+	return credentials, rows.Err()
+}
+
+// RevokeCredential disables a machine credential, which lets the machine
+// enroll again.
+func (em *EnrollmentManager) RevokeCredential(id int) error {
+	_, err := em.db.Exec(`UPDATE machine_credentials SET is_active = false WHERE id = $1`, id)
+	return err
+}
+
+// DeleteCredential removes a machine credential.
+func (em *EnrollmentManager) DeleteCredential(id int) error {
+	_, err := em.db.Exec(`DELETE FROM machine_credentials WHERE id = $1`, id)
+	return err
+}
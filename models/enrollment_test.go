@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEnrollmentTokenLimits(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresOn string
+		maxUses   string
+		wantMax   int // 0: unlimited
+		wantErr   bool
+	}{
+		{"no limits", "", "", 0, false},
+		{"both limits", "2026-10-31", " 50 ", 50, false},
+		{"zero machines", "", "0", 0, true},
+		{"not a number", "", "ten", 0, true},
+		{"past expiry", "2026-10-01", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiresAt, maxUses, err := ParseEnrollmentTokenLimits(tt.expiresOn, tt.maxUses, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEnrollmentTokenLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (expiresAt != nil) != (tt.expiresOn != "") {
+				t.Errorf("expiresAt = %v for expiry date %q", expiresAt, tt.expiresOn)
+			}
+			var got int
+			if maxUses != nil {
+				got = *maxUses
+			}
+			if got != tt.wantMax {
+				t.Errorf("maxUses = %d, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestEnrollmentTokenUsable(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	two := 2
+
+	tests := []struct {
+		name  string
+		token EnrollmentToken
+		want  bool
+	}{
+		{"unlimited", EnrollmentToken{IsActive: true}, true},
+		{"uses left", EnrollmentToken{IsActive: true, MaxUses: &two, UseCount: 1, ExpiresAt: &future}, true},
+		{"used up", EnrollmentToken{IsActive: true, MaxUses: &two, UseCount: 2}, false},
+		{"expired", EnrollmentToken{IsActive: true, ExpiresAt: &past}, false},
+		{"revoked", EnrollmentToken{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.token.Usable(); got != tt.want {
+			t.Errorf("%s: Usable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Exposure notification delivery statuses.
+const (
+	ExposureStatusPending = "pending"
+	ExposureStatusSent    = "sent"
+	ExposureStatusFailed  = "failed"
+)
+
+// MaxExposureAttempts is how many times a notification is tried before it is
+// marked as failed and no longer retried.
+const MaxExposureAttempts = 5
+
+// PackageVulnerabilityLink is a row of package_vulnerabilities.
+type PackageVulnerabilityLink struct {
+	PackageName     string
+	Version         string
+	Release         string
+	VulnerabilityID string
+	Ecosystem       string
+}
+
+// Exposure is a vulnerability affecting the packages installed on one asset.
+type Exposure struct {
+	VulnerabilityID string
+	Severity        string
+	CVSSScore       float64
+	Summary         string
+	PublishedAt     *time.Time
+	MachineID       string
+	Hostname        string
+	Packages        []string // name-version-release
+}
+
+// ExposedAsset is an asset affected by a new exposure.
+type ExposedAsset struct {
+	MachineID string   `json:"machine_id"`
+	Hostname  string   `json:"hostname"`
+	Packages  []string `json:"packages"`
+}
+
+// ExposureEvent announces that a vulnerability newly affects one or more
+// assets. It is the payload delivered by the notification channels.
+type ExposureEvent struct {
+	Event           string         `json:"event"`
+	VulnerabilityID string         `json:"vulnerability_id"`
+	Severity        string         `json:"severity"`
+	CVSSScore       float64        `json:"cvss_score"`
+	Summary         string         `json:"summary"`
+	PublishedAt     *time.Time     `json:"published_at,omitempty"`
+	Packages        []string       `json:"packages"`
+	Assets          []ExposedAsset `json:"assets"`
+	DetectedAt      time.Time      `json:"detected_at"`
+}
+
+// ExposureEventName is the value of ExposureEvent.Event.
+const ExposureEventName = "vulnerability.exposure"
+
+// GroupExposures turns per-asset exposures into one event per vulnerability,
+// ordered by severity (CVSS score) then vulnerability ID. Assets and packages
+// inside an event are sorted and deduplicated.
+func GroupExposures(exposures []Exposure, detectedAt time.Time) []ExposureEvent {
+	events := map[string]*ExposureEvent{}
+	assets := map[string]map[string]*ExposedAsset{}
+
+	for _, e := range exposures {
+		ev, ok := events[e.VulnerabilityID]
+		if !ok {
+			ev = &ExposureEvent{
+				Event:           ExposureEventName,
+				VulnerabilityID: e.VulnerabilityID,
+				Severity:        e.Severity,
+				CVSSScore:       e.CVSSScore,
+				Summary:         e.Summary,
+				PublishedAt:     e.PublishedAt,
+				DetectedAt:      detectedAt,
+			}
+			events[e.VulnerabilityID] = ev
+			assets[e.VulnerabilityID] = map[string]*ExposedAsset{}
+		}
+
+		asset, ok := assets[e.VulnerabilityID][e.MachineID]
+		if !ok {
+			asset = &ExposedAsset{MachineID: e.MachineID, Hostname: e.Hostname}
+			assets[e.VulnerabilityID][e.MachineID] = asset
+		}
+		asset.Packages = appendUnique(asset.Packages, e.Packages...)
+		ev.Packages = appendUnique(ev.Packages, e.Packages...)
+	}
+
+	result := make([]ExposureEvent, 0, len(events))
+	for id, ev := range events {
+		for _, a := range assets[id] {
+			sort.Strings(a.Packages)
+			ev.Assets = append(ev.Assets, *a)
+		}
+		sort.Slice(ev.Assets, func(i, j int) bool {
+			if ev.Assets[i].Hostname != ev.Assets[j].Hostname {
+				return ev.Assets[i].Hostname < ev.Assets[j].Hostname
+			}
+			return ev.Assets[i].MachineID < ev.Assets[j].MachineID
+		})
+		sort.Strings(ev.Packages)
+		result = append(result, *ev)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CVSSScore != result[j].CVSSScore {
+			return result[i].CVSSScore > result[j].CVSSScore
+		}
+		return result[i].VulnerabilityID < result[j].VulnerabilityID
+	})
+
+	return result
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ExposureManager finds new exposures and tracks their notifications in
+// exposure_notifications.
+type ExposureManager struct {
+	db *sql.DB
+}
+
+// NewExposureManager returns a new ExposureManager backed by the given DB.
+func NewExposureManager(db *sql.DB) *ExposureManager {
+	return &ExposureManager{db: db}
+}
+
+// FindExposures returns the active assets that currently have a package
+// affected by one of the given links installed, one row per vulnerability
+// and asset.
+func (em *ExposureManager) FindExposures(links []PackageVulnerabilityLink) ([]Exposure, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, len(links))
+	versions := make([]string, len(links))
+	releases := make([]string, len(links))
+	vulnIDs := make([]string, len(links))
+	ecosystems := make([]string, len(links))
+	for i, l := range links {
+		names[i], versions[i], releases[i] = l.PackageName, l.Version, l.Release
+		vulnIDs[i], ecosystems[i] = l.VulnerabilityID, l.Ecosystem
+	}
+
+	rows, err := em.db.Query(`
+WITH new_links AS (
+    SELECT
+        unnest($1::text[]) AS package_name,
+        unnest($2::text[]) AS version,
+        unnest($3::text[]) AS release,
+        unnest($4::text[]) AS vulnerability_id,
+        unnest($5::text[]) AS ecosystem
+), `+installedPackagesCTE+`
+SELECT
+    v.id,
+    COALESCE(v.severity, 'UNKNOWN'),
+    COALESCE(v.cvss_score, 0),
+    COALESCE(v.summary, ''),
+    v.published_at,
+    ac.machine_id,
+    ac.hostname,
+    string_agg(DISTINCT i.package || '-' || i.version || CASE WHEN i.release <> '' THEN '-' || i.release ELSE '' END, ',')
+FROM installed i
+JOIN active ac ON ac.machine_id = i.machine_id
+JOIN new_links nl ON nl.package_name = i.package AND nl.version = i.version AND nl.release = i.release
+     AND (
+         (NOT ac.is_rh_family AND nl.ecosystem = ac.ecosystem_prefix) OR
+         (ac.is_rh_family AND nl.ecosystem LIKE ac.ecosystem_prefix || '::%')
+     )
+JOIN vulnerabilities v ON v.id = nl.vulnerability_id
+GROUP BY v.id, v.severity, v.cvss_score, v.summary, v.published_at, ac.machine_id, ac.hostname
+`, pq.Array(names), pq.Array(versions), pq.Array(releases), pq.Array(vulnIDs), pq.Array(ecosystems))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exposures []Exposure
+	for rows.Next() {
+		var e Exposure
+		var publishedAt sql.NullTime
+		var packages string
+		if err := rows.Scan(
+			&e.VulnerabilityID, &e.Severity, &e.CVSSScore, &e.Summary, &publishedAt,
+			&e.MachineID, &e.Hostname, &packages,
+		); err != nil {
+			return nil, err
+		}
+		if publishedAt.Valid {
+			e.PublishedAt = &publishedAt.Time
+		}
+		e.Packages = strings.Split(packages, ",")
+		exposures = append(exposures, e)
+	}
+
+	return exposures, rows.Err()
+}
+
+// Enqueue records exposures as pending for a channel. Exposures already
+// recorded for that channel (whatever their status) are skipped, which is
+// what deduplicates notifications across runs. It returns how many were new.
+func (em *ExposureManager) Enqueue(channel string, exposures []Exposure) (int, error) {
+	queued := 0
+	for _, e := range exposures {
+		res, err := em.db.Exec(`
+			INSERT INTO exposure_notifications (vulnerability_id, machine_id, channel, hostname, packages, status)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (vulnerability_id, machine_id, channel) DO NOTHING
+		`, e.VulnerabilityID, e.MachineID, channel, e.Hostname, strings.Join(e.Packages, ","), ExposureStatusPending)
+		if err != nil {
+			return queued, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// Pending returns the exposures still waiting to be delivered on a channel,
+// including those whose previous delivery failed.
+func (em *ExposureManager) Pending(channel string) ([]Exposure, error) {
+	rows, err := em.db.Query(`
+		SELECT en.vulnerability_id, COALESCE(v.severity, 'UNKNOWN'), COALESCE(v.cvss_score, 0),
+		       COALESCE(v.summary, ''), v.published_at, en.machine_id, en.hostname, en.packages
+		FROM exposure_notifications en
+		LEFT JOIN vulnerabilities v ON v.id = en.vulnerability_id
+		WHERE en.channel = $1 AND en.status = $2
+		ORDER BY en.detected_at, en.vulnerability_id
+	`, channel, ExposureStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exposures []Exposure
+	for rows.Next() {
+		var e Exposure
+		var publishedAt sql.NullTime
+		var packages string
+		if err := rows.Scan(
+			&e.VulnerabilityID, &e.Severity, &e.CVSSScore, &e.Summary, &publishedAt,
+			&e.MachineID, &e.Hostname, &packages,
+		); err != nil {
+			return nil, err
+		}
+		if publishedAt.Valid {
+			e.PublishedAt = &publishedAt.Time
+		}
+		if packages != "" {
+			e.Packages = strings.Split(packages, ",")
+		}
+		exposures = append(exposures, e)
+	}
+
+	return exposures, rows.Err()
+}
+
+// MarkSent flags every pending notification of an event on a channel as
+// delivered.
+func (em *ExposureManager) MarkSent(channel string, event ExposureEvent) error {
+	_, err := em.db.Exec(`
+		UPDATE exposure_notifications
+		SET status = $1, sent_at = NOW(), attempts = attempts + 1, last_error = NULL
+		WHERE channel = $2 AND vulnerability_id = $3 AND machine_id = ANY($4) AND status = $5
+	`, ExposureStatusSent, channel, event.VulnerabilityID, pq.Array(eventMachineIDs(event)), ExposureStatusPending)
+	return err
+}
+
+// MarkFailed records a failed delivery of an event on a channel. After
+// MaxExposureAttempts the notifications are marked as failed for good.
+func (em *ExposureManager) MarkFailed(channel string, event ExposureEvent, deliveryErr error) error {
+	_, err := em.db.Exec(`
+		UPDATE exposure_notifications
+		SET attempts = attempts + 1,
+		    last_error = $1,
+		    status = CASE WHEN attempts + 1 >= $2 THEN $3 ELSE status END
+		WHERE channel = $4 AND vulnerability_id = $5 AND machine_id = ANY($6) AND status = $7
+	`, deliveryErr.Error(), MaxExposureAttempts, ExposureStatusFailed,
+		channel, event.VulnerabilityID, pq.Array(eventMachineIDs(event)), ExposureStatusPending)
+	return err
+}
+
+func eventMachineIDs(event ExposureEvent) []string {
+	ids := make([]string, len(event.Assets))
+	for i, a := range event.Assets {
+		ids[i] = a.MachineID
+	}
+	return ids
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupExposures(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	exposures := []Exposure{
+		{VulnerabilityID: "CVE-2026-0002", Severity: "HIGH", CVSSScore: 7.5, MachineID: "m2", Hostname: "web02", Packages: []string{"curl-8.0-1"}},
+		{VulnerabilityID: "CVE-2026-0001", Severity: "CRITICAL", CVSSScore: 9.8, MachineID: "m2", Hostname: "web02", Packages: []string{"openssl-3.0-1"}},
+		{VulnerabilityID: "CVE-2026-0001", Severity: "CRITICAL", CVSSScore: 9.8, MachineID: "m1", Hostname: "web01", Packages: []string{"openssl-libs-3.0-1", "openssl-3.0-1"}},
+		{VulnerabilityID: "CVE-2026-0001", Severity: "CRITICAL", CVSSScore: 9.8, MachineID: "m1", Hostname: "web01", Packages: []string{"openssl-3.0-1"}},
+	}
+
+	events := GroupExposures(exposures, now)
+	if len(events) != 2 {
+		t.Fatalf("GroupExposures() returned %d events, want 2", len(events))
+	}
+
+	first := events[0]
+	if first.VulnerabilityID != "CVE-2026-0001" || first.Event != ExposureEventName || !first.DetectedAt.Equal(now) {
+		t.Errorf("first event = %+v, want CVE-2026-0001 first (highest CVSS)", first)
+	}
+	if want := []string{"openssl-3.0-1", "openssl-libs-3.0-1"}; !reflect.DeepEqual(first.Packages, want) {
+		t.Errorf("Packages = %v, want %v", first.Packages, want)
+	}
+	wantAssets := []ExposedAsset{
+		{MachineID: "m1", Hostname: "web01", Packages: []string{"openssl-3.0-1", "openssl-libs-3.0-1"}},
+		{MachineID: "m2", Hostname: "web02", Packages: []string{"openssl-3.0-1"}},
+	}
+	if !reflect.DeepEqual(first.Assets, wantAssets) {
+		t.Errorf("Assets = %+v, want %+v", first.Assets, wantAssets)
+	}
+
+	if events[1].VulnerabilityID != "CVE-2026-0002" || len(events[1].Assets) != 1 {
+		t.Errorf("second event = %+v, want CVE-2026-0002 with one asset", events[1])
+	}
+
+	if got := GroupExposures(nil, now); len(got) != 0 {
+		t.Errorf("GroupExposures(nil) = %v, want empty", got)
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// FleetStats summarizes the active assets for monitoring.
+type FleetStats struct {
+	ActiveAssets    int
+	NeedsRestarting int
+	// OpenVulns counts open vulnerabilities by severity (CRITICAL, HIGH,
+	// MEDIUM, LOW and UNKNOWN), once per asset they affect, as of the last
+	// risk calculation.
+	OpenVulns map[string]int
+	// AgentVersions counts active assets by agent version; assets that never
+	// reported one are counted under "".
+	AgentVersions map[string]int
+}
+
+// FleetManager computes fleet-wide statistics.
+type FleetManager struct {
+	db *sql.DB
+}
+
+// NewFleetManager returns a new FleetManager backed by the given DB.
+func NewFleetManager(db *sql.DB) *FleetManager {
+	return &FleetManager{db: db}
+}
+
+// Stats returns the current FleetStats.
+func (fm *FleetManager) Stats(ctx context.Context) (*FleetStats, error) {
+	stats := &FleetStats{
+		OpenVulns:     map[string]int{},
+		AgentVersions: map[string]int{},
+	}
+
+	err := fm.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE needs_restarting = TRUE)
+		FROM assets
+		WHERE is_active = TRUE
+	`).Scan(&stats.ActiveAssets, &stats.NeedsRestarting)
+	if err != nil {
+		return nil, err
+	}
+
+	var open, critical, high, medium, low int
+	err = fm.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(rs.open_vulns), 0),
+			COALESCE(SUM(rs.critical_vulns), 0),
+			COALESCE(SUM(rs.high_vulns), 0),
+			COALESCE(SUM(rs.medium_vulns), 0),
+			COALESCE(SUM(rs.low_vulns), 0)
+		FROM asset_risk_scores rs
+		JOIN assets a ON a.machine_id = rs.machine_id AND a.is_active = TRUE
+	`).Scan(&open, &critical, &high, &medium, &low)
+	if err != nil {
+		return nil, err
+	}
+	stats.OpenVulns["CRITICAL"] = critical
+	stats.OpenVulns["HIGH"] = high
+	stats.OpenVulns["MEDIUM"] = medium
+	stats.OpenVulns["LOW"] = low
+	stats.OpenVulns["UNKNOWN"] = max(open-critical-high-medium-low, 0)
+
+	rows, err := fm.db.QueryContext(ctx, `
+		SELECT COALESCE(agent_version, ''), COUNT(*)
+		FROM assets
+		WHERE is_active = TRUE
+		GROUP BY 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version string
+		var count int
+		if err := rows.Scan(&version, &count); err != nil {
+			return nil, err
+		}
+		stats.AgentVersions[version] = count
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,351 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InventoryHost is an active asset as exported to configuration management
+// and monitoring inventories.
+type InventoryHost struct {
+	Hostname        string
+	MachineID       string
+	OS              string
+	AgentVersion    string
+	NeedsRestarting bool
+	LastSeen        time.Time
+	// CriticalVulns and RiskScore come from the last risk calculation.
+	CriticalVulns int
+	RiskScore     float64
+	Labels        map[string]string
+	// Topology is nil when the hostname matches no topology pattern.
+	Topology *ResolvedTopology
+}
+
+// InventoryManager lists the assets exported to inventories.
+type InventoryManager struct {
+	db *sql.DB
+}
+
+// NewInventoryManager returns a new InventoryManager backed by the given DB.
+func NewInventoryManager(db *sql.DB) *InventoryManager {
+	return &InventoryManager{db: db}
+}
+
+// ListHosts returns the active assets that pass filter ordered by hostname,
+// with their labels and their topology placement resolved as
+// ResolveHostname does, in the same query that applies the filter.
+func (im *InventoryManager) ListHosts(ctx context.Context, filter InventoryFilter) ([]InventoryHost, error) {
+	rows, err := im.db.QueryContext(ctx, `
+		SELECT
+			a.hostname,
+			a.machine_id,
+			COALESCE(a.os, ''),
+			COALESCE(a.agent_version, ''),
+			COALESCE(a.needs_restarting, FALSE),
+			a.last_seen,
+			COALESCE(rs.critical_vulns, 0),
+			COALESCE(rs.score, 0),
+			tp.raw_env IS NOT NULL,
+			COALESCE(tp.raw_env, ''),
+			COALESCE(best_env.name, tp.raw_env, ''),
+			COALESCE(tp.raw_svc, ''),
+			COALESCE(best_svc.name, tp.raw_svc, ''),
+			COALESCE(NULLIF(tp.raw_pod, ''), 'Default')
+		FROM assets a
+		LEFT JOIN asset_risk_scores rs ON rs.machine_id = a.machine_id`+topologyJoins+`
+		WHERE a.is_active = TRUE
+		  AND ($1 = '' OR lower(best_env.name) = lower($1) OR lower(NULLIF(tp.raw_env, '')) = lower($1))
+		  AND ($2 = '' OR lower(best_svc.name) = lower($2) OR lower(NULLIF(tp.raw_svc, '')) = lower($2))
+		  AND ($3 = '' OR (tp.raw_env IS NOT NULL AND lower(COALESCE(NULLIF(tp.raw_pod, ''), 'Default')) = lower($3)))
+		  AND ($4 = '' OR lower(a.os) = lower($4))
+		  AND ($5 = '' OR lower(a.agent_version) = lower($5))
+		  AND ($6::boolean IS NULL OR COALESCE(a.needs_restarting, FALSE) = $6)
+		ORDER BY a.hostname
+	`, filter.Environment, filter.Service, filter.Pod, filter.OS, filter.AgentVersion, filter.NeedsRestarting)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hosts []InventoryHost
+	for rows.Next() {
+		var h InventoryHost
+		var inTopology bool
+		var t ResolvedTopology
+		if err := rows.Scan(&h.Hostname, &h.MachineID, &h.OS, &h.AgentVersion, &h.NeedsRestarting,
+			&h.LastSeen, &h.CriticalVulns, &h.RiskScore, &inTopology,
+			&t.EnvironmentValue, &t.EnvironmentName, &t.ServiceValue, &t.ServiceName, &t.PodID); err != nil {
+			return nil, err
+		}
+		if inTopology {
+			h.Topology = &t
+		}
+		hosts = append(hosts, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	labels, err := im.activeAssetLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		hosts[i].Labels = labels[hosts[i].Hostname]
+	}
+
+	return hosts, nil
+}
+
+// activeAssetLabels returns the labels of every active asset by hostname.
+func (im *InventoryManager) activeAssetLabels(ctx context.Context) (map[string]map[string]string, error) {
+	rows, err := im.db.QueryContext(ctx, `
+		SELECT l.hostname, l.name, l.value
+		FROM asset_labels l
+		JOIN assets a ON a.hostname = l.hostname AND a.is_active = TRUE
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := map[string]map[string]string{}
+	for rows.Next() {
+		var hostname, name, value string
+		if err := rows.Scan(&hostname, &name, &value); err != nil {
+			return nil, err
+		}
+		if labels[hostname] == nil {
+			labels[hostname] = map[string]string{}
+		}
+		labels[hostname][name] = value
+	}
+
+	return labels, rows.Err()
+}
+
+// AnsibleGroup is a group of an Ansible inventory.
+type AnsibleGroup struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children,omitempty"`
+}
+
+// AnsibleInventory is the document an Ansible dynamic inventory script
+// prints for --list: one key per group plus _meta.hostvars, so Ansible does
+// not call the script again for each host.
+type AnsibleInventory struct {
+	Groups   map[string]*AnsibleGroup
+	HostVars map[string]map[string]any
+}
+
+// MarshalJSON renders the inventory in the Ansible script format.
+func (inv AnsibleInventory) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]any, len(inv.Groups)+1)
+	for name, g := range inv.Groups {
+		doc[name] = g
+	}
+	doc["_meta"] = map[string]any{"hostvars": inv.HostVars}
+	return json.Marshal(doc)
+}
+
+// BuildAnsibleInventory groups the hosts by topology environment (env_),
+// service (svc_) and pod (pod_<env>_<service>_<pod>, as pods of a service
+// share their numbers across environments), OS (os_), agent version
+// (agent_), restart flag (needs_restarting) and labels
+// (label_<name>_<value>). Group names are lowercased and reduced to letters,
+// digits and underscores, as Ansible requires. Hosts without any group are
+// placed in ungrouped. Host variables are prefixed with txlog_ so they
+// cannot shadow Ansible's own variables.
+func BuildAnsibleInventory(hosts []InventoryHost) AnsibleInventory {
+	inv := AnsibleInventory{
+		Groups:   map[string]*AnsibleGroup{},
+		HostVars: make(map[string]map[string]any, len(hosts)),
+	}
+
+	add := func(group, hostname string) bool {
+		group = inventoryName(group)
+		if group == "" {
+			return false
+		}
+		g, ok := inv.Groups[group]
+		if !ok {
+			g = &AnsibleGroup{}
+			inv.Groups[group] = g
+		}
+		g.Hosts = append(g.Hosts, hostname)
+		return true
+	}
+
+	var ungrouped []string
+	for _, h := range hosts {
+		vars := map[string]any{
+			"txlog_machine_id":       h.MachineID,
+			"txlog_os":               h.OS,
+			"txlog_agent_version":    h.AgentVersion,
+			"txlog_needs_restarting": h.NeedsRestarting,
+			"txlog_last_seen":        h.LastSeen.UTC().Format(time.RFC3339),
+			"txlog_critical_cves":    h.CriticalVulns,
+			"txlog_risk_score":       h.RiskScore,
+			"txlog_labels":           h.Labels,
+		}
+		if h.Labels == nil {
+			vars["txlog_labels"] = map[string]string{}
+		}
+
+		grouped := false
+		if t := h.Topology; t != nil {
+			vars["txlog_environment"] = t.EnvironmentName
+			vars["txlog_service"] = t.ServiceName
+			vars["txlog_pod"] = t.PodID
+			if t.EnvironmentName != "" {
+				grouped = add("env_"+t.EnvironmentName, h.Hostname) || grouped
+			}
+			if t.ServiceName != "" {
+				grouped = add("svc_"+t.ServiceName, h.Hostname) || grouped
+				grouped = add("pod_"+t.EnvironmentName+"_"+t.ServiceName+"_"+t.PodID, h.Hostname) || grouped
+			}
+		}
+		if h.OS != "" {
+			grouped = add("os_"+h.OS, h.Hostname) || grouped
+		}
+		if h.AgentVersion != "" {
+			grouped = add("agent_"+h.AgentVersion, h.Hostname) || grouped
+		}
+		if h.NeedsRestarting {
+			grouped = add("needs_restarting", h.Hostname) || grouped
+		}
+		for name, value := range h.Labels {
+			grouped = add("label_"+name+"_"+value, h.Hostname) || grouped
+		}
+
+		if !grouped {
+			ungrouped = append(ungrouped, h.Hostname)
+		}
+		inv.HostVars[h.Hostname] = vars
+	}
+
+	children := make([]string, 0, len(inv.Groups)+1)
+	for name, g := range inv.Groups {
+		slices.Sort(g.Hosts)
+		g.Hosts = slices.Compact(g.Hosts)
+		children = append(children, name)
+	}
+	slices.Sort(children)
+	children = append(children, "ungrouped")
+
+	inv.Groups["ungrouped"] = &AnsibleGroup{Hosts: ungrouped}
+	inv.Groups["all"] = &AnsibleGroup{Children: children}
+
+	return inv
+}
+
+// inventoryName lowercases s and replaces every run of characters other
+// than letters and digits with a single underscore, which makes it a valid
+// Ansible group name and Prometheus label name suffix.
+func inventoryName(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// InventoryFilter selects inventory hosts. Empty fields match every host.
+// Text fields are compared without regard to case; Environment and Service
+// match the friendly topology name or the raw :env/:svc value.
+type InventoryFilter struct {
+	Environment     string
+	Service         string
+	Pod             string
+	OS              string
+	AgentVersion    string
+	NeedsRestarting *bool
+}
+
+// Matches reports whether h passes the filter. Hosts outside the topology
+// never match a topology filter.
+func (f InventoryFilter) Matches(h InventoryHost) bool {
+	if f.Environment != "" || f.Service != "" || f.Pod != "" {
+		t := h.Topology
+		if t == nil {
+			return false
+		}
+		if f.Environment != "" && !strings.EqualFold(f.Environment, t.EnvironmentName) && !strings.EqualFold(f.Environment, t.EnvironmentValue) {
+			return false
+		}
+		if f.Service != "" && !strings.EqualFold(f.Service, t.ServiceName) && !strings.EqualFold(f.Service, t.ServiceValue) {
+			return false
+		}
+		if f.Pod != "" && !strings.EqualFold(f.Pod, t.PodID) {
+			return false
+		}
+	}
+	if f.OS != "" && !strings.EqualFold(f.OS, h.OS) {
+		return false
+	}
+	if f.AgentVersion != "" && !strings.EqualFold(f.AgentVersion, h.AgentVersion) {
+		return false
+	}
+	if f.NeedsRestarting != nil && *f.NeedsRestarting != h.NeedsRestarting {
+		return false
+	}
+	return true
+}
+
+// PrometheusTargetGroup is one entry of a Prometheus HTTP service discovery
+// response.
+type PrometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// BuildPrometheusTargets returns one target group per host, scraping
+// hostname:port. Host details are exposed as __meta_txlog_* labels, which
+// Prometheus drops after relabeling unless a relabel rule keeps them, so
+// changing values such as the agent version do not create new series.
+func BuildPrometheusTargets(hosts []InventoryHost, port int) []PrometheusTargetGroup {
+	groups := make([]PrometheusTargetGroup, 0, len(hosts))
+	for _, h := range hosts {
+		labels := map[string]string{
+			"__meta_txlog_hostname":         h.Hostname,
+			"__meta_txlog_machine_id":       h.MachineID,
+			"__meta_txlog_os":               h.OS,
+			"__meta_txlog_agent_version":    h.AgentVersion,
+			"__meta_txlog_needs_restarting": strconv.FormatBool(h.NeedsRestarting),
+			"__meta_txlog_critical_cves":    strconv.Itoa(h.CriticalVulns),
+			"__meta_txlog_environment":      "",
+			"__meta_txlog_service":          "",
+			"__meta_txlog_pod":              "",
+		}
+		if t := h.Topology; t != nil {
+			labels["__meta_txlog_environment"] = t.EnvironmentName
+			labels["__meta_txlog_service"] = t.ServiceName
+			labels["__meta_txlog_pod"] = t.PodID
+		}
+		for name, value := range h.Labels {
+			if name = inventoryName(name); name != "" {
+				labels["__meta_txlog_label_"+name] = value
+			}
+		}
+
+		groups = append(groups, PrometheusTargetGroup{
+			Targets: []string{net.JoinHostPort(h.Hostname, strconv.Itoa(port))},
+			Labels:  labels,
+		})
+	}
+	return groups
+}
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInventoryName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"env_Production", "env_production"},
+		{"os_Rocky Linux 9.4", "os_rocky_linux_9_4"},
+		{"agent_1.12.0", "agent_1_12_0"},
+		{"svc_ACME  System--API", "svc_acme_system_api"},
+		{"label_team_Ops/SRE!", "label_team_ops_sre"},
+		{"  ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := inventoryName(tt.in); got != tt.want {
+			t.Errorf("inventoryName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInventoryManager_ListHosts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cleanupTestData(t, db)
+	defer cleanupTestData(t, db)
+
+	tm := NewTopologyManager(db)
+	pattern, err := tm.CreatePattern("test-:env-inventory-:svc-node:seq", -1000)
+	if err != nil {
+		t.Fatalf("CreatePattern: %v", err)
+	}
+	defer func() { _ = tm.DeletePattern(pattern.ID) }()
+	env, err := tm.CreateEnvironmentName("tstprd", "Test Production")
+	if err != nil {
+		t.Fatalf("CreateEnvironmentName: %v", err)
+	}
+	defer func() { _ = tm.DeleteEnvironmentName(env.ID) }()
+
+	for _, hostname := range []string{"test-tstprd-inventory-billing-node01", "test-outside-topology"} {
+		_, err := db.Exec(`
+			INSERT INTO assets (hostname, machine_id, first_seen, last_seen, is_active)
+			VALUES ($1, $1, NOW(), NOW(), TRUE)
+		`, hostname)
+		if err != nil {
+			t.Fatalf("Failed to create asset %s: %v", hostname, err)
+		}
+	}
+
+	im := NewInventoryManager(db)
+	hosts, err := im.ListHosts(context.Background(), InventoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHosts: %v", err)
+	}
+	got := map[string]*ResolvedTopology{}
+	for _, h := range hosts {
+		if strings.HasPrefix(h.Hostname, "test-") {
+			got[h.Hostname] = h.Topology
+		}
+	}
+
+	want := ResolvedTopology{
+		EnvironmentValue: "tstprd", EnvironmentName: "Test Production",
+		ServiceValue: "billing", ServiceName: "billing", PodID: "01",
+	}
+	if topology := got["test-tstprd-inventory-billing-node01"]; topology == nil || *topology != want {
+		t.Errorf("topology = %+v, want %+v", topology, want)
+	}
+	if topology, ok := got["test-outside-topology"]; !ok || topology != nil {
+		t.Errorf("hosts outside the topology should be listed without topology, got %+v", topology)
+	}
+
+	filters := []struct {
+		name   string
+		filter InventoryFilter
+		want   []string
+	}{
+		{name: "Friendly environment name", filter: InventoryFilter{Environment: "test production"}, want: []string{"test-tstprd-inventory-billing-node01"}},
+		{name: "Raw service value", filter: InventoryFilter{Service: "BILLING", Pod: "01"}, want: []string{"test-tstprd-inventory-billing-node01"}},
+		{name: "Default pod", filter: InventoryFilter{Pod: "Default"}, want: nil},
+		{name: "Other environment", filter: InventoryFilter{Environment: "tstdev"}, want: nil},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := im.ListHosts(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("ListHosts: %v", err)
+			}
+			var got []string
+			for _, h := range hosts {
+				if strings.HasPrefix(h.Hostname, "test-") {
+					got = append(got, h.Hostname)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ListHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildAnsibleInventory(t *testing.T) {
+	lastSeen := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	hosts := []InventoryHost{
+		{
+			Hostname: "prd-web-01", MachineID: "m1", OS: "Rocky Linux 9.4", AgentVersion: "1.12.0",
+			NeedsRestarting: true, LastSeen: lastSeen, CriticalVulns: 3, RiskScore: 42.5,
+			Labels:   map[string]string{"criticality": "high"},
+			Topology: &ResolvedTopology{EnvironmentName: "Production", ServiceName: "Web", PodID: "01"},
+		},
+		{
+			Hostname: "prd-web-02", MachineID: "m2", OS: "Rocky Linux 9.4", AgentVersion: "1.12.0",
+			LastSeen: lastSeen,
+			Topology: &ResolvedTopology{EnvironmentName: "Production", ServiceName: "Web", PodID: "02"},
+		},
+		{Hostname: "laptop", MachineID: "m3", LastSeen: lastSeen},
+	}
+
+	inv := BuildAnsibleInventory(hosts)
+
+	wantGroups := map[string][]string{
+		"env_production":         {"prd-web-01", "prd-web-02"},
+		"svc_web":                {"prd-web-01", "prd-web-02"},
+		"pod_production_web_01":  {"prd-web-01"},
+		"pod_production_web_02":  {"prd-web-02"},
+		"os_rocky_linux_9_4":     {"prd-web-01", "prd-web-02"},
+		"agent_1_12_0":           {"prd-web-01", "prd-web-02"},
+		"needs_restarting":       {"prd-web-01"},
+		"label_criticality_high": {"prd-web-01"},
+		"ungrouped":              {"laptop"},
+	}
+	for name, want := range wantGroups {
+		g, ok := inv.Groups[name]
+		if !ok {
+			t.Errorf("missing group %q", name)
+			continue
+		}
+		if !slices.Equal(g.Hosts, want) {
+			t.Errorf("group %q hosts = %v, want %v", name, g.Hosts, want)
+		}
+	}
+	if len(inv.Groups) != len(wantGroups)+1 {
+		t.Errorf("got %d groups, want %d", len(inv.Groups), len(wantGroups)+1)
+	}
+
+	children := inv.Groups["all"].Children
+	if children[len(children)-1] != "ungrouped" || len(children) != len(wantGroups) {
+		t.Errorf("all.children = %v", children)
+	}
+
+	vars := inv.HostVars["prd-web-01"]
+	if vars["txlog_machine_id"] != "m1" || vars["txlog_critical_cves"] != 3 || vars["txlog_environment"] != "Production" {
+		t.Errorf("unexpected hostvars: %v", vars)
+	}
+	if vars["txlog_last_seen"] != "2026-10-18T12:00:00Z" {
+		t.Errorf("txlog_last_seen = %v", vars["txlog_last_seen"])
+	}
+	if _, ok := inv.HostVars["laptop"]["txlog_environment"]; ok {
+		t.Error("hosts outside the topology should not have topology variables")
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var meta struct {
+		HostVars map[string]map[string]any `json:"hostvars"`
+	}
+	if err := json.Unmarshal(doc["_meta"], &meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.HostVars) != 3 {
+		t.Errorf("_meta.hostvars has %d hosts, want 3", len(meta.HostVars))
+	}
+	if _, ok := doc["env_production"]; !ok {
+		t.Error("groups should be top-level keys")
+	}
+}
+
+func TestBuildAnsibleInventory_PodsOfEnvironments(t *testing.T) {
+	hosts := []InventoryHost{
+		{Hostname: "prd-web-01", Topology: &ResolvedTopology{EnvironmentName: "Production", ServiceName: "Web", PodID: "01"}},
+		{Hostname: "stg-web-01", Topology: &ResolvedTopology{EnvironmentName: "Staging", ServiceName: "Web", PodID: "01"}},
+	}
+
+	inv := BuildAnsibleInventory(hosts)
+
+	for name, want := range map[string][]string{
+		"pod_production_web_01": {"prd-web-01"},
+		"pod_staging_web_01":    {"stg-web-01"},
+		"svc_web":               {"prd-web-01", "stg-web-01"},
+	} {
+		if g, ok := inv.Groups[name]; !ok || !slices.Equal(g.Hosts, want) {
+			t.Errorf("group %q = %v, want hosts %v", name, g, want)
+		}
+	}
+	if _, ok := inv.Groups["pod_web_01"]; ok {
+		t.Error("pods of different environments should not share a group")
+	}
+}
+
+func TestInventoryFilterMatches(t *testing.T) {
+	prod := InventoryHost{
+		Hostname: "prd-web-01", OS: "Rocky Linux 9.4", AgentVersion: "1.12.0", NeedsRestarting: true,
+		Topology: &ResolvedTopology{EnvironmentValue: "prd", EnvironmentName: "Production", ServiceValue: "web", ServiceName: "Web Portal", PodID: "01"},
+	}
+	outside := InventoryHost{Hostname: "laptop", OS: "Fedora 40"}
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		filter InventoryFilter
+		host   InventoryHost
+		want   bool
+	}{
+		{"empty filter", InventoryFilter{}, prod, true},
+		{"empty filter outside topology", InventoryFilter{}, outside, true},
+		{"environment by name", InventoryFilter{Environment: "production"}, prod, true},
+		{"environment by value", InventoryFilter{Environment: "PRD"}, prod, true},
+		{"other environment", InventoryFilter{Environment: "Staging"}, prod, false},
+		{"service by name", InventoryFilter{Service: "web portal"}, prod, true},
+		{"service by value", InventoryFilter{Service: "web"}, prod, true},
+		{"pod", InventoryFilter{Service: "web", Pod: "01"}, prod, true},
+		{"other pod", InventoryFilter{Pod: "02"}, prod, false},
+		{"topology filter outside topology", InventoryFilter{Environment: "Production"}, outside, false},
+		{"os", InventoryFilter{OS: "rocky linux 9.4"}, prod, true},
+		{"other os", InventoryFilter{OS: "Rocky Linux 8.10"}, prod, false},
+		{"agent version", InventoryFilter{AgentVersion: "1.12.0"}, prod, true},
+		{"needs restarting", InventoryFilter{NeedsRestarting: &yes}, prod, true},
+		{"does not need restarting", InventoryFilter{NeedsRestarting: &no}, prod, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Matches(tt.host); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildPrometheusTargets(t *testing.T) {
+	hosts := []InventoryHost{
+		{
+			Hostname: "prd-web-01", MachineID: "m1", OS: "Rocky Linux 9.4", AgentVersion: "1.12.0",
+			NeedsRestarting: true, CriticalVulns: 2,
+			Labels:   map[string]string{"criticality": "high", "Owner Team": "ops"},
+			Topology: &ResolvedTopology{EnvironmentName: "Production", ServiceName: "Web", PodID: "01"},
+		},
+		{Hostname: "laptop", MachineID: "m2"},
+	}
+
+	groups := BuildPrometheusTargets(hosts, 9100)
+	if len(groups) != 2 {
+		t.Fatalf("got %d target groups, want 2", len(groups))
+	}
+	if !slices.Equal(groups[0].Targets, []string{"prd-web-01:9100"}) {
+		t.Errorf("targets = %v", groups[0].Targets)
+	}
+
+	want := map[string]string{
+		"__meta_txlog_hostname":          "prd-web-01",
+		"__meta_txlog_machine_id":        "m1",
+		"__meta_txlog_environment":       "Production",
+		"__meta_txlog_service":           "Web",
+		"__meta_txlog_pod":               "01",
+		"__meta_txlog_os":                "Rocky Linux 9.4",
+		"__meta_txlog_agent_version":     "1.12.0",
+		"__meta_txlog_needs_restarting":  "true",
+		"__meta_txlog_critical_cves":     "2",
+		"__meta_txlog_label_criticality": "high",
+		"__meta_txlog_label_owner_team":  "ops",
+	}
+	for k, v := range want {
+		if groups[0].Labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, groups[0].Labels[k], v)
+		}
+	}
+	if groups[1].Labels["__meta_txlog_environment"] != "" {
+		t.Errorf("hosts outside the topology should have an empty environment")
+	}
+
+	data, err := json.Marshal(BuildPrometheusTargets(nil, 9100))
+	if err != nil || string(data) != "[]" {
+		t.Errorf("empty inventory = %s, %v; want []", data, err)
+	}
+}
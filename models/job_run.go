@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Job run triggers.
+const (
+	JobTriggerCron   = "cron"
+	JobTriggerManual = "manual"
+)
+
+// Job run statuses.
+const (
+	JobStatusRunning     = "running"
+	JobStatusSucceeded   = "succeeded"
+	JobStatusFailed      = "failed"
+	JobStatusInterrupted = "interrupted"
+)
+
+// JobRun represents a single execution of a background job.
+type JobRun struct {
+	ID                   int64      `json:"id"`
+	JobName              string     `json:"job_name"`
+	Trigger              string     `json:"trigger"`
+	Status               string     `json:"status"`
+	Phase                string     `json:"phase"`
+	ProgressCurrent      int        `json:"progress_current"`
+	ProgressTotal        int        `json:"progress_total"`
+	PackagesChecked      int        `json:"packages_checked"`
+	VulnerabilitiesFound int        `json:"vulnerabilities_found"`
+	ErrorCount           int        `json:"error_count"`
+	LastError            string     `json:"last_error,omitempty"`
+	StartedAt            time.Time  `json:"started_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	FinishedAt           *time.Time `json:"finished_at"`
+}
+
+// IsRunning reports whether the run has not finished yet.
+func (r JobRun) IsRunning() bool {
+	return r.Status == JobStatusRunning
+}
+
+// ProgressPercent returns the progress of the current phase as a 0-100 value.
+func (r JobRun) ProgressPercent() int {
+	if r.ProgressTotal <= 0 {
+		return 0
+	}
+	pct := r.ProgressCurrent * 100 / r.ProgressTotal
+	if pct > 100 {
+		pct = 100
+	}
+	return pct
+}
+
+// Duration returns how long the run took, or how long it has been running.
+func (r JobRun) Duration() time.Duration {
+	end := time.Now()
+	if r.FinishedAt != nil {
+		end = *r.FinishedAt
+	}
+	return end.Sub(r.StartedAt).Round(time.Second)
+}
+
+// JobRunManager records and lists job runs in the job_runs table.
+type JobRunManager struct {
+	db *sql.DB
+}
+
+// NewJobRunManager returns a new JobRunManager backed by the given DB.
+func NewJobRunManager(db *sql.DB) *JobRunManager {
+	return &JobRunManager{db: db}
+}
+
+// Start records a new running job and returns its ID. Any previous run of the
+// same job still marked as running is flagged as interrupted first: the caller
+// holds the job's cron_lock, so such rows belong to an instance that died
+// mid-run.
+func (m *JobRunManager) Start(jobName, trigger string) (int64, error) {
+	_, err := m.db.Exec(`
+		UPDATE job_runs
+		SET status = $1, finished_at = updated_at
+		WHERE job_name = $2 AND status = $3
+	`, JobStatusInterrupted, jobName, JobStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = m.db.QueryRow(`
+		INSERT INTO job_runs (job_name, trigger, status)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, jobName, trigger, JobStatusRunning).Scan(&id)
+	return id, err
+}
+
+// UpdateProgress stores the current phase, progress and counters of a run.
+func (m *JobRunManager) UpdateProgress(run *JobRun) error {
+	_, err := m.db.Exec(`
+		UPDATE job_runs
+		SET phase = $1, progress_current = $2, progress_total = $3,
+		    packages_checked = $4, vulnerabilities_found = $5,
+		    error_count = $6, last_error = NULLIF($7, ''), updated_at = NOW()
+		WHERE id = $8
+	`, run.Phase, run.ProgressCurrent, run.ProgressTotal,
+		run.PackagesChecked, run.VulnerabilitiesFound,
+		run.ErrorCount, run.LastError, run.ID)
+	return err
+}
+
+// Finish stores the final counters of a run and marks it with the given status.
+func (m *JobRunManager) Finish(run *JobRun, status string) error {
+	run.Status = status
+	_, err := m.db.Exec(`
+		UPDATE job_runs
+		SET status = $1, phase = $2, progress_current = $3, progress_total = $4,
+		    packages_checked = $5, vulnerabilities_found = $6,
+		    error_count = $7, last_error = NULLIF($8, ''),
+		    updated_at = NOW(), finished_at = NOW()
+		WHERE id = $9
+	`, status, run.Phase, run.ProgressCurrent, run.ProgressTotal,
+		run.PackagesChecked, run.VulnerabilitiesFound,
+		run.ErrorCount, run.LastError, run.ID)
+	return err
+}
+
+// List returns the most recent runs of a job, newest first.
+func (m *JobRunManager) List(jobName string, limit int) ([]JobRun, error) {
+	rows, err := m.db.Query(`
+		SELECT id, job_name, trigger, status, phase, progress_current, progress_total,
+		       packages_checked, vulnerabilities_found, error_count, COALESCE(last_error, ''),
+		       started_at, updated_at, finished_at
+		FROM job_runs
+		WHERE job_name = $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2
+	`, jobName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		var r JobRun
+		var finishedAt sql.NullTime
+		if err := rows.Scan(
+			&r.ID, &r.JobName, &r.Trigger, &r.Status, &r.Phase, &r.ProgressCurrent, &r.ProgressTotal,
+			&r.PackagesChecked, &r.VulnerabilitiesFound, &r.ErrorCount, &r.LastError,
+			&r.StartedAt, &r.UpdatedAt, &finishedAt,
+		); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			r.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
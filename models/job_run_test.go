@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobRunProgressPercent(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  int
+		total    int
+		expected int
+	}{
+		{"no total", 5, 0, 0},
+		{"not started", 0, 200, 0},
+		{"halfway", 100, 200, 50},
+		{"rounds down", 1, 3, 33},
+		{"done", 200, 200, 100},
+		{"overshoot is capped", 250, 200, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := JobRun{ProgressCurrent: tt.current, ProgressTotal: tt.total}
+			if got := run.ProgressPercent(); got != tt.expected {
+				t.Errorf("ProgressPercent() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJobRunDuration(t *testing.T) {
+	started := time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)
+	finished := started.Add(90*time.Second + 400*time.Millisecond)
+
+	run := JobRun{StartedAt: started, FinishedAt: &finished, Status: JobStatusSucceeded}
+	if got := run.Duration(); got != 90*time.Second {
+		t.Errorf("Duration() = %s, want 1m30s", got)
+	}
+	if run.IsRunning() {
+		t.Error("finished run should not be running")
+	}
+
+	running := JobRun{StartedAt: time.Now().Add(-time.Minute), Status: JobStatusRunning}
+	if got := running.Duration(); got < time.Minute {
+		t.Errorf("Duration() of running job = %s, want at least 1m", got)
+	}
+	if !running.IsRunning() {
+		t.Error("running run should be running")
+	}
+}
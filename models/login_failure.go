@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Kinds of login failure counters.
+const (
+	LoginFailureUsername = "username"
+	LoginFailureIP       = "ip"
+)
+
+// maxLoginDelay caps the delay after a failure before the threshold is
+// reached.
+const maxLoginDelay = 30 * time.Second
+
+// LoginLockout configures how failed logins slow down password guessing.
+type LoginLockout struct {
+	// UsernameThreshold is how many failures in a row lock a username.
+	UsernameThreshold int
+	// IPThreshold is how many failures in a row lock a client IP.
+	IPThreshold int
+	// Duration is how long a lockout lasts. Failures are forgotten after as
+	// long without one.
+	Duration time.Duration
+}
+
+// LoginDelay returns how long logins are refused after the given number of
+// failures in a row: one second after the first, doubled after each next
+// one up to 30 seconds, and the lockout duration once the threshold is
+// reached. A threshold below 1 disables the counter.
+func LoginDelay(failures, threshold int, lockout time.Duration) time.Duration {
+	if threshold < 1 || failures < 1 {
+		return 0
+	}
+	if failures >= threshold {
+		return lockout
+	}
+
+	delay := time.Second
+	for i := 1; i < failures && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxLoginDelay, lockout)
+}
+
+// LoginFailureManager counts failed logins in the login_failures table, so
+// every instance refuses the same usernames and addresses.
+type LoginFailureManager struct {
+	db *sql.DB
+}
+
+// NewLoginFailureManager returns a new LoginFailureManager backed by the
+// given DB.
+func NewLoginFailureManager(db *sql.DB) *LoginFailureManager {
+	return &LoginFailureManager{db: db}
+}
+
+// LockedFor returns how long logins for username from ip are still refused,
+// or zero when they are allowed.
+func (m *LoginFailureManager) LockedFor(username, ip string) (time.Duration, error) {
+	var lockedUntil sql.NullTime
+	err := m.db.QueryRow(`
+		SELECT MAX(locked_until)
+		FROM login_failures
+		WHERE ((kind = $1 AND key = $2) OR (kind = $3 AND key = $4)) AND locked_until > NOW()
+	`, LoginFailureUsername, username, LoginFailureIP, ip).Scan(&lockedUntil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login lockout: %w", err)
+	}
+	if !lockedUntil.Valid {
+		return 0, nil
+	}
+	return max(time.Until(lockedUntil.Time), time.Second), nil
+}
+
+// RecordFailure counts a failed login for username and ip, and refuses the
+// next logins of each for its LoginDelay. It reports whether either was
+// locked out by this failure.
+func (m *LoginFailureManager) RecordFailure(username, ip string, config LoginLockout) (bool, error) {
+	lockedOut := false
+	for _, counter := range []struct {
+		kind, key string
+		threshold int
+	}{
+		{LoginFailureUsername, username, config.UsernameThreshold},
+		{LoginFailureIP, ip, config.IPThreshold},
+	} {
+		if counter.threshold < 1 || counter.key == "" {
+			continue
+		}
+
+		var failures int
+		err := m.db.QueryRow(`
+			INSERT INTO login_failures (kind, key, failures, last_failure_at)
+			VALUES ($1, $2, 1, NOW())
+			ON CONFLICT (kind, key) DO UPDATE
+			SET failures = CASE
+			        WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+			        ELSE login_failures.failures + 1
+			    END,
+			    last_failure_at = NOW()
+			RETURNING failures
+		`, counter.kind, counter.key, config.Duration.Seconds()).Scan(&failures)
+		if err != nil {
+			return false, fmt.Errorf("failed to count login failure: %w", err)
+		}
+
+		delay := LoginDelay(failures, counter.threshold, config.Duration)
+		_, err = m.db.Exec(`
+			UPDATE login_failures SET locked_until = NOW() + make_interval(secs => $3)
+			WHERE kind = $1 AND key = $2
+		`, counter.kind, counter.key, delay.Seconds())
+		if err != nil {
+			return false, fmt.Errorf("failed to lock login: %w", err)
+		}
+		if failures == counter.threshold {
+			lockedOut = true
+		}
+	}
+	return lockedOut, nil
+}
+
+// Reset forgets the failures of a username after a successful login. The
+// counter of the client IP is kept, so one valid account does not let an
+// address keep guessing the passwords of others.
+func (m *LoginFailureManager) Reset(username string) error {
+	_, err := m.db.Exec(`DELETE FROM login_failures WHERE kind = $1 AND key = $2`, LoginFailureUsername, username)
+	if err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// PurgeStale deletes the counters without a failure for the given time and
+// no running lockout, and returns how many were deleted.
+func (m *LoginFailureManager) PurgeStale(olderThan time.Duration) (int64, error) {
+	result, err := m.db.Exec(`
+		DELETE FROM login_failures
+		WHERE last_failure_at < NOW() - make_interval(secs => $1)
+		  AND (locked_until IS NULL OR locked_until < NOW())
+	`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge login failures: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	lockout := 15 * time.Minute
+	tests := []struct {
+		failures  int
+		threshold int
+		want      time.Duration
+	}{
+		{0, 5, 0},
+		{1, 5, time.Second},
+		{2, 5, 2 * time.Second},
+		{4, 5, 8 * time.Second},
+		{5, 5, lockout},
+		{7, 5, lockout},
+		{6, 10, 30 * time.Second},
+		{9, 10, 30 * time.Second},
+		{3, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := LoginDelay(tt.failures, tt.threshold, lockout); got != tt.want {
+			t.Errorf("LoginDelay(%d, %d) = %v, want %v", tt.failures, tt.threshold, got, tt.want)
+		}
+	}
+
+	if got := LoginDelay(4, 5, 5*time.Second); got != 5*time.Second {
+		t.Errorf("LoginDelay() = %v, want it capped at the lockout duration", got)
+	}
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MaxPersonalTokens caps how many active personal access tokens a user may
+// have.
+const MaxPersonalTokens = 20
+
+// PersonalTokenManager manages the personal access tokens of users: API
+// keys with an owner, stored in api_keys.
+type PersonalTokenManager struct {
+	db *sql.DB
+}
+
+// NewPersonalTokenManager returns a new PersonalTokenManager backed by the
+// given DB.
+func NewPersonalTokenManager(db *sql.DB) *PersonalTokenManager {
+	return &PersonalTokenManager{db: db}
+}
+
+// ListForUser returns the personal access tokens of a user, newest first.
+func (m *PersonalTokenManager) ListForUser(userID int) ([]ApiKey, error) {
+	rows, err := m.db.Query(`
+		SELECT id, name, key_prefix, created_at, last_used_at, is_active, created_by, user_id,
+		       scopes, expires_at, allowed_cidrs, COALESCE(environment, '')
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []ApiKey{}
+	for rows.Next() {
+		var token ApiKey
+		err := rows.Scan(
+			&token.ID, &token.Name, &token.KeyPrefix, &token.CreatedAt, &token.LastUsedAt, &token.IsActive,
+			&token.CreatedBy, &token.UserID, pq.Array(&token.Scopes), &token.ExpiresAt,
+			pq.Array(&token.AllowedCIDRs), &token.Environment,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan personal access token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// CountActive returns how many personal access tokens of a user are still
+// accepted.
+func (m *PersonalTokenManager) CountActive(userID int) (int, error) {
+	var count int
+	err := m.db.QueryRow(`
+		SELECT COUNT(*) FROM api_keys
+		WHERE user_id = $1 AND is_active AND (expires_at IS NULL OR expires_at > NOW())
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count personal access tokens: %w", err)
+	}
+	return count, nil
+}
+
+// Create stores a personal access token of a user, who is also its creator,
+// and returns its ID. Only the hash of the secret is stored.
+func (m *PersonalTokenManager) Create(userID int, name, keyHash, keyPrefix string, restrictions APIKeyRestrictions) (int, error) {
+	var id int
+	err := m.db.QueryRow(`
+		INSERT INTO api_keys (
+			name, key_hash, key_prefix, created_by, user_id, created_at, is_active,
+			scopes, expires_at, allowed_cidrs, environment
+		)
+		VALUES ($1, $2, $3, $4, $4, $5, true, $6, $7, $8, NULLIF($9, ''))
+		RETURNING id
+	`, name, keyHash, keyPrefix, userID, time.Now(),
+		pq.Array(restrictions.Scopes), restrictions.ExpiresAt, pq.Array(restrictions.AllowedCIDRs), restrictions.Environment,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create personal access token: %w", err)
+	}
+	return id, nil
+}
+
+// Revoke deactivates a personal access token of a user. It reports whether
+// an active token was found; tokens of other users are never touched.
+func (m *PersonalTokenManager) Revoke(userID, tokenID int) (bool, error) {
+	result, err := m.db.Exec(`
+		UPDATE api_keys SET is_active = false
+		WHERE id = $1 AND user_id = $2 AND is_active
+	`, tokenID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke personal access token: %w", err)
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
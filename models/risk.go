@@ -0,0 +1,628 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CriticalityLabel is the asset label that holds the asset criticality.
+const CriticalityLabel = "criticality"
+
+// Asset criticality levels. Assets without a criticality label are treated
+// as DefaultCriticality.
+const (
+	CriticalityLow      = "low"
+	CriticalityMedium   = "medium"
+	CriticalityHigh     = "high"
+	CriticalityCritical = "critical"
+
+	DefaultCriticality = CriticalityMedium
+)
+
+// criticalityWeights multiply the vulnerability score of an asset.
+var criticalityWeights = map[string]float64{
+	CriticalityLow:      0.5,
+	CriticalityMedium:   1.0,
+	CriticalityHigh:     1.5,
+	CriticalityCritical: 2.0,
+}
+
+// Criticalities lists the valid criticality values, lowest first.
+var Criticalities = []string{CriticalityLow, CriticalityMedium, CriticalityHigh, CriticalityCritical}
+
+// IsValidCriticality reports whether c is a known criticality level.
+func IsValidCriticality(c string) bool {
+	_, ok := criticalityWeights[c]
+	return ok
+}
+
+// CriticalityWeight returns the score multiplier of a criticality level.
+// Unknown or empty values get the weight of DefaultCriticality.
+func CriticalityWeight(c string) float64 {
+	if w, ok := criticalityWeights[c]; ok {
+		return w
+	}
+	return criticalityWeights[DefaultCriticality]
+}
+
+// AssetRiskScore combines the vulnerability score of an asset (the sum of
+// CVSS x exploitability factor over its open vulnerabilities) with its
+// criticality weight. The result is rounded to two decimals.
+func AssetRiskScore(vulnScore float64, criticality string) float64 {
+	return math.Round(vulnScore*CriticalityWeight(criticality)*100) / 100
+}
+
+// Risk aggregation levels, from the whole fleet down to a single asset.
+const (
+	RiskLevelFleet       = "fleet"
+	RiskLevelEnvironment = "environment"
+	RiskLevelService     = "service"
+	RiskLevelPod         = "pod"
+	RiskLevelAsset       = "asset"
+)
+
+// IsValidRiskLevel reports whether level is a known aggregation level.
+func IsValidRiskLevel(level string) bool {
+	switch level {
+	case RiskLevelFleet, RiskLevelEnvironment, RiskLevelService, RiskLevelPod, RiskLevelAsset:
+		return true
+	}
+	return false
+}
+
+// AssetRisk is the current risk of a single active asset.
+type AssetRisk struct {
+	MachineID     string    `json:"machine_id"`
+	Hostname      string    `json:"hostname"`
+	Environment   string    `json:"environment"`
+	Service       string    `json:"service"`
+	Pod           string    `json:"pod"`
+	Criticality   string    `json:"criticality"`
+	OpenVulns     int       `json:"open_vulns"`
+	CriticalVulns int       `json:"critical_vulns"`
+	HighVulns     int       `json:"high_vulns"`
+	MediumVulns   int       `json:"medium_vulns"`
+	LowVulns      int       `json:"low_vulns"`
+	MaxCVSS       float64   `json:"max_cvss"`
+	Score         float64   `json:"score"`
+	ComputedAt    time.Time `json:"computed_at"`
+}
+
+// RiskGroup is the risk of a topology group (or of a single asset when the
+// level is RiskLevelAsset). Score is the sum of the asset scores in the group.
+type RiskGroup struct {
+	Level           string  `json:"level"`
+	Environment     string  `json:"environment,omitempty"`
+	EnvironmentName string  `json:"environment_name,omitempty"`
+	Service         string  `json:"service,omitempty"`
+	ServiceName     string  `json:"service_name,omitempty"`
+	Pod             string  `json:"pod,omitempty"`
+	Hostname        string  `json:"hostname,omitempty"`
+	MachineID       string  `json:"machine_id,omitempty"`
+	Criticality     string  `json:"criticality,omitempty"`
+	Score           float64 `json:"score"`
+	MaxAssetScore   float64 `json:"max_asset_score"`
+	AssetCount      int     `json:"asset_count"`
+	OpenVulns       int     `json:"open_vulns"`
+	CriticalVulns   int     `json:"critical_vulns"`
+	HighVulns       int     `json:"high_vulns"`
+	MaxCVSS         float64 `json:"max_cvss"`
+}
+
+// RiskHistoryPoint is one daily snapshot of a group's risk.
+type RiskHistoryPoint struct {
+	Date          string  `json:"date"` // YYYY-MM-DD
+	Score         float64 `json:"score"`
+	AssetCount    int     `json:"asset_count"`
+	OpenVulns     int     `json:"open_vulns"`
+	CriticalVulns int     `json:"critical_vulns"`
+}
+
+// AggregateRisk rolls asset risks up to the given level and returns the
+// groups sorted by score, highest first. Assets outside the topology
+// (no resolved environment or service) only count towards the levels they
+// can be placed in.
+func AggregateRisk(assets []AssetRisk, level string) []RiskGroup {
+	groups := map[string]*RiskGroup{}
+	var order []string
+
+	for _, a := range assets {
+		var key string
+		g := RiskGroup{Level: level}
+		switch level {
+		case RiskLevelFleet:
+			key = RiskLevelFleet
+		case RiskLevelEnvironment:
+			if a.Environment == "" {
+				continue
+			}
+			key = a.Environment
+			g.Environment = a.Environment
+		case RiskLevelService:
+			if a.Service == "" {
+				continue
+			}
+			key = a.Environment + "\x00" + a.Service
+			g.Environment, g.Service = a.Environment, a.Service
+		case RiskLevelPod:
+			if a.Service == "" {
+				continue
+			}
+			key = a.Environment + "\x00" + a.Service + "\x00" + a.Pod
+			g.Environment, g.Service, g.Pod = a.Environment, a.Service, a.Pod
+		case RiskLevelAsset:
+			key = a.MachineID
+			g.Environment, g.Service, g.Pod = a.Environment, a.Service, a.Pod
+			g.Hostname, g.MachineID, g.Criticality = a.Hostname, a.MachineID, a.Criticality
+		default:
+			return []RiskGroup{}
+		}
+
+		existing, ok := groups[key]
+		if !ok {
+			existing = &g
+			groups[key] = existing
+			order = append(order, key)
+		}
+		existing.Score += a.Score
+		existing.AssetCount++
+		existing.OpenVulns += a.OpenVulns
+		existing.CriticalVulns += a.CriticalVulns
+		existing.HighVulns += a.HighVulns
+		existing.MaxAssetScore = math.Max(existing.MaxAssetScore, a.Score)
+		existing.MaxCVSS = math.Max(existing.MaxCVSS, a.MaxCVSS)
+	}
+
+	result := make([]RiskGroup, 0, len(order))
+	for _, key := range order {
+		g := *groups[key]
+		g.Score = math.Round(g.Score*100) / 100
+		result = append(result, g)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Environment+result[i].Service+result[i].Pod+result[i].Hostname <
+			result[j].Environment+result[j].Service+result[j].Pod+result[j].Hostname
+	})
+
+	return result
+}
+
+// RiskManager computes and queries risk scores.
+type RiskManager struct {
+	db *sql.DB
+}
+
+// NewRiskManager returns a new RiskManager backed by the given DB.
+func NewRiskManager(db *sql.DB) *RiskManager {
+	return &RiskManager{db: db}
+}
+
+// installedPackagesCTE defines three CTEs shared by the vulnerability
+// queries: active (active assets with the OSV ecosystem of their OS),
+// latest_tx (the latest transaction that touched each package and arch on an
+// asset) and installed (the package versions those transactions installed,
+// i.e. what is on the asset now).
+const installedPackagesCTE = `
+active AS (
+    SELECT
+        a.machine_id,
+        a.hostname,
+        CASE
+            WHEN a.os ILIKE '%AlmaLinux%' THEN 'AlmaLinux:' || SUBSTRING(a.os FROM '[0-9]+')
+            WHEN a.os ILIKE '%Rocky%' THEN 'Rocky Linux:' || SUBSTRING(a.os FROM '[0-9]+')
+            WHEN a.os ILIKE '%Red Hat%' OR a.os ILIKE '%RHEL%' OR a.os ILIKE '%CentOS%' OR a.os ILIKE '%Oracle%' THEN 'Red Hat:enterprise_linux:' || SUBSTRING(a.os FROM '[0-9]+')
+            ELSE ''
+        END AS ecosystem_prefix,
+        (a.os ILIKE '%Red Hat%' OR a.os ILIKE '%RHEL%' OR a.os ILIKE '%CentOS%' OR a.os ILIKE '%Oracle%') AS is_rh_family
+    FROM assets a
+    WHERE a.is_active = TRUE
+),
+latest_tx AS (
+    SELECT ti.machine_id, ti.package, COALESCE(ti.arch, '') AS arch, MAX(ti.transaction_id) AS transaction_id
+    FROM transaction_items ti
+    JOIN active ac ON ac.machine_id = ti.machine_id
+    GROUP BY ti.machine_id, ti.package, COALESCE(ti.arch, '')
+),
+installed AS (
+    SELECT DISTINCT ti.machine_id, ti.package, ti.version, COALESCE(ti.release, '') AS release
+    FROM transaction_items ti
+    JOIN latest_tx lt ON lt.machine_id = ti.machine_id AND lt.package = ti.package
+         AND lt.arch = COALESCE(ti.arch, '') AND lt.transaction_id = ti.transaction_id
+    WHERE ti.action IN ('Install', 'Upgrade', 'Downgrade', 'Reinstall', 'installed', 'upgrade')
+)
+`
+
+// assetVulnScoreQuery returns one row per active asset with its topology
+// placement, criticality label and open vulnerability totals. A vulnerability
+// is open when it affects the version of a package installed by the latest
+// transaction that touched that package (per arch) on the asset. Each
+// vulnerability weighs its CVSS score (inferred from the severity when OSV
+// gave none) times an exploitability factor between 0.5 and 1.5; unknown
+// exploitability counts as 1.0.
+const assetVulnScoreQuery = `
+WITH ` + installedPackagesCTE + `,
+open_vulns AS (
+    SELECT DISTINCT
+        i.machine_id,
+        v.id,
+        v.severity,
+        CASE
+            WHEN v.cvss_score > 0 THEN v.cvss_score
+            WHEN v.severity = 'CRITICAL' THEN 9.5
+            WHEN v.severity = 'HIGH' THEN 8.0
+            WHEN v.severity = 'MEDIUM' THEN 5.5
+            WHEN v.severity = 'LOW' THEN 3.0
+            ELSE 1.0
+        END AS cvss,
+        0.5 + COALESCE(v.exploitability_score, 1.95) / 3.9 AS exploitability_factor
+    FROM installed i
+    JOIN active ac ON ac.machine_id = i.machine_id
+    JOIN package_vulnerabilities pv ON pv.package_name = i.package AND pv.version = i.version
+         AND pv.release = i.release
+         AND (
+             (NOT ac.is_rh_family AND pv.ecosystem = ac.ecosystem_prefix) OR
+             (ac.is_rh_family AND pv.ecosystem LIKE ac.ecosystem_prefix || '::%')
+         )
+    JOIN vulnerabilities v ON v.id = pv.vulnerability_id
+),
+vuln_totals AS (
+    SELECT
+        machine_id,
+        COUNT(*) AS open_vulns,
+        COUNT(*) FILTER (WHERE severity = 'CRITICAL') AS critical_vulns,
+        COUNT(*) FILTER (WHERE severity = 'HIGH') AS high_vulns,
+        COUNT(*) FILTER (WHERE severity = 'MEDIUM') AS medium_vulns,
+        COUNT(*) FILTER (WHERE severity = 'LOW') AS low_vulns,
+        MAX(cvss) AS max_cvss,
+        SUM(cvss * exploitability_factor) AS vuln_score
+    FROM open_vulns
+    GROUP BY machine_id
+)
+SELECT
+    ac.machine_id,
+    ac.hostname,
+    COALESCE(best_env.match_value, tp.raw_env, ''),
+    COALESCE(best_svc.match_value, tp.raw_svc, ''),
+    COALESCE(NULLIF(tp.raw_pod, ''), 'Default'),
+    COALESCE(lbl.value, ''),
+    COALESCE(vt.open_vulns, 0),
+    COALESCE(vt.critical_vulns, 0),
+    COALESCE(vt.high_vulns, 0),
+    COALESCE(vt.medium_vulns, 0),
+    COALESCE(vt.low_vulns, 0),
+    COALESCE(vt.max_cvss, 0),
+    COALESCE(vt.vuln_score, 0)
+FROM active ac
+LEFT JOIN vuln_totals vt ON vt.machine_id = ac.machine_id
+LEFT JOIN asset_labels lbl ON lbl.hostname = ac.hostname AND lbl.name = '` + CriticalityLabel + `'
+LEFT JOIN LATERAL (
+    SELECT compiled_pattern,
+           (regexp_match(ac.hostname, compiled_pattern))[env_group_index] AS raw_env,
+           (regexp_match(ac.hostname, compiled_pattern))[svc_group_index] AS raw_svc,
+           (regexp_match(ac.hostname, compiled_pattern))[seq_group_index] AS raw_pod
+    FROM topology_patterns
+    WHERE ac.hostname ~ compiled_pattern
+    ORDER BY display_order, id
+    LIMIT 1
+) tp ON true
+LEFT JOIN LATERAL (
+    SELECT en.match_value
+    FROM environment_names en, unnest(string_to_array(en.match_value, '|')) AS part
+    WHERE ac.hostname ILIKE '%' || part || '%'
+    ORDER BY length(part) DESC
+    LIMIT 1
+) best_env ON true
+LEFT JOIN LATERAL (
+    SELECT sn.match_value
+    FROM service_names sn, unnest(string_to_array(sn.match_value, '|')) AS part
+    WHERE ac.hostname ILIKE '%' || part || '%'
+    ORDER BY length(part) DESC
+    LIMIT 1
+) best_svc ON true
+`
+
+// Recalculate rebuilds asset_risk_scores from the current package state and
+// records today's snapshot of every topology group in risk_score_history.
+// It returns the number of assets scored.
+func (rm *RiskManager) Recalculate() (int, error) {
+	rows, err := rm.db.Query(assetVulnScoreQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	var assets []AssetRisk
+	now := time.Now()
+	for rows.Next() {
+		var a AssetRisk
+		var vulnScore float64
+		if err := rows.Scan(
+			&a.MachineID, &a.Hostname, &a.Environment, &a.Service, &a.Pod, &a.Criticality,
+			&a.OpenVulns, &a.CriticalVulns, &a.HighVulns, &a.MediumVulns, &a.LowVulns,
+			&a.MaxCVSS, &vulnScore,
+		); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !IsValidCriticality(a.Criticality) {
+			a.Criticality = DefaultCriticality
+		}
+		a.Score = AssetRiskScore(vulnScore, a.Criticality)
+		a.ComputedAt = now
+		assets = append(assets, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := rm.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM asset_risk_scores`); err != nil {
+		return 0, err
+	}
+
+	batchSize := 200
+	for i := 0; i < len(assets); i += batchSize {
+		end := i + batchSize
+		if end > len(assets) {
+			end = len(assets)
+		}
+
+		var valueParts []string
+		var args []interface{}
+		idx := 1
+		for _, a := range assets[i:end] {
+			placeholders := make([]string, 14)
+			for p := range placeholders {
+				placeholders[p] = fmt.Sprintf("$%d", idx+p)
+			}
+			valueParts = append(valueParts, "("+strings.Join(placeholders, ", ")+")")
+			args = append(args, a.MachineID, a.Hostname, a.Environment, a.Service, a.Pod, a.Criticality,
+				a.OpenVulns, a.CriticalVulns, a.HighVulns, a.MediumVulns, a.LowVulns,
+				a.MaxCVSS, a.Score, a.ComputedAt)
+			idx += 14
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO asset_risk_scores (
+				machine_id, hostname, environment, service, pod, criticality,
+				open_vulns, critical_vulns, high_vulns, medium_vulns, low_vulns,
+				max_cvss, score, computed_at
+			) VALUES `+strings.Join(valueParts, ", ")+`
+			ON CONFLICT (machine_id) DO NOTHING`, args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, level := range []string{RiskLevelFleet, RiskLevelEnvironment, RiskLevelService, RiskLevelPod} {
+		for _, g := range AggregateRisk(assets, level) {
+			_, err := tx.Exec(`
+				INSERT INTO risk_score_history (
+					snapshot_date, scope, environment, service, pod,
+					score, asset_count, open_vulns, critical_vulns
+				) VALUES (CURRENT_DATE, $1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (snapshot_date, scope, environment, service, pod) DO UPDATE SET
+					score = EXCLUDED.score,
+					asset_count = EXCLUDED.asset_count,
+					open_vulns = EXCLUDED.open_vulns,
+					critical_vulns = EXCLUDED.critical_vulns`,
+				level, g.Environment, g.Service, g.Pod,
+				g.Score, g.AssetCount, g.OpenVulns, g.CriticalVulns)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(assets), nil
+}
+
+// ListAssetRisks returns the current risk of active assets, highest score
+// first. Empty environment or service values match every asset.
+func (rm *RiskManager) ListAssetRisks(environment, service string) ([]AssetRisk, error) {
+	rows, err := rm.db.Query(`
+		SELECT machine_id, hostname, environment, service, pod, criticality,
+		       open_vulns, critical_vulns, high_vulns, medium_vulns, low_vulns,
+		       max_cvss, score, computed_at
+		FROM asset_risk_scores
+		WHERE ($1 = '' OR environment = $1)
+		  AND ($2 = '' OR service = $2)
+		ORDER BY score DESC, hostname
+	`, environment, service)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []AssetRisk{}
+	for rows.Next() {
+		var a AssetRisk
+		if err := rows.Scan(
+			&a.MachineID, &a.Hostname, &a.Environment, &a.Service, &a.Pod, &a.Criticality,
+			&a.OpenVulns, &a.CriticalVulns, &a.HighVulns, &a.MediumVulns, &a.LowVulns,
+			&a.MaxCVSS, &a.Score, &a.ComputedAt,
+		); err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+
+	return assets, rows.Err()
+}
+
+// Rank returns the riskiest groups at the given level, optionally restricted
+// to an environment and service, with friendly topology names filled in.
+// A limit of zero or less returns every group.
+func (rm *RiskManager) Rank(level, environment, service string, limit int) ([]RiskGroup, error) {
+	assets, err := rm.ListAssetRisks(environment, service)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := AggregateRisk(assets, level)
+	if limit > 0 && len(groups) > limit {
+		groups = groups[:limit]
+	}
+
+	envNames, svcNames, err := rm.topologyNames()
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i].EnvironmentName = envNames[groups[i].Environment]
+		groups[i].ServiceName = svcNames[groups[i].Service]
+	}
+
+	return groups, nil
+}
+
+// History returns the daily snapshots of a group over the last days days,
+// oldest first. Environment, service and pod identify the group and must be
+// empty for the levels above them.
+func (rm *RiskManager) History(level, environment, service, pod string, days int) ([]RiskHistoryPoint, error) {
+	rows, err := rm.db.Query(`
+		SELECT to_char(snapshot_date, 'YYYY-MM-DD'), score, asset_count, open_vulns, critical_vulns
+		FROM risk_score_history
+		WHERE scope = $1 AND environment = $2 AND service = $3 AND pod = $4
+		  AND snapshot_date > CURRENT_DATE - $5::int
+		ORDER BY snapshot_date
+	`, level, environment, service, pod, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []RiskHistoryPoint{}
+	for rows.Next() {
+		var p RiskHistoryPoint
+		if err := rows.Scan(&p.Date, &p.Score, &p.AssetCount, &p.OpenVulns, &p.CriticalVulns); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// topologyNames maps environment and service match values to their
+// friendly names.
+func (rm *RiskManager) topologyNames() (map[string]string, map[string]string, error) {
+	envNames := map[string]string{}
+	svcNames := map[string]string{}
+
+	rows, err := rm.db.Query(`SELECT match_value, name FROM environment_names`)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var value, name string
+		if err := rows.Scan(&value, &name); err == nil {
+			envNames[value] = name
+		}
+	}
+	rows.Close()
+
+	rows, err = rm.db.Query(`SELECT match_value, name FROM service_names`)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var value, name string
+		if err := rows.Scan(&value, &name); err == nil {
+			svcNames[value] = name
+		}
+	}
+	rows.Close()
+
+	return envNames, svcNames, nil
+}
+
+// GetAssetLabels returns the labels of a logical asset (hostname).
+func (rm *RiskManager) GetAssetLabels(hostname string) (map[string]string, error) {
+	rows, err := rm.db.Query(`SELECT name, value FROM asset_labels WHERE hostname = $1 ORDER BY name`, hostname)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := map[string]string{}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		labels[name] = value
+	}
+
+	return labels, rows.Err()
+}
+
+// SetAssetLabel creates or updates a label of a logical asset. An empty
+// value removes the label.
+func (rm *RiskManager) SetAssetLabel(hostname, name, value string) error {
+	if value == "" {
+		_, err := rm.db.Exec(`DELETE FROM asset_labels WHERE hostname = $1 AND name = $2`, hostname, name)
+		return err
+	}
+
+	_, err := rm.db.Exec(`
+		INSERT INTO asset_labels (hostname, name, value, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (hostname, name) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`, hostname, name, value)
+	return err
+}
+
+// LastComputedAt returns when asset_risk_scores was last rebuilt, or nil if
+// it has never been.
+func (rm *RiskManager) LastComputedAt() (*time.Time, error) {
+	var computedAt sql.NullTime
+	if err := rm.db.QueryRow(`SELECT MAX(computed_at) FROM asset_risk_scores`).Scan(&computedAt); err != nil {
+		return nil, err
+	}
+	if !computedAt.Valid {
+		return nil, nil
+	}
+	return &computedAt.Time, nil
+}
+
+// GetAssetRisk returns the current risk of an asset, or nil if it has not
+// been scored yet.
+func (rm *RiskManager) GetAssetRisk(machineID string) (*AssetRisk, error) {
+	var a AssetRisk
+	err := rm.db.QueryRow(`
+		SELECT machine_id, hostname, environment, service, pod, criticality,
+		       open_vulns, critical_vulns, high_vulns, medium_vulns, low_vulns,
+		       max_cvss, score, computed_at
+		FROM asset_risk_scores
+		WHERE machine_id = $1
+	`, machineID).Scan(
+		&a.MachineID, &a.Hostname, &a.Environment, &a.Service, &a.Pod, &a.Criticality,
+		&a.OpenVulns, &a.CriticalVulns, &a.HighVulns, &a.MediumVulns, &a.LowVulns,
+		&a.MaxCVSS, &a.Score, &a.ComputedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
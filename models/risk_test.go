@@ -0,0 +1,117 @@
+package models
+
+import "testing"
+
+func TestCriticalityWeight(t *testing.T) {
+	tests := []struct {
+		criticality string
+		expected    float64
+	}{
+		{CriticalityLow, 0.5},
+		{CriticalityMedium, 1.0},
+		{CriticalityHigh, 1.5},
+		{CriticalityCritical, 2.0},
+		{"", 1.0},
+		{"unknown", 1.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.criticality, func(t *testing.T) {
+			if got := CriticalityWeight(tt.criticality); got != tt.expected {
+				t.Errorf("CriticalityWeight(%q) = %v, want %v", tt.criticality, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAssetRiskScore(t *testing.T) {
+	tests := []struct {
+		name        string
+		vulnScore   float64
+		criticality string
+		expected    float64
+	}{
+		{"no vulnerabilities", 0, CriticalityCritical, 0},
+		{"medium keeps score", 12.345, CriticalityMedium, 12.35},
+		{"critical doubles", 10, CriticalityCritical, 20},
+		{"low halves", 9.9, CriticalityLow, 4.95},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AssetRiskScore(tt.vulnScore, tt.criticality); got != tt.expected {
+				t.Errorf("AssetRiskScore(%v, %q) = %v, want %v", tt.vulnScore, tt.criticality, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAggregateRisk(t *testing.T) {
+	assets := []AssetRisk{
+		{MachineID: "m1", Hostname: "prd-web01", Environment: "prd", Service: "web", Pod: "01", Score: 10, OpenVulns: 3, CriticalVulns: 1, MaxCVSS: 9.8},
+		{MachineID: "m2", Hostname: "prd-web02", Environment: "prd", Service: "web", Pod: "02", Score: 5.5, OpenVulns: 2, HighVulns: 2, MaxCVSS: 7.5},
+		{MachineID: "m3", Hostname: "prd-db01", Environment: "prd", Service: "db", Pod: "01", Score: 20, OpenVulns: 4, CriticalVulns: 2, MaxCVSS: 9.1},
+		{MachineID: "m4", Hostname: "hlg-web01", Environment: "hlg", Service: "web", Pod: "01", Score: 1, OpenVulns: 1, MaxCVSS: 3.1},
+		{MachineID: "m5", Hostname: "laptop", Score: 7, OpenVulns: 2, MaxCVSS: 6},
+	}
+
+	tests := []struct {
+		name     string
+		level    string
+		expected []RiskGroup
+	}{
+		{
+			name:  "fleet",
+			level: RiskLevelFleet,
+			expected: []RiskGroup{
+				{Level: RiskLevelFleet, Score: 43.5, MaxAssetScore: 20, AssetCount: 5, OpenVulns: 12, CriticalVulns: 3, HighVulns: 2, MaxCVSS: 9.8},
+			},
+		},
+		{
+			name:  "environment skips unresolved assets",
+			level: RiskLevelEnvironment,
+			expected: []RiskGroup{
+				{Level: RiskLevelEnvironment, Environment: "prd", Score: 35.5, MaxAssetScore: 20, AssetCount: 3, OpenVulns: 9, CriticalVulns: 3, HighVulns: 2, MaxCVSS: 9.8},
+				{Level: RiskLevelEnvironment, Environment: "hlg", Score: 1, MaxAssetScore: 1, AssetCount: 1, OpenVulns: 1, MaxCVSS: 3.1},
+			},
+		},
+		{
+			name:  "service is scoped by environment",
+			level: RiskLevelService,
+			expected: []RiskGroup{
+				{Level: RiskLevelService, Environment: "prd", Service: "db", Score: 20, MaxAssetScore: 20, AssetCount: 1, OpenVulns: 4, CriticalVulns: 2, MaxCVSS: 9.1},
+				{Level: RiskLevelService, Environment: "prd", Service: "web", Score: 15.5, MaxAssetScore: 10, AssetCount: 2, OpenVulns: 5, CriticalVulns: 1, HighVulns: 2, MaxCVSS: 9.8},
+				{Level: RiskLevelService, Environment: "hlg", Service: "web", Score: 1, MaxAssetScore: 1, AssetCount: 1, OpenVulns: 1, MaxCVSS: 3.1},
+			},
+		},
+		{
+			name:     "unknown level",
+			level:    "galaxy",
+			expected: []RiskGroup{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AggregateRisk(assets, tt.level)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("AggregateRisk() returned %d groups, want %d: %+v", len(got), len(tt.expected), got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("group %d = %+v, want %+v", i, got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+
+	t.Run("asset level keeps identity", func(t *testing.T) {
+		got := AggregateRisk(assets, RiskLevelAsset)
+		if len(got) != len(assets) {
+			t.Fatalf("AggregateRisk() returned %d groups, want %d", len(got), len(assets))
+		}
+		if got[0].MachineID != "m3" || got[0].Hostname != "prd-db01" || got[0].Score != 20 {
+			t.Errorf("riskiest asset = %+v, want m3/prd-db01 with score 20", got[0])
+		}
+	})
+}
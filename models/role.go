@@ -0,0 +1,175 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// User roles. Every role can see the assets in the user's scope; the other
+// roles add permissions to the viewer's.
+const (
+	RoleViewer          = "viewer"           // read only
+	RoleOperator        = "operator"         // manages assets: labels and deletion
+	RoleSecurityAnalyst = "security_analyst" // runs vulnerability scans
+	RoleAdmin           = "admin"            // everything, including the admin panel
+)
+
+// Roles lists the roles in the order they are displayed. When a user is
+// mapped to several roles, the last one listed wins.
+var Roles = []string{RoleViewer, RoleOperator, RoleSecurityAnalyst, RoleAdmin}
+
+// Permissions granted by roles on top of seeing assets.
+const (
+	PermissionManageAssets        = "manage_assets"        // edit labels and delete assets
+	PermissionScanVulnerabilities = "scan_vulnerabilities" // start an OSV vulnerability update
+	PermissionAdminister          = "administer"           // admin panel, users, keys and settings
+)
+
+var rolePermissions = map[string][]string{
+	RoleOperator:        {PermissionManageAssets},
+	RoleSecurityAnalyst: {PermissionScanVulnerabilities},
+	RoleAdmin:           {PermissionManageAssets, PermissionScanVulnerabilities, PermissionAdminister},
+}
+
+// RoleHasPermission reports whether role grants permission.
+func RoleHasPermission(role, permission string) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// RoleLabel returns the name of role shown in the admin panel.
+func RoleLabel(role string) string {
+	switch role {
+	case RoleOperator:
+		return "Operator"
+	case RoleSecurityAnalyst:
+		return "Security analyst"
+	case RoleAdmin:
+		return "Admin"
+	default:
+		return "Viewer"
+	}
+}
+
+// ParseRole validates a role name, without regard to case.
+func ParseRole(role string) (string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if !slices.Contains(Roles, role) {
+		return "", errors.New("unknown role " + role)
+	}
+	return role, nil
+}
+
+// HighestRole returns the last of roles in the order of Roles, or an empty
+// string when roles is empty.
+func HighestRole(roles []string) string {
+	highest := ""
+	for _, role := range Roles {
+		if slices.Contains(roles, role) {
+			highest = role
+		}
+	}
+	return highest
+}
+
+// AccessScope limits a user to the assets of some topology environments and
+// services. Names match the friendly name or the raw value captured by the
+// topology pattern, without regard to case. An empty list does not limit.
+type AccessScope struct {
+	Environments []string `json:"environments" db:"environments"`
+	Services     []string `json:"services" db:"services"`
+}
+
+// Restricted reports whether the scope hides part of the fleet.
+func (s AccessScope) Restricted() bool {
+	return len(s.Environments) > 0 || len(s.Services) > 0
+}
+
+// AcceptsTopology reports whether an asset resolved to t is in the scope.
+// Restricted scopes never accept assets outside the topology.
+func (s AccessScope) AcceptsTopology(t *ResolvedTopology) bool {
+	if !s.Restricted() {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return s.AcceptsEnvironment(t.EnvironmentName, t.EnvironmentValue) && s.AcceptsService(t.ServiceName, t.ServiceValue)
+}
+
+// AcceptsEnvironment reports whether the environment with the given friendly
+// name and match value is in the scope.
+func (s AccessScope) AcceptsEnvironment(name, value string) bool {
+	return scopeListAccepts(s.Environments, name, value)
+}
+
+// AcceptsService reports whether the service with the given friendly name
+// and match value is in the scope.
+func (s AccessScope) AcceptsService(name, value string) bool {
+	return scopeListAccepts(s.Services, name, value)
+}
+
+func scopeListAccepts(list []string, name, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, entry := range list {
+		if (name != "" && strings.EqualFold(entry, name)) || (value != "" && strings.EqualFold(entry, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the scope for error messages, e.g. "environment
+// Production, services billing and payments".
+func (s AccessScope) String() string {
+	var parts []string
+	if len(s.Environments) > 0 {
+		parts = append(parts, plural("environment", s.Environments)+" "+joinAnd(s.Environments))
+	}
+	if len(s.Services) > 0 {
+		parts = append(parts, plural("service", s.Services)+" "+joinAnd(s.Services))
+	}
+	if len(parts) == 0 {
+		return "the whole fleet"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(noun string, list []string) string {
+	if len(list) == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+func joinAnd(list []string) string {
+	if len(list) == 1 {
+		return list[0]
+	}
+	return strings.Join(list[:len(list)-1], ", ") + " and " + list[len(list)-1]
+}
+
+// ParseAccessScope parses the environments and services entered for a user
+// in the admin panel, separated by commas or new lines. Duplicates are
+// dropped.
+func ParseAccessScope(environments, services string) AccessScope {
+	return AccessScope{
+		Environments: splitScopeList(environments),
+		Services:     splitScopeList(services),
+	}
+}
+
+func splitScopeList(s string) []string {
+	list := []string{}
+	for _, field := range strings.FieldsFunc(s, func(c rune) bool {
+		return c == ',' || c == '\n' || c == '\r'
+	}) {
+		field = strings.TrimSpace(field)
+		if field != "" && !slices.ContainsFunc(list, func(e string) bool { return strings.EqualFold(e, field) }) {
+			list = append(list, field)
+		}
+	}
+	return list
+}
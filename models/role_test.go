@@ -0,0 +1,104 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRoleHasPermission(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{RoleViewer, PermissionManageAssets, false},
+		{RoleOperator, PermissionManageAssets, true},
+		{RoleOperator, PermissionScanVulnerabilities, false},
+		{RoleSecurityAnalyst, PermissionScanVulnerabilities, true},
+		{RoleSecurityAnalyst, PermissionManageAssets, false},
+		{RoleAdmin, PermissionManageAssets, true},
+		{RoleAdmin, PermissionScanVulnerabilities, true},
+		{RoleAdmin, PermissionAdminister, true},
+		{"unknown", PermissionAdminister, false},
+	}
+
+	for _, tt := range tests {
+		if got := RoleHasPermission(tt.role, tt.permission); got != tt.want {
+			t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	if role, err := ParseRole(" Security_Analyst "); err != nil || role != RoleSecurityAnalyst {
+		t.Errorf("ParseRole() = %q, %v, want %q", role, err, RoleSecurityAnalyst)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Error("ParseRole(root) error = nil, want an error")
+	}
+}
+
+func TestHighestRole(t *testing.T) {
+	tests := []struct {
+		roles []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"unknown"}, ""},
+		{[]string{RoleViewer}, RoleViewer},
+		{[]string{RoleSecurityAnalyst, RoleOperator}, RoleSecurityAnalyst},
+		{[]string{RoleViewer, RoleAdmin, RoleOperator}, RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		if got := HighestRole(tt.roles); got != tt.want {
+			t.Errorf("HighestRole(%v) = %q, want %q", tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestAccessScope(t *testing.T) {
+	production := &ResolvedTopology{EnvironmentValue: "prd", EnvironmentName: "Production", ServiceValue: "bil", ServiceName: "Billing"}
+	staging := &ResolvedTopology{EnvironmentValue: "stg", EnvironmentName: "Staging", ServiceValue: "bil", ServiceName: "Billing"}
+
+	tests := []struct {
+		name     string
+		scope    AccessScope
+		topology *ResolvedTopology
+		want     bool
+	}{
+		{"unrestricted", AccessScope{}, nil, true},
+		{"outside topology", AccessScope{Environments: []string{"Production"}}, nil, false},
+		{"friendly name", AccessScope{Environments: []string{"production"}}, production, true},
+		{"raw value", AccessScope{Environments: []string{"PRD"}}, production, true},
+		{"other environment", AccessScope{Environments: []string{"Production"}}, staging, false},
+		{"service", AccessScope{Services: []string{"billing"}}, staging, true},
+		{"environment and service", AccessScope{Environments: []string{"Production"}, Services: []string{"payments"}}, production, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.AcceptsTopology(tt.topology); got != tt.want {
+				t.Errorf("AcceptsTopology() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAccessScope(t *testing.T) {
+	scope := ParseAccessScope(" Production, production\nStaging ", "")
+	if !slices.Equal(scope.Environments, []string{"Production", "Staging"}) {
+		t.Errorf("Environments = %v, want [Production Staging]", scope.Environments)
+	}
+	if scope.Services == nil || len(scope.Services) != 0 {
+		t.Errorf("Services = %#v, want an empty list", scope.Services)
+	}
+
+	scope.Services = []string{"billing", "payments", "search"}
+	if got, want := scope.String(), "environments Production and Staging, services billing, payments and search"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (AccessScope{}).String(); got != "the whole fleet" {
+		t.Errorf("String() = %q, want the whole fleet", got)
+	}
+}
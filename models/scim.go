@@ -0,0 +1,573 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrSCIMConflict is returned when a SCIM user or group would take the
+// userName, e-mail address or name of another one.
+var ErrSCIMConflict = errors.New("already provisioned")
+
+// SCIMUser is a user provisioned by the identity provider over SCIM.
+type SCIMUser struct {
+	ID         int
+	UserName   string
+	ExternalID string
+	Email      string
+	Name       string
+	IsActive   bool
+	Role       string
+	Groups     []SCIMMember
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SCIMGroup is a group pushed by the identity provider over SCIM.
+type SCIMGroup struct {
+	ID          int
+	DisplayName string
+	ExternalID  string
+	Members     []SCIMMember
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SCIMMember is a reference from a group to one of its users, or from a
+// user to one of its groups.
+type SCIMMember struct {
+	ID      int
+	Display string
+}
+
+// SCIMUserFilter selects SCIM users. Empty fields do not filter; userName
+// and e-mail address are compared without regard to case.
+type SCIMUserFilter struct {
+	UserName   string
+	ExternalID string
+	Email      string
+}
+
+// SCIMGroupFilter selects SCIM groups. Empty fields do not filter.
+type SCIMGroupFilter struct {
+	DisplayName string
+	ExternalID  string
+}
+
+// SCIMManager stores the users and groups provisioned over SCIM. Users are
+// rows of users with a scim_user_name; those created by logins are only
+// linked when the identity provider pushes them.
+type SCIMManager struct {
+	db *sql.DB
+}
+
+// NewSCIMManager returns a new SCIMManager backed by the given DB.
+func NewSCIMManager(db *sql.DB) *SCIMManager {
+	return &SCIMManager{db: db}
+}
+
+const scimUserColumns = `
+	id, scim_user_name, COALESCE(scim_external_id, ''), email, name, is_active, role, created_at, updated_at
+`
+
+func scanSCIMUser(row interface{ Scan(...any) error }) (SCIMUser, error) {
+	var u SCIMUser
+	err := row.Scan(&u.ID, &u.UserName, &u.ExternalID, &u.Email, &u.Name, &u.IsActive, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+// ListUsers returns the provisioned users matching filter, oldest first,
+// skipping offset of them and returning at most limit, and how many match
+// in all.
+func (m *SCIMManager) ListUsers(filter SCIMUserFilter, offset, limit int) ([]SCIMUser, int, error) {
+	where := `
+		WHERE scim_user_name IS NOT NULL
+		  AND ($1 = '' OR LOWER(scim_user_name) = LOWER($1))
+		  AND ($2 = '' OR scim_external_id = $2)
+		  AND ($3 = '' OR LOWER(email) = LOWER($3))
+	`
+	args := []any{filter.UserName, filter.ExternalID, filter.Email}
+
+	var total int
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count SCIM users: %w", err)
+	}
+
+	users := []SCIMUser{}
+	if limit == 0 {
+		return users, total, nil
+	}
+
+	rows, err := m.db.Query(`SELECT `+scimUserColumns+` FROM users`+where+`ORDER BY id OFFSET $4 LIMIT $5`,
+		append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list SCIM users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan SCIM user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list SCIM users: %w", err)
+	}
+
+	if err := m.loadUserGroups(users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetUser returns a provisioned user, or nil if there is none with that ID.
+func (m *SCIMManager) GetUser(id int) (*SCIMUser, error) {
+	u, err := scanSCIMUser(m.db.QueryRow(`SELECT `+scimUserColumns+` FROM users WHERE id = $1 AND scim_user_name IS NOT NULL`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SCIM user: %w", err)
+	}
+
+	users := []SCIMUser{u}
+	if err := m.loadUserGroups(users); err != nil {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// loadUserGroups sets the groups of users.
+func (m *SCIMManager) loadUserGroups(users []SCIMUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+	ids := make([]int, len(users))
+	index := make(map[int]int, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+		index[u.ID] = i
+	}
+
+	rows, err := m.db.Query(`
+		SELECT m.user_id, g.id, g.display_name
+		FROM scim_group_members m
+		INNER JOIN scim_groups g ON g.id = m.group_id
+		WHERE m.user_id = ANY($1)
+		ORDER BY g.display_name
+	`, pq.Array(int64s(ids)))
+	if err != nil {
+		return fmt.Errorf("failed to list groups of SCIM users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		var group SCIMMember
+		if err := rows.Scan(&userID, &group.ID, &group.Display); err != nil {
+			return fmt.Errorf("failed to scan group of SCIM user: %w", err)
+		}
+		users[index[userID]].Groups = append(users[index[userID]].Groups, group)
+	}
+	return rows.Err()
+}
+
+// CreateUser provisions a user, and returns its ID and whether it was
+// created. A user with the same e-mail address who has logged in with OIDC
+// before is linked instead, keeping its role, scope and sessions; local and
+// LDAP accounts are left to their own source and return ErrSCIMConflict.
+// New users get the viewer role and a subject that their first OIDC login
+// replaces.
+func (m *SCIMManager) CreateUser(u SCIMUser) (int, bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	var userName sql.NullString
+	var oidc bool
+	created := false
+	err = tx.QueryRow(`
+		SELECT id, scim_user_name,
+		       sub NOT LIKE 'local:%' AND sub NOT LIKE 'ldap:%' AND password_hash IS NULL
+		FROM users
+		WHERE LOWER(email) = LOWER($1)
+		FOR UPDATE
+	`, u.Email).Scan(&id, &userName, &oidc)
+	switch {
+	case err == sql.ErrNoRows:
+		created = true
+		err = tx.QueryRow(`
+			INSERT INTO users (sub, email, name, picture, is_active, role, scim_user_name, scim_external_id)
+			VALUES ($1, $2, $3, '', $4, $5, $6, NULLIF($7, ''))
+			RETURNING id
+		`, "scim:"+u.UserName, u.Email, u.Name, u.IsActive, RoleViewer, u.UserName, u.ExternalID).Scan(&id)
+	case err != nil:
+		return 0, false, fmt.Errorf("failed to find user by email: %w", err)
+	case userName.Valid, !oidc:
+		return 0, false, ErrSCIMConflict
+	default:
+		_, err = tx.Exec(`
+			UPDATE users
+			SET scim_user_name = $2, scim_external_id = NULLIF($3, ''), name = $4, is_active = $5, updated_at = NOW()
+			WHERE id = $1
+		`, id, u.UserName, u.ExternalID, u.Name, u.IsActive)
+	}
+	if err != nil {
+		return 0, false, scimWriteError("failed to create SCIM user", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, created, nil
+}
+
+// UpdateUser replaces the attributes of a provisioned user, and reports
+// whether it was found.
+func (m *SCIMManager) UpdateUser(u SCIMUser) (bool, error) {
+	result, err := m.db.Exec(`
+		UPDATE users
+		SET scim_user_name = $2, scim_external_id = NULLIF($3, ''), email = $4, name = $5, is_active = $6, updated_at = NOW()
+		WHERE id = $1 AND scim_user_name IS NOT NULL
+	`, u.ID, u.UserName, u.ExternalID, u.Email, u.Name, u.IsActive)
+	if err != nil {
+		return false, scimWriteError("failed to update SCIM user", err)
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// DeleteUser deactivates a provisioned user and unlinks it from SCIM and
+// its groups, and reports whether it was found. The row is kept for the
+// audit log and the user's history.
+func (m *SCIMManager) DeleteUser(id int) (bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET is_active = false, scim_user_name = NULL, scim_external_id = NULL, updated_at = NOW()
+		WHERE id = $1 AND scim_user_name IS NOT NULL
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete SCIM user: %w", err)
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE user_id = $1`, id); err != nil {
+		return false, fmt.Errorf("failed to remove SCIM user from groups: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// UserGroupNames returns the names and external IDs of the groups of a
+// user, to be mapped to a role.
+func (m *SCIMManager) UserGroupNames(userID int) ([]string, error) {
+	rows, err := m.db.Query(`
+		SELECT g.display_name, COALESCE(g.external_id, '')
+		FROM scim_group_members m
+		INNER JOIN scim_groups g ON g.id = m.group_id
+		WHERE m.user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups of SCIM user: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name, externalID string
+		if err := rows.Scan(&name, &externalID); err != nil {
+			return nil, fmt.Errorf("failed to scan group of SCIM user: %w", err)
+		}
+		names = append(names, name)
+		if externalID != "" {
+			names = append(names, externalID)
+		}
+	}
+	return names, rows.Err()
+}
+
+// SetRole sets the role of a provisioned user and returns the previous one,
+// or an empty string if the user is not provisioned.
+func (m *SCIMManager) SetRole(userID int, role string) (string, error) {
+	var previous string
+	err := m.db.QueryRow(`
+		UPDATE users u
+		SET role = $2, updated_at = CASE WHEN old.role = $2 THEN u.updated_at ELSE NOW() END
+		FROM (SELECT role FROM users WHERE id = $1) old
+		WHERE u.id = $1 AND u.scim_user_name IS NOT NULL
+		RETURNING old.role
+	`, userID, role).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to set role of SCIM user: %w", err)
+	}
+	return previous, nil
+}
+
+// Deactivate deactivates a provisioned user, and reports whether it was
+// active.
+func (m *SCIMManager) Deactivate(userID int) (bool, error) {
+	result, err := m.db.Exec(`
+		UPDATE users
+		SET is_active = false, updated_at = NOW()
+		WHERE id = $1 AND scim_user_name IS NOT NULL AND is_active = true
+	`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to deactivate SCIM user: %w", err)
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// ListGroups returns the groups matching filter, by name, skipping offset
+// of them and returning at most limit, and how many match in all.
+func (m *SCIMManager) ListGroups(filter SCIMGroupFilter, offset, limit int) ([]SCIMGroup, int, error) {
+	where := `
+		WHERE ($1 = '' OR display_name = $1)
+		  AND ($2 = '' OR external_id = $2)
+	`
+	args := []any{filter.DisplayName, filter.ExternalID}
+
+	var total int
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM scim_groups`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count SCIM groups: %w", err)
+	}
+
+	groups := []SCIMGroup{}
+	if limit == 0 {
+		return groups, total, nil
+	}
+
+	rows, err := m.db.Query(`
+		SELECT id, display_name, COALESCE(external_id, ''), created_at, updated_at
+		FROM scim_groups`+where+`ORDER BY display_name OFFSET $3 LIMIT $4`,
+		append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list SCIM groups: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g SCIMGroup
+		if err := rows.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan SCIM group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list SCIM groups: %w", err)
+	}
+
+	for i := range groups {
+		members, err := m.groupMembers(groups[i].ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups[i].Members = members
+	}
+	return groups, total, nil
+}
+
+// GetGroup returns a group, or nil if there is none with that ID.
+func (m *SCIMManager) GetGroup(id int) (*SCIMGroup, error) {
+	var g SCIMGroup
+	err := m.db.QueryRow(`
+		SELECT id, display_name, COALESCE(external_id, ''), created_at, updated_at
+		FROM scim_groups WHERE id = $1
+	`, id).Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SCIM group: %w", err)
+	}
+
+	g.Members, err = m.groupMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// groupMembers returns the users in a group.
+func (m *SCIMManager) groupMembers(groupID int) ([]SCIMMember, error) {
+	rows, err := m.db.Query(`
+		SELECT u.id, COALESCE(u.scim_user_name, u.email)
+		FROM scim_group_members m
+		INNER JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY u.id
+	`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members of SCIM group: %w", err)
+	}
+	defer rows.Close()
+
+	var members []SCIMMember
+	for rows.Next() {
+		var member SCIMMember
+		if err := rows.Scan(&member.ID, &member.Display); err != nil {
+			return nil, fmt.Errorf("failed to scan member of SCIM group: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// CreateGroup stores a group with its members and returns its ID. Members
+// that are not provisioned users are ignored.
+func (m *SCIMManager) CreateGroup(displayName, externalID string, memberIDs []int) (int, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO scim_groups (display_name, external_id) VALUES ($1, NULLIF($2, '')) RETURNING id
+	`, displayName, externalID).Scan(&id)
+	if err != nil {
+		return 0, scimWriteError("failed to create SCIM group", err)
+	}
+	if err := addGroupMembers(tx, id, memberIDs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateGroup renames a group and, unless memberIDs is nil, replaces its
+// members. It reports whether the group was found.
+func (m *SCIMManager) UpdateGroup(id int, displayName, externalID string, memberIDs []int) (bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE scim_groups SET display_name = $2, external_id = NULLIF($3, ''), updated_at = NOW() WHERE id = $1
+	`, id, displayName, externalID)
+	if err != nil {
+		return false, scimWriteError("failed to update SCIM group", err)
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		return false, err
+	}
+
+	if memberIDs != nil {
+		if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE group_id = $1`, id); err != nil {
+			return false, fmt.Errorf("failed to remove members of SCIM group: %w", err)
+		}
+		if err := addGroupMembers(tx, id, memberIDs); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// AddMembers adds provisioned users to a group. Users already in it and
+// unknown users are ignored.
+func (m *SCIMManager) AddMembers(groupID int, userIDs []int) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := addGroupMembers(tx, groupID, userIDs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE scim_groups SET updated_at = NOW() WHERE id = $1`, groupID); err != nil {
+		return fmt.Errorf("failed to update SCIM group: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RemoveMembers removes users from a group.
+func (m *SCIMManager) RemoveMembers(groupID int, userIDs []int) error {
+	_, err := m.db.Exec(`DELETE FROM scim_group_members WHERE group_id = $1 AND user_id = ANY($2)`, groupID, pq.Array(int64s(userIDs)))
+	if err != nil {
+		return fmt.Errorf("failed to remove members of SCIM group: %w", err)
+	}
+	if _, err := m.db.Exec(`UPDATE scim_groups SET updated_at = NOW() WHERE id = $1`, groupID); err != nil {
+		return fmt.Errorf("failed to update SCIM group: %w", err)
+	}
+	return nil
+}
+
+// DeleteGroup deletes a group and its memberships, and reports whether it
+// was found.
+func (m *SCIMManager) DeleteGroup(id int) (bool, error) {
+	result, err := m.db.Exec(`DELETE FROM scim_groups WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete SCIM group: %w", err)
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// addGroupMembers adds the provisioned users among userIDs to a group.
+func addGroupMembers(tx *sql.Tx, groupID int, userIDs []int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO scim_group_members (group_id, user_id)
+		SELECT $1::int, id FROM users WHERE id = ANY($2) AND scim_user_name IS NOT NULL
+		ON CONFLICT DO NOTHING
+	`, groupID, pq.Array(int64s(userIDs)))
+	if err != nil {
+		return fmt.Errorf("failed to add members to SCIM group: %w", err)
+	}
+	return nil
+}
+
+// scimWriteError returns ErrSCIMConflict for unique violations, and err
+// wrapped with msg otherwise.
+func scimWriteError(msg string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrSCIMConflict
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// int64s converts IDs for pq.Array.
+func int64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session is a browser session of a signed-in user. Its ID, the value of
+// the session cookie, is never loaded: sessions are told apart by Ref.
+type Session struct {
+	Ref        int64     `json:"ref"`
+	UserID     int       `json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	// Current is true for the session of the request that listed it.
+	Current bool `json:"current"`
+}
+
+// Browser returns a short description of the browser and operating system
+// of the session, such as "Firefox on Linux", from its User-Agent.
+func (s Session) Browser() string {
+	ua := s.UserAgent
+	if ua == "" {
+		return "Unknown browser"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		// Order matters: Edge and Opera also send Chrome, and Chrome also
+		// sends Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			return browser + " on " + o.name
+		}
+	}
+	return browser
+}
+
+// SessionManager lists, extends and ends the sessions of the user_sessions
+// table.
+type SessionManager struct {
+	db *sql.DB
+}
+
+// NewSessionManager returns a new SessionManager backed by the given DB.
+func NewSessionManager(db *sql.DB) *SessionManager {
+	return &SessionManager{db: db}
+}
+
+// ListForUser returns the active sessions of a user, most recently used
+// first. The session with ID currentID is marked as Current.
+func (m *SessionManager) ListForUser(userID int, currentID string) ([]Session, error) {
+	rows, err := m.db.Query(`
+		SELECT ref, user_id, created_at, last_seen_at, expires_at, user_agent, ip_address, id = $2
+		FROM user_sessions
+		WHERE user_id = $1 AND is_active = true AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`, userID, currentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.Ref, &s.UserID, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt,
+			&s.UserAgent, &s.IPAddress, &s.Current); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records a request of a session and pushes its end back by the idle
+// timeout, up to its maximum lifetime. The row is written at most once a
+// minute per session.
+func (m *SessionManager) Touch(sessionID string, idleTimeout time.Duration) error {
+	_, err := m.db.Exec(`
+		UPDATE user_sessions
+		SET last_seen_at = NOW(),
+		    expires_at = LEAST(absolute_expires_at, NOW() + make_interval(secs => $2))
+		WHERE id = $1 AND is_active = true AND last_seen_at < NOW() - INTERVAL '1 minute'
+	`, sessionID, idleTimeout.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+	return nil
+}
+
+// Revoke ends a session of a user and reports whether it existed.
+func (m *SessionManager) Revoke(userID int, ref int64) (bool, error) {
+	result, err := m.db.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND ref = $2`, userID, ref)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeOthers ends every session of a user except the one with ID keepID,
+// and returns how many were ended.
+func (m *SessionManager) RevokeOthers(userID int, keepID string) (int64, error) {
+	result, err := m.db.Exec(`
+		DELETE FROM user_sessions
+		WHERE user_id = $1 AND id <> $2 AND is_active = true
+	`, userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RevokeAll ends every session of a user, and returns how many were ended.
+func (m *SessionManager) RevokeAll(userID int) (int64, error) {
+	result, err := m.db.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND is_active = true`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// PurgeExpired deletes expired and logged out sessions, and returns how many
+// were deleted. Logins waiting for their TOTP code are kept until they
+// expire.
+func (m *SessionManager) PurgeExpired() (int64, error) {
+	result, err := m.db.Exec(`
+		DELETE FROM user_sessions
+		WHERE expires_at <= NOW() OR (is_active = false AND totp_pending = false)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestSessionBrowser(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36", "Chrome on Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36 Edg/130.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.9.1", "curl"},
+		{"SomeBot/1.0", "Unknown browser"},
+		{"", "Unknown browser"},
+	}
+
+	for _, tt := range tests {
+		if got := (Session{UserAgent: tt.userAgent}).Browser(); got != tt.want {
+			t.Errorf("Browser() for %q = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Syslog transport protocols.
+const (
+	SyslogProtocolUDP = "udp"
+	SyslogProtocolTCP = "tcp"
+	SyslogProtocolTLS = "tls"
+)
+
+// Syslog message payload formats.
+const (
+	SyslogFormatCEF  = "cef"
+	SyslogFormatJSON = "json"
+)
+
+// SyslogForwarder is a syslog collector, usually a SIEM, that receives
+// server events.
+type SyslogForwarder struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Address      string    `json:"address"`
+	Protocol     string    `json:"protocol"`
+	Format       string    `json:"format"`
+	Environments []string  `json:"environments"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AcceptsEnvironment reports whether asset events from the given topology
+// environment go to this forwarder. An empty environment list accepts every
+// asset, including assets outside the topology. Names are compared without
+// regard to case.
+func (f SyslogForwarder) AcceptsEnvironment(environment string) bool {
+	if len(f.Environments) == 0 {
+		return true
+	}
+	for _, e := range f.Environments {
+		if strings.EqualFold(e, environment) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSyslogForwarder checks the fields of a forwarder before it is
+// stored.
+func ValidateSyslogForwarder(name, address, protocol, format string) error {
+	if len(strings.TrimSpace(name)) < 3 {
+		return errors.New("name must be at least 3 characters")
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return errors.New("address must be host:port")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return errors.New("address must have a port between 1 and 65535")
+	}
+	switch protocol {
+	case SyslogProtocolUDP, SyslogProtocolTCP, SyslogProtocolTLS:
+	default:
+		return errors.New("protocol must be udp, tcp or tls")
+	}
+	switch format {
+	case SyslogFormatCEF, SyslogFormatJSON:
+	default:
+		return errors.New("format must be cef or json")
+	}
+	return nil
+}
+
+// SyslogForwarderManager stores syslog forwarders.
+type SyslogForwarderManager struct {
+	db *sql.DB
+}
+
+// NewSyslogForwarderManager returns a new SyslogForwarderManager backed by
+// the given DB.
+func NewSyslogForwarderManager(db *sql.DB) *SyslogForwarderManager {
+	return &SyslogForwarderManager{db: db}
+}
+
+// ListForwarders returns every forwarder ordered by name.
+func (sm *SyslogForwarderManager) ListForwarders() ([]SyslogForwarder, error) {
+	rows, err := sm.db.Query(`
+		SELECT id, name, address, protocol, format, environments, is_active, created_at
+		FROM syslog_forwarders
+		ORDER BY name, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var forwarders []SyslogForwarder
+	for rows.Next() {
+		var f SyslogForwarder
+		if err := rows.Scan(&f.ID, &f.Name, &f.Address, &f.Protocol, &f.Format, pq.Array(&f.Environments), &f.IsActive, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		forwarders = append(forwarders, f)
+	}
+
+	return forwarders, rows.Err()
+}
+
+// CreateForwarder stores a new active forwarder.
+func (sm *SyslogForwarderManager) CreateForwarder(name, address, protocol, format string, environments []string) (*SyslogForwarder, error) {
+	if err := ValidateSyslogForwarder(name, address, protocol, format); err != nil {
+		return nil, err
+	}
+	if environments == nil {
+		environments = []string{}
+	}
+
+	f := &SyslogForwarder{
+		Name:         strings.TrimSpace(name),
+		Address:      address,
+		Protocol:     protocol,
+		Format:       format,
+		Environments: environments,
+		IsActive:     true,
+	}
+	err := sm.db.QueryRow(`
+		INSERT INTO syslog_forwarders (name, address, protocol, format, environments)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, f.Name, f.Address, f.Protocol, f.Format, pq.Array(f.Environments)).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetForwarderActive enables or disables a forwarder.
+func (sm *SyslogForwarderManager) SetForwarderActive(id int, active bool) error {
+	_, err := sm.db.Exec(`UPDATE syslog_forwarders SET is_active = $1 WHERE id = $2`, active, id)
+	return err
+}
+
+// DeleteForwarder removes a forwarder.
+func (sm *SyslogForwarderManager) DeleteForwarder(id int) error {
+	_, err := sm.db.Exec(`DELETE FROM syslog_forwarders WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,51 @@
+package models
+
+import "testing"
+
+func TestValidateSyslogForwarder(t *testing.T) {
+	tests := []struct {
+		name     string
+		fName    string
+		address  string
+		protocol string
+		format   string
+		wantErr  bool
+	}{
+		{"valid udp cef", "SIEM", "siem.example.com:514", SyslogProtocolUDP, SyslogFormatCEF, false},
+		{"valid tls json", "SIEM", "10.0.0.5:6514", SyslogProtocolTLS, SyslogFormatJSON, false},
+		{"valid ipv6", "SIEM", "[::1]:514", SyslogProtocolTCP, SyslogFormatCEF, false},
+		{"short name", "ab", "siem:514", SyslogProtocolUDP, SyslogFormatCEF, true},
+		{"missing port", "SIEM", "siem.example.com", SyslogProtocolUDP, SyslogFormatCEF, true},
+		{"missing host", "SIEM", ":514", SyslogProtocolUDP, SyslogFormatCEF, true},
+		{"port out of range", "SIEM", "siem:70000", SyslogProtocolUDP, SyslogFormatCEF, true},
+		{"unknown protocol", "SIEM", "siem:514", "relp", SyslogFormatCEF, true},
+		{"unknown format", "SIEM", "siem:514", SyslogProtocolUDP, "leef", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSyslogForwarder(tt.fName, tt.address, tt.protocol, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSyslogForwarder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyslogForwarderAcceptsEnvironment(t *testing.T) {
+	all := SyslogForwarder{}
+	if !all.AcceptsEnvironment("Production") || !all.AcceptsEnvironment("") {
+		t.Error("forwarder without environments should accept every asset")
+	}
+
+	prod := SyslogForwarder{Environments: []string{"Production", "DR"}}
+	if !prod.AcceptsEnvironment("production") {
+		t.Error("environment names should be compared without regard to case")
+	}
+	if prod.AcceptsEnvironment("Staging") {
+		t.Error("unlisted environment should be rejected")
+	}
+	if prod.AcceptsEnvironment("") {
+		t.Error("assets outside the topology should be rejected by a filtered forwarder")
+	}
+}
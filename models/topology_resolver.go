@@ -1,5 +1,11 @@
 package models
 
+import (
+	"strings"
+
+	"github.com/lib/pq"
+)
+
 // ResolvedTopology holds the result of resolving a hostname against the
 // configured topology patterns.
 type ResolvedTopology struct {
@@ -80,3 +86,71 @@ func (tm *TopologyManager) ResolveHostname(hostname string) (*ResolvedTopology,
 
 	return rt, nil
 }
+
+// topologyJoins resolves the hostname of the assets aliased a like
+// ResolveHostname does, in the query itself: tp holds the values captured by
+// the first matching pattern, or NULLs when none matches, and best_env and
+// best_svc hold the friendly names of the captured values, if any.
+const topologyJoins = `
+LEFT JOIN LATERAL (
+    SELECT COALESCE((regexp_match(a.hostname, compiled_pattern))[env_group_index], '') AS raw_env,
+           COALESCE((regexp_match(a.hostname, compiled_pattern))[svc_group_index], '') AS raw_svc,
+           COALESCE((regexp_match(a.hostname, compiled_pattern))[seq_group_index], '') AS raw_pod
+    FROM topology_patterns
+    WHERE a.hostname ~ compiled_pattern
+    ORDER BY display_order, id
+    LIMIT 1
+) tp ON true
+LEFT JOIN LATERAL (
+    SELECT en.name
+    FROM environment_names en, unnest(string_to_array(en.match_value, '|')) AS part
+    WHERE tp.raw_env <> '' AND tp.raw_env ILIKE '%' || part || '%'
+    ORDER BY length(part) DESC
+    LIMIT 1
+) best_env ON true
+LEFT JOIN LATERAL (
+    SELECT sn.name
+    FROM service_names sn, unnest(string_to_array(sn.match_value, '|')) AS part
+    WHERE tp.raw_svc <> '' AND tp.raw_svc ILIKE '%' || part || '%'
+    ORDER BY length(part) DESC
+    LIMIT 1
+) best_svc ON true
+`
+
+// HostnamesInScope returns the hostnames of the active assets that scope
+// accepts, resolving their topology in a single query.
+func (tm *TopologyManager) HostnamesInScope(scope AccessScope) ([]string, error) {
+	rows, err := tm.db.Query(`
+		SELECT DISTINCT a.hostname
+		FROM assets a`+topologyJoins+`
+		WHERE a.is_active = TRUE
+		  AND tp.raw_env IS NOT NULL
+		  AND (cardinality($1::text[]) = 0 OR lower(best_env.name) = ANY($1) OR lower(NULLIF(tp.raw_env, '')) = ANY($1))
+		  AND (cardinality($2::text[]) = 0 OR lower(best_svc.name) = ANY($2) OR lower(NULLIF(tp.raw_svc, '')) = ANY($2))
+		ORDER BY a.hostname
+	`, pq.Array(lowerAll(scope.Environments)), pq.Array(lowerAll(scope.Services)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accepted := []string{}
+	for rows.Next() {
+		var hostname string
+		if err := rows.Scan(&hostname); err != nil {
+			return nil, err
+		}
+		accepted = append(accepted, hostname)
+	}
+	return accepted, rows.Err()
+}
+
+// lowerAll returns the values lowercased, and an empty slice rather than nil
+// so that it binds as an empty array.
+func lowerAll(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, v := range values {
+		lowered = append(lowered, strings.ToLower(v))
+	}
+	return lowered
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestHostnamesInScope verifies that the scope matches friendly names and raw
+// values without regard to case, and skips inactive assets and assets
+// outside the topology.
+func TestHostnamesInScope(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	cleanupTestData(t, db)
+	defer cleanupTestData(t, db)
+
+	tm := NewTopologyManager(db)
+
+	pattern, err := tm.CreatePattern("test-:env-scope-:svc-node:seq", -1000)
+	if err != nil {
+		t.Fatalf("CreatePattern: %v", err)
+	}
+	defer func() { _ = tm.DeletePattern(pattern.ID) }()
+
+	env, err := tm.CreateEnvironmentName("tstprd", "Test Production")
+	if err != nil {
+		t.Fatalf("CreateEnvironmentName: %v", err)
+	}
+	defer func() { _ = tm.DeleteEnvironmentName(env.ID) }()
+
+	for _, a := range []struct {
+		hostname string
+		active   bool
+	}{
+		{"test-tstprd-scope-billing-node01", true},
+		{"test-tstprd-scope-billing-node02", false},
+		{"test-tstprd-scope-payments-node01", true},
+		{"test-tstdev-scope-billing-node01", true},
+		{"test-outside-topology", true},
+	} {
+		_, err := db.Exec(`
+			INSERT INTO assets (hostname, machine_id, first_seen, last_seen, is_active)
+			VALUES ($1, $1, NOW(), NOW(), $2)
+		`, a.hostname, a.active)
+		if err != nil {
+			t.Fatalf("Failed to create asset %s: %v", a.hostname, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		scope AccessScope
+		want  []string
+	}{
+		{
+			name:  "Friendly environment name",
+			scope: AccessScope{Environments: []string{"test production"}},
+			want:  []string{"test-tstprd-scope-billing-node01", "test-tstprd-scope-payments-node01"},
+		},
+		{
+			name:  "Raw values",
+			scope: AccessScope{Environments: []string{"TSTPRD", "tstdev"}, Services: []string{"Billing"}},
+			want:  []string{"test-tstdev-scope-billing-node01", "test-tstprd-scope-billing-node01"},
+		},
+		{
+			name:  "No match",
+			scope: AccessScope{Services: []string{"test-none"}},
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tm.HostnamesInScope(tt.scope)
+			if err != nil {
+				t.Fatalf("HostnamesInScope: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("HostnamesInScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
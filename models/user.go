@@ -12,10 +12,40 @@ type User struct {
 	Name        string    `json:"name" db:"name"`
 	Picture     string    `json:"picture" db:"picture"`
 	IsActive    bool      `json:"is_active" db:"is_active"`
-	IsAdmin     bool      `json:"is_admin" db:"is_admin"`
+	Role        string    `json:"role" db:"role"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 	LastLoginAt time.Time `json:"last_login_at" db:"last_login_at"`
+
+	// Scope limits the assets the user can see; it is only loaded with the
+	// session and in the admin panel.
+	Scope AccessScope `json:"scope"`
+
+	// Local account state, also only loaded with the session and in the
+	// admin panel. Local users are those created by Txlog, who can set a
+	// password.
+	IsLocal     bool `json:"is_local"`
+	HasPassword bool `json:"has_password"`
+	TOTPEnabled bool `json:"totp_enabled"`
+
+	// ActiveSessions counts the browser sessions of the user; it is only
+	// loaded in the admin panel.
+	ActiveSessions int `json:"active_sessions"`
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Can reports whether the user's role grants permission.
+func (u *User) Can(permission string) bool {
+	return RoleHasPermission(u.Role, permission)
+}
+
+// RoleLabel returns the name of the user's role shown in the admin panel.
+func (u *User) RoleLabel() string {
+	return RoleLabel(u.Role)
 }
 
 // UserSession represents a user session
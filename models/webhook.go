@@ -0,0 +1,379 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook event names.
+const (
+	WebhookEventAssetCreated           = "asset.created"
+	WebhookEventAssetReactivated       = "asset.reactivated"
+	WebhookEventAssetDeactivated       = "asset.deactivated"
+	WebhookEventNeedsRestartingChanged = "asset.needs_restarting_changed"
+	WebhookEventTransactionIngested    = "transaction.ingested"
+	WebhookEventAnomalyDetected        = "anomaly.detected"
+)
+
+// WebhookEvents lists every event a subscription can filter on.
+var WebhookEvents = []string{
+	WebhookEventAssetCreated,
+	WebhookEventAssetReactivated,
+	WebhookEventAssetDeactivated,
+	WebhookEventNeedsRestartingChanged,
+	WebhookEventTransactionIngested,
+	WebhookEventAnomalyDetected,
+}
+
+// IsValidWebhookEvent reports whether event is one of WebhookEvents.
+func IsValidWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// MaxWebhookAttempts is how many times a delivery is tried before it is
+// marked as failed.
+const MaxWebhookAttempts = 8
+
+// WebhookBackoff returns how long to wait before retrying a delivery that
+// has failed attempts times: one minute, doubled on each attempt and capped
+// at one hour.
+func WebhookBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	d := time.Minute
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= time.Hour {
+			return time.Hour
+		}
+	}
+	return d
+}
+
+// WebhookSubscription is an admin-managed endpoint that receives events.
+type WebhookSubscription struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"` // empty means every event
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the subscription listens to event.
+func (s WebhookSubscription) Matches(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one subscription.
+type WebhookDelivery struct {
+	ID               int64           `json:"id"`
+	SubscriptionID   int             `json:"subscription_id"`
+	SubscriptionName string          `json:"subscription_name"`
+	URL              string          `json:"-"`
+	Secret           string          `json:"-"`
+	Event            string          `json:"event"`
+	Payload          json.RawMessage `json:"payload"`
+	Status           string          `json:"status"`
+	Attempts         int             `json:"attempts"`
+	NextAttemptAt    time.Time       `json:"next_attempt_at"`
+	LastStatusCode   int             `json:"last_status_code"`
+	LastError        string          `json:"last_error,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	DeliveredAt      *time.Time      `json:"delivered_at"`
+}
+
+// WebhookEnvelope is the JSON body POSTed to subscribers.
+type WebhookEnvelope struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Envelope wraps the delivery payload for sending. The ID is stable across
+// retries so receivers can discard duplicates.
+func (d WebhookDelivery) Envelope() WebhookEnvelope {
+	return WebhookEnvelope{ID: d.ID, Event: d.Event, CreatedAt: d.CreatedAt, Data: d.Payload}
+}
+
+// WebhookAssetData is the payload of asset.* events.
+type WebhookAssetData struct {
+	MachineID        string    `json:"machine_id"`
+	Hostname         string    `json:"hostname"`
+	OS               string    `json:"os,omitempty"`
+	AgentVersion     string    `json:"agent_version,omitempty"`
+	NeedsRestarting  *bool     `json:"needs_restarting,omitempty"`
+	RestartingReason string    `json:"restarting_reason,omitempty"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// WebhookTransactionData is the payload of transaction.ingested events.
+type WebhookTransactionData struct {
+	TransactionID string     `json:"transaction_id"`
+	MachineID     string     `json:"machine_id"`
+	Hostname      string     `json:"hostname"`
+	BeginTime     *time.Time `json:"begin_time"`
+	EndTime       *time.Time `json:"end_time"`
+	Actions       string     `json:"actions"`
+	User          string     `json:"user"`
+	CommandLine   string     `json:"command_line"`
+	ReturnCode    string     `json:"return_code"`
+	ItemCount     int        `json:"item_count"`
+}
+
+// EnqueueWebhookEvent queues event for every active subscription listening
+// to it. It must run inside the transaction that produced the event, so the
+// event is only delivered if that transaction commits. A savepoint keeps a
+// failure here (e.g. migrations not applied yet) from aborting the caller's
+// transaction; callers should log the error and carry on. When the savepoint
+// itself fails, the transaction is left aborted and the caller's commit
+// fails.
+func EnqueueWebhookEvent(tx *sql.Tx, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("SAVEPOINT webhook_event"); err != nil {
+		return fmt.Errorf("failed to create webhook event savepoint: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event, payload)
+		SELECT id, $1, $2
+		FROM webhook_subscriptions
+		WHERE is_active AND (cardinality(events) = 0 OR $1 = ANY(events))
+	`, event, payload)
+	if err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT webhook_event"); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to roll back to webhook event savepoint: %w", rollbackErr))
+		}
+		return err
+	}
+	if _, err := tx.Exec("RELEASE SAVEPOINT webhook_event"); err != nil {
+		return fmt.Errorf("failed to release webhook event savepoint: %w", err)
+	}
+
+	return nil
+}
+
+// WebhookManager manages webhook subscriptions and their delivery queue.
+type WebhookManager struct {
+	db *sql.DB
+}
+
+// NewWebhookManager returns a new WebhookManager backed by the given DB.
+func NewWebhookManager(db *sql.DB) *WebhookManager {
+	return &WebhookManager{db: db}
+}
+
+// ValidateWebhookSubscription checks the user-provided fields of a
+// subscription.
+func ValidateWebhookSubscription(name, rawURL string, events []string) error {
+	if len(strings.TrimSpace(name)) < 3 {
+		return errors.New("name must be at least 3 characters")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	for _, e := range events {
+		if !IsValidWebhookEvent(e) {
+			return errors.New("unknown event: " + e)
+		}
+	}
+	return nil
+}
+
+// ListSubscriptions returns every subscription ordered by name.
+func (wm *WebhookManager) ListSubscriptions() ([]WebhookSubscription, error) {
+	rows, err := wm.db.Query(`
+		SELECT id, name, url, secret, events, is_active, created_at
+		FROM webhook_subscriptions
+		ORDER BY name, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []WebhookSubscription
+	for rows.Next() {
+		var s WebhookSubscription
+		if err := rows.Scan(&s.ID, &s.Name, &s.URL, &s.Secret, pq.Array(&s.Events), &s.IsActive, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+
+	return subs, rows.Err()
+}
+
+// CreateSubscription stores a new active subscription.
+func (wm *WebhookManager) CreateSubscription(name, rawURL, secret string, events []string) (*WebhookSubscription, error) {
+	if err := ValidateWebhookSubscription(name, rawURL, events); err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []string{}
+	}
+
+	s := &WebhookSubscription{Name: strings.TrimSpace(name), URL: rawURL, Secret: secret, Events: events, IsActive: true}
+	err := wm.db.QueryRow(`
+		INSERT INTO webhook_subscriptions (name, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, s.Name, s.URL, s.Secret, pq.Array(s.Events)).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetSubscriptionActive enables or disables a subscription. Disabled
+// subscriptions receive no new events; deliveries already queued are kept.
+func (wm *WebhookManager) SetSubscriptionActive(id int, active bool) error {
+	_, err := wm.db.Exec(`UPDATE webhook_subscriptions SET is_active = $1 WHERE id = $2`, active, id)
+	return err
+}
+
+// DeleteSubscription removes a subscription and its delivery log.
+func (wm *WebhookManager) DeleteSubscription(id int) error {
+	_, err := wm.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	return err
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.subscription_id, s.name, s.url, s.secret, d.event, d.payload, d.status, d.attempts,
+	d.next_attempt_at, COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''), d.created_at, d.delivered_at`
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload []byte
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(
+			&d.ID, &d.SubscriptionID, &d.SubscriptionName, &d.URL, &d.Secret, &d.Event, &payload, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &deliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// DueDeliveries returns up to limit pending deliveries whose next attempt is
+// due, oldest first. Deliveries of disabled subscriptions wait until the
+// subscription is enabled again.
+func (wm *WebhookManager) DueDeliveries(limit int) ([]WebhookDelivery, error) {
+	rows, err := wm.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = $1 AND d.next_attempt_at <= NOW() AND s.is_active
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT $2
+	`, WebhookDeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// ListDeliveries returns the most recent deliveries for the delivery log.
+func (wm *WebhookManager) ListDeliveries(limit int) ([]WebhookDelivery, error) {
+	rows, err := wm.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// MarkDelivered records a successful attempt.
+func (wm *WebhookManager) MarkDelivered(id int64, statusCode int) error {
+	_, err := wm.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $3
+	`, WebhookDeliverySucceeded, statusCode, id)
+	return err
+}
+
+// MarkAttemptFailed records a failed attempt and schedules the next one
+// with WebhookBackoff. After MaxWebhookAttempts the delivery is marked as
+// failed. statusCode is 0 when no HTTP response was received.
+func (wm *WebhookManager) MarkAttemptFailed(d WebhookDelivery, statusCode int, deliveryErr error) error {
+	attempts := d.Attempts + 1
+	status := WebhookDeliveryPending
+	if attempts >= MaxWebhookAttempts {
+		status = WebhookDeliveryFailed
+	}
+
+	var code sql.NullInt64
+	if statusCode > 0 {
+		code = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+	}
+
+	_, err := wm.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5
+		WHERE id = $6
+	`, status, attempts, code, deliveryErr.Error(), time.Now().Add(WebhookBackoff(attempts)), d.ID)
+	return err
+}
+
+// RetryDelivery puts a failed delivery back in the queue for an immediate
+// attempt, with a fresh attempt budget.
+func (wm *WebhookManager) RetryDelivery(id int64) error {
+	_, err := wm.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, WebhookDeliveryPending, id, WebhookDeliveryFailed)
+	return err
+}
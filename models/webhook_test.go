@@ -0,0 +1,113 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{0, 0},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{MaxWebhookAttempts, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := WebhookBackoff(tt.attempts); got != tt.expected {
+			t.Errorf("WebhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestWebhookSubscriptionMatches(t *testing.T) {
+	all := WebhookSubscription{}
+	for _, e := range WebhookEvents {
+		if !all.Matches(e) {
+			t.Errorf("subscription without filter should match %q", e)
+		}
+	}
+
+	assets := WebhookSubscription{Events: []string{WebhookEventAssetCreated, WebhookEventAssetDeactivated}}
+	if !assets.Matches(WebhookEventAssetDeactivated) {
+		t.Error("filtered subscription should match a listed event")
+	}
+	if assets.Matches(WebhookEventTransactionIngested) {
+		t.Error("filtered subscription should not match an unlisted event")
+	}
+}
+
+func TestValidateWebhookSubscription(t *testing.T) {
+	tests := []struct {
+		name    string
+		subName string
+		url     string
+		events  []string
+		wantErr bool
+	}{
+		{"valid", "CMDB sync", "https://hooks.example.com/txlog", []string{WebhookEventAssetCreated}, false},
+		{"all events", "CMDB sync", "http://10.0.0.5:8080/hook", nil, false},
+		{"short name", "ab", "https://hooks.example.com", nil, true},
+		{"relative url", "CMDB sync", "/hook", nil, true},
+		{"unsupported scheme", "CMDB sync", "ftp://hooks.example.com", nil, true},
+		{"unknown event", "CMDB sync", "https://hooks.example.com", []string{"policy.violation"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWebhookSubscription(tt.subName, tt.url, tt.events)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWebhookSubscription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransactionAnomalies(t *testing.T) {
+	begin := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	items := func(n int, action string) []TransactionItem {
+		list := make([]TransactionItem, n)
+		for i := range list {
+			list[i] = TransactionItem{Action: action, Name: "pkg", Version: "1.0"}
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		items    []TransactionItem
+		expected []AnomalyType
+		severity AnomalySeverity
+	}{
+		{"small upgrade", items(3, "Upgrade"), nil, ""},
+		{"at threshold", items(HighVolumeThreshold, "Upgrade"), nil, ""},
+		{"high volume", items(HighVolumeThreshold+1, "Upgrade"), []AnomalyType{AnomalyHighVolume}, SeverityMedium},
+		{"very high volume", items(HighVolumeHighThreshold+1, "Install"), []AnomalyType{AnomalyHighVolume}, SeverityHigh},
+		{"downgrade", []TransactionItem{{Action: "Downgrade", Name: "Change openssl", Version: "3.0.1"}}, []AnomalyType{AnomalyDowngrade}, SeverityLow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TransactionAnomalies(Transaction{TransactionID: "7", MachineID: "m1", Hostname: "web01", BeginTime: &begin, Items: tt.items})
+			if len(got) != len(tt.expected) {
+				t.Fatalf("TransactionAnomalies() returned %d anomalies, want %d: %+v", len(got), len(tt.expected), got)
+			}
+			for i, a := range got {
+				if a.Type != tt.expected[i] || a.Severity != tt.severity || a.MachineID != "m1" || !a.DetectedAt.Equal(begin) {
+					t.Errorf("anomaly %d = %+v", i, a)
+				}
+			}
+		})
+	}
+
+	got := TransactionAnomalies(Transaction{Items: []TransactionItem{{Action: "Downgrade", Name: "Change openssl", Version: "3.0.1"}}})
+	if d, ok := got[0].Details.(DowngradeDetails); !ok || d.Package != "openssl" {
+		t.Errorf("downgrade details = %+v, want package openssl", got[0].Details)
+	}
+}
@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/txlog/server/models"
+)
+
+//go:embed templates/*
+var digestTemplateFS embed.FS
+
+var digestFuncs = map[string]any{
+	"sub": func(a, b int) int { return a - b },
+}
+
+var (
+	digestTextTemplate = template.Must(template.New("digest.txt").Funcs(digestFuncs).ParseFS(digestTemplateFS, "templates/digest.txt"))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(digestFuncs).ParseFS(digestTemplateFS, "templates/digest.html"))
+)
+
+// digestView is the data passed to the digest templates.
+type digestView struct {
+	models.Digest
+	Title   string
+	BaseURL string
+}
+
+// PublicURL returns PUBLIC_URL, the address users reach the server at,
+// without a trailing slash. It is used for links in e-mails and is empty
+// when not configured.
+func PublicURL() string {
+	return strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+}
+
+// RenderDigestEmail returns the subject and the plain-text and HTML bodies
+// of a digest e-mail. baseURL prefixes links back to the web interface;
+// links are left out when it is empty.
+func RenderDigestEmail(d models.Digest, baseURL string) (string, string, string, error) {
+	name := "Daily digest"
+	if d.Frequency == models.DigestWeekly {
+		name = "Weekly digest"
+	}
+
+	var counts []string
+	if d.Has(models.DigestSectionRestart) && d.RestartTotal > 0 {
+		counts = append(counts, plural(d.RestartTotal, "asset to restart", "assets to restart"))
+	}
+	if d.Has(models.DigestSectionFailedExecutions) && d.FailedTotal > 0 {
+		counts = append(counts, plural(d.FailedTotal, "failed execution", "failed executions"))
+	}
+	if d.Has(models.DigestSectionVulnerabilities) && d.VulnerabilityTotal > 0 {
+		counts = append(counts, plural(d.VulnerabilityTotal, "new critical vulnerability", "new critical vulnerabilities"))
+	}
+	if d.Has(models.DigestSectionAnomalies) && d.AnomalyTotal > 0 {
+		counts = append(counts, plural(d.AnomalyTotal, "anomaly", "anomalies"))
+	}
+	subject := "[Txlog] " + name
+	if len(counts) > 0 {
+		subject += ": " + strings.Join(counts, ", ")
+	}
+
+	view := digestView{Digest: d, Title: "Txlog " + strings.ToLower(name), BaseURL: strings.TrimRight(baseURL, "/")}
+
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, view); err != nil {
+		return "", "", "", err
+	}
+	if err := digestHTMLTemplate.Execute(&html, view); err != nil {
+		return "", "", "", err
+	}
+	return subject, text.String(), html.String(), nil
+}
+
+// SendDigest renders the digest and mails it to one recipient.
+func SendDigest(cfg SMTPConfig, to string, d models.Digest, baseURL string) error {
+	subject, text, html, err := RenderDigestEmail(d, baseURL)
+	if err != nil {
+		return err
+	}
+	return cfg.SendHTML([]string{to}, subject, text, html)
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, pluralForm)
+}
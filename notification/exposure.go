@@ -0,0 +1,178 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/util"
+)
+
+// Exposure channel names, stored in exposure_notifications.channel.
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// DefaultExposureMinSeverity is the threshold used when a channel does not
+// set one.
+const DefaultExposureMinSeverity = "CRITICAL"
+
+// ExposureChannel delivers new exposure events.
+type ExposureChannel interface {
+	// Name identifies the channel in exposure_notifications.
+	Name() string
+	// Accepts reports whether events of the given severity go to this channel.
+	Accepts(severity string) bool
+	// SendExposure delivers one event.
+	SendExposure(ctx context.Context, event models.ExposureEvent) error
+}
+
+// WebhookExposureChannel POSTs each event as JSON to a URL, signed like
+// subscription deliveries when Secret is set.
+type WebhookExposureChannel struct {
+	URL         string
+	Secret      string
+	MinSeverity string
+}
+
+// Name implements ExposureChannel.
+func (w *WebhookExposureChannel) Name() string { return ChannelWebhook }
+
+// Accepts implements ExposureChannel.
+func (w *WebhookExposureChannel) Accepts(severity string) bool {
+	return util.SeverityRank(severity) >= util.SeverityRank(w.MinSeverity)
+}
+
+// SendExposure implements ExposureChannel.
+func (w *WebhookExposureChannel) SendExposure(ctx context.Context, event models.ExposureEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{HeaderWebhookEvent: event.Event}
+	if w.Secret != "" {
+		ts := time.Now().Unix()
+		headers[HeaderWebhookTimestamp] = strconv.FormatInt(ts, 10)
+		headers[HeaderWebhookSignature] = SignWebhook(w.Secret, ts, body)
+	}
+	_, err = postBody(ctx, w.URL, body, headers)
+	return err
+}
+
+// EmailExposureChannel mails each event to a fixed list of recipients.
+type EmailExposureChannel struct {
+	SMTP        SMTPConfig
+	To          []string
+	MinSeverity string
+}
+
+// Name implements ExposureChannel.
+func (e *EmailExposureChannel) Name() string { return ChannelEmail }
+
+// Accepts implements ExposureChannel.
+func (e *EmailExposureChannel) Accepts(severity string) bool {
+	return util.SeverityRank(severity) >= util.SeverityRank(e.MinSeverity)
+}
+
+// SendExposure implements ExposureChannel.
+func (e *EmailExposureChannel) SendExposure(ctx context.Context, event models.ExposureEvent) error {
+	subject, body, err := RenderExposureEmail(event)
+	if err != nil {
+		return err
+	}
+	return e.SMTP.Send(e.To, subject, body)
+}
+
+// ExposureChannelsFromEnv builds the configured exposure channels:
+//   - webhook when EXPOSURE_WEBHOOK_URL is set, filtered by
+//     EXPOSURE_WEBHOOK_MIN_SEVERITY and signed with EXPOSURE_WEBHOOK_SECRET
+//   - email when EXPOSURE_EMAIL_TO and the SMTP_* settings are set, filtered
+//     by EXPOSURE_EMAIL_MIN_SEVERITY
+//
+// Thresholds default to CRITICAL. Configuration problems are returned as
+// warnings so the caller can log them; the affected channel is skipped.
+func ExposureChannelsFromEnv() ([]ExposureChannel, []string) {
+	var channels []ExposureChannel
+	var warnings []string
+
+	minSeverity := func(name string) string {
+		v := strings.ToUpper(strings.TrimSpace(os.Getenv(name)))
+		if v == "" {
+			return DefaultExposureMinSeverity
+		}
+		if !util.IsValidSeverity(v) {
+			warnings = append(warnings, fmt.Sprintf("%s has invalid value %q, using %s", name, v, DefaultExposureMinSeverity))
+			return DefaultExposureMinSeverity
+		}
+		return v
+	}
+
+	if url := os.Getenv("EXPOSURE_WEBHOOK_URL"); url != "" {
+		channels = append(channels, &WebhookExposureChannel{
+			URL:         url,
+			Secret:      os.Getenv("EXPOSURE_WEBHOOK_SECRET"),
+			MinSeverity: minSeverity("EXPOSURE_WEBHOOK_MIN_SEVERITY"),
+		})
+	}
+
+	if to := ParseAddressList(os.Getenv("EXPOSURE_EMAIL_TO")); len(to) > 0 {
+		cfg, ok := SMTPConfigFromEnv()
+		if !ok {
+			warnings = append(warnings, "EXPOSURE_EMAIL_TO is set but SMTP_HOST or SMTP_FROM is missing; e-mail notifications are disabled")
+		} else {
+			channels = append(channels, &EmailExposureChannel{
+				SMTP:        cfg,
+				To:          to,
+				MinSeverity: minSeverity("EXPOSURE_EMAIL_MIN_SEVERITY"),
+			})
+		}
+	}
+
+	return channels, warnings
+}
+
+var exposureEmailTemplate = template.Must(template.New("exposure").Parse(`A vulnerability newly affects packages installed on your fleet.
+
+Vulnerability: {{ .VulnerabilityID }}
+Severity:      {{ .Severity }}{{ if gt .CVSSScore 0.0 }} (CVSS {{ printf "%.1f" .CVSSScore }}){{ end }}
+{{- if .PublishedAt }}
+Published:     {{ .PublishedAt.Format "2006-01-02" }}{{ end }}
+{{- if .Summary }}
+Summary:       {{ .Summary }}{{ end }}
+Details:       https://osv.dev/vulnerability/{{ .VulnerabilityID }}
+
+Affected packages:
+{{- range .Packages }}
+  - {{ . }}{{ end }}
+
+Affected assets ({{ len .Assets }}):
+{{- range .Assets }}
+  - {{ .Hostname }} ({{ .MachineID }}): {{ range $i, $p := .Packages }}{{ if $i }}, {{ end }}{{ $p }}{{ end }}{{ end }}
+
+Detected at {{ .DetectedAt.Format "2006-01-02 15:04 MST" }} by Txlog Server.
+`))
+
+// RenderExposureEmail returns the subject and plain-text body of the e-mail
+// announcing an exposure event.
+func RenderExposureEmail(event models.ExposureEvent) (string, string, error) {
+	plural := "s"
+	if len(event.Assets) == 1 {
+		plural = ""
+	}
+	subject := fmt.Sprintf("[Txlog] %s %s affects %d asset%s", event.Severity, event.VulnerabilityID, len(event.Assets), plural)
+
+	var body bytes.Buffer
+	if err := exposureEmailTemplate.Execute(&body, event); err != nil {
+		return "", "", err
+	}
+	return subject, body.String(), nil
+}
@@ -0,0 +1,513 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/txlog/server/models"
+)
+
+func sampleEvent() models.ExposureEvent {
+	published := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	return models.ExposureEvent{
+		Event:           models.ExposureEventName,
+		VulnerabilityID: "CVE-2026-1234",
+		Severity:        "CRITICAL",
+		CVSSScore:       9.8,
+		Summary:         "Remote code execution in openssl",
+		PublishedAt:     &published,
+		Packages:        []string{"openssl-3.0.7-27.el9"},
+		Assets: []models.ExposedAsset{
+			{MachineID: "m1", Hostname: "web01", Packages: []string{"openssl-3.0.7-27.el9"}},
+			{MachineID: "m2", Hostname: "web02", Packages: []string{"openssl-3.0.7-27.el9"}},
+		},
+		DetectedAt: time.Date(2026, 10, 18, 4, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestChannelAccepts(t *testing.T) {
+	tests := []struct {
+		minSeverity string
+		severity    string
+		expected    bool
+	}{
+		{"CRITICAL", "CRITICAL", true},
+		{"CRITICAL", "HIGH", false},
+		{"HIGH", "CRITICAL", true},
+		{"HIGH", "high", true},
+		{"MEDIUM", "LOW", false},
+		{"LOW", "UNKNOWN", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.minSeverity+"/"+tt.severity, func(t *testing.T) {
+			w := &WebhookExposureChannel{MinSeverity: tt.minSeverity}
+			e := &EmailExposureChannel{MinSeverity: tt.minSeverity}
+			if got := w.Accepts(tt.severity); got != tt.expected {
+				t.Errorf("webhook Accepts(%q) = %v, want %v", tt.severity, got, tt.expected)
+			}
+			if got := e.Accepts(tt.severity); got != tt.expected {
+				t.Errorf("email Accepts(%q) = %v, want %v", tt.severity, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExposureChannelsFromEnv(t *testing.T) {
+	t.Run("nothing configured", func(t *testing.T) {
+		t.Setenv("EXPOSURE_WEBHOOK_URL", "")
+		t.Setenv("EXPOSURE_EMAIL_TO", "")
+		channels, warnings := ExposureChannelsFromEnv()
+		if len(channels) != 0 || len(warnings) != 0 {
+			t.Errorf("got %d channels and %v, want none", len(channels), warnings)
+		}
+	})
+
+	t.Run("webhook and email", func(t *testing.T) {
+		t.Setenv("EXPOSURE_WEBHOOK_URL", "https://hooks.example.com/txlog")
+		t.Setenv("EXPOSURE_WEBHOOK_MIN_SEVERITY", "high")
+		t.Setenv("EXPOSURE_WEBHOOK_SECRET", "whsec_test")
+		t.Setenv("EXPOSURE_EMAIL_TO", "oncall@example.com, secops@example.com")
+		t.Setenv("EXPOSURE_EMAIL_MIN_SEVERITY", "")
+		t.Setenv("SMTP_HOST", "smtp.example.com")
+		t.Setenv("SMTP_FROM", "txlog@example.com")
+		t.Setenv("SMTP_PORT", "")
+		t.Setenv("SMTP_TLS", "")
+
+		channels, warnings := ExposureChannelsFromEnv()
+		if len(warnings) != 0 {
+			t.Fatalf("unexpected warnings: %v", warnings)
+		}
+		if len(channels) != 2 {
+			t.Fatalf("got %d channels, want 2", len(channels))
+		}
+		webhook := channels[0].(*WebhookExposureChannel)
+		if webhook.MinSeverity != "HIGH" || webhook.Secret != "whsec_test" {
+			t.Errorf("webhook = %+v, want HIGH signed with whsec_test", webhook)
+		}
+		email := channels[1].(*EmailExposureChannel)
+		if email.MinSeverity != DefaultExposureMinSeverity || len(email.To) != 2 {
+			t.Errorf("email channel = %+v", email)
+		}
+		if email.SMTP.Port != "587" || email.SMTP.TLSMode != SMTPTLSStartTLS {
+			t.Errorf("SMTP defaults = %s/%s, want 587/starttls", email.SMTP.Port, email.SMTP.TLSMode)
+		}
+	})
+
+	t.Run("invalid threshold and missing SMTP", func(t *testing.T) {
+		t.Setenv("EXPOSURE_WEBHOOK_URL", "https://hooks.example.com/txlog")
+		t.Setenv("EXPOSURE_WEBHOOK_MIN_SEVERITY", "IMPORTANT")
+		t.Setenv("EXPOSURE_EMAIL_TO", "oncall@example.com")
+		t.Setenv("SMTP_HOST", "")
+
+		channels, warnings := ExposureChannelsFromEnv()
+		if len(channels) != 1 || len(warnings) != 2 {
+			t.Fatalf("got %d channels and warnings %v, want 1 channel and 2 warnings", len(channels), warnings)
+		}
+		if channels[0].(*WebhookExposureChannel).MinSeverity != DefaultExposureMinSeverity {
+			t.Error("invalid threshold should fall back to the default")
+		}
+	})
+}
+
+func TestWebhookSendExposure(t *testing.T) {
+	var got models.ExposureEvent
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ch := &WebhookExposureChannel{URL: server.URL, MinSeverity: "CRITICAL"}
+	if err := ch.SendExposure(context.Background(), sampleEvent()); err != nil {
+		t.Fatalf("SendExposure() error = %v", err)
+	}
+	if header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", header.Get("Content-Type"))
+	}
+	if got.VulnerabilityID != "CVE-2026-1234" || len(got.Assets) != 2 || got.Event != models.ExposureEventName {
+		t.Errorf("received payload = %+v", got)
+	}
+	if header.Get(HeaderWebhookEvent) != models.ExposureEventName || header.Get(HeaderWebhookSignature) != "" {
+		t.Errorf("headers without a secret = %v", header)
+	}
+
+	ch.Secret = "whsec_test"
+	if err := ch.SendExposure(context.Background(), sampleEvent()); err != nil {
+		t.Fatalf("SendExposure() error = %v", err)
+	}
+	ts, err := strconv.ParseInt(header.Get(HeaderWebhookTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid %s header: %v", HeaderWebhookTimestamp, err)
+	}
+	if want := SignWebhook("whsec_test", ts, body); header.Get(HeaderWebhookSignature) != want {
+		t.Errorf("signature = %q, want %q", header.Get(HeaderWebhookSignature), want)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	ch.URL = failing.URL
+	if err := ch.SendExposure(context.Background(), sampleEvent()); err == nil {
+		t.Error("SendExposure() to a failing endpoint should return an error")
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// Reference value: printf '1760000000.{"a":1}' | openssl dgst -sha256 -hmac whsec_test
+	got := SignWebhook("whsec_test", 1760000000, []byte(`{"a":1}`))
+	want := "sha256=f495e119a46eb6023c06ab057f70eee20b42a99ccba7a692b6af681055bfadd9"
+	if got != want {
+		t.Fatalf("SignWebhook() = %q, want %q", got, want)
+	}
+	if got == SignWebhook("whsec_other", 1760000000, []byte(`{"a":1}`)) {
+		t.Error("SignWebhook() should depend on the secret")
+	}
+	if got == SignWebhook("whsec_test", 1760000001, []byte(`{"a":1}`)) {
+		t.Error("SignWebhook() should depend on the timestamp")
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	d := models.WebhookDelivery{
+		ID:        42,
+		URL:       server.URL,
+		Secret:    "whsec_test",
+		Event:     models.WebhookEventAssetCreated,
+		Payload:   json.RawMessage(`{"machine_id":"m1","hostname":"web01"}`),
+		CreatedAt: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+	}
+
+	code, err := DeliverWebhook(context.Background(), d)
+	if err != nil || code != http.StatusAccepted {
+		t.Fatalf("DeliverWebhook() = %d, %v; want 202, nil", code, err)
+	}
+
+	if header.Get(HeaderWebhookEvent) != models.WebhookEventAssetCreated || header.Get(HeaderWebhookDelivery) != "42" {
+		t.Errorf("event headers = %q, %q", header.Get(HeaderWebhookEvent), header.Get(HeaderWebhookDelivery))
+	}
+	ts, err := strconv.ParseInt(header.Get(HeaderWebhookTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid %s header: %v", HeaderWebhookTimestamp, err)
+	}
+	if want := SignWebhook("whsec_test", ts, body); header.Get(HeaderWebhookSignature) != want {
+		t.Errorf("signature = %q, want %q", header.Get(HeaderWebhookSignature), want)
+	}
+
+	var envelope models.WebhookEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if envelope.ID != 42 || envelope.Event != models.WebhookEventAssetCreated || !strings.Contains(string(envelope.Data), `"web01"`) {
+		t.Errorf("envelope = %+v", envelope)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	d.URL = failing.URL
+	if code, err := DeliverWebhook(context.Background(), d); err == nil || code != http.StatusServiceUnavailable {
+		t.Errorf("DeliverWebhook() to a failing endpoint = %d, %v; want 503 and an error", code, err)
+	}
+}
+
+func TestRenderExposureEmail(t *testing.T) {
+	subject, body, err := RenderExposureEmail(sampleEvent())
+	if err != nil {
+		t.Fatalf("RenderExposureEmail() error = %v", err)
+	}
+	if subject != "[Txlog] CRITICAL CVE-2026-1234 affects 2 assets" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{
+		"Severity:      CRITICAL (CVSS 9.8)",
+		"Published:     2026-10-17",
+		"Summary:       Remote code execution in openssl",
+		"  - openssl-3.0.7-27.el9",
+		"Affected assets (2):",
+		"  - web01 (m1): openssl-3.0.7-27.el9",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+// fakeSMTPServer is a minimal SMTP server that records the messages it
+// receives. It supports no extensions, so it is used with SMTPTLSNone.
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	rcpts    []string
+	messages []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSMTPServer{listener: l}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) addr() (string, string) {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host, port
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailSendExposure(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port := server.addr()
+
+	ch := &EmailExposureChannel{
+		SMTP:        SMTPConfig{Host: host, Port: port, From: "txlog@example.com", TLSMode: SMTPTLSNone},
+		To:          []string{"oncall@example.com", "secops@example.com"},
+		MinSeverity: "CRITICAL",
+	}
+	if err := ch.SendExposure(context.Background(), sampleEvent()); err != nil {
+		t.Fatalf("SendExposure() error = %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.rcpts) != 2 || len(server.messages) != 1 {
+		t.Fatalf("server got %d recipients and %d messages, want 2 and 1", len(server.rcpts), len(server.messages))
+	}
+	msg := server.messages[0]
+	for _, want := range []string{
+		"From: txlog@example.com\r\n",
+		"To: oncall@example.com, secops@example.com\r\n",
+		"Subject: [Txlog] CRITICAL CVE-2026-1234 affects 2 assets\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"Vulnerability: CVE-2026-1234\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPSendRequiresStartTLS(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port := server.addr()
+
+	cfg := SMTPConfig{Host: host, Port: port, From: "txlog@example.com", TLSMode: SMTPTLSStartTLS}
+	if err := cfg.Send([]string{"oncall@example.com"}, "test", "body"); err == nil {
+		t.Error("Send() should refuse to continue when the server does not offer STARTTLS")
+	}
+}
+
+func sampleDigest() models.Digest {
+	until := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	published := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	return models.Digest{
+		Frequency: models.DigestDaily,
+		Since:     until.Add(-24 * time.Hour),
+		Until:     until,
+		AssetsRequiringRestart: []models.DigestRestartAsset{
+			{MachineID: "m1", Hostname: "web01", Reason: "Updated kernel"},
+		},
+		RestartTotal: 3,
+		FailedExecutions: []models.DigestFailedExecution{
+			{ID: 42, MachineID: "m2", Hostname: "db01", ExecutedAt: until.Add(-time.Hour), Details: "dnf history failed"},
+		},
+		FailedTotal: 1,
+		Vulnerabilities: []models.DigestVulnerability{
+			{ID: "CVE-2026-1234", Summary: "Remote code execution in openssl", CVSSScore: 9.8, PublishedAt: &published, AssetCount: 2},
+		},
+		VulnerabilityTotal: 1,
+	}
+}
+
+func TestRenderDigestEmail(t *testing.T) {
+	subject, text, html, err := RenderDigestEmail(sampleDigest(), "https://txlog.example.com/")
+	if err != nil {
+		t.Fatalf("RenderDigestEmail() error = %v", err)
+	}
+	if subject != "[Txlog] Daily digest: 3 assets to restart, 1 failed execution, 1 new critical vulnerability" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{
+		"ASSETS REQUIRING RESTART (3)",
+		"  - web01: Updated kernel",
+		"    https://txlog.example.com/assets/m1",
+		"  ... and 2 more.",
+		"  - 2026-10-18 06:00 db01: dnf history failed",
+		"    https://txlog.example.com/executions/42",
+		"  - CVE-2026-1234 (CVSS 9.8), 2 asset(s): Remote code execution in openssl",
+		"ANOMALIES (0)\n  None.",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text body does not contain %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{
+		`<a href="https://txlog.example.com/assets/m1"`,
+		`<a href="https://osv.dev/vulnerability/CVE-2026-1234"`,
+		"CVSS 9.8",
+		`<a href="https://txlog.example.com/settings/notifications"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML body does not contain %q", want)
+		}
+	}
+
+	// Sections left out of the subscription are not rendered, and links are
+	// dropped when no base URL is configured.
+	d := sampleDigest().WithSections([]string{models.DigestSectionVulnerabilities})
+	subject, text, _, err = RenderDigestEmail(d, "")
+	if err != nil {
+		t.Fatalf("RenderDigestEmail() error = %v", err)
+	}
+	if subject != "[Txlog] Daily digest: 1 new critical vulnerability" {
+		t.Errorf("subject = %q", subject)
+	}
+	if strings.Contains(text, "ASSETS REQUIRING RESTART") || strings.Contains(text, "/settings/notifications") {
+		t.Errorf("text body should only contain the vulnerabilities section:\n%s", text)
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port := server.addr()
+
+	cfg := SMTPConfig{Host: host, Port: port, From: "txlog@example.com", TLSMode: SMTPTLSNone}
+	if err := SendDigest(cfg, "alice@example.com", sampleDigest(), ""); err != nil {
+		t.Fatalf("SendDigest() error = %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.messages) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(server.messages))
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(server.messages[0]))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if to := msg.Header.Get("To"); to != "alice@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	var types []string
+	var html string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(part)
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			// multipart.Reader decodes quoted-printable parts transparently
+			html = string(body)
+		}
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("parts = %v, want text/plain then text/html", types)
+	}
+	if !strings.Contains(html, "Assets requiring restart (3)") {
+		t.Errorf("HTML part was not decoded correctly:\n%s", html)
+	}
+}
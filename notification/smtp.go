@@ -0,0 +1,232 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTP connection security modes.
+const (
+	SMTPTLSStartTLS = "starttls" // plain connection upgraded with STARTTLS (default)
+	SMTPTLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	SMTPTLSNone     = "none"     // no encryption; only for local relays
+)
+
+// smtpTimeout bounds dialing and the whole SMTP conversation.
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig holds the outgoing mail server settings.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	TLSMode  string
+}
+
+// SMTPConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD,
+// SMTP_FROM and SMTP_TLS. It returns false when SMTP_HOST or SMTP_FROM is
+// not set.
+func SMTPConfigFromEnv() (SMTPConfig, bool) {
+	cfg := SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		TLSMode:  strings.ToLower(os.Getenv("SMTP_TLS")),
+	}
+	if cfg.Host == "" || cfg.From == "" {
+		return cfg, false
+	}
+	if cfg.TLSMode == "" {
+		cfg.TLSMode = SMTPTLSStartTLS
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+		if cfg.TLSMode == SMTPTLSImplicit {
+			cfg.Port = "465"
+		}
+	}
+	return cfg, true
+}
+
+// Send delivers a plain-text message to the given recipients.
+func (cfg SMTPConfig) Send(to []string, subject, body string) error {
+	return cfg.deliver(to, buildMessage(cfg.From, to, subject, body, time.Now()))
+}
+
+// SendHTML delivers a message with alternative plain-text and HTML bodies
+// to the given recipients.
+func (cfg SMTPConfig) SendHTML(to []string, subject, textBody, htmlBody string) error {
+	msg, err := buildAlternativeMessage(cfg.From, to, subject, textBody, htmlBody, time.Now())
+	if err != nil {
+		return err
+	}
+	return cfg.deliver(to, msg)
+}
+
+// deliver runs the SMTP conversation that sends an already rendered message.
+func (cfg SMTPConfig) deliver(to []string, msg []byte) error {
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	switch cfg.TLSMode {
+	case SMTPTLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	case SMTPTLSStartTLS, SMTPTLSNone:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("invalid SMTP_TLS mode %q", cfg.TLSMode)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if cfg.TLSMode == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// writeHeaders writes the headers shared by every message.
+func writeHeaders(b *bytes.Buffer, from string, to []string, subject string, date time.Time) {
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+}
+
+// writeCRLF writes text with its line endings converted to CRLF.
+func writeCRLF(w io.Writer, text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, line := range strings.Split(text, "\n") {
+		// Dot-stuffing is handled by net/smtp's data writer.
+		io.WriteString(w, line+"\r\n")
+	}
+}
+
+// buildMessage renders an RFC 5322 plain-text message with CRLF line endings.
+func buildMessage(from string, to []string, subject, body string, date time.Time) []byte {
+	var b bytes.Buffer
+	writeHeaders(&b, from, to, subject, date)
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	writeCRLF(&b, body)
+	return b.Bytes()
+}
+
+// buildAlternativeMessage renders a multipart/alternative message with a
+// plain-text part followed by an HTML part. The HTML part is
+// quoted-printable encoded so long lines stay within SMTP limits.
+func buildAlternativeMessage(from string, to []string, subject, textBody, htmlBody string, date time.Time) ([]byte, error) {
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+
+	textPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"8bit"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeCRLF(textPart, textBody)
+
+	htmlPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(htmlPart)
+	if _, err := io.WriteString(qp, htmlBody); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	writeHeaders(&b, from, to, subject, date)
+	b.WriteString("Content-Type: multipart/alternative; boundary=\"" + mw.Boundary() + "\"\r\n")
+	b.WriteString("\r\n")
+	b.Write(parts.Bytes())
+	return b.Bytes(), nil
+}
+
+// ParseAddressList splits a comma-separated list of e-mail addresses,
+// dropping blanks.
+func ParseAddressList(list string) []string {
+	var addrs []string
+	for _, a := range strings.Split(list, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
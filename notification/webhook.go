@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/version"
+)
+
+// WebhookTimeout bounds a single webhook delivery.
+const WebhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: WebhookTimeout}
+
+// postBody POSTs an already encoded JSON body and returns the HTTP status
+// code, which is 0 when no response was received. It fails on any non-2xx
+// answer; extra headers are added as given.
+func postBody(ctx context.Context, url string, body []byte, headers map[string]string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "txlog-server/"+version.SemVer)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Headers sent with every subscription delivery. Exposure webhooks send the
+// event, and the timestamp and signature when a secret is configured.
+const (
+	HeaderWebhookEvent     = "X-Txlog-Event"
+	HeaderWebhookDelivery  = "X-Txlog-Delivery"
+	HeaderWebhookTimestamp = "X-Txlog-Timestamp"
+	HeaderWebhookSignature = "X-Txlog-Signature"
+)
+
+// SignWebhook returns the X-Txlog-Signature value for a body sent at the
+// given Unix timestamp: "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription secret. Including the
+// timestamp lets receivers reject replayed requests.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliverWebhook sends one queued delivery to its subscription, signed with
+// the subscription secret. It returns the HTTP status code (0 when no
+// response was received) and an error for anything but a 2xx answer.
+func DeliverWebhook(ctx context.Context, d models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(d.Envelope())
+	if err != nil {
+		return 0, err
+	}
+
+	ts := time.Now().Unix()
+	return postBody(ctx, d.URL, body, map[string]string{
+		HeaderWebhookEvent:     d.Event,
+		HeaderWebhookDelivery:  strconv.FormatInt(d.ID, 10),
+		HeaderWebhookTimestamp: strconv.FormatInt(ts, 10),
+		HeaderWebhookSignature: SignWebhook(d.Secret, ts, body),
+	})
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/metrics"
+	"github.com/txlog/server/models"
+)
+
+// IPMiddleware counts the request against the class budget of its client
+// IP. It must run before APIKeyMiddleware, so that requests with invalid
+// keys, which cost a database lookup each, are limited too.
+func IPMiddleware(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		limit(c, class, []Client{{Kind: KindIP, ID: ip, Name: ip}}, false)
+	}
+}
+
+// Middleware counts the request against the class budget of its API key,
+// machine credential or client certificate. It must run after IPMiddleware
+// and APIKeyMiddleware; requests without a key, such as those of browser
+// sessions, are only counted.
+func Middleware(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var clients []Client
+		if client, ok := keyClient(c); ok {
+			clients = append(clients, client)
+		}
+		limit(c, class, clients, true)
+	}
+}
+
+// limit spends a token of each of clients' buckets for class, and answers
+// 429 with a Retry-After header when one of them is spent. Requests pass
+// when Configure was not called.
+func limit(c *gin.Context, class string, clients []Client, last bool) {
+	l := defaultLimiter
+	if l == nil {
+		return
+	}
+
+	decision := l.spend(class, clients, time.Now(), last)
+	if decision.Allowed {
+		return
+	}
+
+	metrics.ObserveRateLimited(class, decision.Client.Kind)
+	retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	if decision.FirstRefusal {
+		logger.WarnContext(c.Request.Context(), "API client rate limited", "class", class, "kind", decision.Client.Kind, "client", decision.Client.Name, "client_ip", c.ClientIP())
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error": "Rate limit exceeded. Retry in " + strconv.Itoa(retryAfter) + " seconds.",
+	})
+}
+
+// keyClient returns the identity set by APIKeyMiddleware, if any.
+func keyClient(c *gin.Context) (Client, bool) {
+	if value, exists := c.Get("api_key"); exists {
+		key := value.(*models.ApiKey)
+		return Client{Kind: KindKey, ID: "api_key:" + strconv.Itoa(key.ID), Name: key.Name}, true
+	}
+	if value, exists := c.Get("machine_credential"); exists {
+		mc := value.(*models.MachineCredential)
+		return Client{Kind: KindKey, ID: "machine:" + mc.MachineID, Name: mc.Hostname}, true
+	}
+	if value, exists := c.Get("client_certificate"); exists {
+		identity := value.(*models.CertificateIdentity)
+		return Client{Kind: KindKey, ID: "certificate:" + identity.Name(), Name: identity.Name()}, true
+	}
+	return Client{}, false
+}
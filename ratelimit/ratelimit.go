@@ -0,0 +1,350 @@
+// Package ratelimit limits the request rate of /v1 clients with token
+// buckets, one per client IP, checked before authentication, and one per
+// API key (or machine credential, or client certificate), with separate
+// budgets for the ingest and read routes. Buckets are kept in memory, so
+// each server instance enforces the limits on its own.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route classes with separate budgets.
+const (
+	Ingest = "ingest"
+	Read   = "read"
+)
+
+// Kinds of client a bucket belongs to.
+const (
+	KindKey = "key"
+	KindIP  = "ip"
+)
+
+// maxLimitedClients bounds the recently limited clients kept for the admin
+// panel; the ones limited longest ago are forgotten first.
+const maxLimitedClients = 100
+
+// sweepInterval is how often buckets that have refilled are dropped, so
+// clients seen once do not use memory forever.
+const sweepInterval = time.Minute
+
+// Limit is a budget of Requests per Period. Clients may spend the whole
+// budget at once; it then refills evenly over the period. A zero Limit
+// disables limiting.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled reports whether l limits anything.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// String formats l as accepted by ParseLimit.
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	unit := "s"
+	switch l.Period {
+	case time.Minute:
+		unit = "m"
+	case time.Hour:
+		unit = "h"
+	}
+	return strconv.Itoa(l.Requests) + "/" + unit
+}
+
+// rate returns the tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseLimit parses a limit such as 600/m: a number of requests per second
+// (s), minute (m) or hour (h). "0" and "off" disable limiting.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "0" || s == "off" {
+		return Limit{}, nil
+	}
+
+	count, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected requests/unit, e.g. 600/m", s)
+	}
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: %q is not a number of requests", s, count)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: unit must be s, m or h", s)
+	}
+	if requests == 0 {
+		return Limit{}, nil
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// Config holds the budgets of each route class and kind of client.
+type Config struct {
+	IngestPerKey Limit
+	IngestPerIP  Limit
+	ReadPerKey   Limit
+	ReadPerIP    Limit
+}
+
+// DefaultConfig limits nothing: a fleet sharing one API key would share its
+// budget, and behind a reverse proxy every request comes from the proxy's
+// address. Budgets are enabled with ConfigFromEnv.
+var DefaultConfig = Config{}
+
+// ConfigFromEnv reads RATE_LIMIT_INGEST_PER_KEY, RATE_LIMIT_INGEST_PER_IP,
+// RATE_LIMIT_READ_PER_KEY and RATE_LIMIT_READ_PER_IP. Unset variables keep
+// the DefaultConfig budget.
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig
+	var errs []error
+	for name, limit := range map[string]*Limit{
+		"RATE_LIMIT_INGEST_PER_KEY": &config.IngestPerKey,
+		"RATE_LIMIT_INGEST_PER_IP":  &config.IngestPerIP,
+		"RATE_LIMIT_READ_PER_KEY":   &config.ReadPerKey,
+		"RATE_LIMIT_READ_PER_IP":    &config.ReadPerIP,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := ParseLimit(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		*limit = parsed
+	}
+	return config, errors.Join(errs...)
+}
+
+// limit returns the budget of class for kind of client.
+func (c Config) limit(class, kind string) Limit {
+	switch {
+	case class == Ingest && kind == KindKey:
+		return c.IngestPerKey
+	case class == Ingest:
+		return c.IngestPerIP
+	case kind == KindKey:
+		return c.ReadPerKey
+	default:
+		return c.ReadPerIP
+	}
+}
+
+// Client identifies who a request is counted against.
+type Client struct {
+	Kind string // KindKey or KindIP
+	ID   string // unique per kind, e.g. the API key ID or the IP
+	Name string // shown in the admin panel, e.g. the API key name
+}
+
+// bucketKey identifies the bucket of client for class.
+func bucketKey(class string, client Client) string {
+	return class + "|" + client.Kind + "|" + client.ID
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the bucket was last used.
+func (b *bucket) refill(limit Limit, now time.Time) {
+	b.tokens = math.Min(float64(limit.Requests), b.tokens+now.Sub(b.last).Seconds()*limit.rate())
+	b.last = now
+}
+
+// ClassStats counts the requests of one route class on this instance.
+type ClassStats struct {
+	Allowed uint64
+	Limited uint64
+}
+
+// LimitedClient is a client that was recently refused.
+type LimitedClient struct {
+	Class       string
+	Kind        string
+	Name        string
+	Limited     uint64
+	LastLimited time.Time
+}
+
+// LimiterStats reports the counters of a Limiter.
+type LimiterStats struct {
+	Config  Config
+	Classes map[string]ClassStats
+	Clients []LimitedClient // most recently limited first
+}
+
+// Limiter holds the token buckets of every client.
+type Limiter struct {
+	config Config
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	classes   map[string]*ClassStats
+	limited   map[string]*LimitedClient
+}
+
+// NewLimiter returns a Limiter enforcing config.
+func NewLimiter(config Config) *Limiter {
+	return &Limiter{
+		config:  config,
+		buckets: map[string]*bucket{},
+		classes: map[string]*ClassStats{Ingest: {}, Read: {}},
+		limited: map[string]*LimitedClient{},
+	}
+}
+
+// Decision is the outcome of Allow.
+type Decision struct {
+	Allowed    bool
+	Client     Client        // the client that was refused
+	RetryAfter time.Duration // until the refused client has a token again
+	// FirstRefusal is set for the first refusal of a client after it went
+	// at least a minute without one, so it can be logged once per episode.
+	FirstRefusal bool
+}
+
+// Allow spends one token of each of clients' buckets for class. When one of
+// the buckets is empty nothing is spent and the request is refused.
+func (l *Limiter) Allow(class string, clients []Client, now time.Time) Decision {
+	return l.spend(class, clients, now, true)
+}
+
+// spend is Allow, counting the request as allowed only when last is set, so
+// that a request checked in several stages is counted once.
+func (l *Limiter) spend(class string, clients []Client, now time.Time, last bool) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	spends := make([]*bucket, 0, len(clients))
+	for _, client := range clients {
+		limit := l.config.limit(class, client.Kind)
+		if !limit.Enabled() {
+			continue
+		}
+		key := bucketKey(class, client)
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(limit.Requests), last: now}
+			l.buckets[key] = b
+		}
+		b.refill(limit, now)
+		if b.tokens < 1 {
+			l.classes[class].Limited++
+			return Decision{
+				Client:       client,
+				RetryAfter:   time.Duration((1 - b.tokens) / limit.rate() * float64(time.Second)),
+				FirstRefusal: l.recordLimited(class, client, now),
+			}
+		}
+		spends = append(spends, b)
+	}
+
+	for _, b := range spends {
+		b.tokens--
+	}
+	if last {
+		l.classes[class].Allowed++
+	}
+	return Decision{Allowed: true}
+}
+
+// recordLimited counts a refused request of client, and reports whether it
+// is the first one in a minute.
+func (l *Limiter) recordLimited(class string, client Client, now time.Time) bool {
+	key := bucketKey(class, client)
+	lc, ok := l.limited[key]
+	if !ok {
+		if len(l.limited) >= maxLimitedClients {
+			var oldest string
+			for k, c := range l.limited {
+				if oldest == "" || c.LastLimited.Before(l.limited[oldest].LastLimited) {
+					oldest = k
+				}
+			}
+			delete(l.limited, oldest)
+		}
+		lc = &LimitedClient{Class: class, Kind: client.Kind}
+		l.limited[key] = lc
+	}
+	first := now.Sub(lc.LastLimited) >= time.Minute
+	lc.Name = client.Name
+	lc.Limited++
+	lc.LastLimited = now
+	return first
+}
+
+// sweep drops the buckets that are full again, which behave exactly like
+// new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		class, rest, _ := strings.Cut(key, "|")
+		kind, _, _ := strings.Cut(rest, "|")
+		limit := l.config.limit(class, kind)
+		b.refill(limit, now)
+		if b.tokens >= float64(limit.Requests) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Stats returns a copy of the counters.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := LimiterStats{Config: l.config, Classes: map[string]ClassStats{}}
+	for class, cs := range l.classes {
+		stats.Classes[class] = *cs
+	}
+	for _, lc := range l.limited {
+		stats.Clients = append(stats.Clients, *lc)
+	}
+	sort.Slice(stats.Clients, func(i, j int) bool {
+		return stats.Clients[i].LastLimited.After(stats.Clients[j].LastLimited)
+	})
+	return stats
+}
+
+var defaultLimiter *Limiter
+
+// Configure creates the process-wide limiter used by Middleware. It must be
+// called once at startup, before requests are served.
+func Configure(config Config) {
+	defaultLimiter = NewLimiter(config)
+}
+
+// Stats returns the counters of the process-wide limiter.
+func Stats() LimiterStats {
+	if l := defaultLimiter; l != nil {
+		return l.Stats()
+	}
+	return LimiterStats{Classes: map[string]ClassStats{}}
+}
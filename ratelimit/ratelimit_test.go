@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/models"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{"600/m", Limit{600, time.Minute}, false},
+		{" 10/S ", Limit{10, time.Second}, false},
+		{"3600/h", Limit{3600, time.Hour}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"0/m", Limit{}, false},
+		{"600", Limit{}, true},
+		{"ten/m", Limit{}, true},
+		{"-1/m", Limit{}, true},
+		{"600/d", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_INGEST_PER_IP", "120/m")
+	t.Setenv("RATE_LIMIT_READ_PER_KEY", "off")
+
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv() error = %v", err)
+	}
+	want := Config{IngestPerIP: Limit{120, time.Minute}}
+	if config != want {
+		t.Errorf("ConfigFromEnv() = %+v, want %+v", config, want)
+	}
+
+	t.Setenv("RATE_LIMIT_READ_PER_IP", "fast")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected an error for an invalid limit")
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{
+		IngestPerKey: Limit{3, time.Minute},
+		IngestPerIP:  Limit{5, time.Minute},
+	})
+	key := Client{Kind: KindKey, ID: "api_key:1", Name: "agents"}
+	ip := Client{Kind: KindIP, ID: "10.0.0.1", Name: "10.0.0.1"}
+
+	for i := 0; i < 3; i++ {
+		if d := l.Allow(Ingest, []Client{key, ip}, now); !d.Allowed {
+			t.Fatalf("request %d refused, want the burst allowed", i+1)
+		}
+	}
+	d := l.Allow(Ingest, []Client{key, ip}, now)
+	if d.Allowed || d.Client != key || !d.FirstRefusal {
+		t.Fatalf("Allow() = %+v, want the key refused for the first time", d)
+	}
+	if d.RetryAfter != 20*time.Second {
+		t.Errorf("RetryAfter = %v, want 20s", d.RetryAfter)
+	}
+	if d := l.Allow(Ingest, []Client{key, ip}, now.Add(time.Second)); d.Allowed || d.FirstRefusal {
+		t.Errorf("Allow() = %+v, want a repeated refusal", d)
+	}
+
+	// The IP only paid for the three allowed requests
+	other := Client{Kind: KindKey, ID: "api_key:2", Name: "other"}
+	for i := 0; i < 2; i++ {
+		if d := l.Allow(Ingest, []Client{other, ip}, now); !d.Allowed {
+			t.Fatalf("request %d of another key refused", i+1)
+		}
+	}
+	if d := l.Allow(Ingest, []Client{other, ip}, now); d.Allowed || d.Client != ip {
+		t.Errorf("Allow() = %+v, want the IP refused", d)
+	}
+
+	// Read routes have their own, here unlimited, budgets
+	if d := l.Allow(Read, []Client{key, ip}, now); !d.Allowed {
+		t.Error("read request refused by the ingest budget")
+	}
+
+	// One token is back after a third of the period
+	if d := l.Allow(Ingest, []Client{key}, now.Add(20*time.Second)); !d.Allowed {
+		t.Error("request refused after the bucket refilled")
+	}
+
+	stats := l.Stats()
+	if got := stats.Classes[Ingest]; got.Allowed != 6 || got.Limited != 3 {
+		t.Errorf("ingest stats = %+v, want 6 allowed and 3 limited", got)
+	}
+	if len(stats.Clients) != 2 || stats.Clients[0].Name != "agents" || stats.Clients[0].Limited != 2 {
+		t.Errorf("Clients = %+v, want the key, limited twice, first", stats.Clients)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{ReadPerIP: Limit{60, time.Minute}})
+
+	l.Allow(Read, []Client{{Kind: KindIP, ID: "10.0.0.1"}}, now)
+	for i := 0; i < 30; i++ {
+		l.Allow(Read, []Client{{Kind: KindIP, ID: "10.0.0.2"}}, now.Add(50*time.Second))
+	}
+	l.Allow(Read, []Client{{Kind: KindIP, ID: "10.0.0.3"}}, now.Add(61*time.Second))
+
+	// 10.0.0.1 refilled and was dropped, 10.0.0.2 is still spending
+	if len(l.buckets) != 2 {
+		t.Errorf("buckets = %d, want 2", len(l.buckets))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Configure(Config{IngestPerKey: Limit{1, time.Hour}})
+	t.Cleanup(func() { defaultLimiter = nil })
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("machine_credential", &models.MachineCredential{ID: 1, MachineID: "abc", Hostname: "web01"})
+	})
+	r.POST("/", Middleware(Ingest), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", got)
+	}
+	if clients := Stats().Clients; len(clients) != 1 || clients[0].Name != "web01" {
+		t.Errorf("Clients = %+v, want web01", clients)
+	}
+}
+
+func TestIPMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Configure(Config{ReadPerIP: Limit{1, time.Minute}})
+	t.Cleanup(func() { defaultLimiter = nil })
+
+	// Requests refused by authentication still spend the IP budget
+	r := gin.New()
+	r.GET("/", IPMiddleware(Read), func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("first request: status = %d, want 401", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if classes := Stats().Classes; classes[Read].Allowed != 0 || classes[Read].Limited != 1 {
+		t.Errorf("Classes = %+v, want 0 allowed and 1 limited", classes)
+	}
+}
@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/notification"
+)
+
+// digestJob mails the digests that are due to subscribed users. Content is
+// gathered once per frequency and then narrowed to each user's sections.
+// Digests with nothing to report are skipped but still count as sent, and
+// failed deliveries stay due and are retried on the next run. The job does
+// nothing when SMTP is not configured.
+func digestJob(db *sql.DB) error {
+	cfg, ok := notification.SMTPConfigFromEnv()
+	if !ok {
+		return nil
+	}
+
+	lockName := "digests"
+
+	locked, err := acquireLock(db, lockName)
+	if err != nil {
+		logger.Error("Error acquiring lock for digests", "error", err)
+		return err
+	}
+
+	if !locked {
+		return errJobLocked
+	}
+
+	defer releaseLock(db, lockName)
+
+	dm := models.NewDigestManager(db)
+
+	subs, err := dm.ListSubscriptions()
+	if err != nil {
+		// Table might not exist yet (migration not applied)
+		logger.Debug("Digests: could not load subscriptions", "error", err)
+		return err
+	}
+
+	now := time.Now()
+	baseURL := notification.PublicURL()
+	digests := map[string]*models.Digest{}
+
+	sent, skipped, failed := 0, 0, 0
+	for _, s := range subs {
+		if !s.IsDue(now) {
+			continue
+		}
+
+		d, ok := digests[s.Frequency]
+		if !ok {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			d, err = dm.BuildDigest(ctx, s.Frequency, now)
+			cancel()
+			if err != nil {
+				logger.Error("Digests: error building digest", "frequency", s.Frequency, "error", err)
+				return err
+			}
+			digests[s.Frequency] = d
+		}
+
+		digest := d.WithSections(s.Sections)
+		if digest.IsEmpty() {
+			skipped++
+			if err := dm.MarkSent(s.UserID, now); err != nil {
+				logger.Error("Digests: could not record delivery status", "user_id", s.UserID, "error", err)
+			}
+			continue
+		}
+
+		if err := notification.SendDigest(cfg, s.Email, digest, baseURL); err != nil {
+			failed++
+			logger.Warn("Digests: delivery failed", "user_id", s.UserID, "error", err)
+			if err := dm.MarkFailed(s.UserID, err); err != nil {
+				logger.Error("Digests: could not record delivery status", "user_id", s.UserID, "error", err)
+			}
+			continue
+		}
+
+		sent++
+		if err := dm.MarkSent(s.UserID, now); err != nil {
+			logger.Error("Digests: could not record delivery status", "user_id", s.UserID, "error", err)
+		}
+	}
+
+	if sent > 0 || skipped > 0 || failed > 0 {
+		logger.Info("Digests: run finished.", "sent", sent, "skipped", skipped, "failed", failed)
+	}
+	return nil
+}
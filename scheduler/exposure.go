@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/notification"
+)
+
+// notifyNewExposures announces vulnerabilities that newly affect active
+// assets. Exposures above each channel's severity threshold are queued in
+// exposure_notifications, which skips those already queued for the channel,
+// and then every pending notification is delivered, grouped by
+// vulnerability. Failed deliveries stay pending and are retried after the
+// next run, up to models.MaxExposureAttempts.
+func notifyNewExposures(db *sql.DB, links []models.PackageVulnerabilityLink) {
+	channels, warnings := notification.ExposureChannelsFromEnv()
+	for _, w := range warnings {
+		logger.Warn("Exposure notifications: " + w)
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	em := models.NewExposureManager(db)
+
+	exposures, err := em.FindExposures(links)
+	if err != nil {
+		logger.Error("Exposure notifications: error finding new exposures", "error", err)
+		return
+	}
+
+	for _, ch := range channels {
+		var accepted []models.Exposure
+		for _, e := range exposures {
+			if ch.Accepts(e.Severity) {
+				accepted = append(accepted, e)
+			}
+		}
+
+		queued, err := em.Enqueue(ch.Name(), accepted)
+		if err != nil {
+			logger.Error("Exposure notifications: error queuing events", "channel", ch.Name(), "error", err)
+		}
+
+		pending, err := em.Pending(ch.Name())
+		if err != nil {
+			logger.Error("Exposure notifications: error loading pending events", "channel", ch.Name(), "error", err)
+			continue
+		}
+
+		sent, failed := 0, 0
+		for _, event := range models.GroupExposures(pending, time.Now()) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			err := ch.SendExposure(ctx, event)
+			cancel()
+
+			if err != nil {
+				failed++
+				logger.Warn("Exposure notifications: delivery failed", "channel", ch.Name(), "vulnerability_id", event.VulnerabilityID, "error", err)
+				if err := em.MarkFailed(ch.Name(), event, err); err != nil {
+					logger.Error("Exposure notifications: could not record delivery status", "channel", ch.Name(), "vulnerability_id", event.VulnerabilityID, "error", err)
+				}
+				continue
+			}
+
+			sent++
+			if err := em.MarkSent(ch.Name(), event); err != nil {
+				logger.Error("Exposure notifications: could not record delivery status", "channel", ch.Name(), "vulnerability_id", event.VulnerabilityID, "error", err)
+			}
+		}
+
+		if queued > 0 || sent > 0 || failed > 0 {
+			logger.Info("Exposure notifications: run finished.", "channel", ch.Name(), "queued", queued, "sent", sent, "failed", failed)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"database/sql"
+	"time"
+
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// jobRunFlushInterval limits how often progress is written to job_runs so
+// that tight loops do not turn into a stream of UPDATEs.
+const jobRunFlushInterval = 2 * time.Second
+
+// jobRunTracker records the progress of a single job run in job_runs.
+// A nil tracker is valid and turns every method into a no-op, so jobs keep
+// working when the run could not be recorded (e.g. migration not applied).
+type jobRunTracker struct {
+	manager   *models.JobRunManager
+	run       models.JobRun
+	lastFlush time.Time
+}
+
+// startJobRun records the start of a run. It returns nil if the run could not
+// be recorded; the failure is logged and the job proceeds untracked.
+func startJobRun(db *sql.DB, jobName, trigger string) *jobRunTracker {
+	manager := models.NewJobRunManager(db)
+	id, err := manager.Start(jobName, trigger)
+	if err != nil {
+		logger.Warn("Could not record job run", "job", jobName, "error", err)
+		return nil
+	}
+
+	return &jobRunTracker{
+		manager: manager,
+		run: models.JobRun{
+			ID:      id,
+			JobName: jobName,
+			Trigger: trigger,
+			Status:  models.JobStatusRunning,
+		},
+		lastFlush: time.Now(),
+	}
+}
+
+// setPhase switches the run to a new phase and resets its progress.
+func (t *jobRunTracker) setPhase(phase string, total int) {
+	if t == nil {
+		return
+	}
+	t.run.Phase = phase
+	t.run.ProgressCurrent = 0
+	t.run.ProgressTotal = total
+	t.flush(true)
+}
+
+// setProgress updates the progress of the current phase.
+func (t *jobRunTracker) setProgress(current int) {
+	if t == nil {
+		return
+	}
+	t.run.ProgressCurrent = current
+	t.flush(false)
+}
+
+// addPackagesChecked increments the number of packages queried.
+func (t *jobRunTracker) addPackagesChecked(n int) {
+	if t == nil {
+		return
+	}
+	t.run.PackagesChecked += n
+}
+
+// setVulnerabilitiesFound sets the number of distinct vulnerabilities seen.
+func (t *jobRunTracker) setVulnerabilitiesFound(n int) {
+	if t == nil {
+		return
+	}
+	t.run.VulnerabilitiesFound = n
+}
+
+// recordError counts a non-fatal error and keeps its message.
+func (t *jobRunTracker) recordError(err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.run.ErrorCount++
+	t.run.LastError = err.Error()
+}
+
+// finish marks the run as succeeded, or failed when fatalErr is not nil.
+func (t *jobRunTracker) finish(fatalErr error) {
+	if t == nil {
+		return
+	}
+	status := models.JobStatusSucceeded
+	if fatalErr != nil {
+		status = models.JobStatusFailed
+		t.recordError(fatalErr)
+	}
+	if err := t.manager.Finish(&t.run, status); err != nil {
+		logger.Warn("Could not finish job run", "job", t.run.JobName, "error", err)
+	}
+}
+
+func (t *jobRunTracker) flush(force bool) {
+	if !force && time.Since(t.lastFlush) < jobRunFlushInterval {
+		return
+	}
+	t.lastFlush = time.Now()
+	if err := t.manager.UpdateProgress(&t.run); err != nil {
+		logger.Warn("Could not update job run progress", "job", t.run.JobName, "error", err)
+	}
+}
@@ -1,64 +1,162 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"database/sql"
 	"github.com/mileusna/crontab"
+	"github.com/txlog/server/auth"
+	"github.com/txlog/server/forwarder"
 	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/metrics"
+	"github.com/txlog/server/models"
 	"github.com/txlog/server/statistics"
+	"github.com/txlog/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // numericRegex is precompiled at package level to avoid recompilation on each housekeeping invocation
 var numericRegex = regexp.MustCompile(`^[0-9]+$`)
 
+// errJobLocked is returned by jobs that did not run because another instance
+// holds their lock.
+var errJobLocked = errors.New("another instance is running this job")
+
 // StartScheduler initializes and starts the scheduler system with periodic jobs:
 //   - A housekeeping job that runs according to CRON_RETENTION_EXPRESSION
 //     environment variable
 //   - A statistics job that runs according to CRON_STATS_EXPRESSION environment
 //     variable
 //   - A materialized view refresh job that runs every 5 minutes
+//   - A risk score job that runs according to CRON_RISK_EXPRESSION
+//     environment variable (defaults to hourly)
+//   - A webhook delivery job that runs according to CRON_WEBHOOK_EXPRESSION
+//     environment variable (defaults to every minute)
+//   - An e-mail digest job that runs according to CRON_DIGEST_EXPRESSION
+//     environment variable (defaults to daily at 07:00)
+//   - A syslog forwarder reload that runs every minute on every instance, so
+//     forwarder changes made on another instance are picked up
+//   - A session purge job that deletes expired and logged out user sessions,
+//     and stale failed login counters every hour
+//   - An OIDC session revalidation job that runs every minute when
+//     oidcService is set and OIDC_REVALIDATE_INTERVAL is configured
 //
-// The scheduler uses crontab for job scheduling and execution.
-func StartScheduler(db *sql.DB) {
+// The scheduler uses crontab for job scheduling and execution. Every
+// scheduled run is traced and measured by observeJob.
+func StartScheduler(db *sql.DB, oidcService *auth.OIDCService) {
 	ctab := crontab.New()
-	ctab.MustAddJob(os.Getenv("CRON_RETENTION_EXPRESSION"), func() { housekeepingJob(db) })
-	ctab.MustAddJob(os.Getenv("CRON_STATS_EXPRESSION"), func() { statsJob(db) })
-	ctab.MustAddJob("0 * * * *", latestVersionJob)
-	ctab.MustAddJob("*/5 * * * *", func() { refreshMaterializedViewsJob(db) })
+	ctab.MustAddJob(os.Getenv("CRON_RETENTION_EXPRESSION"), scheduled("housekeeping", func() error { return housekeepingJob(db) }))
+	ctab.MustAddJob(os.Getenv("CRON_STATS_EXPRESSION"), scheduled("statistics", func() error { return statsJob(db) }))
+	ctab.MustAddJob("0 * * * *", scheduled("latest_version", latestVersionJob))
+	ctab.MustAddJob("*/5 * * * *", scheduled("materialized_views", func() error { return refreshMaterializedViewsJob(db) }))
 
 	cronOsv := os.Getenv("CRON_OSV_EXPRESSION")
 	if cronOsv == "" {
 		cronOsv = "0 4 * * *"
 	}
-	ctab.MustAddJob(cronOsv, func() { UpdateVulnerabilitiesJob(db) })
+	ctab.MustAddJob(cronOsv, func() { UpdateVulnerabilitiesJob(db, models.JobTriggerCron) })
+
+	cronRisk := os.Getenv("CRON_RISK_EXPRESSION")
+	if cronRisk == "" {
+		cronRisk = "30 * * * *"
+	}
+	ctab.MustAddJob(cronRisk, scheduled("risk", func() error { return riskJob(db) }))
+
+	cronWebhook := os.Getenv("CRON_WEBHOOK_EXPRESSION")
+	if cronWebhook == "" {
+		cronWebhook = "* * * * *"
+	}
+	ctab.MustAddJob(cronWebhook, scheduled("webhooks", func() error { return webhookDeliveryJob(db) }))
+
+	cronDigest := os.Getenv("CRON_DIGEST_EXPRESSION")
+	if cronDigest == "" {
+		cronDigest = "0 7 * * *"
+	}
+	ctab.MustAddJob(cronDigest, scheduled("digests", func() error { return digestJob(db) }))
+
+	ctab.MustAddJob("* * * * *", scheduled("syslog_reload", reloadForwardersJob))
+	ctab.MustAddJob("45 * * * *", scheduled("sessions", func() error { return sessionPurgeJob(db) }))
+	if oidcService != nil && oidcService.RevalidateInterval > 0 {
+		ctab.MustAddJob("* * * * *", scheduled("oidc_sessions", func() error { return oidcRevalidationJob(db, oidcService) }))
+	}
 
 	latestVersionJob()              // Run for the first time
 	refreshMaterializedViewsJob(db) // Run for the first time
 	logger.Info("Scheduler: started.")
 }
 
-func latestVersionJob() {
+// scheduled returns a crontab job that runs job through observeJob.
+func scheduled(name string, job func() error) func() {
+	return func() { observeJob(name, func(context.Context) error { return job() }) }
+}
+
+// observeJob runs job in a new "scheduler <name>" span and records its
+// duration and outcome in the scheduler metrics. Jobs report errJobLocked
+// when another instance holds their lock, which is recorded as skipped
+// rather than failed. Jobs that pass the context on have their queries and
+// outbound calls traced under the job's span, and their log lines tagged
+// with the job name.
+func observeJob(name string, job func(ctx context.Context) error) {
+	ctx, span := tracing.StartSpan(context.Background(), "scheduler "+name, attribute.String("txlog.job", name))
+	ctx = logger.With(ctx, "job", name)
+	start := time.Now()
+	err := job(ctx)
+	duration := time.Since(start)
+
+	outcome := metrics.JobSucceeded
+	if errors.Is(err, errJobLocked) {
+		outcome = metrics.JobSkipped
+		err = nil
+	} else if err != nil {
+		outcome = metrics.JobFailed
+	}
+	metrics.ObserveJob(name, outcome, duration)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "Scheduled job failed", "duration_ms", duration.Milliseconds(), "error", err)
+	} else {
+		logger.DebugContext(ctx, "Scheduled job finished", "outcome", outcome, "duration_ms", duration.Milliseconds())
+	}
+
+	span.SetAttributes(attribute.String("txlog.job.outcome", outcome))
+	tracing.EndSpan(span, err)
+}
+
+func latestVersionJob() error {
 	resp, err := http.Get("https://txlog.rda.run/server/version")
 	if err != nil {
-		logger.Error("Error fetching latest version: " + err.Error())
-		return
+		logger.Error("Error fetching latest version", "error", err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("Error reading response body: " + err.Error())
-		return
+		logger.Error("Error reading response body", "error", err)
+		return err
 	}
 
 	version := strings.TrimSpace(string(body))
 	os.Setenv("LATEST_VERSION", version)
-	logger.Info("Latest version updated: " + version)
+	logger.Info("Latest version updated", "version", version)
+	return nil
+}
+
+// reloadForwardersJob re-reads the syslog forwarders. It runs on every
+// instance, since each one keeps its own collector connections.
+func reloadForwardersJob() error {
+	err := forwarder.Reload()
+	if err != nil {
+		logger.Error("Error reloading syslog forwarders", "error", err)
+	}
+	return err
 }
 
 // refreshMaterializedViewsJob refreshes the materialized views used for performance optimization.
@@ -71,18 +169,18 @@ func latestVersionJob() {
 //
 // This job should run frequently (every 5 minutes) to keep the data relatively fresh
 // while avoiding the expensive CTEs on each request.
-func refreshMaterializedViewsJob(db *sql.DB) {
+func refreshMaterializedViewsJob(db *sql.DB) error {
 	lockName := "refresh-materialized-views"
 
 	locked, err := acquireLock(db, lockName)
 	if err != nil {
-		logger.Error("Error acquiring lock for materialized view refresh: " + err.Error())
-		return
+		logger.Error("Error acquiring lock for materialized view refresh", "error", err)
+		return err
 	}
 
 	if !locked {
 		// Another instance is already refreshing
-		return
+		return errJobLocked
 	}
 
 	defer releaseLock(db, lockName)
@@ -96,7 +194,7 @@ func refreshMaterializedViewsJob(db *sql.DB) {
 		if err != nil {
 			// View might not exist yet (migration not applied)
 			// This is expected on first deployment, so we only log at debug level
-			logger.Debug("Could not refresh mv_package_listing: " + err.Error())
+			logger.Debug("Could not refresh mv_package_listing", "error", err)
 		}
 	}
 
@@ -111,12 +209,13 @@ func refreshMaterializedViewsJob(db *sql.DB) {
 		if err != nil {
 			_, err = db.Exec(`REFRESH MATERIALIZED VIEW ` + view)
 			if err != nil {
-				logger.Debug("Could not refresh " + view + ": " + err.Error())
+				logger.Debug("Could not refresh materialized view", "view", view, "error", err)
 			}
 		}
 	}
 
 	logger.Debug("Materialized views refreshed successfully.")
+	return nil
 }
 
 // statsJob executes statistical tasks for the system while ensuring only one instance
@@ -127,20 +226,20 @@ func refreshMaterializedViewsJob(db *sql.DB) {
 // 2. If lock acquisition fails or another instance is running, exits early
 // 3. Counts executions, installed packages, and upgraded packages for the last 30 days
 // 4. Automatically releases the lock when the function completes
-func statsJob(db *sql.DB) {
+func statsJob(db *sql.DB) error {
 	logger.Info("Statistics: executing task...")
 
 	lockName := "stats"
 
 	locked, err := acquireLock(db, lockName)
 	if err != nil {
-		logger.Error("Error acquiring lock: " + err.Error())
-		return
+		logger.Error("Error acquiring lock", "error", err)
+		return err
 	}
 
 	if !locked {
 		logger.Info("Another instance is running this job.")
-		return
+		return errJobLocked
 	}
 
 	defer releaseLock(db, lockName)
@@ -150,28 +249,32 @@ func statsJob(db *sql.DB) {
 	statistics.CountUpgradedPackages()
 
 	logger.Info("Statistics updated.")
+	return nil
 }
 
 // housekeepingJob performs database cleanup by deleting old execution records.
 // It uses a distributed lock mechanism to ensure only one instance runs at a time.
 // The retention period is configured via CRON_RETENTION_DAYS environment variable
 // (defaults to 7 days if not set). Records older than the retention period are
-// deleted from the executions table. The function logs its progress and any errors
-// encountered during the process.
-func housekeepingJob(db *sql.DB) {
+// deleted from the executions table. Job run history older than 90 days,
+// risk snapshots older than a year and finished webhook deliveries older than
+// 30 days are also removed. The function logs its progress and any errors
+// encountered during the process; a failed cleanup does not stop the others,
+// and the errors are returned together.
+func housekeepingJob(db *sql.DB) error {
 	logger.Info("Housekeeping: executing task...")
 
 	lockName := "retention-days"
 
 	locked, err := acquireLock(db, lockName)
 	if err != nil {
-		logger.Error("Error acquiring lock: " + err.Error())
-		return
+		logger.Error("Error acquiring lock", "error", err)
+		return err
 	}
 
 	if !locked {
 		logger.Info("Another instance is running this job.")
-		return
+		return errJobLocked
 	}
 
 	defer releaseLock(db, lockName)
@@ -184,6 +287,8 @@ func housekeepingJob(db *sql.DB) {
 		_, _ = db.Exec("DELETE FROM executions WHERE executed_at < NOW() - INTERVAL $1 day", retentionDays)
 	}
 
+	var errs []error
+
 	// D11: Cleanup orphan transaction_items and transactions from inactive assets
 	_, err = db.Exec(`
 		DELETE FROM transaction_items ti
@@ -196,7 +301,8 @@ func housekeepingJob(db *sql.DB) {
 		)
 	`)
 	if err != nil {
-		logger.Error("Housekeeping: error cleaning orphan transaction_items: " + err.Error())
+		logger.Error("Housekeeping: error cleaning orphan transaction_items", "error", err)
+		errs = append(errs, err)
 	}
 
 	_, err = db.Exec(`
@@ -210,10 +316,30 @@ func housekeepingJob(db *sql.DB) {
 		)
 	`)
 	if err != nil {
-		logger.Error("Housekeeping: error cleaning orphan transactions: " + err.Error())
+		logger.Error("Housekeeping: error cleaning orphan transactions", "error", err)
+		errs = append(errs, err)
+	}
+
+	_, err = db.Exec(`DELETE FROM job_runs WHERE started_at < NOW() - INTERVAL '90 days'`)
+	if err != nil {
+		logger.Error("Housekeeping: error cleaning old job runs", "error", err)
+		errs = append(errs, err)
+	}
+
+	_, err = db.Exec(`DELETE FROM risk_score_history WHERE snapshot_date < CURRENT_DATE - INTERVAL '365 days'`)
+	if err != nil {
+		logger.Error("Housekeeping: error cleaning old risk snapshots", "error", err)
+		errs = append(errs, err)
+	}
+
+	_, err = db.Exec(`DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < NOW() - INTERVAL '30 days'`)
+	if err != nil {
+		logger.Error("Housekeeping: error cleaning old webhook deliveries", "error", err)
+		errs = append(errs, err)
 	}
 
-	logger.Info("Housekeeping: executions older than " + retentionDays + " days are deleted.")
+	logger.Info("Housekeeping: old executions are deleted.", "retention_days", retentionDays)
+	return errors.Join(errs...)
 }
 
 // acquireLock attempts to obtain a lock for a given job name in the cron_lock table.
@@ -230,7 +356,7 @@ func acquireLock(db *sql.DB, lockName string) (bool, error) {
 	// locks older than 12 hours. We assume jobs don't take this long.
 	_, err := db.Exec(`DELETE FROM cron_lock WHERE job_name = $1 AND locked_at < NOW() - INTERVAL '12 hours'`, lockName)
 	if err != nil {
-		logger.Error("Failed to clean up stale lock for " + lockName + ": " + err.Error())
+		logger.Error("Failed to clean up stale lock", "lock", lockName, "error", err)
 	}
 
 	res, err := db.Exec(`INSERT INTO cron_lock (job_name, locked_at) VALUES ($1, NOW()) ON CONFLICT (job_name) DO NOTHING`, lockName)
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"database/sql"
+
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// riskJob recalculates the risk score of every active asset and records the
+// daily snapshot of each topology group. It runs on CRON_RISK_EXPRESSION and
+// right after the vulnerabilities job, so scores follow new OSV data without
+// waiting for the next tick.
+func riskJob(db *sql.DB) error {
+	lockName := "risk"
+
+	locked, err := acquireLock(db, lockName)
+	if err != nil {
+		logger.Error("Error acquiring lock for risk scores", "error", err)
+		return err
+	}
+
+	if !locked {
+		logger.Info("Another instance is recalculating risk scores.")
+		return errJobLocked
+	}
+
+	defer releaseLock(db, lockName)
+
+	count, err := models.NewRiskManager(db).Recalculate()
+	if err != nil {
+		logger.Error("Error recalculating risk scores", "error", err)
+		return err
+	}
+
+	logger.Info("Risk scores recalculated.", "assets", count)
+	return nil
+}
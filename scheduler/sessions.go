@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/txlog/server/auth"
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// loginFailureRetention is how long the failed logins of a username or an
+// address are kept after the last one, when no lockout is running.
+const loginFailureRetention = 24 * time.Hour
+
+// sessionPurgeJob deletes expired and logged out user sessions. Such rows are
+// already refused by the middleware, so the job only keeps user_sessions from growing.
+// It also deletes the failed login counters that no longer lock anything.
+func sessionPurgeJob(db *sql.DB) error {
+	count, err := models.NewSessionManager(db).PurgeExpired()
+	if err != nil {
+		logger.Error("Sessions: error purging expired sessions", "error", err)
+		return err
+	}
+
+	if count > 0 {
+		logger.Info("Sessions: purged expired sessions", "count", count)
+	}
+
+	count, err = models.NewLoginFailureManager(db).PurgeStale(loginFailureRetention)
+	if err != nil {
+		logger.Error("Sessions: error purging login failures", "error", err)
+		return err
+	}
+
+	if count > 0 {
+		logger.Info("Sessions: purged login failures", "count", count)
+	}
+	return nil
+}
+
+// oidcRevalidationBatchSize caps how many sessions one run revalidates, so
+// the provider is not flooded after an outage.
+const oidcRevalidationBatchSize = 100
+
+// oidcRevalidationJob asks the OIDC provider, with their refresh tokens,
+// whether it still accepts the users of the sessions due for a check, and
+// ends the sessions it refuses. The lock keeps two instances from refreshing
+// the same token, which providers that rotate refresh tokens treat as theft.
+func oidcRevalidationJob(db *sql.DB, oidcService *auth.OIDCService) error {
+	lockName := "oidc_sessions"
+
+	locked, err := acquireLock(db, lockName)
+	if err != nil {
+		logger.Error("Error acquiring lock for OIDC session revalidation", "error", err)
+		return err
+	}
+
+	if !locked {
+		return errJobLocked
+	}
+
+	defer releaseLock(db, lockName)
+
+	checked, ended, err := oidcService.RevalidateSessions(context.Background(), oidcRevalidationBatchSize)
+	if checked > 0 || ended > 0 {
+		logger.Info("OIDC: sessions revalidated", "checked", checked, "ended", ended)
+	}
+	return err
+}
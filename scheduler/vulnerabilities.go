@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -9,19 +10,22 @@ import (
 
 	"github.com/lib/pq"
 	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/metrics"
+	"github.com/txlog/server/models"
 	"github.com/txlog/server/util"
 )
 
 // Package-level types used across multiple functions in the vulnerability pipeline.
 
 type vulnRecord struct {
-	ID          string
-	Summary     string
-	Details     string
-	Severity    string
-	CVSSScore   float64
-	ModifiedAt  *time.Time
-	PublishedAt *time.Time
+	ID             string
+	Summary        string
+	Details        string
+	Severity       string
+	CVSSScore      float64
+	Exploitability *float64 // CVSS exploitability sub-score; nil when unknown
+	ModifiedAt     *time.Time
+	PublishedAt    *time.Time
 }
 
 type pvRecord struct {
@@ -43,22 +47,41 @@ type vulnTxKey struct {
 	MachineID     string
 }
 
-func UpdateVulnerabilitiesJob(db *sql.DB) {
-	logger.Info("Vulnerabilities: executing update task...")
+// Phases reported in job_runs while UpdateVulnerabilitiesJob is running.
+const (
+	vulnPhaseFetching = "fetching"
+	vulnPhaseScoring  = "scoring"
+)
+
+// UpdateVulnerabilitiesJob downloads OSV data for every known package and
+// recalculates the vulnerability scoreboards of the affected transactions,
+// then notifies new exposures and refreshes the asset risk scores.
+// Each run that acquires the lock is recorded in job_runs with the given
+// trigger (models.JobTriggerCron or models.JobTriggerManual), along with live
+// progress and the final counters. Runs are observed in the scheduler
+// metrics whether they come from the cron or the admin page.
+func UpdateVulnerabilitiesJob(db *sql.DB, trigger string) {
+	observeJob("vulnerabilities", func(ctx context.Context) error { return updateVulnerabilities(ctx, db, trigger) })
+}
+
+func updateVulnerabilities(ctx context.Context, db *sql.DB, trigger string) error {
+	logger.InfoContext(ctx, "Vulnerabilities: executing update task...")
 
 	lockName := "vulnerabilities"
 
 	locked, err := acquireLock(db, lockName)
 	if err != nil {
-		logger.Error("Error acquiring lock for vulnerabilities: " + err.Error())
-		return
+		logger.ErrorContext(ctx, "Error acquiring lock for vulnerabilities", "error", err)
+		return err
 	}
 	if !locked {
-		logger.Info("Another instance is running this vulnerabilities job.")
-		return
+		logger.InfoContext(ctx, "Another instance is running this vulnerabilities job.")
+		return errJobLocked
 	}
 	defer releaseLock(db, lockName)
 
+	run := startJobRun(db, lockName, trigger)
+
 	// Extract all distinct packages from transaction items, joined with asset OS.
 	query := `
         SELECT DISTINCT ti.package, ti.version, COALESCE(ti.release, '') AS release, a.os, COALESCE(ti.repo, '') AS repo
@@ -68,10 +91,11 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
         WHERE ti.action IN ('Install', 'Upgrade', 'Downgrade', 'Reinstall', 'installed', 'upgrade',
                              'Removed', 'Upgraded', 'Downgraded', 'Obsoleted', 'removed')
     `
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		logger.Error("Vulnerabilities: " + err.Error())
-		return
+		logger.ErrorContext(ctx, "Vulnerabilities", "error", err)
+		run.finish(err)
+		return err
 	}
 	defer rows.Close()
 
@@ -86,7 +110,7 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 	for rows.Next() {
 		var pName, pVersion, pRelease, pOs, pRepo sql.NullString
 		if err := rows.Scan(&pName, &pVersion, &pRelease, &pOs, &pRepo); err != nil {
-			logger.Error("Vulnerabilities scan error: " + err.Error())
+			logger.ErrorContext(ctx, "Vulnerabilities scan error", "error", err)
 			continue
 		}
 
@@ -106,7 +130,11 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 		packages = append(packages, v)
 	}
 
-	logger.Info(fmt.Sprintf("Vulnerabilities: found %d discrete package/ecosystem pairs to check.", len(packages)))
+	logger.InfoContext(ctx, "Vulnerabilities: found discrete package/ecosystem pairs to check.", "packages", len(packages))
+	run.setPhase(vulnPhaseFetching, len(packages))
+
+	// Distinct vulnerability IDs returned by OSV during this run
+	foundVulns := make(map[string]bool)
 
 	// Cache for detailed vulnerability data
 	fetchedVulns := make(map[string]*util.OSVVuln)
@@ -115,6 +143,15 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 	// Track which packages had vulnerability data changed for incremental scoreboard
 	updatedPackages := make(map[vulnPkgKey]bool)
 
+	// Links inserted by this run, diffed against the existing ones by the
+	// upsert. When the table starts empty (first run or OSV reset) every link
+	// is new, so the run only sets the baseline for exposure notifications.
+	var newLinks []models.PackageVulnerabilityLink
+	var hasLinks bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM package_vulnerabilities)`).Scan(&hasLinks); err != nil {
+		logger.WarnContext(ctx, "Vulnerabilities: could not check existing links", "error", err)
+	}
+
 	chunkSize := 500
 	for i := 0; i < len(packages); i += chunkSize {
 		end := i + chunkSize
@@ -122,7 +159,7 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 			end = len(packages)
 		}
 
-		logger.Info(fmt.Sprintf("Vulnerabilities: fetching %d to %d of %d...", i+1, end, len(packages)))
+		logger.InfoContext(ctx, "Vulnerabilities: fetching package batch...", "from", i+1, "to", end, "total", len(packages))
 
 		chunk := packages[i:end]
 		osvQueries := make([]util.OSVQuery, 0, len(chunk))
@@ -138,16 +175,21 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 			})
 		}
 
-		resp, err := util.FetchOSVVulnerabilitiesBatch(osvQueries)
+		resp, err := util.FetchOSVVulnerabilitiesBatch(ctx, osvQueries)
 		if err != nil {
-			logger.Error("Vulnerabilities fetch error: " + err.Error())
+			logger.ErrorContext(ctx, "Vulnerabilities fetch error", "error", err)
+			run.recordError(err)
+			run.setProgress(end)
 			continue
 		}
+		run.addPackagesChecked(len(chunk))
+		metrics.AddOSVPackagesChecked(len(chunk))
 
 		// Collect unique vulnerability IDs that need detail fetching
 		var idsToFetch []string
 		for _, result := range resp.Results {
 			for _, batchVuln := range result.Vulns {
+				foundVulns[batchVuln.ID] = true
 				fetchedMu.Lock()
 				_, found := fetchedVulns[batchVuln.ID]
 				fetchedMu.Unlock()
@@ -169,7 +211,7 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 
 		// Fetch vulnerability details concurrently with a worker pool
 		if len(uniqueIDs) > 0 {
-			logger.Info(fmt.Sprintf("Vulnerabilities: fetching details for %d unique CVEs...", len(uniqueIDs)))
+			logger.InfoContext(ctx, "Vulnerabilities: fetching details for unique CVEs...", "vulnerabilities", len(uniqueIDs))
 			const workers = 10
 			idChan := make(chan string, len(uniqueIDs))
 			var wg sync.WaitGroup
@@ -184,7 +226,7 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 				go func() {
 					defer wg.Done()
 					for id := range idChan {
-						fetched, err := util.FetchOSVVulnerabilityDetails(id)
+						fetched, err := util.FetchOSVVulnerabilityDetails(ctx, id)
 						fetchedMu.Lock()
 						if err == nil && fetched != nil {
 							fetchedVulns[id] = fetched
@@ -214,6 +256,11 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 					// Use structured severity extraction
 					severity, cvssScore := vuln.ExtractSeverityAndScore()
 
+					var exploitability *float64
+					if e := vuln.ExtractExploitability(); e > 0 {
+						exploitability = &e
+					}
+
 					var modifiedAt, publishedAt *time.Time
 					if !vuln.ModifiedAt.IsZero() {
 						modifiedAt = &vuln.ModifiedAt
@@ -223,13 +270,14 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 					}
 
 					vulnBatch[vuln.ID] = vulnRecord{
-						ID:          vuln.ID,
-						Summary:     vuln.Summary,
-						Details:     vuln.Details,
-						Severity:    severity,
-						CVSSScore:   cvssScore,
-						ModifiedAt:  modifiedAt,
-						PublishedAt: publishedAt,
+						ID:             vuln.ID,
+						Summary:        vuln.Summary,
+						Details:        vuln.Details,
+						Severity:       severity,
+						CVSSScore:      cvssScore,
+						Exploitability: exploitability,
+						ModifiedAt:     modifiedAt,
+						PublishedAt:    publishedAt,
 					}
 
 					if targetPkg.Ecosystem != "" {
@@ -253,27 +301,46 @@ func UpdateVulnerabilitiesJob(db *sql.DB) {
 
 		// Batch upsert vulnerabilities (multi-row INSERT ... ON CONFLICT)
 		if len(vulnBatch) > 0 {
-			batchUpsertVulnerabilities(db, vulnBatch)
+			run.recordError(batchUpsertVulnerabilities(ctx, db, vulnBatch))
 		}
 
 		// Batch upsert package_vulnerabilities
 		if len(pvBatch) > 0 {
-			batchUpsertPackageVulnerabilities(db, pvBatch)
+			inserted, err := batchUpsertPackageVulnerabilities(ctx, db, pvBatch)
+			run.recordError(err)
+			newLinks = append(newLinks, inserted...)
+			metrics.AddOSVNewPackageVulnerabilities(len(inserted))
 		}
+
+		run.setVulnerabilitiesFound(len(foundVulns))
+		metrics.SetOSVVulnerabilitiesFound(len(foundVulns))
+		run.setProgress(end)
+	}
+
+	logger.InfoContext(ctx, "Vulnerabilities downloaded. Proceeding to calculate transaction scoreboards...")
+	updateTransactionScoreboards(ctx, db, updatedPackages, run)
+	logger.InfoContext(ctx, "Vulnerabilities and transaction scoreboards updated successfully.")
+	run.finish(nil)
+
+	if hasLinks {
+		notifyNewExposures(db, newLinks)
+	} else {
+		logger.InfoContext(ctx, "Vulnerabilities: baseline run, skipping exposure notifications.")
 	}
 
-	logger.Info("Vulnerabilities downloaded. Proceeding to calculate transaction scoreboards...")
-	updateTransactionScoreboards(db, updatedPackages)
-	logger.Info("Vulnerabilities and transaction scoreboards updated successfully.")
+	riskJob(db)
+	return nil
 }
 
 // batchUpsertVulnerabilities inserts/updates vulnerabilities in batches of 200 rows.
-func batchUpsertVulnerabilities(db *sql.DB, records map[string]vulnRecord) {
+// Failed batches are logged and skipped; the last error is returned.
+func batchUpsertVulnerabilities(ctx context.Context, db *sql.DB, records map[string]vulnRecord) error {
 	var all []vulnRecord
 	for _, r := range records {
 		all = append(all, r)
 	}
 
+	var lastErr error
 	batchSize := 200
 	for i := 0; i < len(all); i += batchSize {
 		end := i + batchSize
@@ -287,32 +354,40 @@ func batchUpsertVulnerabilities(db *sql.DB, records map[string]vulnRecord) {
 		idx := 1
 
 		for _, r := range batch {
-			valueParts = append(valueParts, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)",
-				idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6))
-			args = append(args, r.ID, r.Summary, r.Details, r.Severity, r.CVSSScore, r.ModifiedAt, r.PublishedAt)
-			idx += 7
+			valueParts = append(valueParts, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6, idx+7))
+			args = append(args, r.ID, r.Summary, r.Details, r.Severity, r.CVSSScore, r.Exploitability, r.ModifiedAt, r.PublishedAt)
+			idx += 8
 		}
 
 		stmt := fmt.Sprintf(`
-			INSERT INTO vulnerabilities (id, summary, details, severity, cvss_score, modified_at, published_at)
+			INSERT INTO vulnerabilities (id, summary, details, severity, cvss_score, exploitability_score, modified_at, published_at)
 			VALUES %s
 			ON CONFLICT (id) DO UPDATE SET
 				summary = EXCLUDED.summary,
 				details = EXCLUDED.details,
 				severity = EXCLUDED.severity,
 				cvss_score = EXCLUDED.cvss_score,
+				exploitability_score = EXCLUDED.exploitability_score,
 				modified_at = EXCLUDED.modified_at
 		`, strings.Join(valueParts, ", "))
 
-		_, err := db.Exec(stmt, args...)
+		_, err := db.ExecContext(ctx, stmt, args...)
 		if err != nil {
-			logger.Error("Batch upsert vulnerabilities error: " + err.Error())
+			logger.ErrorContext(ctx, "Batch upsert vulnerabilities error", "error", err)
+			lastErr = err
 		}
 	}
+
+	return lastErr
 }
 
-// batchUpsertPackageVulnerabilities inserts package↔vulnerability links in batches.
-func batchUpsertPackageVulnerabilities(db *sql.DB, records []pvRecord) {
+// batchUpsertPackageVulnerabilities inserts package↔vulnerability links in batches
+// and returns the links that did not exist yet.
+// Failed batches are logged and skipped; the last error is returned.
+func batchUpsertPackageVulnerabilities(ctx context.Context, db *sql.DB, records []pvRecord) ([]models.PackageVulnerabilityLink, error) {
+	var lastErr error
+	var inserted []models.PackageVulnerabilityLink
 	batchSize := 200
 	for i := 0; i < len(records); i += batchSize {
 		end := i + batchSize
@@ -336,22 +411,36 @@ func batchUpsertPackageVulnerabilities(db *sql.DB, records []pvRecord) {
 			INSERT INTO package_vulnerabilities (package_name, version, release, vulnerability_id, ecosystem)
 			VALUES %s
 			ON CONFLICT DO NOTHING
+			RETURNING package_name, version, release, vulnerability_id, ecosystem
 		`, strings.Join(valueParts, ", "))
 
-		_, err := db.Exec(stmt, args...)
+		rows, err := db.QueryContext(ctx, stmt, args...)
 		if err != nil {
-			logger.Error("Batch upsert package_vulnerabilities error: " + err.Error())
+			logger.ErrorContext(ctx, "Batch upsert package_vulnerabilities error", "error", err)
+			lastErr = err
+			continue
 		}
+		for rows.Next() {
+			var l models.PackageVulnerabilityLink
+			if err := rows.Scan(&l.PackageName, &l.Version, &l.Release, &l.VulnerabilityID, &l.Ecosystem); err != nil {
+				lastErr = err
+				continue
+			}
+			inserted = append(inserted, l)
+		}
+		rows.Close()
 	}
+
+	return inserted, lastErr
 }
 
-func updateTransactionScoreboards(db *sql.DB, updatedPackages map[vulnPkgKey]bool) {
+func updateTransactionScoreboards(ctx context.Context, db *sql.DB, updatedPackages map[vulnPkgKey]bool, run *jobRunTracker) {
 	if len(updatedPackages) == 0 {
-		logger.Info("Vulnerabilities: No packages were updated, skipping scoreboard recalculation.")
+		logger.InfoContext(ctx, "Vulnerabilities: No packages were updated, skipping scoreboard recalculation.")
 		return
 	}
 
-	logger.Info(fmt.Sprintf("Vulnerabilities: %d packages had vulnerability updates. Fetching affected transactions...", len(updatedPackages)))
+	logger.InfoContext(ctx, "Vulnerabilities: packages had vulnerability updates. Fetching affected transactions...", "packages", len(updatedPackages))
 
 	// Build arrays of package names/versions/releases that were updated
 	var pkgNames, pkgVersions, pkgReleases []string
@@ -362,7 +451,7 @@ func updateTransactionScoreboards(db *sql.DB, updatedPackages map[vulnPkgKey]boo
 	}
 
 	// Find only transactions that contain items matching the updated packages
-	rows, err := db.Query(`
+	rows, err := db.QueryContext(ctx, `
 		SELECT DISTINCT ti.transaction_id, ti.machine_id
 		FROM transaction_items ti
 		WHERE EXISTS (
@@ -371,9 +460,9 @@ func updateTransactionScoreboards(db *sql.DB, updatedPackages map[vulnPkgKey]boo
 		)
 	`, pq.Array(pkgNames), pq.Array(pkgVersions), pq.Array(pkgReleases))
 	if err != nil {
-		logger.Error("Failed to fetch affected transactions: " + err.Error())
+		logger.ErrorContext(ctx, "Failed to fetch affected transactions", "error", err)
 		// Fallback to processing all transactions
-		updateAllTransactionScoreboards(db)
+		updateAllTransactionScoreboards(ctx, db, run)
 		return
 	}
 
@@ -387,24 +476,25 @@ func updateTransactionScoreboards(db *sql.DB, updatedPackages map[vulnPkgKey]boo
 	rows.Close()
 
 	total := len(keys)
-	logger.Info(fmt.Sprintf("Vulnerabilities: %d affected transactions to process (incremental).", total))
+	logger.InfoContext(ctx, "Vulnerabilities: affected transactions to process (incremental).", "transactions", total)
 
 	if total == 0 {
 		return
 	}
 
-	processScoreboardBatch(db, keys)
+	processScoreboardBatch(ctx, db, keys, run)
 }
 
 // updateAllTransactionScoreboards is the fallback that processes all transactions.
-func updateAllTransactionScoreboards(db *sql.DB) {
-	logger.Info("Vulnerabilities: Fallback - fetching ALL transactions for scoreboard calculation...")
+func updateAllTransactionScoreboards(ctx context.Context, db *sql.DB, run *jobRunTracker) {
+	logger.InfoContext(ctx, "Vulnerabilities: Fallback - fetching ALL transactions for scoreboard calculation...")
 
 	var keys []vulnTxKey
 
-	rows, err := db.Query("SELECT DISTINCT transaction_id, machine_id FROM transactions")
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT transaction_id, machine_id FROM transactions")
 	if err != nil {
-		logger.Error("Failed to fetch transactions list: " + err.Error())
+		logger.ErrorContext(ctx, "Failed to fetch transactions list", "error", err)
+		run.recordError(err)
 		return
 	}
 	for rows.Next() {
@@ -416,13 +506,14 @@ func updateAllTransactionScoreboards(db *sql.DB) {
 	rows.Close()
 
 	total := len(keys)
-	logger.Info(fmt.Sprintf("Vulnerabilities: Total of %d transactions to process.", total))
+	logger.InfoContext(ctx, "Vulnerabilities: transactions to process.", "transactions", total)
 
-	processScoreboardBatch(db, keys)
+	processScoreboardBatch(ctx, db, keys, run)
 }
 
-func processScoreboardBatch(db *sql.DB, keys []vulnTxKey) {
+func processScoreboardBatch(ctx context.Context, db *sql.DB, keys []vulnTxKey, run *jobRunTracker) {
 	total := len(keys)
+	run.setPhase(vulnPhaseScoring, total)
 	chunkSize := 500
 	for i := 0; i < total; i += chunkSize {
 		end := i + chunkSize
@@ -430,8 +521,7 @@ func processScoreboardBatch(db *sql.DB, keys []vulnTxKey) {
 			end = total
 		}
 
-		pct := float64(i) / float64(total) * 100
-		logger.Info(fmt.Sprintf("Vulnerabilities: Processing batch %d to %d of %d (%.1f%%)...", i+1, end, total, pct))
+		logger.InfoContext(ctx, "Vulnerabilities: processing transaction batch...", "from", i+1, "to", end, "total", total)
 
 		chunk := keys[i:end]
 		txnIDs := make([]string, 0, len(chunk))
@@ -534,9 +624,11 @@ WHERE t.transaction_id = s.transaction_id
   AND t.machine_id = s.machine_id;
 		`
 
-		_, err := db.Exec(stmt, pq.Array(txnIDs), pq.Array(mchnIDs))
+		_, err := db.ExecContext(ctx, stmt, pq.Array(txnIDs), pq.Array(mchnIDs))
 		if err != nil {
-			logger.Error("Failed to update transaction scoreboards for batch: " + err.Error())
+			logger.ErrorContext(ctx, "Failed to update transaction scoreboards for batch", "error", err)
+			run.recordError(err)
 		}
+		run.setProgress(end)
 	}
 }
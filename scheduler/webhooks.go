@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+	"github.com/txlog/server/notification"
+)
+
+// webhookBatchSize caps how many deliveries one tick sends, so a backlog
+// after an outage drains over several ticks instead of one long run.
+const webhookBatchSize = 200
+
+// webhookDeliveryJob sends the webhook deliveries that are due. Events are
+// queued in webhook_deliveries by the request that produced them; this job
+// signs and POSTs each one, and failed attempts are rescheduled with
+// exponential backoff until models.MaxWebhookAttempts is reached.
+func webhookDeliveryJob(db *sql.DB) error {
+	lockName := "webhooks"
+
+	locked, err := acquireLock(db, lockName)
+	if err != nil {
+		logger.Error("Error acquiring lock for webhook deliveries", "error", err)
+		return err
+	}
+
+	if !locked {
+		return errJobLocked
+	}
+
+	defer releaseLock(db, lockName)
+
+	wm := models.NewWebhookManager(db)
+
+	deliveries, err := wm.DueDeliveries(webhookBatchSize)
+	if err != nil {
+		// Tables might not exist yet (migration not applied)
+		logger.Debug("Webhooks: could not load due deliveries", "error", err)
+		return err
+	}
+
+	sent, failed := 0, 0
+	for _, d := range deliveries {
+		ctx, cancel := context.WithTimeout(context.Background(), notification.WebhookTimeout)
+		code, err := notification.DeliverWebhook(ctx, d)
+		cancel()
+
+		if err != nil {
+			failed++
+			logger.Warn("Webhooks: delivery failed", "delivery_id", d.ID, "event", d.Event, "subscription", d.SubscriptionName, "error", err)
+			if err := wm.MarkAttemptFailed(d, code, err); err != nil {
+				logger.Error("Webhooks: could not record delivery status", "delivery_id", d.ID, "error", err)
+			}
+			continue
+		}
+
+		sent++
+		if err := wm.MarkDelivered(d.ID, code); err != nil {
+			logger.Error("Webhooks: could not record delivery status", "delivery_id", d.ID, "error", err)
+		}
+	}
+
+	if sent > 0 || failed > 0 {
+		logger.Info("Webhooks: run finished.", "delivered", sent, "failed", failed)
+	}
+	return nil
+}
@@ -39,7 +39,7 @@ func CountExecutions() {
 	      `).Scan(&thisMonth, &previousMonth)
 
 	if err != nil {
-		logger.Error("Error querying statistics: " + err.Error())
+		logger.Error("Error querying statistics", "error", err)
 		return
 	}
 
@@ -56,7 +56,7 @@ func CountExecutions() {
 		"executions-30-days", thisMonth, percentage)
 
 	if err != nil {
-		logger.Error("Error inserting statistics: " + err.Error())
+		logger.Error("Error inserting statistics", "error", err)
 		return
 	}
 }
@@ -101,7 +101,7 @@ func CountInstalledPackages() {
       `).Scan(&thisMonth, &previousMonth)
 
 	if err != nil {
-		logger.Error("Error querying statistics: " + err.Error())
+		logger.Error("Error querying statistics", "error", err)
 		return
 	}
 
@@ -118,7 +118,7 @@ func CountInstalledPackages() {
 		"installed-packages-30-days", thisMonth, percentage)
 
 	if err != nil {
-		logger.Error("Error inserting statistics: " + err.Error())
+		logger.Error("Error inserting statistics", "error", err)
 		return
 	}
 }
@@ -159,7 +159,7 @@ func CountUpgradedPackages() {
       `).Scan(&thisMonth, &previousMonth)
 
 	if err != nil {
-		logger.Error("Error querying statistics: " + err.Error())
+		logger.Error("Error querying statistics", "error", err)
 		return
 	}
 
@@ -176,7 +176,7 @@ func CountUpgradedPackages() {
 		"upgraded-packages-30-days", thisMonth, percentage)
 
 	if err != nil {
-		logger.Error("Error inserting statistics: " + err.Error())
+		logger.Error("Error inserting statistics", "error", err)
 		return
 	}
 }
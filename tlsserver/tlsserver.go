@@ -0,0 +1,227 @@
+// Package tlsserver serves the server over HTTPS when TLS_CERT_FILE and
+// TLS_KEY_FILE are set, and verifies agent client certificates against
+// TLS_CLIENT_CA_FILE. Certificates are reloaded when their files change, or
+// on SIGHUP, without a restart.
+package tlsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	logger "github.com/txlog/server/logger"
+	"github.com/txlog/server/models"
+)
+
+// ReloadInterval is how often the certificate files are checked for
+// changes.
+const ReloadInterval = 30 * time.Second
+
+// Config holds the certificate files of the HTTPS server.
+type Config struct {
+	CertFile     string // server certificate chain (PEM)
+	KeyFile      string // server private key (PEM)
+	ClientCAFile string // CAs that sign agent certificates (PEM); empty disables mTLS
+}
+
+// ConfigFromEnv reads TLS_CERT_FILE, TLS_KEY_FILE and TLS_CLIENT_CA_FILE.
+func ConfigFromEnv() Config {
+	return Config{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+}
+
+// Enabled reports whether HTTPS is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// ClientIdentityField returns the request field that the names of a client
+// certificate are compared to, from TLS_CLIENT_IDENTITY: hostname, the
+// default, or machine_id.
+func ClientIdentityField() (string, error) {
+	switch field := strings.ToLower(strings.TrimSpace(os.Getenv("TLS_CLIENT_IDENTITY"))); field {
+	case "", models.CertificateIdentityHostname:
+		return models.CertificateIdentityHostname, nil
+	case models.CertificateIdentityMachineID:
+		return field, nil
+	default:
+		return models.CertificateIdentityHostname, errors.New("TLS_CLIENT_IDENTITY must be hostname or machine_id")
+	}
+}
+
+// ClientIdentity returns the agent identified by the verified client
+// certificate of a connection, or nil when the client sent none. The names
+// are the DNS SANs of the certificate and its subject common name.
+func ClientIdentity(state *tls.ConnectionState, field string) *models.CertificateIdentity {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := state.VerifiedChains[0][0]
+
+	identity := &models.CertificateIdentity{Field: field}
+	identity.Names = append(identity.Names, leaf.DNSNames...)
+	if leaf.Subject.CommonName != "" {
+		identity.Names = append(identity.Names, leaf.Subject.CommonName)
+	}
+	return identity
+}
+
+// Reloader holds the current certificates and replaces them when their
+// files change.
+type Reloader struct {
+	config Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader loads the certificates of config.
+func NewReloader(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must both be set")
+	}
+	r := &Reloader{config: config}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate files again. On error the certificates in
+// use are kept.
+func (r *Reloader) Reload() error {
+	modTimes := r.currentModTimes()
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+// Changed reports whether a certificate file was modified since the last
+// successful Reload.
+func (r *Reloader) Changed() bool {
+	modTimes := r.currentModTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the certificates when their files change, checking every
+// interval, and on SIGHUP, until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.Changed() {
+				continue
+			}
+		case <-hup:
+		}
+
+		if err := r.Reload(); err != nil {
+			logger.Error("Failed to reload TLS certificates, keeping the current ones", "error", err)
+			continue
+		}
+		logger.Info("TLS certificates reloaded")
+	}
+}
+
+// TLSConfig returns a server configuration that always uses the current
+// certificates. Client certificates are requested when a client CA is
+// configured, but not required, so browsers and API key clients still
+// connect.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*r.cert}
+		if r.clientCAs != nil {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+			config.ClientCAs = r.clientCAs
+		}
+		return config, nil
+	}
+	return base
+}
+
+// ListenAndServe serves handler over HTTPS on addr with the certificates of
+// r.
+func ListenAndServe(addr string, handler http.Handler, r *Reloader) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         r.TLSConfig(),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// currentModTimes returns the modification time of each certificate file;
+// files that cannot be read are left out.
+func (r *Reloader) currentModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
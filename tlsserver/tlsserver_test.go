@@ -0,0 +1,232 @@
+package tlsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/txlog/server/models"
+)
+
+// testCert is a certificate and key signed by parent, or self-signed when
+// parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, dnsNames []string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (tc *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.der}, PrivateKey: tc.key}
+}
+
+func TestNewReloader_MissingFiles(t *testing.T) {
+	if _, err := NewReloader(Config{CertFile: "server.crt"}); err == nil {
+		t.Error("expected an error without TLS_KEY_FILE")
+	}
+	dir := t.TempDir()
+	if _, err := NewReloader(Config{CertFile: filepath.Join(dir, "a.crt"), KeyFile: filepath.Join(dir, "a.key")}); err == nil {
+		t.Error("expected an error for files that do not exist")
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil, nil)
+	certFile, keyFile := newTestCert(t, "old.example.com", nil, ca).write(t, dir, "server")
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	if r.Changed() {
+		t.Error("Changed() should be false right after loading")
+	}
+
+	newTestCert(t, "new.example.com", nil, ca).write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !r.Changed() {
+		t.Fatal("Changed() should be true after the files were replaced")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if name := r.cert.Leaf.Subject.CommonName; name != "new.example.com" {
+		t.Errorf("certificate = %q, want new.example.com", name)
+	}
+
+	// A broken file keeps the certificate in use
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+	if name := r.cert.Leaf.Subject.CommonName; name != "new.example.com" {
+		t.Errorf("certificate after failed reload = %q, want new.example.com", name)
+	}
+}
+
+func TestReloader_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Agents CA", nil, nil)
+	certFile, keyFile := newTestCert(t, "txlog.example.com", []string{"txlog.example.com"}, ca).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if identity := ClientIdentity(req.TLS, models.CertificateIdentityHostname); identity != nil {
+			io.WriteString(w, identity.Name())
+		}
+	}))
+	server.TLS = r.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCert *testCert) (string, error) {
+		config := &tls.Config{RootCAs: roots, ServerName: "txlog.example.com"}
+		if clientCert != nil {
+			// Sent even when not signed by a CA the server asks for
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				cert := clientCert.tlsCertificate()
+				return &cert, nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if got, err := get(newTestCert(t, "web01", []string{"web01.example.com"}, ca)); err != nil || got != "web01.example.com" {
+		t.Errorf("signed client certificate: got %q, %v; want web01.example.com", got, err)
+	}
+	if got, err := get(nil); err != nil || got != "" {
+		t.Errorf("no client certificate: got %q, %v; want an anonymous connection", got, err)
+	}
+	if _, err := get(newTestCert(t, "rogue", nil, newTestCert(t, "Other CA", nil, nil))); err == nil {
+		t.Error("client certificate from another CA should be rejected")
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	if ClientIdentity(nil, models.CertificateIdentityHostname) != nil {
+		t.Error("plain HTTP should have no identity")
+	}
+	if ClientIdentity(&tls.ConnectionState{}, models.CertificateIdentityHostname) != nil {
+		t.Error("connection without a verified certificate should have no identity")
+	}
+
+	ca := newTestCert(t, "Agents CA", nil, nil)
+	leaf := newTestCert(t, "4b8f0c2a", []string{"web01", "web01.example.com"}, ca)
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf.cert, ca.cert}}}
+
+	identity := ClientIdentity(state, models.CertificateIdentityMachineID)
+	if want := []string{"web01", "web01.example.com", "4b8f0c2a"}; !slices.Equal(identity.Names, want) {
+		t.Errorf("Names = %v, want %v", identity.Names, want)
+	}
+	if identity.Field != models.CertificateIdentityMachineID {
+		t.Errorf("Field = %q, want machine_id", identity.Field)
+	}
+}
+
+func TestClientIdentityField(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "hostname", false},
+		{"Machine_ID", "machine_id", false},
+		{"serial", "hostname", true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TLS_CLIENT_IDENTITY", tt.value)
+		got, err := ClientIdentityField()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ClientIdentityField() with %q = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"github.com/gin-gonic/gin"
+	"github.com/txlog/server/version"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName is reported when OTEL_SERVICE_NAME is not set.
+const serviceName = "txlog-server"
+
+// instrumentationName names the tracer used for the server's own spans.
+const instrumentationName = "github.com/txlog/server"
+
+// enabled is set by Init once the exporter is configured. It is read by the
+// helpers below, which fall back to the uninstrumented code path when
+// tracing is off so that the default setup pays nothing for it.
+var enabled bool
+
+// Configured reports whether tracing is requested by the environment: an
+// OTLP endpoint is set through OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, and OTEL_SDK_DISABLED is not true.
+func Configured() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Enabled reports whether Init has turned tracing on.
+func Enabled() bool {
+	return enabled
+}
+
+// Init sets up the global tracer provider with an OTLP/HTTP exporter
+// configured by the standard OTEL_EXPORTER_OTLP_* variables, and W3C trace
+// context propagation. It does nothing and returns a no-op shutdown function
+// when tracing is not Configured. The returned function flushes the spans
+// still buffered and must be called before the process exits.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if !Configured() {
+		return noop, nil
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/protobuf" {
+		return noop, errors.New("unsupported OTLP protocol " + protocol + ", only http/protobuf is available")
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, err
+	}
+
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES are
+	// detected last, so they override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version.SemVer),
+		),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return noop, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for every request, named after the route
+// pattern. Health checks, metrics scrapes and static files are not traced.
+func Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		path := r.URL.Path
+		return !strings.HasPrefix(path, "/health") &&
+			!strings.HasPrefix(path, "/images/") &&
+			!strings.HasPrefix(path, "/css/") &&
+			path != "/metrics"
+	}))
+}
+
+// OpenDB opens a database like sql.Open. When tracing is enabled, every
+// query, statement and transaction gets a client span, nested under the
+// span of the context it runs with; queries run without a context start
+// their own trace.
+func OpenDB(driverName, dataSourceName string) (*sql.DB, error) {
+	if !enabled {
+		return sql.Open(driverName, dataSourceName)
+	}
+	return otelsql.Open(driverName, dataSourceName,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+}
+
+// Transport wraps base so outbound requests get a client span and carry
+// the trace context. It returns base unchanged when tracing is disabled.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if !enabled {
+		return base
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// StartSpan starts an internal span for work that is not an HTTP request or
+// a query, such as a scheduler job. End it with EndSpan.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err on span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is a stand-in for an OpenTelemetry collector's OTLP/HTTP
+// receiver that records the names of the spans it is sent.
+type collector struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (col *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var req collectorpb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	col.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				col.spans = append(col.spans, s.Name)
+			}
+		}
+	}
+	col.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	resp, _ := proto.Marshal(&collectorpb.ExportTraceServiceResponse{})
+	w.Write(resp)
+}
+
+func TestConfigured(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		traces   string
+		disabled string
+		want     bool
+	}{
+		{"nothing set", "", "", "", false},
+		{"endpoint", "http://collector:4318", "", "", true},
+		{"traces endpoint", "", "http://collector:4318/v1/traces", "", true},
+		{"sdk disabled", "http://collector:4318", "", "true", false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.traces)
+		t.Setenv("OTEL_SDK_DISABLED", tt.disabled)
+		if got := Configured(); got != tt.want {
+			t.Errorf("%s: Configured() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInitDisabledByDefault(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	shutdown, err := Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() {
+		t.Error("tracing should be disabled without an OTLP endpoint")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if base := http.DefaultTransport; Transport(base) != base {
+		t.Error("Transport should return the base transport when tracing is disabled")
+	}
+}
+
+func TestInitRejectsGRPC(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4317")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+
+	if _, err := Init(context.Background()); err == nil {
+		t.Error("expected an error for the grpc protocol")
+	}
+	if Enabled() {
+		t.Error("tracing should stay disabled when the exporter cannot be set up")
+	}
+}
+
+func TestExportToCollector(t *testing.T) {
+	col := &collector{}
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") == "" {
+			t.Error("outbound request does not carry the trace context")
+		}
+	}))
+	defer upstream.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "")
+	shutdown, err := Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		enabled = false
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	}()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/assets/:machine_id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/assets/abc", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	ctx, span := StartSpan(context.Background(), "scheduler vulnerabilities")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	if resp, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	} else {
+		resp.Body.Close()
+	}
+	EndSpan(span, errors.New("partial failure"))
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	for _, want := range []string{"GET /assets/:machine_id", "scheduler vulnerabilities", "HTTP GET"} {
+		if !slices.Contains(col.spans, want) {
+			t.Errorf("collector did not receive span %q; got %v", want, col.spans)
+		}
+	}
+	if slices.Contains(col.spans, "GET /health") {
+		t.Error("health checks should not be traced")
+	}
+}
@@ -8,9 +8,26 @@ import (
 	"fmt"
 )
 
+// Prefixes of the secrets issued by the server. All of them start with
+// txlog_, the prefix checked by the API key middleware for agent secrets.
+const (
+	APIKeyPrefix            = "txlog_"
+	EnrollmentTokenPrefix   = "txlog_et_"
+	MachineCredentialPrefix = "txlog_mc_"
+	PasswordResetPrefix     = "txlog_pr_"
+	PersonalTokenPrefix     = "txlog_pat_"
+)
+
 // GenerateAPIKey generates a cryptographically secure API key with the format: txlog_{random_string}
 // Returns the full key and its SHA-256 hash
 func GenerateAPIKey() (key string, hash string, prefix string, error error) {
+	return GenerateToken(APIKeyPrefix)
+}
+
+// GenerateToken generates a cryptographically secure secret with the format:
+// {prefix}{random_string}. Returns the full secret, its SHA-256 hash and the
+// start of the secret for display.
+func GenerateToken(tokenPrefix string) (token string, hash string, prefix string, error error) {
 	// Generate 32 random bytes
 	randomBytes := make([]byte, 32)
 	_, err := rand.Read(randomBytes)
@@ -21,17 +38,17 @@ func GenerateAPIKey() (key string, hash string, prefix string, error error) {
 	// Encode to base64url (URL-safe, no padding)
 	randomString := base64.RawURLEncoding.EncodeToString(randomBytes)
 
-	// Create the full key with prefix
-	fullKey := "txlog_" + randomString
+	// Create the full secret with prefix
+	fullToken := tokenPrefix + randomString
 
 	// Generate SHA-256 hash
-	hashBytes := sha256.Sum256([]byte(fullKey))
-	keyHash := hex.EncodeToString(hashBytes[:])
+	hashBytes := sha256.Sum256([]byte(fullToken))
+	tokenHash := hex.EncodeToString(hashBytes[:])
 
 	// Get prefix for display (first 13 characters to fit in varchar(16) with "...")
-	keyPrefix := fullKey[:min(len(fullKey), 13)] + "..."
+	displayPrefix := fullToken[:min(len(fullToken), 13)] + "..."
 
-	return fullKey, keyHash, keyPrefix, nil
+	return fullToken, tokenHash, displayPrefix, nil
 }
 
 // HashAPIKey hashes an API key using SHA-256
@@ -39,3 +56,13 @@ func HashAPIKey(key string) string {
 	hash := sha256.Sum256([]byte(key))
 	return hex.EncodeToString(hash[:])
 }
+
+// GenerateWebhookSecret generates a random secret used to sign webhook
+// payloads, with the format: whsec_{random_string}
+func GenerateWebhookSecret() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
@@ -2,13 +2,18 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"math"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/txlog/server/metrics"
+	"github.com/txlog/server/tracing"
 )
 
 type OSVQueryBatch struct {
@@ -138,6 +143,58 @@ func (v *OSVVuln) ExtractSeverityAndScore() (severity string, cvssScore float64)
 	return severity, cvssScore
 }
 
+// ExtractExploitability returns the highest CVSS 3.x exploitability sub-score
+// (0.1-3.9) found in the severity[] vectors, or 0 when the advisory carries no
+// usable CVSS vector.
+func (v *OSVVuln) ExtractExploitability() float64 {
+	var best float64
+	for _, s := range v.Severity {
+		if strings.HasPrefix(s.Score, "CVSS:3") {
+			if e := parseCVSSExploitability(s.Score); e > best {
+				best = e
+			}
+		}
+	}
+	return best
+}
+
+// parseCVSSExploitability computes the exploitability sub-score of a CVSS 3.x
+// vector (8.22 x AV x AC x PR x UI), rounded to one decimal. PR weights are
+// adjusted for changed scope as in the specification. Returns 0 when one of
+// the four metrics is missing.
+func parseCVSSExploitability(vector string) float64 {
+	parts := strings.Split(vector, "/")
+	if len(parts) < 2 {
+		return 0
+	}
+
+	metrics := make(map[string]string)
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, ":", 2)
+		if len(kv) == 2 {
+			metrics[kv[0]] = kv[1]
+		}
+	}
+
+	av := map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.20}
+	ac := map[string]float64{"L": 0.77, "H": 0.44}
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if metrics["S"] == "C" {
+		pr = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.50}
+	}
+	ui := map[string]float64{"N": 0.85, "R": 0.62}
+
+	avVal, okAV := av[metrics["AV"]]
+	acVal, okAC := ac[metrics["AC"]]
+	prVal, okPR := pr[metrics["PR"]]
+	uiVal, okUI := ui[metrics["UI"]]
+	if !okAV || !okAC || !okPR || !okUI {
+		return 0
+	}
+
+	return math.Round(8.22*avVal*acVal*prVal*uiVal*10) / 10
+}
+
 // parseCVSSScore extracts the base score from a CVSS 3.x vector string.
 // It computes a rough estimate based on the vector components.
 // For a more accurate score, a dedicated CVSS library should be used.
@@ -223,7 +280,7 @@ func ParseCVSSScoreFromString(s string) float64 {
 	return v
 }
 
-func FetchOSVVulnerabilitiesBatch(queries []OSVQuery) (*OSVBatchResponse, error) {
+func FetchOSVVulnerabilitiesBatch(ctx context.Context, queries []OSVQuery) (*OSVBatchResponse, error) {
 	if len(queries) == 0 {
 		return &OSVBatchResponse{}, nil
 	}
@@ -234,21 +291,23 @@ func FetchOSVVulnerabilitiesBatch(queries []OSVQuery) (*OSVBatchResponse, error)
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.osv.dev/v1/querybatch", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.osv.dev/v1/querybatch", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 120 * time.Second}
+	client := &http.Client{Timeout: 120 * time.Second, Transport: tracing.Transport(http.DefaultTransport)}
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveOSVRequest("querybatch", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var batchResp OSVBatchResponse
 	err = json.NewDecoder(resp.Body).Decode(&batchResp)
+	metrics.ObserveOSVRequest("querybatch", err)
 	if err != nil {
 		return nil, err
 	}
@@ -256,29 +315,55 @@ func FetchOSVVulnerabilitiesBatch(queries []OSVQuery) (*OSVBatchResponse, error)
 	return &batchResp, nil
 }
 
-func FetchOSVVulnerabilityDetails(id string) (*OSVVuln, error) {
+func FetchOSVVulnerabilityDetails(ctx context.Context, id string) (*OSVVuln, error) {
 	url := "https://api.osv.dev/v1/vulns/" + id
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(http.DefaultTransport)}
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveOSVRequest("vulns", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.ObserveOSVRequest("vulns", fmt.Errorf("unexpected status %d", resp.StatusCode))
 		return nil, nil // Might be unfound or error
 	}
 
 	var vuln OSVVuln
 	err = json.NewDecoder(resp.Body).Decode(&vuln)
+	metrics.ObserveOSVRequest("vulns", err)
 	if err != nil {
 		return nil, err
 	}
 
 	return &vuln, nil
 }
+
+// severityRanks orders the severity labels produced by ExtractSeverityAndScore.
+var severityRanks = map[string]int{
+	"UNKNOWN":  0,
+	"LOW":      1,
+	"MEDIUM":   2,
+	"HIGH":     3,
+	"CRITICAL": 4,
+}
+
+// SeverityRank returns the position of a severity label from UNKNOWN (0) to
+// CRITICAL (4). Labels are case-insensitive; unrecognized ones rank as
+// UNKNOWN.
+func SeverityRank(severity string) int {
+	return severityRanks[strings.ToUpper(strings.TrimSpace(severity))]
+}
+
+// IsValidSeverity reports whether severity is one of UNKNOWN, LOW, MEDIUM,
+// HIGH or CRITICAL (case-insensitive).
+func IsValidSeverity(severity string) bool {
+	_, ok := severityRanks[strings.ToUpper(strings.TrimSpace(severity))]
+	return ok
+}
@@ -108,3 +108,58 @@ func TestFetchOSVVulnerabilitiesBatch(t *testing.T) {
 
 	_ = originalURL
 }
+
+func TestExtractExploitability(t *testing.T) {
+	tests := []struct {
+		name     string
+		vectors  []string
+		expected float64
+	}{
+		{"no vectors", nil, 0},
+		{"network, no privileges", []string{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}, 3.9},
+		{"local, user interaction", []string{"CVSS:3.1/AV:L/AC:L/PR:L/UI:R/S:U/C:H/I:N/A:N"}, 1.3},
+		{"changed scope adjusts PR", []string{"CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:C/C:L/I:L/A:N"}, 3.1},
+		{"highest vector wins", []string{"CVSS:3.1/AV:P/AC:H/PR:H/UI:R/S:U/C:H/I:H/A:H", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}, 3.9},
+		{"missing metric", []string{"CVSS:3.1/AV:N/AC:L/S:U/C:H/I:H/A:H"}, 0},
+		{"CVSS v2 ignored", []string{"AV:N/AC:L/Au:N/C:P/I:P/A:P"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := OSVVuln{}
+			for _, vec := range tt.vectors {
+				v.Severity = append(v.Severity, OSVSeverity{Type: "CVSS_V3", Score: vec})
+			}
+			if got := v.ExtractExploitability(); got != tt.expected {
+				t.Errorf("ExtractExploitability() = %.1f, want %.1f", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSeverityRank(t *testing.T) {
+	tests := []struct {
+		severity string
+		expected int
+	}{
+		{"CRITICAL", 4},
+		{"high", 3},
+		{" Medium ", 2},
+		{"LOW", 1},
+		{"UNKNOWN", 0},
+		{"", 0},
+		{"IMPORTANT", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			if got := SeverityRank(tt.severity); got != tt.expected {
+				t.Errorf("SeverityRank(%q) = %d, want %d", tt.severity, got, tt.expected)
+			}
+		})
+	}
+
+	if IsValidSeverity("IMPORTANT") || !IsValidSeverity("critical") {
+		t.Error("IsValidSeverity() does not match the known labels")
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"html/template"
 	"strconv"
 	"strings"
@@ -415,6 +416,35 @@ func FormatDate(t time.Time) string {
 	return t.Format("02/01/2006")
 }
 
+// FormatDuration formats a duration in the largest whole unit that fits it,
+// such as "7 days", "12 hours" or "30 minutes".
+//
+// Parameters:
+//   - d: A time.Duration
+//
+// Returns:
+//   - string: The formatted duration, or Go's notation when it is not a
+//     whole number of minutes
+func FormatDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		size time.Duration
+		name string
+	}{
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+	} {
+		if d >= unit.size && d%unit.size == 0 {
+			n := int64(d / unit.size)
+			if n == 1 {
+				return "1 " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return d.String()
+}
+
 // TimeStatusClass returns Tailwind CSS classes for a status dot based on how old a timestamp is.
 // Used to show status indicators for asset last_seen times.
 //
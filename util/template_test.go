@@ -679,3 +679,25 @@ func TestTimeStatusClass(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{7 * 24 * time.Hour, "7 days"},
+		{24 * time.Hour, "1 day"},
+		{36 * time.Hour, "36 hours"},
+		{time.Hour, "1 hour"},
+		{90 * time.Minute, "90 minutes"},
+		{90 * time.Second, "1m30s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := FormatDuration(tt.input); got != tt.expected {
+				t.Errorf("FormatDuration(%v) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}